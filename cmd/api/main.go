@@ -32,7 +32,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := database.RunMigrations(&user.User{}, &auth.UserAuthProvider{}, &auth.RefreshToken{}, &account.Account{}, &account.AccountMember{}, &invoice.Invoice{}); err != nil {
+	if err := database.RunMigrations(&user.User{}, &auth.UserAuthProvider{}, &auth.RefreshToken{}, &auth.PasswordResetToken{}, &auth.EmailChangeToken{}, &auth.MagicLinkToken{}, &auth.EmailVerificationCode{}, &auth.OAuthState{}, &auth.TOTPCredential{}, &auth.RecoveryCode{}, &auth.MFAChallenge{}, &auth.Session{}, &auth.RevokedAccessToken{}, &auth.ThrottleState{}, &auth.DeviceAuthorization{}, &auth.OAuthAuthorizationCode{}, &auth.OAuthGrant{}, &account.Account{}, &account.AccountMember{}, &account.APIKey{}, &account.OAuthClient{}, &account.AccountInvitation{}, &invoice.Invoice{}); err != nil {
 		slog.Error("migrations", "error", err)
 		os.Exit(1)
 	}
@@ -45,7 +45,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	sql := `TRUNCATE TABLE refresh_tokens, user_auth_providers, account_members, invoices, accounts, users RESTART IDENTITY CASCADE`
+	sql := `TRUNCATE TABLE refresh_tokens, password_reset_tokens, email_change_tokens, magic_link_tokens, email_verification_codes, oauth_states, totp_credentials, recovery_codes, mfa_challenges, sessions, revoked_access_tokens, throttle_states, device_authorizations, oauth_authorization_codes, oauth_grants, user_auth_providers, account_members, api_keys, oauth_clients, account_invitations, invoices, accounts, users RESTART IDENTITY CASCADE`
 	if err := db.Exec(sql).Error; err != nil {
 		fmt.Fprintf(os.Stderr, "truncate: %v\n", err)
 		os.Exit(1)
@@ -0,0 +1,54 @@
+// Package main runs one maintenance pass (stale refresh tokens, expired verification tokens) and exits.
+// It is meant for cron jobs or scheduled tasks when the API scheduler is disabled (MAINTENANCE_INTERVAL_MINUTES=0).
+// The run takes the same Postgres advisory lock as the API, so it exits cleanly if another instance is already purging.
+// Configuration is loaded exactly like the API (AWS Secrets Manager for the database credentials).
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/cloudflax/api.cloudflax/internal/auth"
+	"github.com/cloudflax/api.cloudflax/internal/bootstrap/config"
+	"github.com/cloudflax/api.cloudflax/internal/maintenance"
+	"github.com/cloudflax/api.cloudflax/internal/shared/database"
+	"github.com/cloudflax/api.cloudflax/internal/shared/logger"
+	"github.com/cloudflax/api.cloudflax/internal/user"
+)
+
+func main() {
+	logger.Init(os.Getenv("LOG_LEVEL"))
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	if err := database.Init(cfg); err != nil {
+		slog.Error("database", "error", err)
+		os.Exit(1)
+	}
+
+	authRepository := auth.NewRepository(database.DB)
+	service := maintenance.NewService(authRepository, user.NewRepository(database.DB), maintenance.Options{
+		BatchSize: cfg.MaintenanceBatchSize,
+	})
+	service.WithOAuthStates(authRepository).WithRevokedAccessTokens(authRepository).WithThrottleStates(authRepository)
+	report, err := service.RunOnce(context.Background(), maintenance.NewAdvisoryLock(database.DB))
+	if err != nil {
+		slog.Error("maintenance failed", "error", err)
+		os.Exit(1)
+	}
+	if report.Skipped {
+		return
+	}
+	slog.Info("maintenance finished",
+		"event", "maintenance_run",
+		"refresh_tokens_deleted", report.Deleted[maintenance.TaskRefreshTokens],
+		"verification_tokens_cleared", report.Deleted[maintenance.TaskVerificationTokens],
+		"oauth_states_deleted", report.Deleted[maintenance.TaskOAuthStates],
+		"revoked_access_tokens_deleted", report.Deleted[maintenance.TaskRevokedAccessTokens],
+		"throttle_states_deleted", report.Deleted[maintenance.TaskThrottleStates],
+	)
+}
@@ -1,5 +1,7 @@
 package account
 
+import "time"
+
 // CreateAccountRequest is the request body for POST /accounts.
 type CreateAccountRequest struct {
 	Name string `json:"name" validate:"required,min=2,max=100"`
@@ -10,3 +12,50 @@ type CreateAccountRequest struct {
 type SetActiveAccountRequest struct {
 	AccountID string `json:"account_id" validate:"required"`
 }
+
+// CreateAPIKeyRequest is the request body for POST /accounts/:id/api-keys.
+// Scopes are optional; a key without scopes can do everything an account member can.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"       validate:"required,min=2,max=100"`
+	Scopes    []string   `json:"scopes"     validate:"omitempty,max=10,dive,oneof=invoices:read invoices:write"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKeyResponse is the API key returned on creation, including the raw key shown only once.
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// CreateOAuthClientRequest is the request body for POST /accounts/:id/oauth-clients.
+// Public clients (Public true) get no secret and must use PKCE, as every client does.
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name"          validate:"required,min=2,max=100"`
+	RedirectURIs []string `json:"redirect_uris" validate:"required,min=1,max=10,dive,required,max=500"`
+	Scopes       []string `json:"scopes"        validate:"required,min=1,max=5,dive,oneof=openid email profile invoices:read invoices:write"`
+	Public       bool     `json:"public"`
+}
+
+// CreateOAuthClientResponse is the OAuth client returned on creation, including the secret of a confidential client shown only once.
+type CreateOAuthClientResponse struct {
+	OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// CreateInvitationRequest is the request body for POST /accounts/:id/invitations.
+// Owners cannot be invited: ownership only comes from creating the account.
+type CreateInvitationRequest struct {
+	Email string   `json:"email" validate:"required,email,max=255"`
+	Role  RoleType `json:"role"  validate:"required,oneof=admin member"`
+}
+
+// UpdateMemberRoleRequest is the request body for PATCH /accounts/:id/members/:userID.
+// Ownership cannot be granted or taken away through this endpoint.
+type UpdateMemberRoleRequest struct {
+	Role RoleType `json:"role" validate:"required,oneof=admin member"`
+}
+
+// InvitationTokenRequest is the request body for POST /invitations/accept and POST /invitations/decline.
+type InvitationTokenRequest struct {
+	Token string `json:"token" validate:"required,max=128"`
+}
@@ -13,3 +13,36 @@ var ErrMemberNotFound = fmt.Errorf("member not found")
 
 // ErrUserEmailNotVerified is returned when the user's email has not been verified.
 var ErrUserEmailNotVerified = fmt.Errorf("user email not verified")
+
+// ErrInsufficientRole is returned when the member's role does not allow the operation.
+var ErrInsufficientRole = fmt.Errorf("insufficient account role")
+
+// ErrAPIKeyNotFound is returned when an API key does not exist, belongs to another account or is revoked.
+var ErrAPIKeyNotFound = fmt.Errorf("api key not found")
+
+// ErrAPIKeyInvalid is returned when a presented API key is unknown, revoked or expired.
+var ErrAPIKeyInvalid = fmt.Errorf("invalid api key")
+
+// ErrAPIKeyExpiryInPast is returned when an API key is created with an expiry that already passed.
+var ErrAPIKeyExpiryInPast = fmt.Errorf("api key expiry must be in the future")
+
+// ErrOAuthClientNotFound is returned when an OAuth client does not exist, belongs to another account or is revoked.
+var ErrOAuthClientNotFound = fmt.Errorf("oauth client not found")
+
+// ErrInvalidRedirectURI is returned when a redirect URI is not an absolute https URL (http is allowed for loopback hosts).
+var ErrInvalidRedirectURI = fmt.Errorf("invalid redirect uri")
+
+// ErrInvitationNotFound is returned when an invitation is unknown, of another account, expired or already used.
+var ErrInvitationNotFound = fmt.Errorf("invitation not found")
+
+// ErrInvitationEmailMismatch is returned when the user accepting an invitation is signed in with another email.
+var ErrInvitationEmailMismatch = fmt.Errorf("invitation was sent to another email")
+
+// ErrAlreadyMember is returned when the invited email or the accepting user already belongs to the account.
+var ErrAlreadyMember = fmt.Errorf("already a member of the account")
+
+// ErrAccountMemberNotFound is returned when the membership being changed or removed does not exist.
+var ErrAccountMemberNotFound = fmt.Errorf("account member not found")
+
+// ErrOwnerMembership is returned when trying to remove the owner or change the owner's role.
+var ErrOwnerMembership = fmt.Errorf("the owner membership cannot be changed")
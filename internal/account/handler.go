@@ -3,6 +3,7 @@ package account
 import (
 	"errors"
 	"log/slog"
+	"time"
 
 	"github.com/cloudflax/api.cloudflax/internal/shared/requestctx"
 	runtimeError "github.com/cloudflax/api.cloudflax/internal/shared/runtimeerror"
@@ -11,9 +12,15 @@ import (
 	"github.com/gofiber/fiber/v3"
 )
 
+// AccessTokenIssuer signs a new access token for the current session of a user, scoped to their active account.
+type AccessTokenIssuer interface {
+	IssueAccessToken(userID, sessionID string) (accessToken string, expiresAt time.Time, err error)
+}
+
 // Handler handles HTTP requests for accounts.
 type Handler struct {
-	service *Service
+	service     *Service
+	tokenIssuer AccessTokenIssuer
 }
 
 // NewHandler creates a new account handler.
@@ -21,6 +28,12 @@ func NewHandler(service *Service) *Handler {
 	return &Handler{service: service}
 }
 
+// WithAccessTokenIssuer makes POST /accounts/active also return an access token scoped to the new active account.
+func (h *Handler) WithAccessTokenIssuer(issuer AccessTokenIssuer) *Handler {
+	h.tokenIssuer = issuer
+	return h
+}
+
 // CreateAccount handles POST /accounts.
 // Creates an account owned by the authenticated user. Requires a verified email.
 func (h *Handler) CreateAccount(c fiber.Ctx) error {
@@ -66,12 +79,16 @@ func (h *Handler) CreateAccount(c fiber.Ctx) error {
 }
 
 // SetActiveAccount handles POST /accounts/active.
-// It marks the given account as the active account for the authenticated user.
+// It marks the given account as the active account for the authenticated user and, when a token
+// issuer is configured, returns a new access token for the current session scoped to that account.
 func (h *Handler) SetActiveAccount(c fiber.Ctx) error {
 	rctx, err := requestctx.UserOnly(c)
 	if err != nil {
 		return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
 	}
+	if rctx.ActorID != "" {
+		return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeForbidden, "Impersonation sessions cannot switch accounts")
+	}
 
 	var req SetActiveAccountRequest
 	if err := c.Bind().Body(&req); err != nil {
@@ -106,11 +123,426 @@ func (h *Handler) SetActiveAccount(c fiber.Ctx) error {
 		}
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"data": fiber.Map{
-			"active_account_id": req.AccountID,
-		},
-	})
+	data := fiber.Map{"active_account_id": req.AccountID}
+	if h.tokenIssuer != nil {
+		accessToken, expiresAt, err := h.tokenIssuer.IssueAccessToken(rctx.UserID, rctx.SessionID)
+		if err != nil {
+			slog.Error("issue account access token", "user_id", rctx.UserID, "account_id", req.AccountID, "error", err)
+			return runtimeError.Respond(c, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Failed to issue access token")
+		}
+		data["access_token"] = accessToken
+		data["expires_at"] = expiresAt
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"data": data})
+}
+
+// CreateAPIKey handles POST /accounts/:id/api-keys.
+// Issues an API key for machine clients; the raw key is returned only in this response.
+func (h *Handler) CreateAPIKey(c fiber.Ctx) error {
+	rctx, err := requestctx.UserOnly(c)
+	if err != nil {
+		return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+	if rctx.ActorID != "" {
+		return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeForbidden, "Impersonation sessions cannot create API keys")
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.Bind().Body(&req); err != nil {
+		slog.Debug("create api key bind error", "error", err)
+		return runtimeError.Respond(c, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	if err := validator.Validate(req); err != nil {
+		slog.Debug("create api key validation error", "error", err)
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				c, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(c, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	accountID := c.Params("id")
+	key, raw, err := h.service.CreateAPIKey(accountID, rctx.UserID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, ErrAPIKeyExpiryInPast) {
+			return runtimeError.RespondWithDetails(
+				c, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", []runtimeError.ErrorDetail{{Field: "expires_at", Message: "Must be in the future"}},
+			)
+		}
+		return respondAPIKeyError(c, err, "create api key", rctx.UserID, accountID, "Failed to create API key")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"data": CreateAPIKeyResponse{APIKey: *key, Key: raw}})
+}
+
+// ListAPIKeys handles GET /accounts/:id/api-keys.
+// Returns the active keys of the account without their secret part.
+func (h *Handler) ListAPIKeys(c fiber.Ctx) error {
+	rctx, err := requestctx.UserOnly(c)
+	if err != nil {
+		return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	accountID := c.Params("id")
+	keys, err := h.service.ListAPIKeys(accountID, rctx.UserID)
+	if err != nil {
+		return respondAPIKeyError(c, err, "list api keys", rctx.UserID, accountID, "Failed to list API keys")
+	}
+
+	return c.JSON(fiber.Map{"data": keys})
+}
+
+// RevokeAPIKey handles DELETE /accounts/:id/api-keys/:keyID.
+// Revoked keys are rejected immediately by RequireAuth.
+func (h *Handler) RevokeAPIKey(c fiber.Ctx) error {
+	rctx, err := requestctx.UserOnly(c)
+	if err != nil {
+		return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	accountID := c.Params("id")
+	if err := h.service.RevokeAPIKey(accountID, rctx.UserID, c.Params("keyID")); err != nil {
+		return respondAPIKeyError(c, err, "revoke api key", rctx.UserID, accountID, "Failed to revoke API key")
+	}
+
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// CreateOAuthClient handles POST /accounts/:id/oauth-clients.
+// Registers a third-party application; the secret of a confidential client is returned only in this response.
+func (h *Handler) CreateOAuthClient(c fiber.Ctx) error {
+	rctx, err := requestctx.UserOnly(c)
+	if err != nil {
+		return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+	if rctx.ActorID != "" {
+		return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeForbidden, "Impersonation sessions cannot register OAuth clients")
+	}
+
+	var req CreateOAuthClientRequest
+	if err := c.Bind().Body(&req); err != nil {
+		slog.Debug("create oauth client bind error", "error", err)
+		return runtimeError.Respond(c, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	if err := validator.Validate(req); err != nil {
+		slog.Debug("create oauth client validation error", "error", err)
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				c, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(c, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	accountID := c.Params("id")
+	client, secret, err := h.service.CreateOAuthClient(accountID, rctx.UserID, req.Name, req.RedirectURIs, req.Scopes, req.Public)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRedirectURI) {
+			return runtimeError.RespondWithDetails(
+				c, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", []runtimeError.ErrorDetail{{Field: "redirect_uris", Message: "Must be absolute https URLs without fragment (http only for localhost)"}},
+			)
+		}
+		return respondAPIKeyError(c, err, "create oauth client", rctx.UserID, accountID, "Failed to create OAuth client")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"data": CreateOAuthClientResponse{OAuthClient: *client, ClientSecret: secret}})
+}
+
+// ListOAuthClients handles GET /accounts/:id/oauth-clients.
+// Returns the active OAuth clients of the account without their secret.
+func (h *Handler) ListOAuthClients(c fiber.Ctx) error {
+	rctx, err := requestctx.UserOnly(c)
+	if err != nil {
+		return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	accountID := c.Params("id")
+	clients, err := h.service.ListOAuthClients(accountID, rctx.UserID)
+	if err != nil {
+		return respondAPIKeyError(c, err, "list oauth clients", rctx.UserID, accountID, "Failed to list OAuth clients")
+	}
+
+	return c.JSON(fiber.Map{"data": clients})
+}
+
+// RevokeOAuthClient handles DELETE /accounts/:id/oauth-clients/:clientID.
+// A revoked client can no longer obtain or refresh tokens; issued access tokens expire on their own.
+func (h *Handler) RevokeOAuthClient(c fiber.Ctx) error {
+	rctx, err := requestctx.UserOnly(c)
+	if err != nil {
+		return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	accountID := c.Params("id")
+	if err := h.service.RevokeOAuthClient(accountID, rctx.UserID, c.Params("clientID")); err != nil {
+		return respondAPIKeyError(c, err, "revoke oauth client", rctx.UserID, accountID, "Failed to revoke OAuth client")
+	}
+
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// ListMembers handles GET /accounts/:id/members.
+// Returns the memberships of the account to any of its members.
+func (h *Handler) ListMembers(c fiber.Ctx) error {
+	rctx, err := requestctx.UserOnly(c)
+	if err != nil {
+		return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	accountID := c.Params("id")
+	members, err := h.service.ListMembers(accountID, rctx.UserID)
+	if err != nil {
+		return respondAPIKeyError(c, err, "list account members", rctx.UserID, accountID, "Failed to list members")
+	}
+
+	return c.JSON(fiber.Map{"data": members})
+}
+
+// UpdateMemberRole handles PATCH /accounts/:id/members/:userID.
+// Tokens that still claim the member's previous role are rejected from then on.
+func (h *Handler) UpdateMemberRole(c fiber.Ctx) error {
+	rctx, err := requestctx.UserOnly(c)
+	if err != nil {
+		return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	var req UpdateMemberRoleRequest
+	if err := c.Bind().Body(&req); err != nil {
+		slog.Debug("update member role bind error", "error", err)
+		return runtimeError.Respond(c, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	if err := validator.Validate(req); err != nil {
+		slog.Debug("update member role validation error", "error", err)
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				c, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(c, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	accountID := c.Params("id")
+	member, err := h.service.UpdateMemberRole(accountID, rctx.UserID, c.Params("userID"), req.Role)
+	if err != nil {
+		return respondMemberError(c, err, "update member role", rctx.UserID, accountID, "Failed to update member role")
+	}
+
+	return c.JSON(fiber.Map{"data": member})
+}
+
+// RemoveMember handles DELETE /accounts/:id/members/:userID.
+// Tokens that still claim the removed membership are rejected from then on.
+func (h *Handler) RemoveMember(c fiber.Ctx) error {
+	rctx, err := requestctx.UserOnly(c)
+	if err != nil {
+		return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	accountID := c.Params("id")
+	if err := h.service.RemoveMember(accountID, rctx.UserID, c.Params("userID")); err != nil {
+		return respondMemberError(c, err, "remove member", rctx.UserID, accountID, "Failed to remove member")
+	}
+
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// CreateInvitation handles POST /accounts/:id/invitations.
+// Emails an invitation to join the account; the token is only sent by email and never returned.
+func (h *Handler) CreateInvitation(c fiber.Ctx) error {
+	rctx, err := requestctx.UserOnly(c)
+	if err != nil {
+		return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+	if rctx.ActorID != "" {
+		return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeForbidden, "Impersonation sessions cannot send invitations")
+	}
+
+	var req CreateInvitationRequest
+	if err := c.Bind().Body(&req); err != nil {
+		slog.Debug("create invitation bind error", "error", err)
+		return runtimeError.Respond(c, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	if err := validator.Validate(req); err != nil {
+		slog.Debug("create invitation validation error", "error", err)
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				c, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(c, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	accountID := c.Params("id")
+	invitation, _, err := h.service.CreateInvitation(accountID, rctx.UserID, req.Email, req.Role)
+	if err != nil {
+		if errors.Is(err, ErrAlreadyMember) {
+			return runtimeError.Respond(c, fiber.StatusConflict, runtimeError.CodeAccountMemberExists, "User is already a member of this account")
+		}
+		return respondAPIKeyError(c, err, "create invitation", rctx.UserID, accountID, "Failed to create invitation")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"data": invitation})
+}
+
+// ListInvitations handles GET /accounts/:id/invitations.
+// Returns the invitations of the account that can still be accepted.
+func (h *Handler) ListInvitations(c fiber.Ctx) error {
+	rctx, err := requestctx.UserOnly(c)
+	if err != nil {
+		return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	accountID := c.Params("id")
+	invitations, err := h.service.ListInvitations(accountID, rctx.UserID)
+	if err != nil {
+		return respondAPIKeyError(c, err, "list invitations", rctx.UserID, accountID, "Failed to list invitations")
+	}
+
+	return c.JSON(fiber.Map{"data": invitations})
+}
+
+// RevokeInvitation handles DELETE /accounts/:id/invitations/:invitationID.
+// The invitation link stops working immediately.
+func (h *Handler) RevokeInvitation(c fiber.Ctx) error {
+	rctx, err := requestctx.UserOnly(c)
+	if err != nil {
+		return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	accountID := c.Params("id")
+	if err := h.service.RevokeInvitation(accountID, rctx.UserID, c.Params("invitationID")); err != nil {
+		if errors.Is(err, ErrInvitationNotFound) {
+			return runtimeError.Respond(c, fiber.StatusNotFound, runtimeError.CodeInvitationNotFound, "Invitation not found")
+		}
+		return respondAPIKeyError(c, err, "revoke invitation", rctx.UserID, accountID, "Failed to revoke invitation")
+	}
+
+	return c.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// AcceptInvitation handles POST /invitations/accept.
+// Adds the authenticated user to the invited account; the user must be signed in with the invited email.
+func (h *Handler) AcceptInvitation(c fiber.Ctx) error {
+	rctx, err := requestctx.UserOnly(c)
+	if err != nil {
+		return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	var req InvitationTokenRequest
+	if err := c.Bind().Body(&req); err != nil {
+		slog.Debug("accept invitation bind error", "error", err)
+		return runtimeError.Respond(c, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	if err := validator.Validate(req); err != nil {
+		slog.Debug("accept invitation validation error", "error", err)
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				c, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(c, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	member, err := h.service.AcceptInvitation(req.Token, rctx.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvitationNotFound):
+			return runtimeError.Respond(c, fiber.StatusUnprocessableEntity, runtimeError.CodeInvalidInvitationToken, "Invalid or expired invitation")
+		case errors.Is(err, ErrInvitationEmailMismatch):
+			return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeInvitationEmailMismatch, "Invitation was sent to another email")
+		case errors.Is(err, ErrAlreadyMember):
+			return runtimeError.Respond(c, fiber.StatusConflict, runtimeError.CodeAccountMemberExists, "Already a member of this account")
+		case errors.Is(err, user.ErrNotFound):
+			return runtimeError.Respond(c, fiber.StatusNotFound, runtimeError.CodeUserNotFound, "User not found")
+		default:
+			slog.Error("accept invitation", "user_id", rctx.UserID, "error", err)
+			return runtimeError.Respond(c, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Failed to accept invitation")
+		}
+	}
+
+	return c.JSON(fiber.Map{"data": member})
+}
+
+// DeclineInvitation handles POST /invitations/decline.
+// Public: the token from the invitation email is enough, so people without an account can decline too.
+func (h *Handler) DeclineInvitation(c fiber.Ctx) error {
+	var req InvitationTokenRequest
+	if err := c.Bind().Body(&req); err != nil {
+		slog.Debug("decline invitation bind error", "error", err)
+		return runtimeError.Respond(c, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	if err := validator.Validate(req); err != nil {
+		slog.Debug("decline invitation validation error", "error", err)
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				c, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(c, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	if err := h.service.DeclineInvitation(req.Token); err != nil {
+		if errors.Is(err, ErrInvitationNotFound) {
+			return runtimeError.Respond(c, fiber.StatusUnprocessableEntity, runtimeError.CodeInvalidInvitationToken, "Invalid or expired invitation")
+		}
+		slog.Error("decline invitation", "error", err)
+		return runtimeError.Respond(c, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Failed to decline invitation")
+	}
+
+	return c.JSON(fiber.Map{"message": "Invitation declined"})
+}
+
+// respondAPIKeyError maps the errors shared by the API key and OAuth client endpoints to HTTP responses.
+func respondAPIKeyError(c fiber.Ctx, err error, operation, userID, accountID, message string) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return runtimeError.Respond(c, fiber.StatusNotFound, runtimeError.CodeAccountNotFound, "Account not found")
+	case errors.Is(err, ErrMemberNotFound):
+		return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeForbidden, "Access denied: not a member of this account")
+	case errors.Is(err, ErrInsufficientRole):
+		return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeForbidden, "Access denied: owner or admin role required")
+	case errors.Is(err, ErrAPIKeyNotFound):
+		return runtimeError.Respond(c, fiber.StatusNotFound, runtimeError.CodeAPIKeyNotFound, "API key not found")
+	case errors.Is(err, ErrOAuthClientNotFound):
+		return runtimeError.Respond(c, fiber.StatusNotFound, runtimeError.CodeOAuthClientNotFound, "OAuth client not found")
+	default:
+		slog.Error(operation, "user_id", userID, "account_id", accountID, "error", err)
+		return runtimeError.Respond(c, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, message)
+	}
+}
+
+// respondMemberError maps the errors of the membership endpoints, falling back to respondAPIKeyError.
+func respondMemberError(c fiber.Ctx, err error, operation, userID, accountID, message string) error {
+	switch {
+	case errors.Is(err, ErrAccountMemberNotFound):
+		return runtimeError.Respond(c, fiber.StatusNotFound, runtimeError.CodeAccountMemberNotFound, "Member not found")
+	case errors.Is(err, ErrOwnerMembership):
+		return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeForbidden, "The account owner cannot be removed or change role")
+	default:
+		return respondAPIKeyError(c, err, operation, userID, accountID, message)
+	}
 }
 
 // toErrorDetails converts validator.ValidationErrors to runtimeError.ErrorDetail slice.
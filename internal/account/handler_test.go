@@ -3,6 +3,7 @@ package account
 import (
 	"encoding/json"
 	"io"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
@@ -19,7 +20,7 @@ import (
 func setupHandlerTest(t *testing.T) (*Handler, *user.Repository) {
 	t.Helper()
 	require.NoError(t, database.InitForTesting())
-	require.NoError(t, database.RunMigrations(&user.User{}, &Account{}, &AccountMember{}))
+	require.NoError(t, database.RunMigrations(&user.User{}, &Account{}, &AccountMember{}, &APIKey{}, &OAuthClient{}, &AccountInvitation{}))
 
 	userRepository := user.NewRepository(database.DB)
 	accountRepository := NewRepository(database.DB)
@@ -266,6 +267,44 @@ func TestSetActiveAccount_Success(t *testing.T) {
 	assert.Equal(t, created.Data.ID, activeResult.Data.ActiveAccountID)
 }
 
+// fixedTokenIssuer returns the same access token for every call.
+type fixedTokenIssuer struct{}
+
+func (fixedTokenIssuer) IssueAccessToken(string, string) (string, time.Time, error) {
+	return "account-scoped-token", time.Now().Add(15 * time.Minute), nil
+}
+
+func TestSetActiveAccount_ReturnsAccountScopedToken(t *testing.T) {
+	handler, _ := setupHandlerTest(t)
+	handler.WithAccessTokenIssuer(fixedTokenIssuer{})
+	owner := seedVerifiedUserForHandler(t, "Hedy", "hedy@example.com")
+	acc, _, err := handler.service.CreateAccount("Hedy Org", "", owner.ID)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Post("/accounts/active", func(c fiber.Ctx) error {
+		c.Locals("userID", owner.ID)
+		return c.Next()
+	}, handler.SetActiveAccount)
+
+	req := httptest.NewRequest("POST", "/accounts/active", strings.NewReader(`{"account_id":"`+acc.ID+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var result struct {
+		Data struct {
+			ActiveAccountID string `json:"active_account_id"`
+			AccessToken     string `json:"access_token"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, acc.ID, result.Data.ActiveAccountID)
+	assert.Equal(t, "account-scoped-token", result.Data.AccessToken)
+}
+
 func TestSetActiveAccount_NotMember(t *testing.T) {
 	handler, _ := setupHandlerTest(t)
 	owner := seedVerifiedUserForHandler(t, "Kelly", "kelly@example.com")
@@ -309,3 +348,234 @@ func TestSetActiveAccount_NotMember(t *testing.T) {
 	errResp := decodeErrorResponse(t, activeResp.Body)
 	assert.Equal(t, runtimeerror.CodeForbidden, errResp.Error.Code)
 }
+
+func TestAPIKeys_CreateListRevoke(t *testing.T) {
+	handler, _ := setupHandlerTest(t)
+	owner := seedVerifiedUserForHandler(t, "Quinn", "quinn@example.com")
+	acc, _, err := handler.service.CreateAccount("Quinn Org", "", owner.ID)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	Routes(app, handler, func(c fiber.Ctx) error {
+		c.Locals("userID", owner.ID)
+		return c.Next()
+	}, func(c fiber.Ctx) error { return c.Next() })
+
+	createReq := httptest.NewRequest("POST", "/accounts/"+acc.ID+"/api-keys", strings.NewReader(`{"name":"ERP sync","scopes":["invoices:read"]}`))
+	createReq.Header.Set("Content-Type", "application/json")
+	createResp, err := app.Test(createReq, fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	defer createResp.Body.Close()
+	require.Equal(t, fiber.StatusCreated, createResp.StatusCode)
+
+	var created struct {
+		Data CreateAPIKeyResponse `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(createResp.Body).Decode(&created))
+	assert.True(t, strings.HasPrefix(created.Data.Key, APIKeyPrefix))
+	assert.Equal(t, []string{APIKeyScopeInvoicesRead}, created.Data.Scopes)
+
+	listResp, err := app.Test(httptest.NewRequest("GET", "/accounts/"+acc.ID+"/api-keys", nil), fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	defer listResp.Body.Close()
+	require.Equal(t, fiber.StatusOK, listResp.StatusCode)
+	body, err := io.ReadAll(listResp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), created.Data.Prefix)
+	assert.NotContains(t, string(body), created.Data.Key, "the raw key is only returned on creation")
+
+	revokeResp, err := app.Test(httptest.NewRequest("DELETE", "/accounts/"+acc.ID+"/api-keys/"+created.Data.ID, nil), fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	defer revokeResp.Body.Close()
+	assert.Equal(t, fiber.StatusNoContent, revokeResp.StatusCode)
+
+	againResp, err := app.Test(httptest.NewRequest("DELETE", "/accounts/"+acc.ID+"/api-keys/"+created.Data.ID, nil), fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	defer againResp.Body.Close()
+	assert.Equal(t, fiber.StatusNotFound, againResp.StatusCode)
+	assert.Equal(t, runtimeerror.CodeAPIKeyNotFound, decodeErrorResponse(t, againResp.Body).Error.Code)
+}
+
+func TestAPIKeys_CreateValidationError(t *testing.T) {
+	handler, _ := setupHandlerTest(t)
+	owner := seedVerifiedUserForHandler(t, "Quinn", "quinn@example.com")
+	acc, _, err := handler.service.CreateAccount("Quinn Org", "", owner.ID)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Post("/accounts/:id/api-keys", func(c fiber.Ctx) error {
+		c.Locals("userID", owner.ID)
+		return c.Next()
+	}, handler.CreateAPIKey)
+
+	req := httptest.NewRequest("POST", "/accounts/"+acc.ID+"/api-keys", strings.NewReader(`{"name":"CI","scopes":["users:delete"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, runtimeerror.CodeValidationError, decodeErrorResponse(t, resp.Body).Error.Code)
+}
+
+func TestOAuthClients_CreateListRevoke(t *testing.T) {
+	handler, _ := setupHandlerTest(t)
+	owner := seedVerifiedUserForHandler(t, "Quinn", "quinn@example.com")
+	acc, _, err := handler.service.CreateAccount("Quinn Org", "", owner.ID)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	Routes(app, handler, func(c fiber.Ctx) error {
+		c.Locals("userID", owner.ID)
+		return c.Next()
+	}, func(c fiber.Ctx) error { return c.Next() })
+
+	badReq := httptest.NewRequest("POST", "/accounts/"+acc.ID+"/oauth-clients", strings.NewReader(`{"name":"Partner","redirect_uris":["http://partner.example/cb"],"scopes":["invoices:read"]}`))
+	badReq.Header.Set("Content-Type", "application/json")
+	badResp, err := app.Test(badReq, fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	defer badResp.Body.Close()
+	assert.Equal(t, fiber.StatusUnprocessableEntity, badResp.StatusCode)
+	badBody := decodeErrorResponse(t, badResp.Body)
+	require.Len(t, badBody.Error.Details, 1)
+	assert.Equal(t, "redirect_uris", badBody.Error.Details[0].Field)
+
+	createReq := httptest.NewRequest("POST", "/accounts/"+acc.ID+"/oauth-clients", strings.NewReader(`{"name":"Partner","redirect_uris":["https://partner.example/cb"],"scopes":["openid","invoices:read"]}`))
+	createReq.Header.Set("Content-Type", "application/json")
+	createResp, err := app.Test(createReq, fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	defer createResp.Body.Close()
+	require.Equal(t, fiber.StatusCreated, createResp.StatusCode)
+
+	var created struct {
+		Data CreateOAuthClientResponse `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(createResp.Body).Decode(&created))
+	assert.NotEmpty(t, created.Data.ClientSecret)
+	assert.True(t, created.Data.Confidential)
+	assert.Equal(t, []string{"https://partner.example/cb"}, created.Data.RedirectURIs)
+
+	listResp, err := app.Test(httptest.NewRequest("GET", "/accounts/"+acc.ID+"/oauth-clients", nil), fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	defer listResp.Body.Close()
+	require.Equal(t, fiber.StatusOK, listResp.StatusCode)
+	body, err := io.ReadAll(listResp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), created.Data.ID)
+	assert.NotContains(t, string(body), created.Data.ClientSecret, "the secret is only returned on creation")
+
+	revokeResp, err := app.Test(httptest.NewRequest("DELETE", "/accounts/"+acc.ID+"/oauth-clients/"+created.Data.ID, nil), fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	defer revokeResp.Body.Close()
+	assert.Equal(t, fiber.StatusNoContent, revokeResp.StatusCode)
+
+	againResp, err := app.Test(httptest.NewRequest("DELETE", "/accounts/"+acc.ID+"/oauth-clients/"+created.Data.ID, nil), fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	defer againResp.Body.Close()
+	assert.Equal(t, fiber.StatusNotFound, againResp.StatusCode)
+	assert.Equal(t, runtimeerror.CodeOAuthClientNotFound, decodeErrorResponse(t, againResp.Body).Error.Code)
+}
+
+func TestInvitations_CreateAcceptDecline(t *testing.T) {
+	handler, _ := setupHandlerTest(t)
+	owner := seedVerifiedUserForHandler(t, "Quinn", "quinn@example.com")
+	invitee := seedVerifiedUserForHandler(t, "Rosa", "rosa@example.com")
+	acc, _, err := handler.service.CreateAccount("Quinn Org", "", owner.ID)
+	require.NoError(t, err)
+
+	currentUserID := owner.ID
+	app := fiber.New()
+	Routes(app, handler, func(c fiber.Ctx) error {
+		c.Locals("userID", currentUserID)
+		return c.Next()
+	}, func(c fiber.Ctx) error { return c.Next() })
+	post := func(path, body string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := post("/accounts/"+acc.ID+"/invitations", `{"email":"rosa@example.com","role":"owner"}`)
+	assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp = post("/accounts/"+acc.ID+"/invitations", `{"email":"rosa@example.com","role":"member"}`)
+	require.Equal(t, fiber.StatusCreated, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "token", "the token is only sent by email")
+
+	_, raw, err := handler.service.CreateInvitation(acc.ID, owner.ID, "rosa@example.com", RoleMember)
+	require.NoError(t, err)
+
+	resp = post("/invitations/accept", `{"token":"`+raw+`"}`)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, runtimeerror.CodeInvitationEmailMismatch, decodeErrorResponse(t, resp.Body).Error.Code)
+
+	currentUserID = invitee.ID
+	resp = post("/invitations/accept", `{"token":"`+raw+`"}`)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var accepted struct {
+		Data AccountMember `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&accepted))
+	assert.Equal(t, acc.ID, accepted.Data.AccountID)
+	assert.Equal(t, RoleMember, accepted.Data.Role)
+
+	resp = post("/accounts/"+acc.ID+"/invitations", `{"email":"sam@example.com","role":"member"}`)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode, "plain members cannot invite")
+
+	currentUserID = owner.ID
+	resp = post("/accounts/"+acc.ID+"/invitations", `{"email":"rosa@example.com","role":"admin"}`)
+	assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
+	assert.Equal(t, runtimeerror.CodeAccountMemberExists, decodeErrorResponse(t, resp.Body).Error.Code)
+
+	_, declined, err := handler.service.CreateInvitation(acc.ID, owner.ID, "sam@example.com", RoleMember)
+	require.NoError(t, err)
+	resp = post("/invitations/decline", `{"token":"`+declined+`"}`)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	resp = post("/invitations/decline", `{"token":"`+declined+`"}`)
+	assert.Equal(t, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, runtimeerror.CodeInvalidInvitationToken, decodeErrorResponse(t, resp.Body).Error.Code)
+}
+
+func TestImpersonation_CannotSwitchAccountsOrMintCredentials(t *testing.T) {
+	handler, _ := setupHandlerTest(t)
+	owner := seedVerifiedUserForHandler(t, "Rita", "rita@example.com")
+	acc, _, err := handler.service.CreateAccount("Rita Org", "", owner.ID)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(func(c fiber.Ctx) error {
+		c.Locals("userID", owner.ID)
+		c.Locals("actorID", "admin-1")
+		return c.Next()
+	})
+	app.Post("/accounts/active", handler.SetActiveAccount)
+	app.Post("/accounts/:id/api-keys", handler.CreateAPIKey)
+	app.Post("/accounts/:id/oauth-clients", handler.CreateOAuthClient)
+	app.Post("/accounts/:id/invitations", handler.CreateInvitation)
+
+	requests := map[string]string{
+		"/accounts/active":                       `{"account_id":"` + acc.ID + `"}`,
+		"/accounts/" + acc.ID + "/api-keys":      `{"name":"CI"}`,
+		"/accounts/" + acc.ID + "/oauth-clients": `{"name":"App","redirect_uris":["https://app.example.com/cb"],"scopes":["openid"]}`,
+		"/accounts/" + acc.ID + "/invitations":   `{"email":"sam@example.com","role":"member"}`,
+	}
+	for path, body := range requests {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusForbidden, resp.StatusCode, path)
+		assert.Equal(t, runtimeerror.CodeForbidden, decodeErrorResponse(t, resp.Body).Error.Code, path)
+		resp.Body.Close()
+	}
+
+	keys, err := handler.service.ListAPIKeys(acc.ID, owner.ID)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
@@ -1,6 +1,7 @@
 package account
 
 import (
+	"crypto/subtle"
 	"time"
 
 	"github.com/google/uuid"
@@ -62,3 +63,158 @@ func (m *AccountMember) BeforeCreate(_ *gorm.DB) error {
 	}
 	return nil
 }
+
+// API key scopes. A key without scopes has the same access as an account member.
+const (
+	APIKeyScopeInvoicesRead  = "invoices:read"
+	APIKeyScopeInvoicesWrite = "invoices:write"
+)
+
+// APIKeyPrefix starts every account API key so it can be told apart from a JWT.
+const APIKeyPrefix = "cfx_"
+
+// APIKey is an account-scoped credential for machine clients (ERP sync jobs, CI scripts).
+// Only the SHA-256 hash of the key is stored; Prefix keeps its first characters so users can recognise it.
+type APIKey struct {
+	ID              string     `gorm:"type:uuid;primaryKey"           json:"id"`
+	AccountID       string     `gorm:"type:uuid;not null;index"       json:"account_id"`
+	CreatedByUserID string     `gorm:"type:uuid;not null"             json:"created_by_user_id"`
+	Name            string     `gorm:"not null"                       json:"name"`
+	Prefix          string     `gorm:"not null"                       json:"prefix"`
+	KeyHash         string     `gorm:"uniqueIndex;not null"           json:"-"`
+	Scopes          []string   `gorm:"serializer:json"                json:"scopes"`
+	ExpiresAt       *time.Time `                                      json:"expires_at,omitempty"`
+	LastUsedAt      *time.Time `                                      json:"last_used_at,omitempty"`
+	RevokedAt       *time.Time `gorm:"index"                          json:"-"`
+	CreatedAt       time.Time  `                                      json:"created_at"`
+}
+
+// TableName overrides the table name.
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// BeforeCreate generates UUID before insert.
+func (k *APIKey) BeforeCreate(_ *gorm.DB) error {
+	if k.ID == "" {
+		k.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// IsActive reports whether the key is neither revoked nor expired.
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// HasScope reports whether the key grants the scope; keys without scopes grant every scope.
+func (k *APIKey) HasScope(scope string) bool {
+	if len(k.Scopes) == 0 {
+		return true
+	}
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuth scopes a client may request besides the invoice scopes shared with API keys.
+const (
+	OAuthScopeOpenID  = "openid"
+	OAuthScopeEmail   = "email"
+	OAuthScopeProfile = "profile"
+)
+
+// OAuthClient is a third-party application registered by an account to act on users' behalf through
+// authorization code + PKCE. Confidential clients also authenticate with a secret, of which only the
+// SHA-256 hash is stored; public clients (mobile or single-page apps) rely on PKCE alone.
+type OAuthClient struct {
+	ID              string     `gorm:"type:uuid;primaryKey"     json:"client_id"`
+	AccountID       string     `gorm:"type:uuid;not null;index" json:"account_id"`
+	CreatedByUserID string     `gorm:"type:uuid;not null"       json:"created_by_user_id"`
+	Name            string     `gorm:"not null"                 json:"name"`
+	RedirectURIs    []string   `gorm:"serializer:json"          json:"redirect_uris"`
+	Scopes          []string   `gorm:"serializer:json"          json:"scopes"`
+	Confidential    bool       `gorm:"not null"                 json:"confidential"`
+	SecretHash      string     `                                json:"-"`
+	RevokedAt       *time.Time `gorm:"index"                    json:"-"`
+	CreatedAt       time.Time  `                                json:"created_at"`
+}
+
+// TableName overrides the table name.
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+// BeforeCreate generates UUID before insert.
+func (c *OAuthClient) BeforeCreate(_ *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// AllowsRedirectURI reports whether uri exactly matches one of the registered redirect URIs.
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	for _, registered := range c.RedirectURIs {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsScope reports whether the client was registered with the scope.
+func (c *OAuthClient) AllowsScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckSecret reports whether secret is the secret of a confidential client.
+func (c *OAuthClient) CheckSecret(secret string) bool {
+	if !c.Confidential || c.SecretHash == "" || secret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(c.SecretHash)) == 1
+}
+
+// AccountInvitation offers an email address to join an account with a role. Only the SHA-256 hash of the
+// token is stored; the raw token travels in the invitation link. An invitation is used once: it ends
+// accepted, declined, revoked (by an admin or by a newer invitation to the same email) or expired.
+type AccountInvitation struct {
+	ID              string     `gorm:"type:uuid;primaryKey"     json:"id"`
+	AccountID       string     `gorm:"type:uuid;not null;index" json:"account_id"`
+	Email           string     `gorm:"not null;index"           json:"email"`
+	Role            RoleType   `gorm:"not null"                 json:"role"`
+	TokenHash       string     `gorm:"uniqueIndex;not null"     json:"-"`
+	InvitedByUserID string     `gorm:"type:uuid;not null"       json:"invited_by_user_id"`
+	ExpiresAt       time.Time  `gorm:"not null"                 json:"expires_at"`
+	AcceptedAt      *time.Time `                                json:"accepted_at,omitempty"`
+	DeclinedAt      *time.Time `                                json:"declined_at,omitempty"`
+	RevokedAt       *time.Time `gorm:"index"                    json:"-"`
+	CreatedAt       time.Time  `                                json:"created_at"`
+}
+
+// TableName overrides the table name.
+func (AccountInvitation) TableName() string {
+	return "account_invitations"
+}
+
+// BeforeCreate generates UUID before insert.
+func (i *AccountInvitation) BeforeCreate(_ *gorm.DB) error {
+	if i.ID == "" {
+		i.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// IsPending reports whether the invitation can still be accepted or declined.
+func (i *AccountInvitation) IsPending(now time.Time) bool {
+	return i.AcceptedAt == nil && i.DeclinedAt == nil && i.RevokedAt == nil && now.Before(i.ExpiresAt)
+}
@@ -3,6 +3,7 @@ package account
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
@@ -85,6 +86,34 @@ func (r *Repository) GetMember(accountID, userID string) (*AccountMember, error)
 	return &member, nil
 }
 
+// UpdateMemberRole changes the role of a membership.
+// Returns ErrMemberNotFound when no such membership exists.
+func (r *Repository) UpdateMemberRole(accountID, userID string, role RoleType) error {
+	result := r.db.Model(&AccountMember{}).
+		Where("account_id = ? AND user_id = ?", accountID, userID).
+		Update("role", role)
+	if result.Error != nil {
+		return fmt.Errorf("update account member role: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+// DeleteMember removes a membership.
+// Returns ErrMemberNotFound when no such membership exists.
+func (r *Repository) DeleteMember(accountID, userID string) error {
+	result := r.db.Where("account_id = ? AND user_id = ?", accountID, userID).Delete(&AccountMember{})
+	if result.Error != nil {
+		return fmt.Errorf("delete account member: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
 // ListMembers returns all memberships for the given account.
 func (r *Repository) ListMembers(accountID string) ([]AccountMember, error) {
 	var members []AccountMember
@@ -105,3 +134,199 @@ func (r *Repository) ListAccountsForUser(userID string) ([]Account, error) {
 	}
 	return accounts, nil
 }
+
+// CreateAPIKey persists a new API key.
+func (r *Repository) CreateAPIKey(key *APIKey) error {
+	if err := r.db.Create(key).Error; err != nil {
+		return fmt.Errorf("create api key: %w", err)
+	}
+	return nil
+}
+
+// ListAPIKeys returns the non-revoked API keys of the account, newest first.
+func (r *Repository) ListAPIKeys(accountID string) ([]APIKey, error) {
+	var keys []APIKey
+	if err := r.db.
+		Where("account_id = ? AND revoked_at IS NULL", accountID).
+		Order("created_at DESC").
+		Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// GetAPIKeyByHash returns an API key by the SHA-256 hash of its raw value.
+// Returns ErrAPIKeyNotFound when no key matches.
+func (r *Repository) GetAPIKeyByHash(keyHash string) (*APIKey, error) {
+	var key APIKey
+	if err := r.db.First(&key, "key_hash = ?", keyHash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("get api key by hash: %w", err)
+	}
+	return &key, nil
+}
+
+// RevokeAPIKey marks a key of the account as revoked.
+// Returns ErrAPIKeyNotFound when the key does not exist, belongs to another account or is already revoked.
+func (r *Repository) RevokeAPIKey(accountID, keyID string) error {
+	result := r.db.Model(&APIKey{}).
+		Where("id = ? AND account_id = ? AND revoked_at IS NULL", keyID, accountID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("revoke api key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// TouchAPIKey records the time the key was last used.
+func (r *Repository) TouchAPIKey(keyID string, usedAt time.Time) error {
+	if err := r.db.Model(&APIKey{}).Where("id = ?", keyID).Update("last_used_at", usedAt).Error; err != nil {
+		return fmt.Errorf("touch api key: %w", err)
+	}
+	return nil
+}
+
+// CreateOAuthClient persists a new OAuth client.
+func (r *Repository) CreateOAuthClient(client *OAuthClient) error {
+	if err := r.db.Create(client).Error; err != nil {
+		return fmt.Errorf("create oauth client: %w", err)
+	}
+	return nil
+}
+
+// ListOAuthClients returns the non-revoked OAuth clients of the account, newest first.
+func (r *Repository) ListOAuthClients(accountID string) ([]OAuthClient, error) {
+	var clients []OAuthClient
+	if err := r.db.
+		Where("account_id = ? AND revoked_at IS NULL", accountID).
+		Order("created_at DESC").
+		Find(&clients).Error; err != nil {
+		return nil, fmt.Errorf("list oauth clients: %w", err)
+	}
+	return clients, nil
+}
+
+// GetOAuthClient returns a non-revoked OAuth client by its client ID.
+// Returns ErrOAuthClientNotFound when no active client matches.
+func (r *Repository) GetOAuthClient(clientID string) (*OAuthClient, error) {
+	var client OAuthClient
+	if err := r.db.First(&client, "id = ? AND revoked_at IS NULL", clientID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOAuthClientNotFound
+		}
+		return nil, fmt.Errorf("get oauth client: %w", err)
+	}
+	return &client, nil
+}
+
+// RevokeOAuthClient marks a client of the account as revoked.
+// Returns ErrOAuthClientNotFound when the client does not exist, belongs to another account or is already revoked.
+func (r *Repository) RevokeOAuthClient(accountID, clientID string) error {
+	result := r.db.Model(&OAuthClient{}).
+		Where("id = ? AND account_id = ? AND revoked_at IS NULL", clientID, accountID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("revoke oauth client: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrOAuthClientNotFound
+	}
+	return nil
+}
+
+// CreateInvitation persists a new invitation and revokes the pending invitations of the account to the same
+// email in the same transaction, so only the latest link works.
+func (r *Repository) CreateInvitation(invitation *AccountInvitation) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&AccountInvitation{}).
+			Where("account_id = ? AND email = ? AND accepted_at IS NULL AND declined_at IS NULL AND revoked_at IS NULL",
+				invitation.AccountID, invitation.Email).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("revoke previous invitations: %w", err)
+		}
+		if err := tx.Create(invitation).Error; err != nil {
+			return fmt.Errorf("create invitation: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListPendingInvitations returns the invitations of the account that can still be accepted, newest first.
+func (r *Repository) ListPendingInvitations(accountID string, now time.Time) ([]AccountInvitation, error) {
+	var invitations []AccountInvitation
+	if err := r.db.
+		Where("account_id = ? AND accepted_at IS NULL AND declined_at IS NULL AND revoked_at IS NULL AND expires_at > ?", accountID, now).
+		Order("created_at DESC").
+		Find(&invitations).Error; err != nil {
+		return nil, fmt.Errorf("list invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+// GetInvitationByTokenHash returns an invitation by the SHA-256 hash of its raw token.
+// Returns ErrInvitationNotFound when no invitation matches.
+func (r *Repository) GetInvitationByTokenHash(tokenHash string) (*AccountInvitation, error) {
+	var invitation AccountInvitation
+	if err := r.db.First(&invitation, "token_hash = ?", tokenHash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, fmt.Errorf("get invitation by token hash: %w", err)
+	}
+	return &invitation, nil
+}
+
+// RevokeInvitation marks a pending invitation of the account as revoked.
+// Returns ErrInvitationNotFound when the invitation does not exist, belongs to another account or is no longer pending.
+func (r *Repository) RevokeInvitation(accountID, invitationID string) error {
+	result := r.db.Model(&AccountInvitation{}).
+		Where("id = ? AND account_id = ? AND accepted_at IS NULL AND declined_at IS NULL AND revoked_at IS NULL", invitationID, accountID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("revoke invitation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// AcceptInvitation marks the invitation accepted and creates the membership in one transaction.
+// Returns ErrInvitationNotFound when the invitation was used concurrently.
+func (r *Repository) AcceptInvitation(invitationID string, member *AccountMember) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&AccountInvitation{}).
+			Where("id = ? AND accepted_at IS NULL AND declined_at IS NULL AND revoked_at IS NULL", invitationID).
+			Update("accepted_at", time.Now())
+		if result.Error != nil {
+			return fmt.Errorf("accept invitation: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvitationNotFound
+		}
+		if err := tx.Create(member).Error; err != nil {
+			return fmt.Errorf("create account member: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeclineInvitation marks a pending invitation as declined.
+// Returns ErrInvitationNotFound when the invitation is no longer pending.
+func (r *Repository) DeclineInvitation(invitationID string) error {
+	result := r.db.Model(&AccountInvitation{}).
+		Where("id = ? AND accepted_at IS NULL AND declined_at IS NULL AND revoked_at IS NULL", invitationID).
+		Update("declined_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("decline invitation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
@@ -4,8 +4,27 @@ import (
 	"github.com/gofiber/fiber/v3"
 )
 
-// Routes mounts account routes on the given router.
-func Routes(router fiber.Router, h *Handler, authMiddleware fiber.Handler) {
+// Routes mounts account routes on the given router. recentAuthMiddleware guards the routes that mint
+// long-lived credentials or change who belongs to the account, so a stolen access token is not enough for them.
+func Routes(router fiber.Router, h *Handler, authMiddleware, recentAuthMiddleware fiber.Handler) {
 	router.Post("/accounts", authMiddleware, h.CreateAccount)
 	router.Post("/accounts/active", authMiddleware, h.SetActiveAccount)
+
+	router.Post("/accounts/:id/api-keys", authMiddleware, recentAuthMiddleware, h.CreateAPIKey)
+	router.Get("/accounts/:id/api-keys", authMiddleware, h.ListAPIKeys)
+	router.Delete("/accounts/:id/api-keys/:keyID", authMiddleware, h.RevokeAPIKey)
+
+	router.Post("/accounts/:id/oauth-clients", authMiddleware, recentAuthMiddleware, h.CreateOAuthClient)
+	router.Get("/accounts/:id/oauth-clients", authMiddleware, h.ListOAuthClients)
+	router.Delete("/accounts/:id/oauth-clients/:clientID", authMiddleware, h.RevokeOAuthClient)
+
+	router.Get("/accounts/:id/members", authMiddleware, h.ListMembers)
+	router.Patch("/accounts/:id/members/:userID", authMiddleware, recentAuthMiddleware, h.UpdateMemberRole)
+	router.Delete("/accounts/:id/members/:userID", authMiddleware, recentAuthMiddleware, h.RemoveMember)
+
+	router.Post("/accounts/:id/invitations", authMiddleware, recentAuthMiddleware, h.CreateInvitation)
+	router.Get("/accounts/:id/invitations", authMiddleware, h.ListInvitations)
+	router.Delete("/accounts/:id/invitations/:invitationID", authMiddleware, h.RevokeInvitation)
+	router.Post("/invitations/accept", authMiddleware, h.AcceptInvitation)
+	router.Post("/invitations/decline", h.DeclineInvitation)
 }
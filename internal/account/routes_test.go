@@ -0,0 +1,52 @@
+package account
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRoutesRequireRecentAuth checks that the routes minting credentials or changing the membership go through
+// the recent authentication middleware, while reads do not.
+func TestRoutesRequireRecentAuth(t *testing.T) {
+	handler, _ := setupHandlerTest(t)
+	owner := seedVerifiedUserForHandler(t, "Tess", "tess@example.com")
+	acc, _, err := handler.service.CreateAccount("Tess Org", "", owner.ID)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	authenticated := func(c fiber.Ctx) error {
+		c.Locals("userID", owner.ID)
+		return c.Next()
+	}
+	notRecent := func(c fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+	Routes(app, handler, authenticated, notRecent)
+
+	base := "/accounts/" + acc.ID
+	cases := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"POST", base + "/api-keys", fiber.StatusForbidden},
+		{"POST", base + "/oauth-clients", fiber.StatusForbidden},
+		{"PATCH", base + "/members/" + owner.ID, fiber.StatusForbidden},
+		{"DELETE", base + "/members/" + owner.ID, fiber.StatusForbidden},
+		{"POST", base + "/invitations", fiber.StatusForbidden},
+		{"GET", base + "/api-keys", fiber.StatusOK},
+		{"GET", base + "/members", fiber.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(tc.method, tc.path, nil), fiber.TestConfig{Timeout: 0})
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tc.status, resp.StatusCode)
+		})
+	}
+}
@@ -1,10 +1,19 @@
 package account
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/url"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/cloudflax/api.cloudflax/internal/shared/verificationnotify"
 	"github.com/cloudflax/api.cloudflax/internal/user"
 	"github.com/google/uuid"
 )
@@ -12,13 +21,22 @@ import (
 // UserRepository is the subset of the user repository the account service depends on.
 type UserRepository interface {
 	GetUser(id string) (*user.User, error)
+	GetUserByEmail(email string) (*user.User, error)
 	Update(user *user.User) error
 }
 
+// MemberTokenRevoker rejects the access tokens that still claim a user's previous role in an account.
+type MemberTokenRevoker interface {
+	RevokeAccountMemberTokens(accountID, userID string, role RoleType) error
+}
+
 // Service handles account business logic.
 type Service struct {
-	repository     *Repository
-	userRepository UserRepository
+	repository         *Repository
+	userRepository     UserRepository
+	invitationNotifier verificationnotify.AccountInvitationNotifier
+	frontendURL        string
+	memberTokenRevoker MemberTokenRevoker
 }
 
 // NewService creates a new account service.
@@ -26,6 +44,20 @@ func NewService(repository *Repository, userRepository UserRepository) *Service
 	return &Service{repository: repository, userRepository: userRepository}
 }
 
+// WithInvitationNotifier emails invitations with a link to {frontendURL}/invitations/accept.
+// Without it invitations are stored but no email is sent.
+func (s *Service) WithInvitationNotifier(notifier verificationnotify.AccountInvitationNotifier, frontendURL string) *Service {
+	s.invitationNotifier = notifier
+	s.frontendURL = strings.TrimRight(frontendURL, "/")
+	return s
+}
+
+// WithMemberTokenRevoker revokes the tokens that claim the old role whenever a membership is removed or its role changes.
+func (s *Service) WithMemberTokenRevoker(revoker MemberTokenRevoker) *Service {
+	s.memberTokenRevoker = revoker
+	return s
+}
+
 // ListAccountsForUser returns all accounts where the given user is a member.
 // Returns user.ErrNotFound when the user ID is not a valid UUID.
 func (s *Service) ListAccountsForUser(userID string) ([]Account, error) {
@@ -118,6 +150,450 @@ func (s *Service) SetActiveAccountForUser(userID, accountID string) (*user.User,
 	return u, nil
 }
 
+// ListMembers returns the memberships of the account. Any member may list them.
+func (s *Service) ListMembers(accountID, userID string) ([]AccountMember, error) {
+	if _, err := uuid.Parse(accountID); err != nil {
+		return nil, ErrNotFound
+	}
+	if _, err := s.repository.GetMember(accountID, userID); err != nil {
+		return nil, err
+	}
+	return s.repository.ListMembers(accountID)
+}
+
+// UpdateMemberRole changes the role of a member to admin or member and revokes the tokens that still claim
+// the old role. Only owners and admins may call it; returns ErrAccountMemberNotFound when the target is not a
+// member and ErrOwnerMembership when the target is the owner.
+func (s *Service) UpdateMemberRole(accountID, userID, memberUserID string, role RoleType) (*AccountMember, error) {
+	member, err := s.managedMember(accountID, userID, memberUserID)
+	if err != nil {
+		return nil, err
+	}
+	if member.Role == role {
+		return member, nil
+	}
+	if err := s.repository.UpdateMemberRole(accountID, memberUserID, role); err != nil {
+		return nil, err
+	}
+	if err := s.revokeMemberTokens(accountID, memberUserID, member.Role); err != nil {
+		return nil, err
+	}
+	member.Role = role
+	return member, nil
+}
+
+// RemoveMember removes a member from the account and revokes the tokens that still claim the membership.
+// Same access rules as UpdateMemberRole.
+func (s *Service) RemoveMember(accountID, userID, memberUserID string) error {
+	member, err := s.managedMember(accountID, userID, memberUserID)
+	if err != nil {
+		return err
+	}
+	if err := s.repository.DeleteMember(accountID, memberUserID); err != nil {
+		return err
+	}
+	return s.revokeMemberTokens(accountID, memberUserID, member.Role)
+}
+
+// managedMember checks that userID may manage the account and returns the membership of memberUserID,
+// which must exist and not be the owner's.
+func (s *Service) managedMember(accountID, userID, memberUserID string) (*AccountMember, error) {
+	if err := s.requireAccountAdmin(accountID, userID); err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(memberUserID); err != nil {
+		return nil, ErrAccountMemberNotFound
+	}
+	member, err := s.repository.GetMember(accountID, memberUserID)
+	if err != nil {
+		if errors.Is(err, ErrMemberNotFound) {
+			return nil, ErrAccountMemberNotFound
+		}
+		return nil, err
+	}
+	if member.Role == RoleOwner {
+		return nil, ErrOwnerMembership
+	}
+	return member, nil
+}
+
+// revokeMemberTokens denylists the tokens claiming role in the account; it is a no-op without a revoker.
+func (s *Service) revokeMemberTokens(accountID, userID string, role RoleType) error {
+	if s.memberTokenRevoker == nil {
+		return nil
+	}
+	if err := s.memberTokenRevoker.RevokeAccountMemberTokens(accountID, userID, role); err != nil {
+		return fmt.Errorf("revoke member tokens: %w", err)
+	}
+	return nil
+}
+
+const (
+	// apiKeyBytes is the entropy of the secret part of an API key.
+	apiKeyBytes = 32
+	// apiKeyVisibleLength is how much of the key (prefix included) is stored in clear to recognise it.
+	apiKeyVisibleLength = len(APIKeyPrefix) + 8
+	// apiKeyTouchInterval limits last_used_at writes for keys used on every request.
+	apiKeyTouchInterval = time.Minute
+)
+
+// CreateAPIKey issues a new API key for the account and returns it with the raw key, which is shown only once.
+// Only owners and admins may manage keys: returns ErrMemberNotFound for non-members, ErrInsufficientRole
+// for plain members and ErrAPIKeyExpiryInPast when expiresAt already passed.
+func (s *Service) CreateAPIKey(accountID, userID, name string, scopes []string, expiresAt *time.Time) (*APIKey, string, error) {
+	if err := s.requireAccountAdmin(accountID, userID); err != nil {
+		return nil, "", err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", ErrAPIKeyExpiryInPast
+	}
+
+	raw, err := generateAPIKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("generate api key: %w", err)
+	}
+	key := &APIKey{
+		AccountID:       accountID,
+		CreatedByUserID: userID,
+		Name:            name,
+		Prefix:          raw[:apiKeyVisibleLength],
+		KeyHash:         hashToken(raw),
+		Scopes:          scopes,
+		ExpiresAt:       expiresAt,
+	}
+	if err := s.repository.CreateAPIKey(key); err != nil {
+		return nil, "", err
+	}
+	return key, raw, nil
+}
+
+// ListAPIKeys returns the non-revoked API keys of the account. Only owners and admins may call it.
+func (s *Service) ListAPIKeys(accountID, userID string) ([]APIKey, error) {
+	if err := s.requireAccountAdmin(accountID, userID); err != nil {
+		return nil, err
+	}
+	return s.repository.ListAPIKeys(accountID)
+}
+
+// RevokeAPIKey revokes one API key of the account. Only owners and admins may call it;
+// returns ErrAPIKeyNotFound when the key is unknown, of another account or already revoked.
+func (s *Service) RevokeAPIKey(accountID, userID, keyID string) error {
+	if err := s.requireAccountAdmin(accountID, userID); err != nil {
+		return err
+	}
+	if _, err := uuid.Parse(keyID); err != nil {
+		return ErrAPIKeyNotFound
+	}
+	return s.repository.RevokeAPIKey(accountID, keyID)
+}
+
+// AuthenticateAPIKey resolves a raw "cfx_" key presented by a machine client and records its use.
+// Returns ErrAPIKeyInvalid when the key is unknown, revoked or expired.
+func (s *Service) AuthenticateAPIKey(rawKey string) (*APIKey, error) {
+	if !strings.HasPrefix(rawKey, APIKeyPrefix) {
+		return nil, ErrAPIKeyInvalid
+	}
+	key, err := s.repository.GetAPIKeyByHash(hashToken(rawKey))
+	if err != nil {
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			return nil, ErrAPIKeyInvalid
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if !key.IsActive(now) {
+		return nil, ErrAPIKeyInvalid
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.repository.TouchAPIKey(key.ID, now); err != nil {
+			return nil, err
+		}
+		key.LastUsedAt = &now
+	}
+	return key, nil
+}
+
+// oauthClientSecretBytes is the entropy of a confidential client secret.
+const oauthClientSecretBytes = 32
+
+// CreateOAuthClient registers a third-party application for the account and returns it with its secret,
+// which is shown only once and is empty for public clients. Only owners and admins may call it; returns
+// ErrInvalidRedirectURI when a redirect URI is not an absolute https URL (or http on a loopback host).
+func (s *Service) CreateOAuthClient(accountID, userID, name string, redirectURIs, scopes []string, public bool) (*OAuthClient, string, error) {
+	if err := s.requireAccountAdmin(accountID, userID); err != nil {
+		return nil, "", err
+	}
+	for _, uri := range redirectURIs {
+		if !validRedirectURI(uri) {
+			return nil, "", ErrInvalidRedirectURI
+		}
+	}
+
+	client := &OAuthClient{
+		AccountID:       accountID,
+		CreatedByUserID: userID,
+		Name:            name,
+		RedirectURIs:    redirectURIs,
+		Scopes:          scopes,
+		Confidential:    !public,
+	}
+	var secret string
+	if client.Confidential {
+		b := make([]byte, oauthClientSecretBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, "", fmt.Errorf("generate client secret: %w", err)
+		}
+		secret = hex.EncodeToString(b)
+		client.SecretHash = hashToken(secret)
+	}
+	if err := s.repository.CreateOAuthClient(client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// ListOAuthClients returns the active OAuth clients of the account. Only owners and admins may call it.
+func (s *Service) ListOAuthClients(accountID, userID string) ([]OAuthClient, error) {
+	if err := s.requireAccountAdmin(accountID, userID); err != nil {
+		return nil, err
+	}
+	return s.repository.ListOAuthClients(accountID)
+}
+
+// RevokeOAuthClient revokes one OAuth client of the account: it can no longer obtain or refresh tokens.
+// Only owners and admins may call it; returns ErrOAuthClientNotFound when the client is unknown, of another
+// account or already revoked.
+func (s *Service) RevokeOAuthClient(accountID, userID, clientID string) error {
+	if err := s.requireAccountAdmin(accountID, userID); err != nil {
+		return err
+	}
+	if _, err := uuid.Parse(clientID); err != nil {
+		return ErrOAuthClientNotFound
+	}
+	return s.repository.RevokeOAuthClient(accountID, clientID)
+}
+
+// GetOAuthClient resolves an active OAuth client by client ID for the authorization and token endpoints.
+// Returns ErrOAuthClientNotFound when the client is unknown or revoked.
+func (s *Service) GetOAuthClient(clientID string) (*OAuthClient, error) {
+	if _, err := uuid.Parse(clientID); err != nil {
+		return nil, ErrOAuthClientNotFound
+	}
+	return s.repository.GetOAuthClient(clientID)
+}
+
+const (
+	// invitationTTL is how long an invitation link can be used.
+	invitationTTL = 7 * 24 * time.Hour
+	// invitationTokenBytes is the entropy of an invitation token.
+	invitationTokenBytes = 32
+)
+
+// CreateInvitation invites email to join the account with role (admin or member), emails the link and returns
+// the invitation with its raw token, which is only sent by email. A new invitation replaces the pending ones to
+// the same email. Only owners and admins may call it; returns ErrAlreadyMember when a user with that email
+// already belongs to the account.
+func (s *Service) CreateInvitation(accountID, inviterID, email string, role RoleType) (*AccountInvitation, string, error) {
+	if err := s.requireAccountAdmin(accountID, inviterID); err != nil {
+		return nil, "", err
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	invitee, err := s.userRepository.GetUserByEmail(email)
+	switch {
+	case err == nil:
+		if _, err := s.repository.GetMember(accountID, invitee.ID); err == nil {
+			return nil, "", ErrAlreadyMember
+		} else if !errors.Is(err, ErrMemberNotFound) {
+			return nil, "", err
+		}
+	case !errors.Is(err, user.ErrNotFound):
+		return nil, "", fmt.Errorf("lookup invitee: %w", err)
+	}
+
+	b := make([]byte, invitationTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", fmt.Errorf("generate invitation token: %w", err)
+	}
+	raw := hex.EncodeToString(b)
+	invitation := &AccountInvitation{
+		AccountID:       accountID,
+		Email:           email,
+		Role:            role,
+		TokenHash:       hashToken(raw),
+		InvitedByUserID: inviterID,
+		ExpiresAt:       time.Now().Add(invitationTTL),
+	}
+	if err := s.repository.CreateInvitation(invitation); err != nil {
+		return nil, "", err
+	}
+
+	if err := s.sendInvitationEmail(context.Background(), invitation, raw); err != nil {
+		slog.Error("send account invitation email", "account_id", accountID, "invitation_id", invitation.ID, "error", err)
+	}
+	return invitation, raw, nil
+}
+
+// ListInvitations returns the pending invitations of the account. Only owners and admins may call it.
+func (s *Service) ListInvitations(accountID, userID string) ([]AccountInvitation, error) {
+	if err := s.requireAccountAdmin(accountID, userID); err != nil {
+		return nil, err
+	}
+	return s.repository.ListPendingInvitations(accountID, time.Now())
+}
+
+// RevokeInvitation cancels a pending invitation of the account so its link stops working. Same access rules
+// as CreateAPIKey; returns ErrInvitationNotFound when the invitation is unknown, of another account or no longer pending.
+func (s *Service) RevokeInvitation(accountID, userID, invitationID string) error {
+	if err := s.requireAccountAdmin(accountID, userID); err != nil {
+		return err
+	}
+	if _, err := uuid.Parse(invitationID); err != nil {
+		return ErrInvitationNotFound
+	}
+	return s.repository.RevokeInvitation(accountID, invitationID)
+}
+
+// GetPendingInvitation resolves the raw token of an invitation link.
+// Returns ErrInvitationNotFound when the token is unknown, expired or already used.
+func (s *Service) GetPendingInvitation(rawToken string) (*AccountInvitation, error) {
+	if rawToken == "" {
+		return nil, ErrInvitationNotFound
+	}
+	invitation, err := s.repository.GetInvitationByTokenHash(hashToken(rawToken))
+	if err != nil {
+		return nil, err
+	}
+	if !invitation.IsPending(time.Now()) {
+		return nil, ErrInvitationNotFound
+	}
+	return invitation, nil
+}
+
+// AcceptInvitation adds the user to the invited account with the invited role and, when the user has no
+// active account yet, makes it the active one. The user's email must be the invited one. Returns
+// ErrInvitationNotFound for unusable tokens, ErrInvitationEmailMismatch when the emails differ and
+// ErrAlreadyMember when the user already belongs to the account.
+func (s *Service) AcceptInvitation(rawToken, userID string) (*AccountMember, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, user.ErrNotFound
+	}
+	invitation, err := s.GetPendingInvitation(rawToken)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.userRepository.GetUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("lookup user: %w", err)
+	}
+	if !strings.EqualFold(u.Email, invitation.Email) {
+		return nil, ErrInvitationEmailMismatch
+	}
+	if _, err := s.repository.GetMember(invitation.AccountID, userID); err == nil {
+		return nil, ErrAlreadyMember
+	} else if !errors.Is(err, ErrMemberNotFound) {
+		return nil, err
+	}
+
+	member := &AccountMember{
+		AccountID: invitation.AccountID,
+		UserID:    userID,
+		Role:      invitation.Role,
+	}
+	if err := s.repository.AcceptInvitation(invitation.ID, member); err != nil {
+		return nil, err
+	}
+
+	if u.ActiveAccountID == nil {
+		accountID := invitation.AccountID
+		u.ActiveAccountID = &accountID
+		if err := s.userRepository.Update(u); err != nil {
+			return nil, fmt.Errorf("set active account for invitee: %w", err)
+		}
+	}
+	return member, nil
+}
+
+// DeclineInvitation turns down an invitation; the token is the only credential, so it works without signing in.
+// Returns ErrInvitationNotFound when the token is unknown, expired or already used.
+func (s *Service) DeclineInvitation(rawToken string) error {
+	invitation, err := s.GetPendingInvitation(rawToken)
+	if err != nil {
+		return err
+	}
+	return s.repository.DeclineInvitation(invitation.ID)
+}
+
+// sendInvitationEmail sends the invitation link naming the inviter and the account; it is a no-op without a notifier.
+func (s *Service) sendInvitationEmail(ctx context.Context, invitation *AccountInvitation, rawToken string) error {
+	if s.invitationNotifier == nil {
+		return nil
+	}
+	if s.frontendURL == "" {
+		return fmt.Errorf("frontend URL is required to build invitation link")
+	}
+	account, err := s.repository.GetByID(invitation.AccountID)
+	if err != nil {
+		return err
+	}
+	inviter, err := s.userRepository.GetUser(invitation.InvitedByUserID)
+	if err != nil {
+		return fmt.Errorf("lookup inviter: %w", err)
+	}
+	link := fmt.Sprintf("%s/invitations/accept?token=%s", s.frontendURL, rawToken)
+	return s.invitationNotifier.NotifyAccountInvitation(ctx, invitation.Email, inviter.Name, account.Name, link)
+}
+
+// validRedirectURI accepts absolute https URLs without fragment, and http for loopback hosts (native apps).
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return false
+	}
+}
+
+// requireAccountAdmin checks that the user is an owner or admin of the account: returns ErrNotFound for a malformed
+// account ID, ErrMemberNotFound for non-members and ErrInsufficientRole for plain members.
+func (s *Service) requireAccountAdmin(accountID, userID string) error {
+	if _, err := uuid.Parse(accountID); err != nil {
+		return ErrNotFound
+	}
+	member, err := s.repository.GetMember(accountID, userID)
+	if err != nil {
+		return err
+	}
+	if member.Role != RoleOwner && member.Role != RoleAdmin {
+		return ErrInsufficientRole
+	}
+	return nil
+}
+
+// generateAPIKey returns a new raw key: the cfx_ prefix followed by random hex.
+func generateAPIKey() (string, error) {
+	b := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return APIKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// hashToken returns the hex SHA-256 of a raw secret (API key, OAuth client secret or invitation token), the only
+// form that is stored.
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
 var (
 	nonAlphanumDash = regexp.MustCompile(`[^a-z0-9-]+`)
 	multipleDashes  = regexp.MustCompile(`-{2,}`)
@@ -1,6 +1,8 @@
 package account
 
 import (
+	"context"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,7 +15,7 @@ import (
 func setupServiceTest(t *testing.T) *Service {
 	t.Helper()
 	require.NoError(t, database.InitForTesting())
-	require.NoError(t, database.RunMigrations(&user.User{}, &Account{}, &AccountMember{}))
+	require.NoError(t, database.RunMigrations(&user.User{}, &Account{}, &AccountMember{}, &APIKey{}, &OAuthClient{}, &AccountInvitation{}))
 
 	userRepository := user.NewRepository(database.DB)
 	accountRepository := NewRepository(database.DB)
@@ -164,3 +166,264 @@ func TestService_CreateAccount_InvalidUserID(t *testing.T) {
 	_, _, err := service.CreateAccount("Bad", "", "not-a-uuid")
 	assert.Error(t, err)
 }
+
+func TestService_APIKey_CreateAndAuthenticate(t *testing.T) {
+	svc := setupServiceTest(t)
+	owner := seedVerifiedUser(t, "Nora", "nora@example.com")
+	acc, _, err := svc.CreateAccount("Nora Org", "", owner.ID)
+	require.NoError(t, err)
+
+	key, raw, err := svc.CreateAPIKey(acc.ID, owner.ID, "ERP sync", []string{APIKeyScopeInvoicesRead}, nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(raw, APIKeyPrefix))
+	assert.Equal(t, raw[:len(key.Prefix)], key.Prefix)
+	assert.NotContains(t, key.KeyHash, raw)
+
+	authenticated, err := svc.AuthenticateAPIKey(raw)
+	require.NoError(t, err)
+	assert.Equal(t, acc.ID, authenticated.AccountID)
+	assert.Equal(t, []string{APIKeyScopeInvoicesRead}, authenticated.Scopes)
+	require.NotNil(t, authenticated.LastUsedAt)
+
+	_, err = svc.AuthenticateAPIKey(raw + "x")
+	assert.ErrorIs(t, err, ErrAPIKeyInvalid)
+
+	require.NoError(t, svc.RevokeAPIKey(acc.ID, owner.ID, key.ID))
+	_, err = svc.AuthenticateAPIKey(raw)
+	assert.ErrorIs(t, err, ErrAPIKeyInvalid)
+	assert.ErrorIs(t, svc.RevokeAPIKey(acc.ID, owner.ID, key.ID), ErrAPIKeyNotFound)
+}
+
+func TestService_APIKey_Expired(t *testing.T) {
+	svc := setupServiceTest(t)
+	owner := seedVerifiedUser(t, "Nora", "nora@example.com")
+	acc, _, err := svc.CreateAccount("Nora Org", "", owner.ID)
+	require.NoError(t, err)
+
+	past := time.Now().Add(-time.Minute)
+	_, _, err = svc.CreateAPIKey(acc.ID, owner.ID, "CI", nil, &past)
+	assert.ErrorIs(t, err, ErrAPIKeyExpiryInPast)
+
+	future := time.Now().Add(time.Hour)
+	key, raw, err := svc.CreateAPIKey(acc.ID, owner.ID, "CI", nil, &future)
+	require.NoError(t, err)
+	require.NoError(t, database.DB.Model(&APIKey{}).Where("id = ?", key.ID).Update("expires_at", past).Error)
+
+	_, err = svc.AuthenticateAPIKey(raw)
+	assert.ErrorIs(t, err, ErrAPIKeyInvalid)
+}
+
+func TestService_APIKey_RequiresOwnerOrAdmin(t *testing.T) {
+	svc := setupServiceTest(t)
+	owner := seedVerifiedUser(t, "Nora", "nora@example.com")
+	member := seedVerifiedUser(t, "Omar", "omar@example.com")
+	outsider := seedVerifiedUser(t, "Pia", "pia@example.com")
+	acc, _, err := svc.CreateAccount("Nora Org", "", owner.ID)
+	require.NoError(t, err)
+	require.NoError(t, svc.repository.CreateMember(&AccountMember{AccountID: acc.ID, UserID: member.ID, Role: RoleMember}))
+
+	_, _, err = svc.CreateAPIKey(acc.ID, member.ID, "CI", nil, nil)
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+	_, err = svc.ListAPIKeys(acc.ID, outsider.ID)
+	assert.ErrorIs(t, err, ErrMemberNotFound)
+	_, err = svc.ListAPIKeys("not-a-uuid", owner.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestService_OAuthClient_CreateLookupRevoke(t *testing.T) {
+	svc := setupServiceTest(t)
+	owner := seedVerifiedUser(t, "Nora", "nora@example.com")
+	acc, _, err := svc.CreateAccount("Nora Org", "", owner.ID)
+	require.NoError(t, err)
+	scopes := []string{OAuthScopeOpenID, APIKeyScopeInvoicesRead}
+
+	client, secret, err := svc.CreateOAuthClient(acc.ID, owner.ID, "Partner", []string{"https://partner.example/cb"}, scopes, false)
+	require.NoError(t, err)
+	assert.True(t, client.Confidential)
+	assert.True(t, client.CheckSecret(secret))
+	assert.False(t, client.CheckSecret(secret+"x"))
+	assert.NotContains(t, client.SecretHash, secret)
+
+	public, publicSecret, err := svc.CreateOAuthClient(acc.ID, owner.ID, "Mobile", []string{"http://127.0.0.1:8080/cb"}, scopes, true)
+	require.NoError(t, err)
+	assert.Empty(t, publicSecret)
+	assert.False(t, public.CheckSecret(""))
+
+	for _, uri := range []string{"http://partner.example/cb", "https://partner.example/cb#frag", "partner.example/cb"} {
+		_, _, err = svc.CreateOAuthClient(acc.ID, owner.ID, "Bad", []string{uri}, scopes, false)
+		assert.ErrorIs(t, err, ErrInvalidRedirectURI, uri)
+	}
+
+	found, err := svc.GetOAuthClient(client.ID)
+	require.NoError(t, err)
+	assert.True(t, found.AllowsRedirectURI("https://partner.example/cb"))
+	assert.False(t, found.AllowsRedirectURI("https://partner.example/cb/"))
+	assert.True(t, found.AllowsScope(APIKeyScopeInvoicesRead))
+	assert.False(t, found.AllowsScope(APIKeyScopeInvoicesWrite))
+	_, err = svc.GetOAuthClient("not-a-uuid")
+	assert.ErrorIs(t, err, ErrOAuthClientNotFound)
+
+	clients, err := svc.ListOAuthClients(acc.ID, owner.ID)
+	require.NoError(t, err)
+	assert.Len(t, clients, 2)
+
+	require.NoError(t, svc.RevokeOAuthClient(acc.ID, owner.ID, client.ID))
+	_, err = svc.GetOAuthClient(client.ID)
+	assert.ErrorIs(t, err, ErrOAuthClientNotFound)
+	assert.ErrorIs(t, svc.RevokeOAuthClient(acc.ID, owner.ID, client.ID), ErrOAuthClientNotFound)
+}
+
+// recordingInvitationNotifier keeps the last invitation email instead of sending it.
+type recordingInvitationNotifier struct {
+	toEmail, inviterName, accountName, link string
+}
+
+func (n *recordingInvitationNotifier) NotifyAccountInvitation(_ context.Context, toEmail, inviterName, accountName, link string) error {
+	n.toEmail, n.inviterName, n.accountName, n.link = toEmail, inviterName, accountName, link
+	return nil
+}
+
+func TestService_Invitation_CreateAndAccept(t *testing.T) {
+	notifier := &recordingInvitationNotifier{}
+	svc := setupServiceTest(t).WithInvitationNotifier(notifier, "https://app.example/")
+	owner := seedVerifiedUser(t, "Nora", "nora@example.com")
+	invitee := seedVerifiedUser(t, "Omar", "omar@example.com")
+	acc, _, err := svc.CreateAccount("Nora Org", "", owner.ID)
+	require.NoError(t, err)
+
+	invitation, raw, err := svc.CreateInvitation(acc.ID, owner.ID, " Omar@Example.com ", RoleAdmin)
+	require.NoError(t, err)
+	assert.Equal(t, "omar@example.com", invitation.Email)
+	assert.Equal(t, owner.ID, invitation.InvitedByUserID)
+	assert.NotContains(t, invitation.TokenHash, raw)
+	assert.Equal(t, "omar@example.com", notifier.toEmail)
+	assert.Equal(t, "Nora", notifier.inviterName)
+	assert.Equal(t, "Nora Org", notifier.accountName)
+	assert.Equal(t, "https://app.example/invitations/accept?token="+raw, notifier.link)
+
+	pending, err := svc.ListInvitations(acc.ID, owner.ID)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+
+	member, err := svc.AcceptInvitation(raw, invitee.ID)
+	require.NoError(t, err)
+	assert.Equal(t, acc.ID, member.AccountID)
+	assert.Equal(t, RoleAdmin, member.Role)
+
+	updated, err := svc.userRepository.GetUser(invitee.ID)
+	require.NoError(t, err)
+	require.NotNil(t, updated.ActiveAccountID)
+	assert.Equal(t, acc.ID, *updated.ActiveAccountID)
+
+	_, err = svc.AcceptInvitation(raw, invitee.ID)
+	assert.ErrorIs(t, err, ErrInvitationNotFound)
+	pending, err = svc.ListInvitations(acc.ID, owner.ID)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	_, _, err = svc.CreateInvitation(acc.ID, owner.ID, "omar@example.com", RoleMember)
+	assert.ErrorIs(t, err, ErrAlreadyMember)
+}
+
+func TestService_Invitation_Rules(t *testing.T) {
+	svc := setupServiceTest(t)
+	owner := seedVerifiedUser(t, "Nora", "nora@example.com")
+	member := seedVerifiedUser(t, "Omar", "omar@example.com")
+	other := seedVerifiedUser(t, "Pia", "pia@example.com")
+	acc, _, err := svc.CreateAccount("Nora Org", "", owner.ID)
+	require.NoError(t, err)
+	require.NoError(t, svc.repository.CreateMember(&AccountMember{AccountID: acc.ID, UserID: member.ID, Role: RoleMember}))
+
+	_, _, err = svc.CreateInvitation(acc.ID, member.ID, "new@example.com", RoleMember)
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+
+	_, first, err := svc.CreateInvitation(acc.ID, owner.ID, "new@example.com", RoleMember)
+	require.NoError(t, err)
+	_, second, err := svc.CreateInvitation(acc.ID, owner.ID, "new@example.com", RoleMember)
+	require.NoError(t, err)
+	_, err = svc.GetPendingInvitation(first)
+	assert.ErrorIs(t, err, ErrInvitationNotFound, "a new invitation replaces the previous one")
+
+	_, err = svc.AcceptInvitation(second, other.ID)
+	assert.ErrorIs(t, err, ErrInvitationEmailMismatch)
+
+	require.NoError(t, svc.DeclineInvitation(second))
+	assert.ErrorIs(t, svc.DeclineInvitation(second), ErrInvitationNotFound)
+
+	invitation, expired, err := svc.CreateInvitation(acc.ID, owner.ID, "pia@example.com", RoleMember)
+	require.NoError(t, err)
+	require.NoError(t, database.DB.Model(invitation).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	_, err = svc.AcceptInvitation(expired, other.ID)
+	assert.ErrorIs(t, err, ErrInvitationNotFound)
+
+	invitation, _, err = svc.CreateInvitation(acc.ID, owner.ID, "pia@example.com", RoleMember)
+	require.NoError(t, err)
+	require.NoError(t, svc.RevokeInvitation(acc.ID, owner.ID, invitation.ID))
+	assert.ErrorIs(t, svc.RevokeInvitation(acc.ID, owner.ID, invitation.ID), ErrInvitationNotFound)
+}
+
+// recordingTokenRevoker records the memberships whose tokens were revoked.
+type recordingTokenRevoker struct {
+	revoked []string
+}
+
+func (r *recordingTokenRevoker) RevokeAccountMemberTokens(accountID, userID string, role RoleType) error {
+	r.revoked = append(r.revoked, accountID+":"+userID+":"+string(role))
+	return nil
+}
+
+func TestService_Members_RoleChangeAndRemovalRevokeTokens(t *testing.T) {
+	svc := setupServiceTest(t)
+	revoker := &recordingTokenRevoker{}
+	svc.WithMemberTokenRevoker(revoker)
+	owner := seedVerifiedUser(t, "Nora", "nora@example.com")
+	admin := seedVerifiedUser(t, "Omar", "omar@example.com")
+	member := seedVerifiedUser(t, "Pia", "pia@example.com")
+	acc, _, err := svc.CreateAccount("Nora Org", "", owner.ID)
+	require.NoError(t, err)
+	require.NoError(t, svc.repository.CreateMember(&AccountMember{AccountID: acc.ID, UserID: admin.ID, Role: RoleAdmin}))
+	require.NoError(t, svc.repository.CreateMember(&AccountMember{AccountID: acc.ID, UserID: member.ID, Role: RoleMember}))
+
+	members, err := svc.ListMembers(acc.ID, member.ID)
+	require.NoError(t, err)
+	assert.Len(t, members, 3)
+
+	updated, err := svc.UpdateMemberRole(acc.ID, owner.ID, admin.ID, RoleMember)
+	require.NoError(t, err)
+	assert.Equal(t, RoleMember, updated.Role)
+	stored, err := svc.repository.GetMember(acc.ID, admin.ID)
+	require.NoError(t, err)
+	assert.Equal(t, RoleMember, stored.Role)
+	assert.Equal(t, []string{acc.ID + ":" + admin.ID + ":admin"}, revoker.revoked, "tokens claiming the old role are revoked")
+
+	_, err = svc.UpdateMemberRole(acc.ID, owner.ID, admin.ID, RoleMember)
+	require.NoError(t, err)
+	assert.Len(t, revoker.revoked, 1, "an unchanged role revokes nothing")
+
+	require.NoError(t, svc.RemoveMember(acc.ID, owner.ID, member.ID))
+	_, err = svc.repository.GetMember(acc.ID, member.ID)
+	assert.ErrorIs(t, err, ErrMemberNotFound)
+	assert.Equal(t, acc.ID+":"+member.ID+":member", revoker.revoked[1])
+}
+
+func TestService_Members_Rules(t *testing.T) {
+	svc := setupServiceTest(t)
+	owner := seedVerifiedUser(t, "Nora", "nora@example.com")
+	admin := seedVerifiedUser(t, "Omar", "omar@example.com")
+	member := seedVerifiedUser(t, "Pia", "pia@example.com")
+	outsider := seedVerifiedUser(t, "Quin", "quin@example.com")
+	acc, _, err := svc.CreateAccount("Nora Org", "", owner.ID)
+	require.NoError(t, err)
+	require.NoError(t, svc.repository.CreateMember(&AccountMember{AccountID: acc.ID, UserID: admin.ID, Role: RoleAdmin}))
+	require.NoError(t, svc.repository.CreateMember(&AccountMember{AccountID: acc.ID, UserID: member.ID, Role: RoleMember}))
+
+	_, err = svc.UpdateMemberRole(acc.ID, member.ID, admin.ID, RoleMember)
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+	_, err = svc.UpdateMemberRole(acc.ID, admin.ID, owner.ID, RoleMember)
+	assert.ErrorIs(t, err, ErrOwnerMembership)
+	assert.ErrorIs(t, svc.RemoveMember(acc.ID, admin.ID, owner.ID), ErrOwnerMembership)
+	assert.ErrorIs(t, svc.RemoveMember(acc.ID, owner.ID, outsider.ID), ErrAccountMemberNotFound)
+	assert.ErrorIs(t, svc.RemoveMember(acc.ID, outsider.ID, member.ID), ErrMemberNotFound)
+	_, err = svc.ListMembers(acc.ID, outsider.ID)
+	assert.ErrorIs(t, err, ErrMemberNotFound)
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+// DeviceCodeGrantType is the grant_type a device sends to POST /auth/device/token (RFC 8628 section 3.4).
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+const (
+	// userCodeAlphabet has no vowels (no accidental words) and no easily confused characters, as RFC 8628 section 6.1 suggests.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// generateUserCode returns a random user code formatted as two groups of four characters (e.g. "WDJB-MJHT").
+func generateUserCode() (string, error) {
+	var builder strings.Builder
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := 0; i < userCodeLength; i++ {
+		if i == userCodeLength/2 {
+			builder.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return builder.String(), nil
+}
+
+// normalizeUserCode uppercases the code typed by the user and drops separators, so "wdjb mjht" matches "WDJB-MJHT".
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return -1
+		}
+	}, code)
+}
@@ -1,11 +1,14 @@
 package auth
 
-// En: RegisterRequest is the request body for POST /auth/register.
-// Es: Request body para POST /auth/register.
+import "time"
+
+// En: RegisterRequest is the request body for POST /auth/register. InvitationToken registers from an account invitation link.
+// Es: Request body para POST /auth/register. InvitationToken registra desde el enlace de una invitación a una cuenta.
 type RegisterRequest struct {
-	Name     string `json:"name"     validate:"required,min=2,max=100"`
-	Email    string `json:"email"    validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8,max=72"`
+	Name            string `json:"name"             validate:"required,min=2,max=100"`
+	Email           string `json:"email"            validate:"required,email"`
+	Password        string `json:"password"         validate:"required,min=8,max=72"`
+	InvitationToken string `json:"invitation_token" validate:"omitempty,max=128"`
 }
 
 // En: VerifyEmailRequest represents the query parameters for the email verification endpoint (/auth/verify-email).
@@ -14,6 +17,13 @@ type VerifyEmailRequest struct {
 	Token string `query:"token" validate:"required"`
 }
 
+// En: VerifyEmailCodeRequest represents the request body for the code-based email verification endpoint (/auth/verify-email/code).
+// Es: VerifyEmailCodeRequest representa el cuerpo de la solicitud para el endpoint de verificación por código (/auth/verify-email/code).
+type VerifyEmailCodeRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Code  string `json:"code"  validate:"required,len=6,numeric"`
+}
+
 // En: ResendVerificationRequest represents the request body for the email verification resend endpoint.
 // Es: ResendVerificationRequest representa el cuerpo de la solicitud para el endpoint de reenvío de verificación de correo electrónico.
 type ResendVerificationRequest struct {
@@ -23,8 +33,9 @@ type ResendVerificationRequest struct {
 // En: LoginRequest represents the request body for the login endpoint.
 // Es: LoginRequest representa el cuerpo de la solicitud para el endpoint de inicio de sesión.
 type LoginRequest struct {
-	Email    string `json:"email"    validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
+	Email      string `json:"email"       validate:"required,email"`
+	Password   string `json:"password"    validate:"required,min=8"`
+	DeviceName string `json:"device_name" validate:"omitempty,max=100"`
 }
 
 // En: RefreshRequest represents the request body for the refresh endpoint.
@@ -32,3 +43,202 @@ type LoginRequest struct {
 type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
 }
+
+// En: CookieTokenResponse is the token pair body in refresh cookie mode: the refresh token travels only in the
+// HttpOnly cookie, and csrf_token must be echoed in the X-CSRF-Token header of refresh and logout calls.
+// Es: CookieTokenResponse es el cuerpo del par de tokens en modo cookie: el refresh token viaja solo en la cookie
+// HttpOnly, y csrf_token debe reenviarse en el header X-CSRF-Token de las llamadas de refresh y logout.
+type CookieTokenResponse struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CSRFToken   string    `json:"csrf_token"`
+}
+
+// En: LogoutRequest represents the optional request body for the logout endpoint; scope "current" ends only the current session
+// and scope "all" also revokes OAuth client grants.
+// Es: LogoutRequest representa el cuerpo opcional de la solicitud para el endpoint de cierre de sesión; el scope "current" cierra solo
+// la sesión actual y el scope "all" también revoca las concesiones a clientes OAuth.
+type LogoutRequest struct {
+	Scope        string `json:"scope"         validate:"omitempty,oneof=all current"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// En: LogoutOtherSessionsRequest represents the optional request body for POST /auth/sessions/logout-others.
+// Es: LogoutOtherSessionsRequest representa el cuerpo opcional de la solicitud para POST /auth/sessions/logout-others.
+type LogoutOtherSessionsRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// En: ForgotPasswordRequest represents the request body for the forgot-password endpoint.
+// Es: ForgotPasswordRequest representa el cuerpo de la solicitud para el endpoint de contraseña olvidada.
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// En: ResetPasswordRequest represents the request body for the reset-password endpoint.
+// Es: ResetPasswordRequest representa el cuerpo de la solicitud para el endpoint de restablecimiento de contraseña.
+type ResetPasswordRequest struct {
+	Token    string `json:"token"    validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+// En: MagicLinkRequest represents the request body for the magic-link endpoint.
+// Es: MagicLinkRequest representa el cuerpo de la solicitud para el endpoint de magic link.
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// En: VerifyMagicLinkRequest represents the request body for the magic-link verify endpoint.
+// Es: VerifyMagicLinkRequest representa el cuerpo de la solicitud para el endpoint de verificación de magic link.
+type VerifyMagicLinkRequest struct {
+	Token      string `json:"token"       validate:"required"`
+	DeviceName string `json:"device_name" validate:"omitempty,max=100"`
+}
+
+// En: RequestEmailChangeRequest represents the request body for POST /users/me/email.
+// Es: RequestEmailChangeRequest representa el cuerpo de la solicitud para POST /users/me/email.
+type RequestEmailChangeRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// En: ConfirmEmailChangeRequest represents the request body for the confirm-email-change endpoint.
+// Es: ConfirmEmailChangeRequest representa el cuerpo de la solicitud para el endpoint de confirmación de cambio de email.
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// En: OAuthCallbackRequest represents the query parameters the provider sends back to /auth/oauth/:provider/callback.
+// Es: OAuthCallbackRequest representa los parámetros de consulta que el proveedor devuelve a /auth/oauth/:provider/callback.
+type OAuthCallbackRequest struct {
+	Code  string `query:"code"  validate:"required"`
+	State string `query:"state" validate:"required"`
+	Error string `query:"error"`
+}
+
+// En: LinkAuthProviderRequest represents the request body that completes linking a provider to the current user.
+// Es: LinkAuthProviderRequest representa el cuerpo de la solicitud que completa el enlace de un proveedor al usuario actual.
+type LinkAuthProviderRequest struct {
+	Code  string `json:"code"  validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+// En: VerifyMFARequest represents the request body for the second login step (POST /auth/login/2fa).
+// Es: VerifyMFARequest representa el cuerpo de la solicitud para el segundo paso del login (POST /auth/login/2fa).
+type VerifyMFARequest struct {
+	MFAToken   string `json:"mfa_token"   validate:"required"`
+	Code       string `json:"code"        validate:"required"`
+	DeviceName string `json:"device_name" validate:"omitempty,max=100"`
+}
+
+// En: ConfirmTwoFactorRequest represents the request body that confirms a TOTP enrollment.
+// Es: ConfirmTwoFactorRequest representa el cuerpo de la solicitud que confirma una inscripción TOTP.
+type ConfirmTwoFactorRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// En: DisableTwoFactorRequest represents the request body to disable 2FA (password re-authentication plus a code).
+// Es: DisableTwoFactorRequest representa el cuerpo de la solicitud para desactivar 2FA (reautenticación con contraseña más un código).
+type DisableTwoFactorRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"     validate:"required"`
+}
+
+// En: ReauthenticateRequest is the body of POST /auth/reauthenticate: the password, or a TOTP or recovery code when no password is given.
+// Es: ReauthenticateRequest es el cuerpo de POST /auth/reauthenticate: la contraseña, o un código TOTP o de recuperación si no se envía contraseña.
+type ReauthenticateRequest struct {
+	Password string `json:"password" validate:"required_without=Code,max=72"`
+	Code     string `json:"code"     validate:"required_without=Password,max=20"`
+}
+
+// En: SessionResponse is a session as listed by GET /auth/sessions; Current marks the session of the calling token.
+// Es: SessionResponse es una sesión tal como la lista GET /auth/sessions; Current marca la sesión del token que llama.
+type SessionResponse struct {
+	Session
+	Current bool `json:"current"`
+}
+
+// En: DeviceAuthorizationRequest is the body of POST /auth/device/code (JSON or form-encoded, RFC 8628 section 3.1).
+// Es: DeviceAuthorizationRequest es el cuerpo de POST /auth/device/code (JSON o form-encoded, RFC 8628 sección 3.1).
+type DeviceAuthorizationRequest struct {
+	ClientID string `json:"client_id" form:"client_id" validate:"max=100"`
+}
+
+// En: DeviceTokenRequest is the body of POST /auth/device/token (JSON or form-encoded, RFC 8628 section 3.4).
+// Es: DeviceTokenRequest es el cuerpo de POST /auth/device/token (JSON o form-encoded, RFC 8628 sección 3.4).
+type DeviceTokenRequest struct {
+	GrantType  string `json:"grant_type"  form:"grant_type"`
+	DeviceCode string `json:"device_code" form:"device_code"`
+}
+
+// En: DeviceTokenResponse is the RFC 6749 token response of a completed device grant: the TokenPair plus token_type and expires_in.
+// Es: DeviceTokenResponse es la respuesta de token RFC 6749 de una concesión de dispositivo completada: el TokenPair más token_type y expires_in.
+type DeviceTokenResponse struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type"`
+	ExpiresIn    int       `json:"expires_in"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// En: DeviceUserCodeRequest is the body of POST /auth/device/approve and /auth/device/deny.
+// Es: DeviceUserCodeRequest es el cuerpo de POST /auth/device/approve y /auth/device/deny.
+type DeviceUserCodeRequest struct {
+	UserCode string `json:"user_code" validate:"required,max=20"`
+}
+
+// En: OAuthAuthorizationRequest holds the authorization request parameters a third-party client sends to the consent
+// page, which forwards them to GET /oauth/authorize (query) and POST /oauth/authorize (body).
+// Es: OAuthAuthorizationRequest contiene los parámetros de la solicitud de autorización que un cliente de terceros envía
+// a la página de consentimiento, que los reenvía a GET /oauth/authorize (query) y POST /oauth/authorize (cuerpo).
+type OAuthAuthorizationRequest struct {
+	ResponseType        string `query:"response_type"         json:"response_type"`
+	ClientID            string `query:"client_id"             json:"client_id"`
+	RedirectURI         string `query:"redirect_uri"          json:"redirect_uri"`
+	Scope               string `query:"scope"                 json:"scope"`
+	State               string `query:"state"                 json:"state"`
+	CodeChallenge       string `query:"code_challenge"        json:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method" json:"code_challenge_method"`
+	Nonce               string `query:"nonce"                 json:"nonce"`
+}
+
+// En: OAuthConsentRequest is the body of POST /oauth/authorize: the authorization request plus the user's decision and,
+// optionally, the account to delegate (defaults to the active account).
+// Es: OAuthConsentRequest es el cuerpo de POST /oauth/authorize: la solicitud de autorización más la decisión del usuario y,
+// opcionalmente, la cuenta a delegar (por defecto la cuenta activa).
+type OAuthConsentRequest struct {
+	OAuthAuthorizationRequest
+	AccountID string `json:"account_id"`
+	Approve   bool   `json:"approve"`
+}
+
+// En: OAuthTokenRequest is the body of POST /oauth/token (form-encoded or JSON). Client credentials may come in the
+// body or in an HTTP Basic Authorization header.
+// Es: OAuthTokenRequest es el cuerpo de POST /oauth/token (form-encoded o JSON). Las credenciales del cliente pueden
+// venir en el cuerpo o en un header Authorization HTTP Basic.
+type OAuthTokenRequest struct {
+	GrantType    string `json:"grant_type"    form:"grant_type"`
+	Code         string `json:"code"          form:"code"`
+	RedirectURI  string `json:"redirect_uri"  form:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier" form:"code_verifier"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+	ClientID     string `json:"client_id"     form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+}
+
+// En: OAuthIntrospectionRequest is the body of POST /oauth/introspect (RFC 7662).
+// Es: OAuthIntrospectionRequest es el cuerpo de POST /oauth/introspect (RFC 7662).
+type OAuthIntrospectionRequest struct {
+	Token         string `json:"token"           form:"token"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+	ClientID      string `json:"client_id"       form:"client_id"`
+	ClientSecret  string `json:"client_secret"   form:"client_secret"`
+}
+
+// En: ImpersonateRequest is the body of POST /admin/impersonate/:userID; the reason is kept in the audit log and
+// allow_writes lifts the read-only default.
+// Es: ImpersonateRequest es el cuerpo de POST /admin/impersonate/:userID; el motivo queda en el log de auditoría y
+// allow_writes levanta el modo de solo lectura por defecto.
+type ImpersonateRequest struct {
+	Reason      string `json:"reason"       validate:"required,min=5,max=500"`
+	AllowWrites bool   `json:"allow_writes"`
+}
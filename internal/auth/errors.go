@@ -1,6 +1,9 @@
 package auth
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // En: ErrInvalidCredentials is returned when login credentials are wrong or refresh token is invalid/expired.
 // Es: ErrInvalidCredentials se devuelve cuando las credenciales de inicio de sesión son incorrectas o el token de actualización es inválido/expirado.
@@ -10,6 +13,10 @@ var ErrInvalidCredentials = fmt.Errorf("invalid credentials")
 // Es: ErrInvalidVerificationToken se devuelve cuando el token de verificación de correo electrónico es inválido o expirado.
 var ErrInvalidVerificationToken = fmt.Errorf("invalid verification token")
 
+// En: ErrInvalidVerificationCode is returned when the email verification code is wrong, expired or out of attempts.
+// Es: ErrInvalidVerificationCode se devuelve cuando el código de verificación de correo es incorrecto, expiró o agotó los intentos.
+var ErrInvalidVerificationCode = fmt.Errorf("invalid verification code")
+
 // En: ErrEmailAlreadyVerified is returned when the email is already verified.
 // Es: ErrEmailAlreadyVerified se devuelve cuando el correo electrónico ya está verificado.
 var ErrEmailAlreadyVerified = fmt.Errorf("email already verified")
@@ -22,6 +29,139 @@ var ErrEmailNotVerified = fmt.Errorf("email not verified")
 // Es: ErrTokenNotFound se devuelve cuando un token de actualización no existe.
 var ErrTokenNotFound = fmt.Errorf("refresh token not found")
 
+// En: ErrRefreshTokenReused is returned (together with ErrInvalidCredentials) when an already rotated refresh token is presented again.
+// Es: ErrRefreshTokenReused se devuelve (junto con ErrInvalidCredentials) cuando se presenta de nuevo un token de actualización ya rotado.
+var ErrRefreshTokenReused = fmt.Errorf("refresh token reused")
+
+// En: ErrSessionNotFound is returned when a session does not exist, belongs to another user or was already ended.
+// Es: ErrSessionNotFound se devuelve cuando una sesión no existe, pertenece a otro usuario o ya fue cerrada.
+var ErrSessionNotFound = fmt.Errorf("session not found")
+
 // En: ErrJWTUsedAsRefreshToken is returned when the client sends a JWT (access token) as refresh_token.
 // Es: ErrJWTUsedAsRefreshToken se devuelve cuando el cliente envía un JWT (access token) como refresh_token.
 var ErrJWTUsedAsRefreshToken = fmt.Errorf("jwt used as refresh token")
+
+// En: ErrInvalidResetToken is returned when the password reset token is unknown, expired or already used.
+// Es: ErrInvalidResetToken se devuelve cuando el token de restablecimiento de contraseña es desconocido, expiró o ya fue usado.
+var ErrInvalidResetToken = fmt.Errorf("invalid password reset token")
+
+// En: ErrInvalidMagicLinkToken is returned when the magic link token is unknown, expired or already used.
+// Es: ErrInvalidMagicLinkToken se devuelve cuando el token de magic link es desconocido, expiró o ya fue usado.
+var ErrInvalidMagicLinkToken = fmt.Errorf("invalid magic link token")
+
+// En: ErrInvalidCSRFToken is returned when a cookie-borne refresh token arrives without a matching X-CSRF-Token header.
+// Es: ErrInvalidCSRFToken se devuelve cuando un refresh token en cookie llega sin un header X-CSRF-Token que coincida.
+var ErrInvalidCSRFToken = fmt.Errorf("invalid csrf token")
+
+// En: ErrInvalidEmailChangeToken is returned when the email change token is unknown, expired or already used.
+// Es: ErrInvalidEmailChangeToken se devuelve cuando el token de cambio de email es desconocido, expiró o ya fue usado.
+var ErrInvalidEmailChangeToken = fmt.Errorf("invalid email change token")
+
+// En: ErrEmailUnchanged is returned when an email change is requested for the address the user already has.
+// Es: ErrEmailUnchanged se devuelve cuando se solicita un cambio de email a la dirección que el usuario ya tiene.
+var ErrEmailUnchanged = fmt.Errorf("new email is the current email")
+
+// En: ErrAuthProviderNotFound is returned when no user is linked to the given provider subject.
+// Es: ErrAuthProviderNotFound se devuelve cuando ningún usuario está enlazado al sujeto del proveedor dado.
+var ErrAuthProviderNotFound = fmt.Errorf("auth provider not found")
+
+// En: ErrOAuthProviderNotConfigured is returned when social sign-in is requested for an unknown or disabled provider.
+// Es: ErrOAuthProviderNotConfigured se devuelve cuando se solicita inicio de sesión social con un proveedor desconocido o deshabilitado.
+var ErrOAuthProviderNotConfigured = fmt.Errorf("oauth provider not configured")
+
+// En: ErrInvalidOAuthState is returned when the OAuth state is unknown, expired, already used or issued for another provider.
+// Es: ErrInvalidOAuthState se devuelve cuando el state de OAuth es desconocido, expiró, ya fue usado o pertenece a otro proveedor.
+var ErrInvalidOAuthState = fmt.Errorf("invalid oauth state")
+
+// En: ErrOAuthFailed is returned when the provider rejects the code exchange or the ID token does not verify.
+// Es: ErrOAuthFailed se devuelve cuando el proveedor rechaza el intercambio del código o el ID token no es válido.
+var ErrOAuthFailed = fmt.Errorf("oauth sign-in failed")
+
+// En: ErrAuthProviderAlreadyLinked is returned when the provider identity (or provider type) is already linked.
+// Es: ErrAuthProviderAlreadyLinked se devuelve cuando la identidad del proveedor (o el tipo de proveedor) ya está enlazada.
+var ErrAuthProviderAlreadyLinked = fmt.Errorf("auth provider already linked")
+
+// En: ErrLastLoginMethod is returned when unlinking would leave the user without any way to log in.
+// Es: ErrLastLoginMethod se devuelve cuando desenlazar dejaría al usuario sin ninguna forma de iniciar sesión.
+var ErrLastLoginMethod = fmt.Errorf("cannot remove the last login method")
+
+// En: ErrTwoFactorNotEnabled is returned when a 2FA operation needs an enrolled (or confirmed) TOTP credential.
+// Es: ErrTwoFactorNotEnabled se devuelve cuando una operación 2FA necesita una credencial TOTP inscrita (o confirmada).
+var ErrTwoFactorNotEnabled = fmt.Errorf("two-factor authentication not enabled")
+
+// En: ErrTwoFactorAlreadyEnabled is returned when enrolling a user that already has confirmed 2FA.
+// Es: ErrTwoFactorAlreadyEnabled se devuelve al inscribir a un usuario que ya tiene 2FA confirmado.
+var ErrTwoFactorAlreadyEnabled = fmt.Errorf("two-factor authentication already enabled")
+
+// En: ErrInvalidTwoFactorCode is returned when a TOTP or recovery code is wrong, expired or already used.
+// Es: ErrInvalidTwoFactorCode se devuelve cuando un código TOTP o de recuperación es incorrecto, expiró o ya fue usado.
+var ErrInvalidTwoFactorCode = fmt.Errorf("invalid two-factor code")
+
+// En: ErrInvalidMFAToken is returned when the MFA challenge token is unknown, expired, used or out of attempts.
+// Es: ErrInvalidMFAToken se devuelve cuando el token de desafío MFA es desconocido, expiró, ya se usó o agotó los intentos.
+var ErrInvalidMFAToken = fmt.Errorf("invalid mfa challenge token")
+
+// En: ErrInvalidDeviceCode is returned when the device code is unknown or its tokens were already issued (invalid_grant).
+// Es: ErrInvalidDeviceCode se devuelve cuando el device code es desconocido o sus tokens ya se emitieron (invalid_grant).
+var ErrInvalidDeviceCode = fmt.Errorf("invalid device code")
+
+// En: ErrDeviceAuthorizationPending is returned while the user has not approved the device yet (authorization_pending).
+// Es: ErrDeviceAuthorizationPending se devuelve mientras el usuario aún no aprobó el dispositivo (authorization_pending).
+var ErrDeviceAuthorizationPending = fmt.Errorf("device authorization pending")
+
+// En: ErrDeviceSlowDown is returned when the device polls faster than its interval; the interval grows by five seconds (slow_down).
+// Es: ErrDeviceSlowDown se devuelve cuando el dispositivo consulta más rápido que su intervalo; el intervalo crece cinco segundos (slow_down).
+var ErrDeviceSlowDown = fmt.Errorf("device polling too fast")
+
+// En: ErrDeviceAccessDenied is returned when the user denied the device (access_denied).
+// Es: ErrDeviceAccessDenied se devuelve cuando el usuario denegó el dispositivo (access_denied).
+var ErrDeviceAccessDenied = fmt.Errorf("device access denied")
+
+// En: ErrDeviceCodeExpired is returned when the device code expired before being approved (expired_token).
+// Es: ErrDeviceCodeExpired se devuelve cuando el device code expiró antes de ser aprobado (expired_token).
+var ErrDeviceCodeExpired = fmt.Errorf("device code expired")
+
+// En: ErrInvalidUserCode is returned when the user code is unknown, expired or already approved or denied.
+// Es: ErrInvalidUserCode se devuelve cuando el user code es desconocido, expiró o ya fue aprobado o denegado.
+var ErrInvalidUserCode = fmt.Errorf("invalid user code")
+
+// En: ErrOAuthServerDisabled is returned by the OAuth provider endpoints when no issuer URL or client registry is configured.
+// Es: ErrOAuthServerDisabled lo devuelven los endpoints del proveedor OAuth cuando no hay URL de emisor o registro de clientes configurado.
+var ErrOAuthServerDisabled = fmt.Errorf("oauth authorization server disabled")
+
+// En: ErrInvalidOAuthClient is returned when a client is unknown, revoked or fails to authenticate (invalid_client).
+// Es: ErrInvalidOAuthClient se devuelve cuando un cliente es desconocido, está revocado o no se autentica (invalid_client).
+var ErrInvalidOAuthClient = fmt.Errorf("invalid oauth client")
+
+// En: ErrInvalidOAuthGrant is returned when an authorization code or client refresh token is unknown, used, expired,
+// issued to another client, or fails the redirect URI or PKCE check (invalid_grant).
+// Es: ErrInvalidOAuthGrant se devuelve cuando un código de autorización o refresh token de cliente es desconocido, ya se usó,
+// expiró, se emitió a otro cliente, o no supera la comprobación de redirect URI o PKCE (invalid_grant).
+var ErrInvalidOAuthGrant = fmt.Errorf("invalid oauth grant")
+
+// En: ErrOAuthAccountNotAllowed is returned when the consenting user is not a member of the account to delegate,
+// or has no account while the client asks for account scopes.
+// Es: ErrOAuthAccountNotAllowed se devuelve cuando el usuario que consiente no es miembro de la cuenta a delegar,
+// o no tiene cuenta mientras el cliente pide scopes de cuenta.
+var ErrOAuthAccountNotAllowed = fmt.Errorf("account cannot be delegated to the oauth client")
+
+// En: ErrNotPlatformAdmin is returned when a user without the platform-admin role tries to impersonate someone.
+// Es: ErrNotPlatformAdmin se devuelve cuando un usuario sin el rol platform-admin intenta suplantar a alguien.
+var ErrNotPlatformAdmin = fmt.Errorf("platform admin role required")
+
+// En: ErrImpersonationNotAllowed is returned when the target is the actor or another platform admin, or the request
+// itself comes from an impersonation token (impersonation cannot be chained).
+// Es: ErrImpersonationNotAllowed se devuelve cuando el objetivo es el propio actor u otro platform admin, o la solicitud
+// viene de un token de suplantación (la suplantación no se puede encadenar).
+var ErrImpersonationNotAllowed = fmt.Errorf("impersonation not allowed")
+
+// En: MFARequiredError is returned by login when the password (or provider) check passed but a second factor is required.
+// Es: MFARequiredError se devuelve en el login cuando la contraseña (o el proveedor) es válida pero se requiere un segundo factor.
+type MFARequiredError struct {
+	MFAToken  string
+	ExpiresAt time.Time
+}
+
+func (e *MFARequiredError) Error() string {
+	return "two-factor authentication required"
+}
@@ -1,10 +1,15 @@
 package auth
 
 import (
+	"encoding/base64"
 	"errors"
 	"log/slog"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/cloudflax/api.cloudflax/internal/account"
 	"github.com/cloudflax/api.cloudflax/internal/shared/requestctx"
 	runtimeError "github.com/cloudflax/api.cloudflax/internal/shared/runtimeerror"
 	"github.com/cloudflax/api.cloudflax/internal/shared/validator"
@@ -15,8 +20,13 @@ import (
 // En: Handler handles HTTP requests for authentication.
 // Es: Manejador maneja las solicitudes HTTP para la autenticación.
 type Handler struct {
-	service     *Service
-	resendGuard ResendVerificationGuard
+	service             *Service
+	resendGuard         ResendVerificationGuard
+	forgotPasswordGuard ResendVerificationGuard
+	loginThrottle       LoginThrottle
+	magicLinkGuard      ResendVerificationGuard
+	deviceCodeGuard     ResendVerificationGuard
+	refreshCookie       *RefreshTokenCookieOptions
 }
 
 // En: NewHandler creates a new auth handler.
@@ -32,8 +42,38 @@ func (handler *Handler) WithResendVerificationGuard(guard ResendVerificationGuar
 	return handler
 }
 
+// En: WithForgotPasswordGuard sets an optional throttle guard for forgot-password requests.
+// Es: WithForgotPasswordGuard define un guard opcional de throttling para solicitudes de contraseña olvidada.
+func (handler *Handler) WithForgotPasswordGuard(guard ResendVerificationGuard) *Handler {
+	handler.forgotPasswordGuard = guard
+	return handler
+}
+
+// En: WithLoginThrottle sets an optional throttle for failed password logins.
+// Es: WithLoginThrottle define un throttle opcional para los logins fallidos con contraseña.
+func (handler *Handler) WithLoginThrottle(throttle LoginThrottle) *Handler {
+	handler.loginThrottle = throttle
+	return handler
+}
+
+// En: WithMagicLinkGuard sets an optional throttle guard for magic link requests.
+// Es: WithMagicLinkGuard define un guard opcional de throttling para solicitudes de magic link.
+func (handler *Handler) WithMagicLinkGuard(guard ResendVerificationGuard) *Handler {
+	handler.magicLinkGuard = guard
+	return handler
+}
+
+// En: WithDeviceCodeGuard sets an optional per-IP throttle guard for device authorization requests.
+// Es: WithDeviceCodeGuard define un guard opcional de throttling por IP para solicitudes de autorización de dispositivo.
+func (handler *Handler) WithDeviceCodeGuard(guard ResendVerificationGuard) *Handler {
+	handler.deviceCodeGuard = guard
+	return handler
+}
+
 // En: Login authenticates a user and returns an access + refresh token pair.
+// Failed attempts count towards the login throttle; a locked email or IP gets 429 with Retry-After.
 // Es: Inicia sesión de un usuario y devuelve un par de tokens de acceso y actualización.
+// Los intentos fallidos cuentan para el throttle de login; un email o IP bloqueado recibe 429 con Retry-After.
 func (handler *Handler) Login(ctx fiber.Ctx) error {
 	var req LoginRequest
 	if err := ctx.Bind().Body(&req); err != nil {
@@ -53,9 +93,31 @@ func (handler *Handler) Login(ctx fiber.Ctx) error {
 		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
 	}
 
-	pair, err := handler.service.Login(req.Email, req.Password)
+	if handler.loginThrottle != nil {
+		if err := handler.loginThrottle.Check(ctx.Context(), req.Email, ctx.IP()); err != nil {
+			var limitErr *RateLimitError
+			if errors.As(err, &limitErr) {
+				return respondRateLimited(ctx, limitErr.RetryAfter, limitErr.Dimension, "Too many failed login attempts. Try again later")
+			}
+			slog.Error("login throttle", "error", err)
+			return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Login failed")
+		}
+	}
+
+	pair, err := handler.service.Login(req.Email, req.Password, sessionMetadata(ctx, req.DeviceName))
 	if err != nil {
+		var mfaErr *MFARequiredError
+		if errors.As(err, &mfaErr) {
+			// The email counter is only reset once the second factor is accepted, so a known password
+			// cannot be replayed to get fresh MFA attempts.
+			return respondMFARequired(ctx, mfaErr)
+		}
 		if errors.Is(err, ErrInvalidCredentials) {
+			if handler.loginThrottle != nil {
+				if err := handler.loginThrottle.RecordFailure(ctx.Context(), req.Email, ctx.IP()); err != nil {
+					slog.Error("login throttle record failure", "error", err)
+				}
+			}
 			return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeInvalidCredentials, "Invalid email or password")
 		}
 		if errors.Is(err, ErrEmailNotVerified) {
@@ -65,16 +127,38 @@ func (handler *Handler) Login(ctx fiber.Ctx) error {
 		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Login failed")
 	}
 
-	return ctx.JSON(fiber.Map{"data": pair})
+	handler.resetLoginThrottle(ctx, req.Email)
+	return handler.respondTokenPair(ctx, pair)
+}
+
+// En: resetLoginThrottle clears the failed-login counter of the email once its password was accepted; errors are only logged.
+// Es: resetLoginThrottle borra el contador de logins fallidos del email cuando su contraseña fue aceptada; los errores solo se registran.
+func (handler *Handler) resetLoginThrottle(ctx fiber.Ctx, email string) {
+	if handler.loginThrottle == nil {
+		return
+	}
+	if err := handler.loginThrottle.Reset(ctx.Context(), email); err != nil {
+		slog.Error("login throttle reset", "error", err)
+	}
 }
 
 // En: Refresh exchanges a valid refresh token for a new token pair.
 // Es: Actualiza un token de actualización válido por un nuevo par de tokens.
 func (handler *Handler) Refresh(ctx fiber.Ctx) error {
 	var req RefreshRequest
-	if err := ctx.Bind().Body(&req); err != nil {
-		slog.Debug("refresh bind error", "error", err)
-		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	// In cookie mode the body is optional: the refresh token comes from the cookie.
+	if handler.refreshCookie == nil || len(ctx.Body()) > 0 {
+		if err := ctx.Bind().Body(&req); err != nil {
+			slog.Debug("refresh bind error", "error", err)
+			return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+		}
+	}
+	if req.RefreshToken == "" {
+		refreshToken, err := handler.cookieRefreshToken(ctx)
+		if err != nil {
+			return respondInvalidCSRFToken(ctx)
+		}
+		req.RefreshToken = refreshToken
 	}
 
 	if err := validator.Validate(req); err != nil {
@@ -88,13 +172,14 @@ func (handler *Handler) Refresh(ctx fiber.Ctx) error {
 		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
 	}
 
-	pair, err := handler.service.RefreshTokens(req.RefreshToken)
+	pair, err := handler.service.RefreshTokens(req.RefreshToken, sessionMetadata(ctx, ""))
 	if err != nil {
 		if errors.Is(err, ErrJWTUsedAsRefreshToken) {
 			return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeRefreshTokenWrongFormat,
 				"Use refresh_token (opaque value from login), not access_token (JWT)")
 		}
 		if errors.Is(err, ErrInvalidCredentials) {
+			handler.clearRefreshTokenCookies(ctx)
 			return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeTokenInvalid, "Invalid or expired refresh token")
 		}
 		if errors.Is(err, ErrEmailNotVerified) {
@@ -104,22 +189,146 @@ func (handler *Handler) Refresh(ctx fiber.Ctx) error {
 		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Token refresh failed")
 	}
 
-	return ctx.JSON(fiber.Map{"data": pair})
+	return handler.respondTokenPair(ctx, pair)
 }
 
-// En: Logout revokes all active refresh tokens for the authenticated user.
-// Es: Cierra sesión de un usuario y revoca todos los tokens de actualización activos.
+// En: Logout revokes all active refresh tokens for the authenticated user, or only the current session with scope "current".
+// Scope "all" also revokes the user's grants to third-party OAuth clients.
+// Es: Cierra sesión de un usuario y revoca todos los tokens de actualización activos, o solo la sesión actual con scope "current".
+// El scope "all" también revoca las concesiones del usuario a clientes OAuth de terceros.
 func (handler *Handler) Logout(ctx fiber.Ctx) error {
 	requestContext, err := requestctx.UserOnly(ctx)
 	if err != nil {
 		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
 	}
 
-	if err := handler.service.Logout(requestContext.UserID); err != nil {
-		slog.Error("logout", "user_id", requestContext.UserID, "error", err)
+	// The body is optional: without one, logout keeps ending every session.
+	var req LogoutRequest
+	if len(ctx.Body()) > 0 {
+		if err := ctx.Bind().Body(&req); err != nil {
+			slog.Debug("logout bind error", "error", err)
+			return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+		}
+		if err := validator.Validate(req); err != nil {
+			var ve validator.ValidationErrors
+			if errors.As(err, &ve) {
+				return runtimeError.RespondWithDetails(
+					ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+					"Validation failed", toErrorDetails(ve),
+				)
+			}
+			return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+		}
+	}
+	if req.RefreshToken == "" {
+		refreshToken, err := handler.cookieRefreshToken(ctx)
+		if err != nil {
+			return respondInvalidCSRFToken(ctx)
+		}
+		req.RefreshToken = refreshToken
+	}
+
+	switch req.Scope {
+	case "current":
+		err = handler.service.LogoutSession(requestContext.UserID, requestContext.SessionID, req.RefreshToken)
+	case "all":
+		err = handler.service.RevokeAllByUserID(requestContext.UserID)
+	default:
+		err = handler.service.Logout(requestContext.UserID)
+	}
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeSessionNotFound, "Current session not found")
+		}
+		slog.Error("logout", "user_id", requestContext.UserID, "scope", req.Scope, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Logout failed")
+	}
+
+	// The access token used to log out stops working right away, even if it carries no session.
+	if err := handler.service.RevokeAccessToken(requestContext.TokenID, requestContext.TokenExpiresAt); err != nil {
+		slog.Error("logout revoke access token", "user_id", requestContext.UserID, "error", err)
 		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Logout failed")
 	}
 
+	handler.clearRefreshTokenCookies(ctx)
+	return ctx.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// En: ListSessions returns the active sessions of the authenticated user, flagging the current one.
+// Es: ListSessions devuelve las sesiones activas del usuario autenticado, marcando la actual.
+func (handler *Handler) ListSessions(ctx fiber.Ctx) error {
+	requestContext, err := requestctx.UserOnly(ctx)
+	if err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	sessions, err := handler.service.ListSessions(requestContext.UserID)
+	if err != nil {
+		slog.Error("list sessions", "user_id", requestContext.UserID, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not list sessions")
+	}
+
+	response := make([]SessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = SessionResponse{
+			Session: session,
+			Current: session.ID == requestContext.SessionID,
+		}
+	}
+	return ctx.JSON(fiber.Map{"data": response})
+}
+
+// En: RevokeSession ends one session of the authenticated user and revokes its refresh tokens.
+// Es: RevokeSession cierra una sesión del usuario autenticado y revoca sus tokens de actualización.
+func (handler *Handler) RevokeSession(ctx fiber.Ctx) error {
+	requestContext, err := requestctx.UserOnly(ctx)
+	if err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	if err := handler.service.RevokeSession(requestContext.UserID, ctx.Params("id")); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeSessionNotFound, "Session not found")
+		}
+		slog.Error("revoke session", "user_id", requestContext.UserID, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not revoke session")
+	}
+
+	return ctx.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// En: LogoutOtherSessions ends every session of the authenticated user except the current one.
+// Es: LogoutOtherSessions cierra todas las sesiones del usuario autenticado excepto la actual.
+func (handler *Handler) LogoutOtherSessions(ctx fiber.Ctx) error {
+	requestContext, err := requestctx.UserOnly(ctx)
+	if err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	// The body is optional: the current session defaults to the sid claim of the access token.
+	var req LogoutOtherSessionsRequest
+	if len(ctx.Body()) > 0 {
+		if err := ctx.Bind().Body(&req); err != nil {
+			slog.Debug("logout other sessions bind error", "error", err)
+			return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+		}
+	}
+	if req.RefreshToken == "" {
+		refreshToken, err := handler.cookieRefreshToken(ctx)
+		if err != nil {
+			return respondInvalidCSRFToken(ctx)
+		}
+		req.RefreshToken = refreshToken
+	}
+
+	if err := handler.service.RevokeOtherSessions(requestContext.UserID, requestContext.SessionID, req.RefreshToken); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeSessionNotFound, "Current session not found")
+		}
+		slog.Error("logout other sessions", "user_id", requestContext.UserID, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not log out other sessions")
+	}
+
 	return ctx.Status(fiber.StatusNoContent).Send(nil)
 }
 
@@ -144,8 +353,19 @@ func (handler *Handler) Register(ctx fiber.Ctx) error {
 		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
 	}
 
+	if req.InvitationToken != "" {
+		return handler.registerWithInvitation(ctx, req)
+	}
+
 	createdUser, _, err := handler.service.Register(req.Name, req.Email, req.Password)
 	if err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
 		if errors.Is(err, user.ErrDuplicateEmail) {
 			return runtimeError.Respond(ctx, fiber.StatusConflict, runtimeError.CodeEmailAlreadyExists, "Email already exists")
 		}
@@ -159,6 +379,36 @@ func (handler *Handler) Register(ctx fiber.Ctx) error {
 	})
 }
 
+// En: registerWithInvitation registers a user from an account invitation link; the email needs no verification.
+// Es: registerWithInvitation registra un usuario desde el enlace de una invitación a una cuenta; el email no requiere verificación.
+func (handler *Handler) registerWithInvitation(ctx fiber.Ctx, req RegisterRequest) error {
+	createdUser, member, err := handler.service.RegisterWithInvitation(req.Name, req.Email, req.Password, req.InvitationToken)
+	if err != nil {
+		var ve validator.ValidationErrors
+		switch {
+		case errors.As(err, &ve):
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		case errors.Is(err, account.ErrInvitationNotFound):
+			return runtimeError.Respond(ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeInvalidInvitationToken, "Invalid or expired invitation")
+		case errors.Is(err, account.ErrInvitationEmailMismatch):
+			return runtimeError.Respond(ctx, fiber.StatusForbidden, runtimeError.CodeInvitationEmailMismatch, "Invitation was sent to another email")
+		case errors.Is(err, user.ErrDuplicateEmail):
+			return runtimeError.Respond(ctx, fiber.StatusConflict, runtimeError.CodeEmailAlreadyExists, "Email already exists")
+		default:
+			slog.Error("register with invitation", "error", err)
+			return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Registration failed")
+		}
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"data": createdUser,
+		"meta": fiber.Map{"email_verification_required": false, "account_id": member.AccountID},
+	})
+}
+
 // En: VerifyEmail marks the user's email as verified using the token from the verification link.
 // Es: Marca el correo electrónico del usuario como verificado usando el token del enlace de verificación.
 func (handler *Handler) VerifyEmail(ctx fiber.Ctx) error {
@@ -189,6 +439,39 @@ func (handler *Handler) VerifyEmail(ctx fiber.Ctx) error {
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Email verified successfully"})
 }
 
+// En: VerifyEmailCode marks the user's email as verified using the six-digit code from the verification email.
+// Es: VerifyEmailCode marca el correo electrónico del usuario como verificado usando el código de seis dígitos del correo de verificación.
+func (handler *Handler) VerifyEmailCode(ctx fiber.Ctx) error {
+	var req VerifyEmailCodeRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("verify email code bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if err := validator.Validate(req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	if err := handler.service.VerifyEmailCode(req.Email, req.Code); err != nil {
+		if errors.Is(err, ErrInvalidVerificationCode) {
+			return runtimeError.Respond(ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeInvalidVerificationCode, "Invalid or expired verification code")
+		}
+		if errors.Is(err, ErrEmailAlreadyVerified) {
+			return runtimeError.Respond(ctx, fiber.StatusConflict, runtimeError.CodeEmailAlreadyVerified, "Email is already verified")
+		}
+		slog.Error("verify email code", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Email verification failed")
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Email verified successfully"})
+}
+
 // En: ResendVerification generates a new verification token for the given email.
 // Es: Envía un nuevo correo de verificación para el correo electrónico dado.
 func (handler *Handler) ResendVerification(ctx fiber.Ctx) error {
@@ -212,17 +495,7 @@ func (handler *Handler) ResendVerification(ctx fiber.Ctx) error {
 		if err := handler.resendGuard.CheckAndConsume(ctx.Context(), req.Email, ctx.IP()); err != nil {
 			var limitErr *ResendVerificationRateLimitError
 			if errors.As(err, &limitErr) {
-				retryAfterSeconds := int64(limitErr.RetryAfter.Seconds())
-				if retryAfterSeconds <= 0 {
-					retryAfterSeconds = 1
-				}
-				ctx.Set("Retry-After", strconv.FormatInt(retryAfterSeconds, 10))
-				return runtimeError.Respond(
-					ctx,
-					fiber.StatusTooManyRequests,
-					runtimeError.CodeRateLimited,
-					"Too many verification requests. Try again later",
-				)
+				return respondRateLimited(ctx, limitErr.RetryAfter, limitErr.Dimension, "Too many verification requests. Try again later")
 			}
 			slog.Error("resend verification throttle", "error", err)
 			return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not resend verification")
@@ -244,17 +517,12 @@ func (handler *Handler) ResendVerification(ctx fiber.Ctx) error {
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "If the email exists, a verification link has been sent"})
 }
 
-// En: DevGetVerificationToken returns the current email verification token for a given email.
-//
-//	This endpoint is intended for development environments only.
-//
-// Es: DevGetVerificationToken devuelve el token de verificación de correo electrónico actual para un correo dado.
-//
-//	Este endpoint está pensado solo para entornos de desarrollo.
-func (handler *Handler) DevGetVerificationToken(ctx fiber.Ctx) error {
-	var req ResendVerificationRequest
+// En: ForgotPassword sends a password reset link when the email belongs to a user; the response never reveals it.
+// Es: ForgotPassword envía un enlace de restablecimiento si el correo pertenece a un usuario; la respuesta nunca lo revela.
+func (handler *Handler) ForgotPassword(ctx fiber.Ctx) error {
+	var req ForgotPasswordRequest
 	if err := ctx.Bind().Body(&req); err != nil {
-		slog.Debug("dev get verification token bind error", "error", err)
+		slog.Debug("forgot password bind error", "error", err)
 		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
 	}
 	if err := validator.Validate(req); err != nil {
@@ -268,25 +536,1159 @@ func (handler *Handler) DevGetVerificationToken(ctx fiber.Ctx) error {
 		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
 	}
 
-	token, err := handler.service.ResendVerification(req.Email)
+	if handler.forgotPasswordGuard != nil {
+		if err := handler.forgotPasswordGuard.CheckAndConsume(ctx.Context(), req.Email, ctx.IP()); err != nil {
+			var limitErr *ResendVerificationRateLimitError
+			if errors.As(err, &limitErr) {
+				return respondRateLimited(ctx, limitErr.RetryAfter, limitErr.Dimension, "Too many password reset requests. Try again later")
+			}
+			slog.Error("forgot password throttle", "error", err)
+			return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not process password reset")
+		}
+	}
+
+	if _, err := handler.service.ForgotPassword(req.Email); err != nil && !errors.Is(err, user.ErrNotFound) {
+		slog.Error("forgot password", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not process password reset")
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "If the email exists, a password reset link has been sent"})
+}
+
+// En: ResetPassword sets a new password using a reset token and ends every active session of the user.
+// Es: ResetPassword establece una nueva contraseña usando un token de restablecimiento y cierra todas las sesiones activas del usuario.
+func (handler *Handler) ResetPassword(ctx fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("reset password bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if err := validator.Validate(req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	if err := handler.service.ResetPassword(req.Token, req.Password); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		if errors.Is(err, ErrInvalidResetToken) {
+			return runtimeError.Respond(ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeInvalidResetToken, "Invalid or expired password reset token")
+		}
+		slog.Error("reset password", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Password reset failed")
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Password reset successfully"})
+}
+
+// En: RequestMagicLink emails a single-use login link. The response is the same whether or not the email exists.
+// Es: RequestMagicLink envía por correo un enlace de login de un solo uso. La respuesta es la misma exista o no el email.
+func (handler *Handler) RequestMagicLink(ctx fiber.Ctx) error {
+	var req MagicLinkRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("magic link bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if err := validator.Validate(req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	if handler.magicLinkGuard != nil {
+		if err := handler.magicLinkGuard.CheckAndConsume(ctx.Context(), req.Email, ctx.IP()); err != nil {
+			var limitErr *ResendVerificationRateLimitError
+			if errors.As(err, &limitErr) {
+				return respondRateLimited(ctx, limitErr.RetryAfter, limitErr.Dimension, "Too many login link requests. Try again later")
+			}
+			slog.Error("magic link throttle", "error", err)
+			return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not send login link")
+		}
+	}
+
+	if _, err := handler.service.RequestMagicLink(req.Email); err != nil && !errors.Is(err, user.ErrNotFound) {
+		slog.Error("magic link", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not send login link")
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "If the email exists, a login link has been sent"})
+}
+
+// En: VerifyMagicLink exchanges a magic link token for a token pair (or an MFA challenge when 2FA is enabled).
+// Es: VerifyMagicLink canjea un token de magic link por un par de tokens (o un desafío MFA si 2FA está activo).
+func (handler *Handler) VerifyMagicLink(ctx fiber.Ctx) error {
+	var req VerifyMagicLinkRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("verify magic link bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if err := validator.Validate(req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	pair, err := handler.service.VerifyMagicLink(req.Token, sessionMetadata(ctx, req.DeviceName))
 	if err != nil {
-		if errors.Is(err, ErrEmailAlreadyVerified) {
-			return runtimeError.Respond(ctx, fiber.StatusConflict, runtimeError.CodeEmailAlreadyVerified, "Email is already verified")
+		var mfaErr *MFARequiredError
+		if errors.As(err, &mfaErr) {
+			return respondMFARequired(ctx, mfaErr)
 		}
-		if errors.Is(err, user.ErrNotFound) {
-			return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeUserNotFound, "User not found")
+		if errors.Is(err, ErrInvalidMagicLinkToken) {
+			return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeInvalidMagicLinkToken, "Invalid or expired login link")
 		}
-		slog.Error("dev get verification token", "email", req.Email, "error", err)
-		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not generate verification token")
+		slog.Error("verify magic link", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Login failed")
 	}
 
-	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
-		"data": fiber.Map{
-			"token": token,
-		},
+	return handler.respondTokenPair(ctx, pair)
+}
+
+// En: DeviceAuthorization starts an RFC 8628 device grant and answers with the device and user codes in the RFC wire format.
+// Es: DeviceAuthorization inicia una concesión de dispositivo RFC 8628 y responde con los códigos de dispositivo y de usuario en el formato del RFC.
+func (handler *Handler) DeviceAuthorization(ctx fiber.Ctx) error {
+	var req DeviceAuthorizationRequest
+	if len(ctx.Body()) > 0 {
+		if err := ctx.Bind().Body(&req); err != nil {
+			slog.Debug("device authorization bind error", "error", err)
+			return respondOAuthError(ctx, fiber.StatusBadRequest, "invalid_request", "Invalid request body")
+		}
+	}
+	if err := validator.Validate(req); err != nil {
+		return respondOAuthError(ctx, fiber.StatusBadRequest, "invalid_request", "client_id must be at most 100 characters")
+	}
+
+	if handler.deviceCodeGuard != nil {
+		if err := handler.deviceCodeGuard.CheckAndConsume(ctx.Context(), "", ctx.IP()); err != nil {
+			var limitErr *ResendVerificationRateLimitError
+			if errors.As(err, &limitErr) {
+				setRetryAfter(ctx, limitErr.RetryAfter)
+				return respondOAuthError(ctx, fiber.StatusTooManyRequests, "slow_down", "Too many device authorization requests. Try again later")
+			}
+			slog.Error("device authorization throttle", "error", err)
+			return respondOAuthError(ctx, fiber.StatusInternalServerError, "server_error", "Could not start device authorization")
+		}
+	}
+
+	grant, err := handler.service.StartDeviceAuthorization(req.ClientID)
+	if err != nil {
+		slog.Error("start device authorization", "error", err)
+		return respondOAuthError(ctx, fiber.StatusInternalServerError, "server_error", "Could not start device authorization")
+	}
+
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	return ctx.JSON(grant)
+}
+
+// En: DeviceToken is polled by the device with its device code; it answers the RFC 8628 errors until the user decides
+// and then returns the token pair once.
+// Es: DeviceToken lo consulta el dispositivo con su device code; responde los errores de RFC 8628 hasta que el usuario decide
+// y luego devuelve el par de tokens una sola vez.
+func (handler *Handler) DeviceToken(ctx fiber.Ctx) error {
+	var req DeviceTokenRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("device token bind error", "error", err)
+		return respondOAuthError(ctx, fiber.StatusBadRequest, "invalid_request", "Invalid request body")
+	}
+	if req.GrantType != DeviceCodeGrantType {
+		return respondOAuthError(ctx, fiber.StatusBadRequest, "unsupported_grant_type", "grant_type must be "+DeviceCodeGrantType)
+	}
+	if strings.TrimSpace(req.DeviceCode) == "" {
+		return respondOAuthError(ctx, fiber.StatusBadRequest, "invalid_request", "device_code is required")
+	}
+
+	pair, err := handler.service.PollDeviceAuthorization(req.DeviceCode, sessionMetadata(ctx, ""))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrDeviceAuthorizationPending):
+			return respondOAuthError(ctx, fiber.StatusBadRequest, "authorization_pending", "The user has not approved the device yet")
+		case errors.Is(err, ErrDeviceSlowDown):
+			return respondOAuthError(ctx, fiber.StatusBadRequest, "slow_down", "Polling too fast; increase the interval by 5 seconds")
+		case errors.Is(err, ErrDeviceAccessDenied):
+			return respondOAuthError(ctx, fiber.StatusBadRequest, "access_denied", "The user denied the device")
+		case errors.Is(err, ErrDeviceCodeExpired):
+			return respondOAuthError(ctx, fiber.StatusBadRequest, "expired_token", "The device code expired")
+		case errors.Is(err, ErrInvalidDeviceCode):
+			return respondOAuthError(ctx, fiber.StatusBadRequest, "invalid_grant", "Invalid device code")
+		}
+		slog.Error("poll device authorization", "error", err)
+		return respondOAuthError(ctx, fiber.StatusInternalServerError, "server_error", "Could not issue tokens")
+	}
+
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	return ctx.JSON(DeviceTokenResponse{
+		AccessToken:  pair.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    max(int(time.Until(pair.ExpiresAt)/time.Second), 0),
+		RefreshToken: pair.RefreshToken,
+		ExpiresAt:    pair.ExpiresAt,
 	})
 }
 
+// En: ApproveDevice lets the authenticated user approve the device that shows the given user code.
+// Es: ApproveDevice permite al usuario autenticado aprobar el dispositivo que muestra el user code indicado.
+func (handler *Handler) ApproveDevice(ctx fiber.Ctx) error {
+	return handler.decideDevice(ctx, true)
+}
+
+// En: DenyDevice lets the authenticated user deny the device that shows the given user code.
+// Es: DenyDevice permite al usuario autenticado denegar el dispositivo que muestra el user code indicado.
+func (handler *Handler) DenyDevice(ctx fiber.Ctx) error {
+	return handler.decideDevice(ctx, false)
+}
+
+// decideDevice binds the user code and records the authenticated user's decision on the device request.
+func (handler *Handler) decideDevice(ctx fiber.Ctx, approved bool) error {
+	requestContext, err := requestctx.UserOnly(ctx)
+	if err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+	if approved && requestContext.ActorID != "" {
+		return runtimeError.Respond(ctx, fiber.StatusForbidden, runtimeError.CodeForbidden, "Impersonation sessions cannot approve devices")
+	}
+
+	var req DeviceUserCodeRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("device decision bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if err := validator.Validate(req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	if approved {
+		err = handler.service.ApproveDeviceAuthorization(requestContext.UserID, req.UserCode)
+	} else {
+		err = handler.service.DenyDeviceAuthorization(requestContext.UserID, req.UserCode)
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidUserCode) {
+			return runtimeError.Respond(ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeInvalidUserCode, "Invalid or expired user code")
+		}
+		slog.Error("decide device authorization", "user_id", requestContext.UserID, "approved", approved, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not record the decision")
+	}
+
+	if approved {
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Device approved"})
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Device denied"})
+}
+
+// En: OpenIDConfiguration serves the OIDC discovery document of the OAuth provider for third-party clients.
+// Es: OpenIDConfiguration sirve el documento de descubrimiento OIDC del proveedor OAuth para clientes de terceros.
+func (handler *Handler) OpenIDConfiguration(ctx fiber.Ctx) error {
+	configuration, err := handler.service.OpenIDConfiguration()
+	if err != nil {
+		return respondOAuthServerError(ctx, "openid configuration", err)
+	}
+	ctx.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return ctx.JSON(configuration)
+}
+
+// En: GetOAuthAuthorization validates the authorization request forwarded by the consent page and returns the
+// client name and scopes to show the authenticated user.
+// Es: GetOAuthAuthorization valida la solicitud de autorización reenviada por la página de consentimiento y devuelve
+// el nombre del cliente y los scopes a mostrar al usuario autenticado.
+func (handler *Handler) GetOAuthAuthorization(ctx fiber.Ctx) error {
+	if _, err := requestctx.UserOnly(ctx); err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	var req OAuthAuthorizationRequest
+	if err := ctx.Bind().Query(&req); err != nil {
+		slog.Debug("oauth authorization bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid query parameters")
+	}
+
+	consent, err := handler.service.ValidateOAuthAuthorization(req)
+	if err != nil {
+		return respondAuthorizationRequestError(ctx, err)
+	}
+	return ctx.JSON(fiber.Map{"data": consent})
+}
+
+// En: DecideOAuthAuthorization records the authenticated user's consent and returns the client redirect URL,
+// carrying an authorization code when approved or error=access_denied when denied.
+// Es: DecideOAuthAuthorization registra el consentimiento del usuario autenticado y devuelve la URL de redirección del
+// cliente, con un código de autorización si aprueba o error=access_denied si deniega.
+func (handler *Handler) DecideOAuthAuthorization(ctx fiber.Ctx) error {
+	requestContext, err := requestctx.UserOnly(ctx)
+	if err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+	if requestContext.ActorID != "" {
+		return runtimeError.Respond(ctx, fiber.StatusForbidden, runtimeError.CodeForbidden, "Impersonation sessions cannot authorize clients")
+	}
+
+	var req OAuthConsentRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("oauth consent bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+
+	redirectTo, err := handler.service.AuthorizeOAuthClient(requestContext.UserID, req.OAuthAuthorizationRequest, req.AccountID, req.Approve)
+	if err != nil {
+		if errors.Is(err, ErrOAuthAccountNotAllowed) {
+			return runtimeError.Respond(ctx, fiber.StatusForbidden, runtimeError.CodeForbidden, "The account cannot be delegated to this client")
+		}
+		return respondAuthorizationRequestError(ctx, err)
+	}
+	return ctx.JSON(fiber.Map{"data": fiber.Map{"redirect_to": redirectTo}})
+}
+
+// En: OAuthToken is the token endpoint for third-party clients: it exchanges an authorization code (with its PKCE
+// verifier) or a client refresh token. Errors use the RFC 6749 format.
+// Es: OAuthToken es el endpoint de token para clientes de terceros: canjea un código de autorización (con su verificador
+// PKCE) o un refresh token de cliente. Los errores usan el formato RFC 6749.
+func (handler *Handler) OAuthToken(ctx fiber.Ctx) error {
+	var req OAuthTokenRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("oauth token bind error", "error", err)
+		return respondOAuthError(ctx, fiber.StatusBadRequest, "invalid_request", "Invalid request body")
+	}
+	creds, ok := oauthClientCredentials(ctx, req.ClientID, req.ClientSecret)
+	if !ok {
+		return respondInvalidOAuthClient(ctx)
+	}
+
+	var (
+		response *OAuthTokenResponse
+		err      error
+	)
+	switch req.GrantType {
+	case OAuthGrantTypeAuthorizationCode:
+		if req.Code == "" || req.RedirectURI == "" || req.CodeVerifier == "" {
+			return respondOAuthError(ctx, fiber.StatusBadRequest, "invalid_request", "code, redirect_uri and code_verifier are required")
+		}
+		response, err = handler.service.ExchangeOAuthAuthorizationCode(creds, req.Code, req.RedirectURI, req.CodeVerifier)
+	case OAuthGrantTypeRefreshToken:
+		if req.RefreshToken == "" {
+			return respondOAuthError(ctx, fiber.StatusBadRequest, "invalid_request", "refresh_token is required")
+		}
+		response, err = handler.service.RefreshOAuthToken(creds, req.RefreshToken)
+	default:
+		return respondOAuthError(ctx, fiber.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidOAuthClient), errors.Is(err, ErrOAuthServerDisabled):
+			return respondInvalidOAuthClient(ctx)
+		case errors.Is(err, ErrInvalidOAuthGrant):
+			return respondOAuthError(ctx, fiber.StatusBadRequest, "invalid_grant", "Invalid, expired or already used grant")
+		}
+		slog.Error("oauth token", "client_id", creds.ClientID, "grant_type", req.GrantType, "error", err)
+		return respondOAuthError(ctx, fiber.StatusInternalServerError, "server_error", "Could not issue tokens")
+	}
+
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	return ctx.JSON(response)
+}
+
+// En: OAuthIntrospect is the RFC 7662 introspection endpoint; confidential clients check their own tokens.
+// Es: OAuthIntrospect es el endpoint de introspección RFC 7662; los clientes confidenciales comprueban sus propios tokens.
+func (handler *Handler) OAuthIntrospect(ctx fiber.Ctx) error {
+	var req OAuthIntrospectionRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("oauth introspection bind error", "error", err)
+		return respondOAuthError(ctx, fiber.StatusBadRequest, "invalid_request", "Invalid request body")
+	}
+	creds, ok := oauthClientCredentials(ctx, req.ClientID, req.ClientSecret)
+	if !ok {
+		return respondInvalidOAuthClient(ctx)
+	}
+	if req.Token == "" {
+		return respondOAuthError(ctx, fiber.StatusBadRequest, "invalid_request", "token is required")
+	}
+
+	introspection, err := handler.service.IntrospectOAuthToken(ctx.Context(), creds, req.Token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidOAuthClient) || errors.Is(err, ErrOAuthServerDisabled) {
+			return respondInvalidOAuthClient(ctx)
+		}
+		slog.Error("oauth introspection", "client_id", creds.ClientID, "error", err)
+		return respondOAuthError(ctx, fiber.StatusInternalServerError, "server_error", "Could not introspect the token")
+	}
+
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	return ctx.JSON(introspection)
+}
+
+// En: RequestEmailChange starts changing the authenticated user's email: the new address gets a confirmation link
+// and the current one is notified.
+// Es: RequestEmailChange inicia el cambio del email del usuario autenticado: la nueva dirección recibe un enlace de confirmación
+// y se avisa a la actual.
+func (handler *Handler) RequestEmailChange(ctx fiber.Ctx) error {
+	requestContext, err := requestctx.UserOnly(ctx)
+	if err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+	if requestContext.ActorID != "" {
+		return runtimeError.Respond(ctx, fiber.StatusForbidden, runtimeError.CodeForbidden, "Impersonation sessions cannot change the email")
+	}
+
+	var req RequestEmailChangeRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("request email change bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if err := validator.Validate(req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	if _, err := handler.service.RequestEmailChange(requestContext.UserID, req.Email); err != nil {
+		if errors.Is(err, ErrEmailUnchanged) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", []runtimeError.ErrorDetail{{Field: "email", Message: "must differ from the current email"}},
+			)
+		}
+		if errors.Is(err, user.ErrDuplicateEmail) {
+			return runtimeError.Respond(ctx, fiber.StatusConflict, runtimeError.CodeEmailAlreadyExists, "Email already exists")
+		}
+		if errors.Is(err, user.ErrNotFound) {
+			return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeUserNotFound, "User not found")
+		}
+		slog.Error("request email change", "user_id", requestContext.UserID, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not request email change")
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "A confirmation link has been sent to the new email"})
+}
+
+// En: ConfirmEmailChange applies a pending email change using the token from the confirmation link.
+// Es: ConfirmEmailChange aplica un cambio de email pendiente usando el token del enlace de confirmación.
+func (handler *Handler) ConfirmEmailChange(ctx fiber.Ctx) error {
+	var req ConfirmEmailChangeRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("confirm email change bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if err := validator.Validate(req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	if err := handler.service.ConfirmEmailChange(req.Token); err != nil {
+		if errors.Is(err, ErrInvalidEmailChangeToken) {
+			return runtimeError.Respond(ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeInvalidEmailChangeToken, "Invalid or expired email change token")
+		}
+		if errors.Is(err, user.ErrDuplicateEmail) {
+			return runtimeError.Respond(ctx, fiber.StatusConflict, runtimeError.CodeEmailAlreadyExists, "Email already exists")
+		}
+		slog.Error("confirm email change", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Email change failed")
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Email changed successfully"})
+}
+
+// En: OAuthStart begins social sign-in with the given provider and returns the authorization URL to redirect the browser to.
+// Es: OAuthStart inicia el inicio de sesión social con el proveedor dado y devuelve la URL de autorización a la que redirigir el navegador.
+func (handler *Handler) OAuthStart(ctx fiber.Ctx) error {
+	provider := ProviderType(strings.ToLower(ctx.Params("provider")))
+
+	authorizationURL, err := handler.service.StartOAuth(ctx.Context(), provider)
+	if err != nil {
+		if errors.Is(err, ErrOAuthProviderNotConfigured) {
+			return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeOAuthProviderNotSupported, "OAuth provider not supported")
+		}
+		slog.Error("oauth start", "provider", provider, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadGateway, runtimeError.CodeOAuthFailed, "Could not start sign-in with provider")
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": fiber.Map{
+			"authorization_url": authorizationURL,
+		},
+	})
+}
+
+// En: OAuthCallback completes social sign-in (state, PKCE code exchange, ID token) and returns a token pair.
+// Es: OAuthCallback completa el inicio de sesión social (state, intercambio de código PKCE, ID token) y devuelve un par de tokens.
+func (handler *Handler) OAuthCallback(ctx fiber.Ctx) error {
+	provider := ProviderType(strings.ToLower(ctx.Params("provider")))
+
+	var req OAuthCallbackRequest
+	if err := ctx.Bind().Query(&req); err != nil {
+		slog.Debug("oauth callback bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid query parameters")
+	}
+	if req.Error != "" {
+		slog.Debug("oauth callback provider error", "provider", provider, "error", req.Error)
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeOAuthFailed, "Sign-in with provider was not completed")
+	}
+	if err := validator.Validate(req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	pair, err := handler.service.CompleteOAuth(ctx.Context(), provider, req.Code, req.State, sessionMetadata(ctx, ""))
+	if err != nil {
+		var mfaErr *MFARequiredError
+		if errors.As(err, &mfaErr) {
+			return respondMFARequired(ctx, mfaErr)
+		}
+		if errors.Is(err, ErrOAuthProviderNotConfigured) {
+			return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeOAuthProviderNotSupported, "OAuth provider not supported")
+		}
+		if errors.Is(err, ErrInvalidOAuthState) {
+			return runtimeError.Respond(ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeInvalidOAuthState, "Invalid or expired OAuth state")
+		}
+		if errors.Is(err, ErrOAuthFailed) {
+			return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeOAuthFailed, "Sign-in with provider failed")
+		}
+		if errors.Is(err, ErrEmailNotVerified) {
+			return runtimeError.Respond(ctx, fiber.StatusForbidden, runtimeError.CodeEmailVerificationRequired, "The provider did not return a verified email")
+		}
+		slog.Error("oauth callback", "provider", provider, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Sign-in with provider failed")
+	}
+
+	return handler.respondTokenPair(ctx, pair)
+}
+
+// En: ListAuthProviders returns the login methods linked to the authenticated user.
+// Es: ListAuthProviders devuelve los métodos de inicio de sesión enlazados al usuario autenticado.
+func (handler *Handler) ListAuthProviders(ctx fiber.Ctx) error {
+	requestContext, err := requestctx.UserOnly(ctx)
+	if err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	providers, err := handler.service.ListAuthProviders(requestContext.UserID)
+	if err != nil {
+		slog.Error("list auth providers", "user_id", requestContext.UserID, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not list auth providers")
+	}
+
+	return ctx.JSON(fiber.Map{"data": providers})
+}
+
+// En: StartLinkAuthProvider begins linking a social provider to the authenticated user and returns the authorization URL.
+// Es: StartLinkAuthProvider inicia el enlace de un proveedor social al usuario autenticado y devuelve la URL de autorización.
+func (handler *Handler) StartLinkAuthProvider(ctx fiber.Ctx) error {
+	requestContext, err := requestctx.UserOnly(ctx)
+	if err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+	if requestContext.ActorID != "" {
+		return runtimeError.Respond(ctx, fiber.StatusForbidden, runtimeError.CodeForbidden, "Impersonation sessions cannot link providers")
+	}
+	provider := ProviderType(strings.ToLower(ctx.Params("provider")))
+
+	authorizationURL, err := handler.service.StartOAuthLink(ctx.Context(), requestContext.UserID, provider)
+	if err != nil {
+		if errors.Is(err, ErrOAuthProviderNotConfigured) {
+			return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeOAuthProviderNotSupported, "OAuth provider not supported")
+		}
+		slog.Error("start link auth provider", "user_id", requestContext.UserID, "provider", provider, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadGateway, runtimeError.CodeOAuthFailed, "Could not start linking with provider")
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": fiber.Map{
+			"authorization_url": authorizationURL,
+		},
+	})
+}
+
+// En: CompleteLinkAuthProvider finishes the link flow with the code and state returned by the provider.
+// Es: CompleteLinkAuthProvider finaliza el flujo de enlace con el código y el state devueltos por el proveedor.
+func (handler *Handler) CompleteLinkAuthProvider(ctx fiber.Ctx) error {
+	requestContext, err := requestctx.UserOnly(ctx)
+	if err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+	if requestContext.ActorID != "" {
+		return runtimeError.Respond(ctx, fiber.StatusForbidden, runtimeError.CodeForbidden, "Impersonation sessions cannot link providers")
+	}
+	provider := ProviderType(strings.ToLower(ctx.Params("provider")))
+
+	var req LinkAuthProviderRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("link auth provider bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if err := validator.Validate(req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	link, err := handler.service.CompleteOAuthLink(ctx.Context(), requestContext.UserID, provider, req.Code, req.State)
+	if err != nil {
+		if errors.Is(err, ErrOAuthProviderNotConfigured) {
+			return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeOAuthProviderNotSupported, "OAuth provider not supported")
+		}
+		if errors.Is(err, ErrInvalidOAuthState) {
+			return runtimeError.Respond(ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeInvalidOAuthState, "Invalid or expired OAuth state")
+		}
+		if errors.Is(err, ErrOAuthFailed) {
+			return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeOAuthFailed, "Linking with provider failed")
+		}
+		if errors.Is(err, ErrAuthProviderAlreadyLinked) {
+			return runtimeError.Respond(ctx, fiber.StatusConflict, runtimeError.CodeAuthProviderAlreadyLinked, "This provider is already linked")
+		}
+		slog.Error("complete link auth provider", "user_id", requestContext.UserID, "provider", provider, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Linking with provider failed")
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{"data": link})
+}
+
+// En: UnlinkAuthProvider removes a login method from the authenticated user; the last one cannot be removed.
+// Es: UnlinkAuthProvider elimina un método de inicio de sesión del usuario autenticado; el último no puede eliminarse.
+func (handler *Handler) UnlinkAuthProvider(ctx fiber.Ctx) error {
+	requestContext, err := requestctx.UserOnly(ctx)
+	if err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	if err := handler.service.UnlinkAuthProvider(requestContext.UserID, ctx.Params("id")); err != nil {
+		if errors.Is(err, ErrAuthProviderNotFound) {
+			return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeAuthProviderNotFound, "Auth provider not found")
+		}
+		if errors.Is(err, ErrLastLoginMethod) {
+			return runtimeError.Respond(ctx, fiber.StatusConflict, runtimeError.CodeLastLoginMethod, "Cannot remove the last login method")
+		}
+		slog.Error("unlink auth provider", "user_id", requestContext.UserID, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not unlink auth provider")
+	}
+
+	return ctx.Status(fiber.StatusNoContent).Send(nil)
+}
+
+// En: VerifyMFA completes the two-step login with the MFA token from login and a TOTP or recovery code.
+// Es: VerifyMFA completa el login en dos pasos con el token MFA del login y un código TOTP o de recuperación.
+func (handler *Handler) VerifyMFA(ctx fiber.Ctx) error {
+	var req VerifyMFARequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("verify mfa bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if err := validator.Validate(req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	// Failures count against the challenge owner's email and the client IP, like password failures.
+	email := ""
+	if handler.loginThrottle != nil {
+		if challengeEmail, err := handler.service.MFAChallengeEmail(req.MFAToken); err == nil {
+			email = challengeEmail
+		}
+		if err := handler.loginThrottle.Check(ctx.Context(), email, ctx.IP()); err != nil {
+			var limitErr *RateLimitError
+			if errors.As(err, &limitErr) {
+				return respondRateLimited(ctx, limitErr.RetryAfter, limitErr.Dimension, "Too many failed login attempts. Try again later")
+			}
+			slog.Error("verify mfa throttle", "error", err)
+			return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Login failed")
+		}
+	}
+
+	pair, err := handler.service.VerifyMFA(req.MFAToken, req.Code, sessionMetadata(ctx, req.DeviceName))
+	if err != nil {
+		if errors.Is(err, ErrInvalidMFAToken) || errors.Is(err, ErrInvalidTwoFactorCode) {
+			if handler.loginThrottle != nil {
+				if err := handler.loginThrottle.RecordFailure(ctx.Context(), email, ctx.IP()); err != nil {
+					slog.Error("verify mfa throttle record failure", "error", err)
+				}
+			}
+		}
+		if errors.Is(err, ErrInvalidMFAToken) || errors.Is(err, ErrTwoFactorNotEnabled) {
+			return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeInvalidMFAToken, "Invalid or expired MFA token")
+		}
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeInvalidTwoFactorCode, "Invalid two-factor code")
+		}
+		slog.Error("verify mfa", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Login failed")
+	}
+
+	handler.resetLoginThrottle(ctx, email)
+	return handler.respondTokenPair(ctx, pair)
+}
+
+// En: EnrollTwoFactor starts TOTP enrollment for the authenticated user and returns the secret and otpauth URI.
+// Es: EnrollTwoFactor inicia la inscripción TOTP del usuario autenticado y devuelve el secreto y el URI otpauth.
+func (handler *Handler) EnrollTwoFactor(ctx fiber.Ctx) error {
+	requestContext, err := requestctx.UserOnly(ctx)
+	if err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+	if requestContext.ActorID != "" {
+		return runtimeError.Respond(ctx, fiber.StatusForbidden, runtimeError.CodeForbidden, "Impersonation sessions cannot enroll two-factor authentication")
+	}
+
+	enrollment, err := handler.service.EnrollTwoFactor(requestContext.UserID)
+	if err != nil {
+		if errors.Is(err, ErrTwoFactorAlreadyEnabled) {
+			return runtimeError.Respond(ctx, fiber.StatusConflict, runtimeError.CodeTwoFactorAlreadyEnabled, "Two-factor authentication is already enabled")
+		}
+		if errors.Is(err, user.ErrNotFound) {
+			return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeUserNotFound, "User not found")
+		}
+		slog.Error("enroll two factor", "user_id", requestContext.UserID, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not start two-factor enrollment")
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"data": enrollment})
+}
+
+// En: ConfirmTwoFactor enables 2FA with a first TOTP code and returns the recovery codes.
+// Es: ConfirmTwoFactor activa el 2FA con un primer código TOTP y devuelve los códigos de recuperación.
+func (handler *Handler) ConfirmTwoFactor(ctx fiber.Ctx) error {
+	requestContext, err := requestctx.UserOnly(ctx)
+	if err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+	if requestContext.ActorID != "" {
+		return runtimeError.Respond(ctx, fiber.StatusForbidden, runtimeError.CodeForbidden, "Impersonation sessions cannot enable two-factor authentication")
+	}
+
+	var req ConfirmTwoFactorRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("confirm two factor bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if err := validator.Validate(req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	recoveryCodes, err := handler.service.ConfirmTwoFactor(requestContext.UserID, req.Code)
+	if err != nil {
+		if errors.Is(err, ErrTwoFactorNotEnabled) {
+			return runtimeError.Respond(ctx, fiber.StatusConflict, runtimeError.CodeTwoFactorNotEnabled, "Two-factor enrollment has not been started")
+		}
+		if errors.Is(err, ErrTwoFactorAlreadyEnabled) {
+			return runtimeError.Respond(ctx, fiber.StatusConflict, runtimeError.CodeTwoFactorAlreadyEnabled, "Two-factor authentication is already enabled")
+		}
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			return runtimeError.Respond(ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeInvalidTwoFactorCode, "Invalid two-factor code")
+		}
+		slog.Error("confirm two factor", "user_id", requestContext.UserID, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not enable two-factor authentication")
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": fiber.Map{
+			"recovery_codes": recoveryCodes,
+		},
+		"message": "Two-factor authentication enabled",
+	})
+}
+
+// En: DisableTwoFactor turns 2FA off after re-authentication (password and a TOTP or recovery code). Failures count
+// towards the login throttle.
+// Es: DisableTwoFactor desactiva el 2FA tras reautenticación (contraseña y un código TOTP o de recuperación). Los fallos
+// cuentan para el throttle de login.
+func (handler *Handler) DisableTwoFactor(ctx fiber.Ctx) error {
+	requestContext, err := requestctx.UserOnly(ctx)
+	if err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+
+	var req DisableTwoFactorRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("disable two factor bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if err := validator.Validate(req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	if handler.loginThrottle != nil {
+		if err := handler.loginThrottle.Check(ctx.Context(), requestContext.Email, ctx.IP()); err != nil {
+			var limitErr *RateLimitError
+			if errors.As(err, &limitErr) {
+				return respondRateLimited(ctx, limitErr.RetryAfter, limitErr.Dimension, "Too many failed attempts. Try again later")
+			}
+			slog.Error("disable two factor throttle", "error", err)
+			return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not disable two-factor authentication")
+		}
+	}
+
+	if err := handler.service.DisableTwoFactor(requestContext.UserID, req.Password, req.Code); err != nil {
+		if errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrInvalidTwoFactorCode) {
+			if handler.loginThrottle != nil {
+				if err := handler.loginThrottle.RecordFailure(ctx.Context(), requestContext.Email, ctx.IP()); err != nil {
+					slog.Error("disable two factor throttle record failure", "error", err)
+				}
+			}
+			if errors.Is(err, ErrInvalidCredentials) {
+				return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeInvalidCredentials, "Invalid password")
+			}
+			return runtimeError.Respond(ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeInvalidTwoFactorCode, "Invalid two-factor code")
+		}
+		if errors.Is(err, ErrTwoFactorNotEnabled) {
+			return runtimeError.Respond(ctx, fiber.StatusConflict, runtimeError.CodeTwoFactorNotEnabled, "Two-factor authentication is not enabled")
+		}
+		if errors.Is(err, user.ErrNotFound) {
+			return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeUserNotFound, "User not found")
+		}
+		slog.Error("disable two factor", "user_id", requestContext.UserID, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not disable two-factor authentication")
+	}
+
+	handler.resetLoginThrottle(ctx, requestContext.Email)
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+}
+
+// En: Reauthenticate confirms the password (or a TOTP or recovery code) of the signed-in user and returns a short-lived
+// elevated access token accepted by routes that require recent authentication. Failures count towards the login throttle.
+// Es: Reauthenticate confirma la contraseña (o un código TOTP o de recuperación) del usuario con sesión iniciada y devuelve
+// un token de acceso elevado de corta duración que aceptan las rutas que exigen autenticación reciente. Los fallos cuentan
+// para el throttle de login.
+func (handler *Handler) Reauthenticate(ctx fiber.Ctx) error {
+	requestContext, err := requestctx.UserOnly(ctx)
+	if err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+	if requestContext.ActorID != "" {
+		return runtimeError.Respond(ctx, fiber.StatusForbidden, runtimeError.CodeForbidden, "Impersonation sessions cannot reauthenticate")
+	}
+
+	var req ReauthenticateRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("reauthenticate bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if err := validator.Validate(req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	if handler.loginThrottle != nil {
+		if err := handler.loginThrottle.Check(ctx.Context(), requestContext.Email, ctx.IP()); err != nil {
+			var limitErr *RateLimitError
+			if errors.As(err, &limitErr) {
+				return respondRateLimited(ctx, limitErr.RetryAfter, limitErr.Dimension, "Too many failed attempts. Try again later")
+			}
+			slog.Error("reauthenticate throttle", "error", err)
+			return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not reauthenticate")
+		}
+	}
+
+	token, err := handler.service.Reauthenticate(requestContext.UserID, requestContext.SessionID, req.Password, req.Code)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrInvalidTwoFactorCode) {
+			if handler.loginThrottle != nil {
+				if err := handler.loginThrottle.RecordFailure(ctx.Context(), requestContext.Email, ctx.IP()); err != nil {
+					slog.Error("reauthenticate throttle record failure", "error", err)
+				}
+			}
+			if errors.Is(err, ErrInvalidCredentials) {
+				return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeInvalidCredentials, "Invalid password")
+			}
+			return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeInvalidTwoFactorCode, "Invalid two-factor code")
+		}
+		if errors.Is(err, ErrTwoFactorNotEnabled) {
+			return runtimeError.Respond(ctx, fiber.StatusConflict, runtimeError.CodeTwoFactorNotEnabled, "Two-factor authentication is not enabled")
+		}
+		if errors.Is(err, ErrSessionNotFound) {
+			return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeTokenRevoked, "Session has ended")
+		}
+		if errors.Is(err, user.ErrNotFound) {
+			return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeUserNotFound, "User not found")
+		}
+		slog.Error("reauthenticate", "user_id", requestContext.UserID, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not reauthenticate")
+	}
+
+	handler.resetLoginThrottle(ctx, requestContext.Email)
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"data": token})
+}
+
+// En: Impersonate lets a platform admin obtain a short-lived access token acting as the user in the path.
+// Es: Impersonate permite a un platform admin obtener un token de acceso de corta duración actuando como el usuario de la ruta.
+func (handler *Handler) Impersonate(ctx fiber.Ctx) error {
+	requestContext, err := requestctx.UserOnly(ctx)
+	if err != nil {
+		return runtimeError.Respond(ctx, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
+	}
+	if requestContext.ActorID != "" {
+		return runtimeError.Respond(ctx, fiber.StatusForbidden, runtimeError.CodeForbidden, "Impersonation sessions cannot impersonate")
+	}
+
+	var req ImpersonateRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("impersonate bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if err := validator.Validate(req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	token, err := handler.service.Impersonate(requestContext.UserID, ctx.Params("userID"), req.Reason, req.AllowWrites)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotPlatformAdmin):
+			return runtimeError.Respond(ctx, fiber.StatusForbidden, runtimeError.CodeForbidden, "Platform admin role required")
+		case errors.Is(err, ErrImpersonationNotAllowed):
+			return runtimeError.Respond(ctx, fiber.StatusForbidden, runtimeError.CodeForbidden, "This user cannot be impersonated")
+		case errors.Is(err, user.ErrNotFound):
+			return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeUserNotFound, "User not found")
+		}
+		slog.Error("impersonate", "actor_id", requestContext.UserID, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not start impersonation")
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{"data": token})
+}
+
+// En: JWKS publishes the access token verification keys as a JSON Web Key Set (RFC 7517).
+// Es: JWKS publica las claves de verificación de los tokens de acceso como un JSON Web Key Set (RFC 7517).
+func (handler *Handler) JWKS(ctx fiber.Ctx) error {
+	ctx.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return ctx.JSON(fiber.Map{"keys": handler.service.jwks()})
+}
+
+// En: DevGetVerificationToken returns the current email verification token for a given email.
+//
+//	This endpoint is intended for development environments only.
+//
+// Es: DevGetVerificationToken devuelve el token de verificación de correo electrónico actual para un correo dado.
+//
+//	Este endpoint está pensado solo para entornos de desarrollo.
+func (handler *Handler) DevGetVerificationToken(ctx fiber.Ctx) error {
+	var req ResendVerificationRequest
+	if err := ctx.Bind().Body(&req); err != nil {
+		slog.Debug("dev get verification token bind error", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Invalid request body")
+	}
+	if err := validator.Validate(req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
+		return runtimeError.Respond(ctx, fiber.StatusBadRequest, runtimeError.CodeValidationError, err.Error())
+	}
+
+	token, err := handler.service.ResendVerification(req.Email)
+	if err != nil {
+		if errors.Is(err, ErrEmailAlreadyVerified) {
+			return runtimeError.Respond(ctx, fiber.StatusConflict, runtimeError.CodeEmailAlreadyVerified, "Email is already verified")
+		}
+		if errors.Is(err, user.ErrNotFound) {
+			return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeUserNotFound, "User not found")
+		}
+		slog.Error("dev get verification token", "email", req.Email, "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not generate verification token")
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": fiber.Map{
+			"token": token,
+		},
+	})
+}
+
+// maxSessionUserAgentLength caps the stored User-Agent header.
+const maxSessionUserAgentLength = 512
+
+// En: sessionMetadata collects the client details stored with a session (User-Agent, IP and optional device name).
+// Es: sessionMetadata recoge los datos del cliente que se guardan con una sesión (User-Agent, IP y nombre de dispositivo opcional).
+func sessionMetadata(ctx fiber.Ctx, deviceName string) SessionMetadata {
+	userAgent := ctx.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > maxSessionUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:maxSessionUserAgentLength], "")
+	}
+	return SessionMetadata{
+		UserAgent:  userAgent,
+		IPAddress:  ctx.IP(),
+		DeviceName: deviceName,
+	}
+}
+
+// En: respondMFARequired answers a first login step that needs a second factor with the MFA challenge token.
+// Es: respondMFARequired responde a un primer paso de login que necesita segundo factor con el token de desafío MFA.
+func respondMFARequired(ctx fiber.Ctx, mfaErr *MFARequiredError) error {
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": fiber.Map{
+			"mfa_required": true,
+			"mfa_token":    mfaErr.MFAToken,
+			"expires_at":   mfaErr.ExpiresAt,
+		},
+	})
+}
+
+// En: respondRateLimited writes a 429 response with the Retry-After header (in whole seconds, at least 1)
+// and, when known, a detail naming the throttle dimension that tripped ("email" or "ip").
+// Es: respondRateLimited escribe una respuesta 429 con la cabecera Retry-After (en segundos enteros, mínimo 1)
+// y, si se conoce, un detalle con la dimensión de throttle que se activó ("email" o "ip").
+func respondRateLimited(ctx fiber.Ctx, retryAfter time.Duration, dimension, message string) error {
+	setRetryAfter(ctx, retryAfter)
+	switch dimension {
+	case ThrottleDimensionEmail:
+		return runtimeError.RespondWithDetails(ctx, fiber.StatusTooManyRequests, runtimeError.CodeRateLimited, message,
+			[]runtimeError.ErrorDetail{{Field: ThrottleDimensionEmail, Message: "Too many requests for this email address"}})
+	case ThrottleDimensionIP:
+		return runtimeError.RespondWithDetails(ctx, fiber.StatusTooManyRequests, runtimeError.CodeRateLimited, message,
+			[]runtimeError.ErrorDetail{{Field: ThrottleDimensionIP, Message: "Too many requests from this IP address"}})
+	}
+	return runtimeError.Respond(ctx, fiber.StatusTooManyRequests, runtimeError.CodeRateLimited, message)
+}
+
+// setRetryAfter sets the Retry-After header in whole seconds, at least one.
+func setRetryAfter(ctx fiber.Ctx, retryAfter time.Duration) {
+	retryAfterSeconds := int64(retryAfter.Seconds())
+	if retryAfterSeconds <= 0 {
+		retryAfterSeconds = 1
+	}
+	ctx.Set("Retry-After", strconv.FormatInt(retryAfterSeconds, 10))
+}
+
+// respondOAuthError writes an RFC 6749 error body ({"error", "error_description"}) for the device grant endpoints.
+func respondOAuthError(ctx fiber.Ctx, status int, code, description string) error {
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	return ctx.Status(status).JSON(fiber.Map{"error": code, "error_description": description})
+}
+
+// oauthClientCredentials reads the client id and secret from an HTTP Basic header (RFC 6749 section 2.3.1) or the
+// body; ok is false when the Basic header is malformed or both are used.
+func oauthClientCredentials(ctx fiber.Ctx, bodyClientID, bodyClientSecret string) (OAuthClientCredentials, bool) {
+	authorization := ctx.Get(fiber.HeaderAuthorization)
+	if authorization == "" {
+		return OAuthClientCredentials{ClientID: bodyClientID, ClientSecret: bodyClientSecret}, true
+	}
+	encoded, found := strings.CutPrefix(authorization, "Basic ")
+	if !found || bodyClientSecret != "" {
+		return OAuthClientCredentials{}, false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return OAuthClientCredentials{}, false
+	}
+	rawID, rawSecret, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return OAuthClientCredentials{}, false
+	}
+	clientID, errID := url.QueryUnescape(rawID)
+	clientSecret, errSecret := url.QueryUnescape(rawSecret)
+	if errID != nil || errSecret != nil {
+		return OAuthClientCredentials{}, false
+	}
+	return OAuthClientCredentials{ClientID: clientID, ClientSecret: clientSecret}, true
+}
+
+// respondInvalidOAuthClient writes the invalid_client error with the Basic challenge RFC 6749 section 5.2 asks for.
+func respondInvalidOAuthClient(ctx fiber.Ctx) error {
+	ctx.Set(fiber.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+	return respondOAuthError(ctx, fiber.StatusUnauthorized, "invalid_client", "Client authentication failed")
+}
+
+// respondAuthorizationRequestError maps errors of an authorization request; they are shown on the consent page and
+// never redirected to the client, since the client or its redirect URI may be the invalid part.
+func respondAuthorizationRequestError(ctx fiber.Ctx, err error) error {
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) {
+		return runtimeError.RespondWithDetails(
+			ctx, fiber.StatusBadRequest, runtimeError.CodeInvalidAuthorizationRequest,
+			"Invalid authorization request", toErrorDetails(ve),
+		)
+	}
+	return respondOAuthServerError(ctx, "oauth authorization", err)
+}
+
+// respondOAuthServerError answers 404 when the OAuth provider is not configured and 500 otherwise.
+func respondOAuthServerError(ctx fiber.Ctx, operation string, err error) error {
+	if errors.Is(err, ErrOAuthServerDisabled) {
+		return runtimeError.Respond(ctx, fiber.StatusNotFound, runtimeError.CodeOAuthServerDisabled, "OAuth authorization server is not enabled")
+	}
+	slog.Error(operation, "error", err)
+	return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Internal server error")
+}
+
 // En: toErrorDetails converts validator.ValidationErrors to runtimeError.ErrorDetail slice.
 // Es: toErrorDetails convierte validator.ValidationErrors en un slice de runtimeError.ErrorDetail.
 func toErrorDetails(validationErrors validator.ValidationErrors) []runtimeError.ErrorDetail {
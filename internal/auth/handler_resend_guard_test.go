@@ -3,11 +3,13 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/cloudflax/api.cloudflax/internal/shared/database"
 	runtimeError "github.com/cloudflax/api.cloudflax/internal/shared/runtimeerror"
 	"github.com/gofiber/fiber/v3"
 	"github.com/stretchr/testify/assert"
@@ -30,7 +32,7 @@ func TestResendVerificationRateLimited(test *testing.T) {
 	require.NoError(test, err)
 
 	handler.WithResendVerificationGuard(testResendGuard{
-		err: &ResendVerificationRateLimitError{RetryAfter: 2 * time.Hour},
+		err: &ResendVerificationRateLimitError{RetryAfter: 2 * time.Hour, Dimension: ThrottleDimensionIP},
 	})
 
 	app := fiber.New()
@@ -50,4 +52,99 @@ func TestResendVerificationRateLimited(test *testing.T) {
 	var result runtimeError.ErrorResponse
 	require.NoError(test, json.NewDecoder(resp.Body).Decode(&result))
 	assert.Equal(test, runtimeError.CodeRateLimited, result.Error.Code)
+	require.Len(test, result.Error.Details, 1)
+	assert.Equal(test, ThrottleDimensionIP, result.Error.Details[0].Field)
+}
+
+type testLoginThrottle struct {
+	checkErr error
+	failures []string
+	resets   []string
+}
+
+func (t *testLoginThrottle) Check(_ context.Context, _, _ string) error {
+	return t.checkErr
+}
+
+func (t *testLoginThrottle) RecordFailure(_ context.Context, email, _ string) error {
+	t.failures = append(t.failures, email)
+	return nil
+}
+
+func (t *testLoginThrottle) Reset(_ context.Context, email string) error {
+	t.resets = append(t.resets, email)
+	return nil
+}
+
+// En: TestLoginThrottled tests that a locked login answers 429 with Retry-After and records failures and resets.
+// Es: TestLoginThrottled prueba que un login bloqueado responde 429 con Retry-After y registra fallos y reinicios.
+func TestLoginThrottled(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+	createVerifiedTestUser(test, "Throttle", "throttle@example.com", "password123")
+
+	throttle := &testLoginThrottle{}
+	handler.WithLoginThrottle(throttle)
+
+	app := fiber.New()
+	app.Post("/auth/login", handler.Login)
+	login := func(password string) *http.Response {
+		body := strings.NewReader(`{"email":"throttle@example.com","password":"` + password + `"}`)
+		req := httptest.NewRequest("POST", "/auth/login", body)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+		require.NoError(test, err)
+		test.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	assert.Equal(test, fiber.StatusUnauthorized, login("wrong-password").StatusCode)
+	assert.Equal(test, []string{"throttle@example.com"}, throttle.failures)
+
+	assert.Equal(test, fiber.StatusOK, login("password123").StatusCode)
+	assert.Equal(test, []string{"throttle@example.com"}, throttle.resets)
+
+	throttle.checkErr = &RateLimitError{RetryAfter: 15 * time.Minute}
+	resp := login("password123")
+	assert.Equal(test, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(test, "900", resp.Header.Get("Retry-After"))
+
+	var result runtimeError.ErrorResponse
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(test, runtimeError.CodeRateLimited, result.Error.Code)
+	assert.Len(test, throttle.resets, 1, "a throttled request never reaches the password check")
+}
+
+// En: TestDeviceAuthorizationRateLimited tests that device code requests are throttled per IP and answer 429 in the OAuth format.
+// Es: TestDeviceAuthorizationRateLimited prueba que las solicitudes de device code se limitan por IP y responden 429 en el formato OAuth.
+func TestDeviceAuthorizationRateLimited(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+	handler.WithDeviceCodeGuard(NewMemoryResendVerificationGuard(ThrottleScopeDeviceCode, ResendVerificationLimits{
+		IP: ThrottleLimits{MaxAttempts: 2, Window: time.Hour, Lock: time.Hour},
+	}))
+
+	app := fiber.New()
+	app.Post("/auth/device/code", handler.DeviceAuthorization)
+	requestCode := func() *http.Response {
+		req := httptest.NewRequest("POST", "/auth/device/code", strings.NewReader("client_id=cloudflax-cli"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+		require.NoError(test, err)
+		test.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	assert.Equal(test, fiber.StatusOK, requestCode().StatusCode)
+	assert.Equal(test, fiber.StatusOK, requestCode().StatusCode)
+
+	resp := requestCode()
+	assert.Equal(test, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(test, "3600", resp.Header.Get("Retry-After"))
+
+	var result map[string]string
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(test, "slow_down", result["error"])
+
+	var count int64
+	require.NoError(test, database.DB.Model(&DeviceAuthorization{}).Count(&count).Error)
+	assert.Equal(test, int64(2), count, "a throttled request does not store a device authorization")
 }
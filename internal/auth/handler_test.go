@@ -5,16 +5,22 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"io"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/cloudflax/api.cloudflax/internal/account"
 	"github.com/cloudflax/api.cloudflax/internal/shared/database"
+	"github.com/cloudflax/api.cloudflax/internal/shared/middleware"
 	runtimeError "github.com/cloudflax/api.cloudflax/internal/shared/runtimeerror"
+	"github.com/cloudflax/api.cloudflax/internal/shared/validator"
 	"github.com/cloudflax/api.cloudflax/internal/shared/verificationnotify"
 	"github.com/cloudflax/api.cloudflax/internal/user"
 	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -35,7 +41,7 @@ const testJWTSecret = "test-secret-key-for-unit-tests-only"
 func SetupAuthHandlerTest(test *testing.T) (*Handler, *Service) {
 	test.Helper()
 	require.NoError(test, database.InitForTesting())
-	require.NoError(test, database.RunMigrations(&user.User{}, &UserAuthProvider{}, &RefreshToken{}))
+	require.NoError(test, database.RunMigrations(&user.User{}, &UserAuthProvider{}, &RefreshToken{}, &PasswordResetToken{}, &OAuthState{}, &TOTPCredential{}, &RecoveryCode{}, &MFAChallenge{}, &Session{}, &RevokedAccessToken{}, &EmailChangeToken{}, &MagicLinkToken{}, &EmailVerificationCode{}, &DeviceAuthorization{}, &OAuthAuthorizationCode{}, &OAuthGrant{}))
 
 	userRepository := user.NewRepository(database.DB)
 	authRepository := NewRepository(database.DB)
@@ -43,6 +49,7 @@ func SetupAuthHandlerTest(test *testing.T) (*Handler, *Service) {
 		JWTSecret:            testJWTSecret,
 		VerificationNotifier: verificationnotify.NoopNotifier{},
 		FrontendURL:          "http://test",
+		RevocationStore:      NewMemoryTokenRevocationStore(),
 	})
 	authHandler := NewHandler(authService)
 	return authHandler, authService
@@ -224,7 +231,7 @@ func TestRefreshSuccess(test *testing.T) {
 	handler, service := SetupAuthHandlerTest(test)
 	createVerifiedTestUser(test, "Dave", "dave@example.com", "password123")
 
-	pair, err := service.Login("dave@example.com", "password123")
+	pair, err := service.Login("dave@example.com", "password123", SessionMetadata{})
 	require.NoError(test, err)
 
 	app := fiber.New()
@@ -276,7 +283,7 @@ func TestRefreshRejectsAccessTokenAsRefreshToken(test *testing.T) {
 	handler, service := SetupAuthHandlerTest(test)
 	createVerifiedTestUser(test, "Frank", "frank@example.com", "password123")
 
-	pair, err := service.Login("frank@example.com", "password123")
+	pair, err := service.Login("frank@example.com", "password123", SessionMetadata{})
 	require.NoError(test, err)
 
 	app := fiber.New()
@@ -302,7 +309,7 @@ func TestRefreshTokenRotationOldTokenInvalidAfterRefresh(test *testing.T) {
 	handler, service := SetupAuthHandlerTest(test)
 	createVerifiedTestUser(test, "Eve", "eve@example.com", "password123")
 
-	pair, err := service.Login("eve@example.com", "password123")
+	pair, err := service.Login("eve@example.com", "password123", SessionMetadata{})
 	require.NoError(test, err)
 
 	app := fiber.New()
@@ -356,6 +363,93 @@ func TestRefreshEmailNotVerified(test *testing.T) {
 	assert.Equal(test, runtimeError.CodeEmailVerificationRequired, errResp.Error.Code)
 }
 
+// En: TestLoginAndRefreshWithCookie verifies that cookie mode keeps the refresh token out of the body and refreshes from the cookie.
+// Es: TestLoginAndRefreshWithCookie verifica que el modo cookie deja el refresh token fuera del cuerpo y refresca desde la cookie.
+func TestLoginAndRefreshWithCookie(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+	handler.WithRefreshTokenCookie(RefreshTokenCookieOptions{})
+	createVerifiedTestUser(test, "Cora", "cora@example.com", "password123")
+
+	app := fiber.New()
+	app.Post("/auth/login", handler.Login)
+	app.Post("/auth/refresh", handler.Refresh)
+
+	bodyStr, _ := json.Marshal(map[string]string{"email": "cora@example.com", "password": "password123"})
+	req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(string(bodyStr)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	require.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	var login struct {
+		Data map[string]any `json:"data"`
+	}
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&login))
+	assert.NotContains(test, login.Data, "refresh_token")
+	csrfToken, _ := login.Data["csrf_token"].(string)
+	require.NotEmpty(test, csrfToken)
+
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	refreshCookie := cookies[RefreshTokenCookieName]
+	require.NotNil(test, refreshCookie)
+	assert.True(test, refreshCookie.HttpOnly)
+	assert.True(test, refreshCookie.Secure)
+	assert.Equal(test, "/auth", refreshCookie.Path)
+	assert.Equal(test, http.SameSiteStrictMode, refreshCookie.SameSite)
+	require.NotNil(test, cookies[CSRFTokenCookieName])
+	assert.False(test, cookies[CSRFTokenCookieName].HttpOnly, "the SPA must be able to read the CSRF cookie")
+
+	req = httptest.NewRequest("POST", "/auth/refresh", nil)
+	req.AddCookie(&http.Cookie{Name: RefreshTokenCookieName, Value: refreshCookie.Value})
+	req.AddCookie(&http.Cookie{Name: CSRFTokenCookieName, Value: csrfToken})
+	req.Header.Set(CSRFTokenHeader, csrfToken)
+	resp2, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp2.Body.Close()
+	assert.Equal(test, fiber.StatusOK, resp2.StatusCode)
+
+	var refreshed struct {
+		Data CookieTokenResponse `json:"data"`
+	}
+	require.NoError(test, json.NewDecoder(resp2.Body).Decode(&refreshed))
+	assert.NotEmpty(test, refreshed.Data.AccessToken)
+	assert.NotEqual(test, csrfToken, refreshed.Data.CSRFToken, "the CSRF token rotates with the refresh token")
+}
+
+// En: TestRefreshCookieRequiresCSRFToken verifies that a cookie-borne refresh token without a matching X-CSRF-Token gets 403.
+// Es: TestRefreshCookieRequiresCSRFToken verifica que un refresh token en cookie sin un X-CSRF-Token que coincida recibe 403.
+func TestRefreshCookieRequiresCSRFToken(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	handler.WithRefreshTokenCookie(RefreshTokenCookieOptions{})
+	createVerifiedTestUser(test, "Cleo", "cleo@example.com", "password123")
+
+	pair, err := service.Login("cleo@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+
+	app := fiber.New()
+	app.Post("/auth/refresh", handler.Refresh)
+
+	for _, header := range []string{"", "other-token"} {
+		req := httptest.NewRequest("POST", "/auth/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: RefreshTokenCookieName, Value: pair.RefreshToken})
+		req.AddCookie(&http.Cookie{Name: CSRFTokenCookieName, Value: "csrf-token"})
+		if header != "" {
+			req.Header.Set(CSRFTokenHeader, header)
+		}
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+		require.NoError(test, err)
+		defer resp.Body.Close()
+
+		assert.Equal(test, fiber.StatusForbidden, resp.StatusCode)
+		errResp := DecodeErrorResponse(test, resp.Body)
+		assert.Equal(test, runtimeError.CodeCSRFTokenInvalid, errResp.Error.Code)
+	}
+}
+
 // --- Logout ---
 
 // En: TestLogoutSuccess tests the successful logout.
@@ -364,7 +458,7 @@ func TestLogoutSuccess(test *testing.T) {
 	handler, service := SetupAuthHandlerTest(test)
 	createVerifiedTestUser(test, "Frank", "frank@example.com", "password123")
 
-	pair, err := service.Login("frank@example.com", "password123")
+	pair, err := service.Login("frank@example.com", "password123", SessionMetadata{})
 	require.NoError(test, err)
 
 	app := fiber.New()
@@ -402,6 +496,202 @@ func TestLogoutWithoutAuth(test *testing.T) {
 	assert.Equal(test, fiber.StatusUnauthorized, resp.StatusCode)
 }
 
+// En: TestLogoutCurrentSessionOnly tests that scope "current" ends the session of the access token and keeps the others.
+// Es: TestLogoutCurrentSessionOnly prueba que el scope "current" cierra la sesión del token de acceso y mantiene las demás.
+func TestLogoutCurrentSessionOnly(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	createVerifiedTestUser(test, "Frank", "frank@example.com", "password123")
+
+	current, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	other, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+
+	app := fiber.New()
+	app.Post("/auth/logout", middleware.RequireAuth(service), handler.Logout)
+
+	req := httptest.NewRequest("POST", "/auth/logout", strings.NewReader(`{"scope":"current"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+current.AccessToken)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusNoContent, resp.StatusCode)
+
+	_, err = service.RefreshTokens(current.RefreshToken, SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidCredentials)
+	_, err = service.RefreshTokens(other.RefreshToken, SessionMetadata{})
+	assert.NoError(test, err)
+}
+
+// En: TestLogoutInvalidScope tests that an unknown logout scope is rejected.
+// Es: TestLogoutInvalidScope prueba que un scope de cierre de sesión desconocido se rechaza.
+func TestLogoutInvalidScope(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	createVerifiedTestUser(test, "Frank", "frank@example.com", "password123")
+
+	pair, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+
+	app := fiber.New()
+	app.Post("/auth/logout", middleware.RequireAuth(service), handler.Logout)
+
+	req := httptest.NewRequest("POST", "/auth/logout", strings.NewReader(`{"scope":"everything"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeValidationError, errResp.Error.Code)
+}
+
+// En: TestLogoutRevokesAccessToken tests that the access token used to log out is rejected by RequireAuth afterwards.
+// Es: TestLogoutRevokesAccessToken prueba que el token de acceso usado para cerrar sesión es rechazado después por RequireAuth.
+func TestLogoutRevokesAccessToken(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	createVerifiedTestUser(test, "Frank", "frank@example.com", "password123")
+
+	pair, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+
+	app := fiber.New()
+	app.Post("/auth/logout", middleware.RequireAuth(service), handler.Logout)
+	app.Get("/auth/sessions", middleware.RequireAuth(service), handler.ListSessions)
+
+	get := func() *http.Response {
+		req := httptest.NewRequest("GET", "/auth/sessions", nil)
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+		require.NoError(test, err)
+		return resp
+	}
+
+	resp := get()
+	resp.Body.Close()
+	require.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	req := httptest.NewRequest("POST", "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	logoutResp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	logoutResp.Body.Close()
+	require.Equal(test, fiber.StatusNoContent, logoutResp.StatusCode)
+
+	resp = get()
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusUnauthorized, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeTokenRevoked, errResp.Error.Code)
+}
+
+// --- Sessions ---
+
+// En: TestListSessionsMarksCurrent tests that the sessions list includes metadata and flags the calling session.
+// Es: TestListSessionsMarksCurrent prueba que la lista de sesiones incluye metadatos y marca la sesión que llama.
+func TestListSessionsMarksCurrent(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	createVerifiedTestUser(test, "Frank", "frank@example.com", "password123")
+
+	app := fiber.New()
+	app.Post("/auth/login", handler.Login)
+	app.Get("/auth/sessions", middleware.RequireAuth(service), handler.ListSessions)
+
+	_, err := service.Login("frank@example.com", "password123", SessionMetadata{DeviceName: "Phone"})
+	require.NoError(test, err)
+
+	loginBody := `{"email":"frank@example.com","password":"password123","device_name":"Work laptop"}`
+	loginReq := httptest.NewRequest("POST", "/auth/login", strings.NewReader(loginBody))
+	loginReq.Header.Set("Content-Type", "application/json")
+	loginReq.Header.Set("User-Agent", "TestAgent/1.0")
+	loginResp, err := app.Test(loginReq, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer loginResp.Body.Close()
+	require.Equal(test, fiber.StatusOK, loginResp.StatusCode)
+	var login struct {
+		Data TokenPair `json:"data"`
+	}
+	require.NoError(test, json.NewDecoder(loginResp.Body).Decode(&login))
+
+	req := httptest.NewRequest("GET", "/auth/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+login.Data.AccessToken)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	require.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	var result struct {
+		Data []SessionResponse `json:"data"`
+	}
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&result))
+	require.Len(test, result.Data, 2)
+
+	current := 0
+	for _, session := range result.Data {
+		if session.Current {
+			current++
+			assert.Equal(test, "Work laptop", session.DeviceName)
+			assert.Equal(test, "TestAgent/1.0", session.UserAgent)
+			assert.NotEmpty(test, session.IPAddress)
+		}
+	}
+	assert.Equal(test, 1, current)
+}
+
+// En: TestRevokeSessionNotFound tests that revoking an unknown session returns 404.
+// Es: TestRevokeSessionNotFound prueba que revocar una sesión desconocida devuelve 404.
+func TestRevokeSessionNotFound(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	createVerifiedTestUser(test, "Frank", "frank@example.com", "password123")
+
+	pair, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+
+	app := fiber.New()
+	app.Delete("/auth/sessions/:id", middleware.RequireAuth(service), handler.RevokeSession)
+
+	req := httptest.NewRequest("DELETE", "/auth/sessions/"+uuid.New().String(), nil)
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusNotFound, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeSessionNotFound, errResp.Error.Code)
+}
+
+// En: TestLogoutOtherSessionsSuccess tests that the other sessions are ended and the current one survives.
+// Es: TestLogoutOtherSessionsSuccess prueba que las demás sesiones se cierran y la actual sigue activa.
+func TestLogoutOtherSessionsSuccess(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	u := createVerifiedTestUser(test, "Frank", "frank@example.com", "password123")
+
+	current, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	_, err = service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+
+	app := fiber.New()
+	app.Post("/auth/sessions/logout-others", middleware.RequireAuth(service), handler.LogoutOtherSessions)
+
+	req := httptest.NewRequest("POST", "/auth/sessions/logout-others", nil)
+	req.Header.Set("Authorization", "Bearer "+current.AccessToken)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusNoContent, resp.StatusCode)
+
+	sessions, err := service.ListSessions(u.ID)
+	require.NoError(test, err)
+	require.Len(test, sessions, 1)
+	claims, err := service.ValidateAccessTokenClaims(current.AccessToken)
+	require.NoError(test, err)
+	assert.Equal(test, claims.SessionID, sessions[0].ID)
+}
+
 // --- Register ---
 
 // En: TestRegisterSuccess tests the successful registration.
@@ -491,6 +781,90 @@ func TestRegisterValidationError(test *testing.T) {
 	assert.Equal(test, runtimeError.CodeValidationError, errResp.Error.Code)
 }
 
+// En: TestRegisterPasswordPolicyViolation returns field-level details for a password rejected by the policy.
+// Es: TestRegisterPasswordPolicyViolation devuelve detalles por campo para una contraseña rechazada por la política.
+func TestRegisterPasswordPolicyViolation(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	breached, err := validator.LoadBreachedPasswords(strings.NewReader("CBFDAC6008F9CAB4083784CBD1874F76618D2A97:250\n"))
+	require.NoError(test, err)
+	service.passwordPolicy = validator.NewPasswordPolicy(validator.PasswordRules{RequireDigit: true, ForbidPersonalInfo: true}, breached)
+
+	app := fiber.New()
+	app.Post("/auth/register", handler.Register)
+
+	cases := map[string]string{
+		"Must not contain your email":                                "alice.reg-secret9",
+		"Must contain a digit":                                       "correct-horse",
+		"Has appeared in a data breach; choose a different password": "password123",
+	}
+	for message, password := range cases {
+		bodyStr, _ := json.Marshal(map[string]string{"name": "Alice", "email": "alice.reg@example.com", "password": password})
+		req := httptest.NewRequest("POST", "/auth/register", strings.NewReader(string(bodyStr)))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+		require.NoError(test, err)
+		assert.Equal(test, fiber.StatusUnprocessableEntity, resp.StatusCode, password)
+		errResp := DecodeErrorResponse(test, resp.Body)
+		resp.Body.Close()
+		assert.Equal(test, runtimeError.CodeValidationError, errResp.Error.Code)
+		assert.Equal(test, []runtimeError.ErrorDetail{{Field: "password", Message: message}}, errResp.Error.Details, password)
+	}
+
+	var count int64
+	require.NoError(test, database.DB.Model(&user.User{}).Count(&count).Error)
+	assert.Zero(test, count)
+}
+
+// En: TestRegisterWithInvitation checks that registering from an invitation link verifies the email and joins the account,
+// and that the token must be valid and sent to the registered email.
+// Es: TestRegisterWithInvitation comprueba que registrarse desde el enlace de una invitación verifica el email y une a la cuenta,
+// y que el token debe ser válido y enviado al email registrado.
+func TestRegisterWithInvitation(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	require.NoError(test, database.RunMigrations(&account.Account{}, &account.AccountMember{}, &account.AccountInvitation{}))
+	accountService := account.NewService(account.NewRepository(database.DB), user.NewRepository(database.DB))
+	service.accountInvitations = accountService
+
+	owner := createVerifiedTestUser(test, "Owner", "owner@example.com", "password123")
+	acc, _, err := accountService.CreateAccount("Owner Org", "", owner.ID)
+	require.NoError(test, err)
+	_, invitationToken, err := accountService.CreateInvitation(acc.ID, owner.ID, "invitee@example.com", account.RoleMember)
+	require.NoError(test, err)
+
+	app := fiber.New()
+	app.Post("/auth/register", handler.Register)
+	register := func(email, token string) (int, map[string]any) {
+		bodyStr, _ := json.Marshal(map[string]string{"name": "Invitee", "email": email, "password": "password123", "invitation_token": token})
+		req := httptest.NewRequest("POST", "/auth/register", strings.NewReader(string(bodyStr)))
+		req.Header.Set("Content-Type", "application/json")
+		return doOAuthRequest(test, app, req)
+	}
+
+	status, body := register("invitee@example.com", "unknown-token")
+	assert.Equal(test, fiber.StatusUnprocessableEntity, status)
+	assert.Equal(test, string(runtimeError.CodeInvalidInvitationToken), body["error"].(map[string]any)["code"])
+
+	status, body = register("someone.else@example.com", invitationToken)
+	assert.Equal(test, fiber.StatusForbidden, status)
+	assert.Equal(test, string(runtimeError.CodeInvitationEmailMismatch), body["error"].(map[string]any)["code"])
+
+	status, body = register("Invitee@Example.com", invitationToken)
+	require.Equal(test, fiber.StatusCreated, status, body)
+	meta := body["meta"].(map[string]any)
+	assert.Equal(test, false, meta["email_verification_required"])
+	assert.Equal(test, acc.ID, meta["account_id"])
+
+	created, err := service.userRepository.GetUserByEmail("invitee@example.com")
+	require.NoError(test, err)
+	assert.True(test, created.IsEmailVerified())
+	require.NotNil(test, created.ActiveAccountID)
+	assert.Equal(test, acc.ID, *created.ActiveAccountID)
+	member, err := account.NewRepository(database.DB).GetMember(acc.ID, created.ID)
+	require.NoError(test, err)
+	assert.Equal(test, account.RoleMember, member.Role)
+}
+
 // --- VerifyEmail ---
 
 // En: TestVerifyEmailSuccess tests the successful email verification.
@@ -540,6 +914,51 @@ func TestVerifyEmailInvalidToken(test *testing.T) {
 
 // --- ResendVerification ---
 
+// En: TestVerifyEmailCodeInvalid returns 422 for a wrong code and for an unknown email alike.
+// Es: TestVerifyEmailCodeInvalid devuelve 422 tanto para un código incorrecto como para un email desconocido.
+func TestVerifyEmailCodeInvalid(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+	createTestUser(test, "Finn", "finn@example.com", "password123")
+
+	app := fiber.New()
+	app.Post("/auth/verify-email/code", handler.VerifyEmailCode)
+
+	for _, email := range []string{"finn@example.com", "ghost@example.com"} {
+		body := `{"email":"` + email + `","code":"123456"}`
+		req := httptest.NewRequest("POST", "/auth/verify-email/code", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+		require.NoError(test, err)
+		defer resp.Body.Close()
+
+		assert.Equal(test, fiber.StatusUnprocessableEntity, resp.StatusCode)
+		errResp := DecodeErrorResponse(test, resp.Body)
+		assert.Equal(test, runtimeError.CodeInvalidVerificationCode, errResp.Error.Code)
+	}
+}
+
+// En: TestVerifyEmailCodeValidationError returns 422 with details when the code is not six digits.
+// Es: TestVerifyEmailCodeValidationError devuelve 422 con detalles cuando el código no tiene seis dígitos.
+func TestVerifyEmailCodeValidationError(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+
+	app := fiber.New()
+	app.Post("/auth/verify-email/code", handler.VerifyEmailCode)
+
+	req := httptest.NewRequest("POST", "/auth/verify-email/code", strings.NewReader(`{"email":"finn@example.com","code":"12ab"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeValidationError, errResp.Error.Code)
+	assert.NotEmpty(test, errResp.Error.Details)
+}
+
 // En: TestResendVerificationSuccess tests the successful email verification resend.
 // Es: TestResendVerificationSuccess prueba el reenvío de verificación de correo electrónico exitoso.
 func TestResendVerificationSuccess(test *testing.T) {
@@ -642,3 +1061,888 @@ func TestDevGetVerificationTokenSuccess(test *testing.T) {
 	require.NoError(test, json.NewDecoder(resp.Body).Decode(&result))
 	assert.NotEmpty(test, result.Data.Token)
 }
+
+// --- Forgot / Reset password ---
+
+// En: TestForgotPasswordUnknownEmail answers generically for unknown emails.
+// Es: TestForgotPasswordUnknownEmail responde de forma genérica para correos desconocidos.
+func TestForgotPasswordUnknownEmail(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+
+	app := fiber.New()
+	app.Post("/auth/forgot-password", handler.ForgotPassword)
+
+	req := httptest.NewRequest("POST", "/auth/forgot-password", strings.NewReader(`{"email":"ghost@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusOK, resp.StatusCode)
+}
+
+// En: TestForgotPasswordRateLimited returns 429 with Retry-After when the guard trips.
+// Es: TestForgotPasswordRateLimited devuelve 429 con Retry-After cuando el guard se activa.
+func TestForgotPasswordRateLimited(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+	handler.WithForgotPasswordGuard(testResendGuard{
+		err: &ResendVerificationRateLimitError{RetryAfter: 90 * time.Second},
+	})
+
+	app := fiber.New()
+	app.Post("/auth/forgot-password", handler.ForgotPassword)
+
+	req := httptest.NewRequest("POST", "/auth/forgot-password", strings.NewReader(`{"email":"someone@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(test, "90", resp.Header.Get("Retry-After"))
+}
+
+// En: TestResetPasswordSuccess resets the password with a valid token.
+// Es: TestResetPasswordSuccess restablece la contraseña con un token válido.
+func TestResetPasswordSuccess(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	createVerifiedTestUser(test, "Kate", "kate@example.com", "password123")
+
+	token, err := service.ForgotPassword("kate@example.com")
+	require.NoError(test, err)
+
+	app := fiber.New()
+	app.Post("/auth/reset-password", handler.ResetPassword)
+
+	bodyStr, _ := json.Marshal(map[string]string{"token": token, "password": "newpassword456"})
+	req := httptest.NewRequest("POST", "/auth/reset-password", strings.NewReader(string(bodyStr)))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusOK, resp.StatusCode)
+	_, err = service.Login("kate@example.com", "newpassword456", SessionMetadata{})
+	assert.NoError(test, err)
+}
+
+// En: TestResetPasswordInvalidToken returns 422 for unknown tokens.
+// Es: TestResetPasswordInvalidToken devuelve 422 para tokens desconocidos.
+func TestResetPasswordInvalidToken(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+
+	app := fiber.New()
+	app.Post("/auth/reset-password", handler.ResetPassword)
+
+	req := httptest.NewRequest("POST", "/auth/reset-password", strings.NewReader(`{"token":"nope","password":"newpassword456"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeInvalidResetToken, errResp.Error.Code)
+}
+
+// En: TestResetPasswordValidationError returns 422 with details for a short password.
+// Es: TestResetPasswordValidationError devuelve 422 con detalles para una contraseña corta.
+func TestResetPasswordValidationError(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+
+	app := fiber.New()
+	app.Post("/auth/reset-password", handler.ResetPassword)
+
+	req := httptest.NewRequest("POST", "/auth/reset-password", strings.NewReader(`{"token":"abc","password":"short"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeValidationError, errResp.Error.Code)
+	assert.NotEmpty(test, errResp.Error.Details)
+}
+
+// En: TestResetPasswordPolicyViolationKeepsToken rejects a password that contains the name and leaves the token usable.
+// Es: TestResetPasswordPolicyViolationKeepsToken rechaza una contraseña que contiene el nombre y deja el token utilizable.
+func TestResetPasswordPolicyViolationKeepsToken(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	service.passwordPolicy = validator.NewPasswordPolicy(validator.PasswordRules{ForbidPersonalInfo: true}, nil)
+	createVerifiedTestUser(test, "Kate Lovelace", "kate.policy@example.com", "password123")
+
+	token, err := service.ForgotPassword("kate.policy@example.com")
+	require.NoError(test, err)
+
+	app := fiber.New()
+	app.Post("/auth/reset-password", handler.ResetPassword)
+
+	for _, tc := range []struct {
+		password string
+		status   int
+	}{
+		{password: "lovelace-forever", status: fiber.StatusUnprocessableEntity},
+		{password: "newpassword456", status: fiber.StatusOK},
+	} {
+		bodyStr, _ := json.Marshal(map[string]string{"token": token, "password": tc.password})
+		req := httptest.NewRequest("POST", "/auth/reset-password", strings.NewReader(string(bodyStr)))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+		require.NoError(test, err)
+		resp.Body.Close()
+		assert.Equal(test, tc.status, resp.StatusCode, tc.password)
+	}
+}
+
+// En: TestMagicLinkRequestAndVerify answers generically on request and returns a token pair on verify.
+// Es: TestMagicLinkRequestAndVerify responde de forma genérica al solicitar y devuelve un par de tokens al verificar.
+func TestMagicLinkRequestAndVerify(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	createVerifiedTestUser(test, "Sam", "sam@example.com", "password123")
+
+	app := fiber.New()
+	app.Post("/auth/magic-link", handler.RequestMagicLink)
+	app.Post("/auth/magic-link/verify", handler.VerifyMagicLink)
+
+	req := httptest.NewRequest("POST", "/auth/magic-link", strings.NewReader(`{"email":"ghost@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	token, err := service.RequestMagicLink("sam@example.com")
+	require.NoError(test, err)
+
+	bodyStr, _ := json.Marshal(map[string]string{"token": token})
+	req = httptest.NewRequest("POST", "/auth/magic-link/verify", strings.NewReader(string(bodyStr)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	var result struct {
+		Data TokenPair `json:"data"`
+	}
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&result))
+	assert.NotEmpty(test, result.Data.AccessToken)
+
+	req = httptest.NewRequest("POST", "/auth/magic-link/verify", strings.NewReader(string(bodyStr)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusUnauthorized, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeInvalidMagicLinkToken, errResp.Error.Code)
+}
+
+// En: TestMagicLinkDeliveryFailureAnswersGenerically returns the generic 200 when the login link cannot be sent,
+// so the response does not reveal that the account exists.
+// Es: TestMagicLinkDeliveryFailureAnswersGenerically devuelve el 200 genérico cuando el enlace no se puede enviar,
+// para que la respuesta no revele que la cuenta existe.
+func TestMagicLinkDeliveryFailureAnswersGenerically(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	service.magicLinkNotifier = failingNotifier{}
+	createVerifiedTestUser(test, "Sam", "sam@example.com", "password123")
+
+	app := fiber.New()
+	app.Post("/auth/magic-link", handler.RequestMagicLink)
+
+	for _, email := range []string{"sam@example.com", "ghost@example.com"} {
+		req := httptest.NewRequest("POST", "/auth/magic-link", strings.NewReader(`{"email":"`+email+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+		require.NoError(test, err)
+		defer resp.Body.Close()
+		assert.Equal(test, fiber.StatusOK, resp.StatusCode, email)
+	}
+}
+
+// En: TestMagicLinkRateLimited returns 429 with Retry-After when the guard trips.
+// Es: TestMagicLinkRateLimited devuelve 429 con Retry-After cuando el guard se activa.
+func TestMagicLinkRateLimited(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+	handler.WithMagicLinkGuard(testResendGuard{
+		err: &ResendVerificationRateLimitError{RetryAfter: 45 * time.Second},
+	})
+
+	app := fiber.New()
+	app.Post("/auth/magic-link", handler.RequestMagicLink)
+
+	req := httptest.NewRequest("POST", "/auth/magic-link", strings.NewReader(`{"email":"someone@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(test, "45", resp.Header.Get("Retry-After"))
+}
+
+// pollDeviceToken posts a form-encoded device token request and decodes the JSON answer.
+func pollDeviceToken(test *testing.T, app *fiber.App, grantType, deviceCode string) (int, map[string]any) {
+	test.Helper()
+	form := url.Values{"grant_type": {grantType}, "device_code": {deviceCode}}
+	req := httptest.NewRequest("POST", "/auth/device/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	var body map[string]any
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body
+}
+
+// En: TestDeviceAuthorizationFlow covers the device grant: pending, slow_down, approval and a single token issue.
+// Es: TestDeviceAuthorizationFlow cubre la concesión de dispositivo: pendiente, slow_down, aprobación y una única emisión de tokens.
+func TestDeviceAuthorizationFlow(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+	u := createVerifiedTestUser(test, "Dana", "dana@example.com", "password123")
+
+	app := fiber.New()
+	app.Post("/auth/device/code", handler.DeviceAuthorization)
+	app.Post("/auth/device/token", handler.DeviceToken)
+	app.Post("/auth/device/approve", func(c fiber.Ctx) error {
+		c.Locals("userID", u.ID)
+		return c.Next()
+	}, handler.ApproveDevice)
+
+	req := httptest.NewRequest("POST", "/auth/device/code", strings.NewReader("client_id=cloudflax-cli"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	require.Equal(test, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(test, "no-store", resp.Header.Get("Cache-Control"))
+
+	var grant DeviceAuthorizationGrant
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&grant))
+	assert.NotEmpty(test, grant.DeviceCode)
+	assert.Regexp(test, `^[A-Z]{4}-[A-Z]{4}$`, grant.UserCode)
+	assert.Equal(test, "http://test/device", grant.VerificationURI)
+	assert.Equal(test, "http://test/device?user_code="+grant.UserCode, grant.VerificationURIComplete)
+	assert.Equal(test, 600, grant.ExpiresIn)
+	assert.Equal(test, 5, grant.Interval)
+
+	status, body := pollDeviceToken(test, app, DeviceCodeGrantType, grant.DeviceCode)
+	assert.Equal(test, fiber.StatusBadRequest, status)
+	assert.Equal(test, "authorization_pending", body["error"])
+
+	status, body = pollDeviceToken(test, app, DeviceCodeGrantType, grant.DeviceCode)
+	assert.Equal(test, fiber.StatusBadRequest, status)
+	assert.Equal(test, "slow_down", body["error"])
+
+	var stored DeviceAuthorization
+	require.NoError(test, database.DB.Where("device_code_hash = ?", hashToken(grant.DeviceCode)).First(&stored).Error)
+	assert.Equal(test, 10, stored.IntervalSeconds)
+
+	// The user types the code in lower case without the separator.
+	typed := strings.ToLower(strings.ReplaceAll(grant.UserCode, "-", ""))
+	req = httptest.NewRequest("POST", "/auth/device/approve", strings.NewReader(`{"user_code":"`+typed+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	require.NoError(test, database.DB.Model(&DeviceAuthorization{}).Where("id = ?", stored.ID).Update("last_polled_at", nil).Error)
+	status, body = pollDeviceToken(test, app, DeviceCodeGrantType, grant.DeviceCode)
+	require.Equal(test, fiber.StatusOK, status)
+	assert.NotEmpty(test, body["access_token"])
+	assert.NotEmpty(test, body["refresh_token"])
+	assert.Equal(test, "Bearer", body["token_type"])
+	assert.Greater(test, body["expires_in"], float64(0))
+
+	var session Session
+	require.NoError(test, database.DB.Where("user_id = ?", u.ID).First(&session).Error)
+	assert.Equal(test, "cloudflax-cli", session.DeviceName)
+
+	require.NoError(test, database.DB.Model(&DeviceAuthorization{}).Where("id = ?", stored.ID).Update("last_polled_at", nil).Error)
+	status, body = pollDeviceToken(test, app, DeviceCodeGrantType, grant.DeviceCode)
+	assert.Equal(test, fiber.StatusBadRequest, status)
+	assert.Equal(test, "invalid_grant", body["error"], "tokens are issued only once")
+}
+
+// En: TestDeviceAuthorizationDeniedAndExpired covers denial, expiry, an unknown user code and a wrong grant type.
+// Es: TestDeviceAuthorizationDeniedAndExpired cubre la denegación, la expiración, un user code desconocido y un grant type incorrecto.
+func TestDeviceAuthorizationDeniedAndExpired(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	u := createVerifiedTestUser(test, "Eli", "eli@example.com", "password123")
+
+	app := fiber.New()
+	app.Post("/auth/device/token", handler.DeviceToken)
+	app.Post("/auth/device/deny", func(c fiber.Ctx) error {
+		c.Locals("userID", u.ID)
+		return c.Next()
+	}, handler.DenyDevice)
+
+	denied, err := service.StartDeviceAuthorization("cli")
+	require.NoError(test, err)
+	req := httptest.NewRequest("POST", "/auth/device/deny", strings.NewReader(`{"user_code":"`+denied.UserCode+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	status, body := pollDeviceToken(test, app, DeviceCodeGrantType, denied.DeviceCode)
+	assert.Equal(test, fiber.StatusBadRequest, status)
+	assert.Equal(test, "access_denied", body["error"])
+
+	req = httptest.NewRequest("POST", "/auth/device/deny", strings.NewReader(`{"user_code":"`+denied.UserCode+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusUnprocessableEntity, resp.StatusCode, "a decided code cannot be reused")
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeInvalidUserCode, errResp.Error.Code)
+
+	expired, err := service.StartDeviceAuthorization("cli")
+	require.NoError(test, err)
+	require.NoError(test, database.DB.Model(&DeviceAuthorization{}).
+		Where("device_code_hash = ?", hashToken(expired.DeviceCode)).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	status, body = pollDeviceToken(test, app, DeviceCodeGrantType, expired.DeviceCode)
+	assert.Equal(test, fiber.StatusBadRequest, status)
+	assert.Equal(test, "expired_token", body["error"])
+
+	status, body = pollDeviceToken(test, app, "authorization_code", expired.DeviceCode)
+	assert.Equal(test, fiber.StatusBadRequest, status)
+	assert.Equal(test, "unsupported_grant_type", body["error"])
+
+	status, body = pollDeviceToken(test, app, DeviceCodeGrantType, "unknown")
+	assert.Equal(test, fiber.StatusBadRequest, status)
+	assert.Equal(test, "invalid_grant", body["error"])
+}
+
+// En: TestRequestAndConfirmEmailChange changes the email through both endpoints.
+// Es: TestRequestAndConfirmEmailChange cambia el email mediante ambos endpoints.
+func TestRequestAndConfirmEmailChange(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	u := createVerifiedTestUser(test, "Paul", "paul@example.com", "password123")
+
+	app := fiber.New()
+	app.Post("/users/me/email", func(c fiber.Ctx) error {
+		c.Locals("userID", u.ID)
+		return c.Next()
+	}, handler.RequestEmailChange)
+	app.Post("/auth/confirm-email-change", handler.ConfirmEmailChange)
+
+	req := httptest.NewRequest("POST", "/users/me/email", strings.NewReader(`{"email":"paul@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	require.Len(test, errResp.Error.Details, 1)
+	assert.Equal(test, "email", errResp.Error.Details[0].Field)
+
+	req = httptest.NewRequest("POST", "/users/me/email", strings.NewReader(`{"email":"paul@newco.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	// The raw token only travels in the email; issue a known one for the confirmation step.
+	require.NoError(test, service.repository.InvalidateEmailChangeTokensByUserID(u.ID))
+	require.NoError(test, service.repository.CreateEmailChangeToken(&EmailChangeToken{
+		UserID:    u.ID,
+		NewEmail:  "paul@newco.com",
+		TokenHash: handlerTestHashToken("email-change-token"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}))
+
+	req = httptest.NewRequest("POST", "/auth/confirm-email-change", strings.NewReader(`{"token":"email-change-token"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	updated, err := user.NewRepository(database.DB).GetUser(u.ID)
+	require.NoError(test, err)
+	assert.Equal(test, "paul@newco.com", updated.Email)
+}
+
+// En: TestConfirmEmailChangeInvalidToken returns 422 for unknown tokens.
+// Es: TestConfirmEmailChangeInvalidToken devuelve 422 para tokens desconocidos.
+func TestConfirmEmailChangeInvalidToken(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+
+	app := fiber.New()
+	app.Post("/auth/confirm-email-change", handler.ConfirmEmailChange)
+
+	req := httptest.NewRequest("POST", "/auth/confirm-email-change", strings.NewReader(`{"token":"nope"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeInvalidEmailChangeToken, errResp.Error.Code)
+}
+
+// En: TestOAuthStartUnsupportedProvider returns 404 for providers that are not configured.
+// Es: TestOAuthStartUnsupportedProvider devuelve 404 para proveedores no configurados.
+func TestOAuthStartUnsupportedProvider(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+
+	app := fiber.New()
+	app.Get("/auth/oauth/:provider/start", handler.OAuthStart)
+
+	req := httptest.NewRequest("GET", "/auth/oauth/google/start", nil)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusNotFound, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeOAuthProviderNotSupported, errResp.Error.Code)
+}
+
+// En: TestOAuthStartAndCallbackSuccess runs the full authorization code + PKCE flow against a mock provider.
+// Es: TestOAuthStartAndCallbackSuccess ejecuta el flujo completo de código de autorización + PKCE contra un proveedor simulado.
+func TestOAuthStartAndCallbackSuccess(test *testing.T) {
+	service, mock := setupOAuthServiceTest(test)
+	handler := NewHandler(service)
+
+	app := fiber.New()
+	app.Get("/auth/oauth/:provider/start", handler.OAuthStart)
+	app.Get("/auth/oauth/:provider/callback", handler.OAuthCallback)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/auth/oauth/google/start", nil), fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	require.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	var startBody struct {
+		Data struct {
+			AuthorizationURL string `json:"authorization_url"`
+		} `json:"data"`
+	}
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&startBody))
+	state := mock.authorize(test, startBody.Data.AuthorizationURL)
+
+	callbackURL := "/auth/oauth/google/callback?code=" + mockOIDCCode + "&state=" + state
+	resp, err = app.Test(httptest.NewRequest("GET", callbackURL, nil), fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	require.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	var callbackBody struct {
+		Data TokenPair `json:"data"`
+	}
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&callbackBody))
+	assert.NotEmpty(test, callbackBody.Data.AccessToken)
+	assert.NotEmpty(test, callbackBody.Data.RefreshToken)
+}
+
+// En: TestOAuthCallbackInvalidState returns 422 when the state was never issued.
+// Es: TestOAuthCallbackInvalidState devuelve 422 cuando el state nunca fue emitido.
+func TestOAuthCallbackInvalidState(test *testing.T) {
+	service, _ := setupOAuthServiceTest(test)
+	handler := NewHandler(service)
+
+	app := fiber.New()
+	app.Get("/auth/oauth/:provider/callback", handler.OAuthCallback)
+
+	req := httptest.NewRequest("GET", "/auth/oauth/google/callback?code=abc&state=unknown", nil)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeInvalidOAuthState, errResp.Error.Code)
+}
+
+// En: TestOAuthCallbackProviderError returns 401 when the provider reports an error (e.g. access_denied).
+// Es: TestOAuthCallbackProviderError devuelve 401 cuando el proveedor informa un error (p. ej. access_denied).
+func TestOAuthCallbackProviderError(test *testing.T) {
+	service, _ := setupOAuthServiceTest(test)
+	handler := NewHandler(service)
+
+	app := fiber.New()
+	app.Get("/auth/oauth/:provider/callback", handler.OAuthCallback)
+
+	req := httptest.NewRequest("GET", "/auth/oauth/google/callback?error=access_denied&state=abc", nil)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusUnauthorized, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeOAuthFailed, errResp.Error.Code)
+}
+
+// En: TestListAuthProviders returns the login methods of the authenticated user.
+// Es: TestListAuthProviders devuelve los métodos de inicio de sesión del usuario autenticado.
+func TestListAuthProviders(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	u := createVerifiedTestUser(test, "Alice", "alice@example.com", "password123")
+	require.NoError(test, service.repository.CreateAuthProvider(&UserAuthProvider{
+		UserID: u.ID, Provider: ProviderCredentials, ProviderSubjectID: u.Email,
+	}))
+
+	app := fiber.New()
+	app.Get("/users/me/auth-providers", func(c fiber.Ctx) error {
+		c.Locals("userID", u.ID)
+		return c.Next()
+	}, handler.ListAuthProviders)
+
+	req := httptest.NewRequest("GET", "/users/me/auth-providers", nil)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusOK, resp.StatusCode)
+	var result struct {
+		Data []UserAuthProvider `json:"data"`
+	}
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&result))
+	require.Len(test, result.Data, 1)
+	assert.Equal(test, ProviderCredentials, result.Data[0].Provider)
+}
+
+// En: TestUnlinkLastAuthProvider returns 409 when the provider is the only login method left.
+// Es: TestUnlinkLastAuthProvider devuelve 409 cuando el proveedor es el único método de inicio de sesión restante.
+func TestUnlinkLastAuthProvider(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	u := createVerifiedTestUser(test, "Alice", "alice@example.com", "password123")
+	credentials := &UserAuthProvider{UserID: u.ID, Provider: ProviderCredentials, ProviderSubjectID: u.Email}
+	require.NoError(test, service.repository.CreateAuthProvider(credentials))
+
+	app := fiber.New()
+	app.Delete("/users/me/auth-providers/:id", func(c fiber.Ctx) error {
+		c.Locals("userID", u.ID)
+		return c.Next()
+	}, handler.UnlinkAuthProvider)
+
+	req := httptest.NewRequest("DELETE", "/users/me/auth-providers/"+credentials.ID, nil)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusConflict, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeLastLoginMethod, errResp.Error.Code)
+}
+
+// En: TestUnlinkAuthProviderNotFound returns 404 for unknown provider IDs.
+// Es: TestUnlinkAuthProviderNotFound devuelve 404 para IDs de proveedor desconocidos.
+func TestUnlinkAuthProviderNotFound(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+	u := createVerifiedTestUser(test, "Alice", "alice@example.com", "password123")
+
+	app := fiber.New()
+	app.Delete("/users/me/auth-providers/:id", func(c fiber.Ctx) error {
+		c.Locals("userID", u.ID)
+		return c.Next()
+	}, handler.UnlinkAuthProvider)
+
+	req := httptest.NewRequest("DELETE", "/users/me/auth-providers/00000000-0000-0000-0000-000000000000", nil)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusNotFound, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeAuthProviderNotFound, errResp.Error.Code)
+}
+
+// En: TestLoginTwoFactorRequired returns an MFA challenge token instead of a token pair when 2FA is enabled.
+// Es: TestLoginTwoFactorRequired devuelve un token de desafío MFA en lugar de un par de tokens cuando el 2FA está activo.
+func TestLoginTwoFactorRequired(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	u := createVerifiedTestUser(test, "Alice", "alice@example.com", "password123")
+	secret, _ := enableTwoFactorForTest(test, service, u.ID)
+
+	app := fiber.New()
+	app.Post("/auth/login", handler.Login)
+	app.Post("/auth/login/2fa", handler.VerifyMFA)
+
+	req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(`{"email":"alice@example.com","password":"password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	require.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	var challenge struct {
+		Data struct {
+			MFARequired bool   `json:"mfa_required"`
+			MFAToken    string `json:"mfa_token"`
+		} `json:"data"`
+	}
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&challenge))
+	assert.True(test, challenge.Data.MFARequired)
+	require.NotEmpty(test, challenge.Data.MFAToken)
+
+	body := `{"mfa_token":"` + challenge.Data.MFAToken + `","code":"` + nextTOTPCodeForTest(test, secret) + `"}`
+	req = httptest.NewRequest("POST", "/auth/login/2fa", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	require.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	var result struct {
+		Data TokenPair `json:"data"`
+	}
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&result))
+	assert.NotEmpty(test, result.Data.AccessToken)
+}
+
+// En: TestVerifyMFAInvalidToken returns 401 for unknown MFA tokens.
+// Es: TestVerifyMFAInvalidToken devuelve 401 para tokens MFA desconocidos.
+func TestVerifyMFAInvalidToken(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+
+	app := fiber.New()
+	app.Post("/auth/login/2fa", handler.VerifyMFA)
+
+	req := httptest.NewRequest("POST", "/auth/login/2fa", strings.NewReader(`{"mfa_token":"nope","code":"123456"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusUnauthorized, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeInvalidMFAToken, errResp.Error.Code)
+}
+
+// En: TestVerifyMFAFailuresCountPerUser checks second-factor failures add up across challenges: logging in again
+// with the password does not grant fresh attempts, and the lock also blocks the password step.
+// Es: TestVerifyMFAFailuresCountPerUser comprueba que los fallos del segundo factor se suman entre desafíos: volver a
+// iniciar sesión con la contraseña no concede intentos nuevos y el bloqueo también frena el paso de la contraseña.
+func TestVerifyMFAFailuresCountPerUser(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	handler.WithLoginThrottle(NewMemoryLoginThrottle())
+	u := createVerifiedTestUser(test, "Alice", "alice@example.com", "password123")
+	secret, _ := enableTwoFactorForTest(test, service, u.ID)
+
+	app := fiber.New()
+	app.Post("/auth/login", handler.Login)
+	app.Post("/auth/login/2fa", handler.VerifyMFA)
+	send := func(path, body string) *http.Response {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+		require.NoError(test, err)
+		test.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	login := func() string {
+		resp := send("/auth/login", `{"email":"alice@example.com","password":"password123"}`)
+		require.Equal(test, fiber.StatusOK, resp.StatusCode)
+		var challenge struct {
+			Data struct {
+				MFAToken string `json:"mfa_token"`
+			} `json:"data"`
+		}
+		require.NoError(test, json.NewDecoder(resp.Body).Decode(&challenge))
+		return challenge.Data.MFAToken
+	}
+
+	pending := login()
+	for range int(loginEmailMaxFailures) {
+		resp := send("/auth/login/2fa", `{"mfa_token":"`+login()+`","code":"000000"}`)
+		require.Equal(test, fiber.StatusUnauthorized, resp.StatusCode)
+	}
+
+	resp := send("/auth/login/2fa", `{"mfa_token":"`+pending+`","code":"`+nextTOTPCodeForTest(test, secret)+`"}`)
+	assert.Equal(test, fiber.StatusTooManyRequests, resp.StatusCode)
+	resp = send("/auth/login", `{"email":"alice@example.com","password":"password123"}`)
+	assert.Equal(test, fiber.StatusTooManyRequests, resp.StatusCode)
+}
+
+// En: TestEnrollAndConfirmTwoFactor enrolls, rejects a wrong code and confirms with a valid one.
+// Es: TestEnrollAndConfirmTwoFactor inscribe, rechaza un código erróneo y confirma con uno válido.
+func TestEnrollAndConfirmTwoFactor(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+	u := createVerifiedTestUser(test, "Alice", "alice@example.com", "password123")
+
+	app := fiber.New()
+	setUser := func(c fiber.Ctx) error {
+		c.Locals("userID", u.ID)
+		return c.Next()
+	}
+	app.Post("/auth/2fa/enroll", setUser, handler.EnrollTwoFactor)
+	app.Post("/auth/2fa/confirm", setUser, handler.ConfirmTwoFactor)
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/auth/2fa/enroll", nil), fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	require.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	var enrollment struct {
+		Data TwoFactorEnrollment `json:"data"`
+	}
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&enrollment))
+	assert.Contains(test, enrollment.Data.OTPAuthURI, "otpauth://totp/")
+
+	code, err := totpCodeAt(enrollment.Data.Secret, time.Now())
+	require.NoError(test, err)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	req := httptest.NewRequest("POST", "/auth/2fa/confirm", strings.NewReader(`{"code":"`+wrong+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeInvalidTwoFactorCode, errResp.Error.Code)
+
+	req = httptest.NewRequest("POST", "/auth/2fa/confirm", strings.NewReader(`{"code":"`+code+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	require.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	var confirmed struct {
+		Data struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		} `json:"data"`
+	}
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&confirmed))
+	assert.Len(test, confirmed.Data.RecoveryCodes, recoveryCodeCount)
+}
+
+// En: TestDisableTwoFactorNotEnabled returns 409 when the user has no 2FA.
+// Es: TestDisableTwoFactorNotEnabled devuelve 409 cuando el usuario no tiene 2FA.
+func TestDisableTwoFactorNotEnabled(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+	u := createVerifiedTestUser(test, "Alice", "alice@example.com", "password123")
+
+	app := fiber.New()
+	app.Post("/auth/2fa/disable", func(c fiber.Ctx) error {
+		c.Locals("userID", u.ID)
+		return c.Next()
+	}, handler.DisableTwoFactor)
+
+	req := httptest.NewRequest("POST", "/auth/2fa/disable", strings.NewReader(`{"password":"password123","code":"123456"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusConflict, resp.StatusCode)
+	errResp := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeTwoFactorNotEnabled, errResp.Error.Code)
+}
+
+// En: TestDisableTwoFactorWrongPasswordIsThrottled checks wrong passwords on POST /auth/2fa/disable count towards the
+// login throttle, so the endpoint cannot be used to guess the password.
+// Es: TestDisableTwoFactorWrongPasswordIsThrottled comprueba que las contraseñas erróneas en POST /auth/2fa/disable
+// cuentan para el throttle de login, así que el endpoint no sirve para adivinar la contraseña.
+func TestDisableTwoFactorWrongPasswordIsThrottled(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	handler.WithLoginThrottle(NewMemoryLoginThrottle())
+	u := createVerifiedTestUser(test, "Alice", "alice@example.com", "password123")
+	secret, _ := enableTwoFactorForTest(test, service, u.ID)
+
+	app := fiber.New()
+	app.Post("/auth/2fa/disable", func(c fiber.Ctx) error {
+		c.Locals("userID", u.ID)
+		c.Locals("email", u.Email)
+		return c.Next()
+	}, handler.DisableTwoFactor)
+	send := func(body string) *http.Response {
+		req := httptest.NewRequest("POST", "/auth/2fa/disable", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+		require.NoError(test, err)
+		test.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	for range int(loginEmailMaxFailures) {
+		resp := send(`{"password":"wrongpassword","code":"000000"}`)
+		require.Equal(test, fiber.StatusUnauthorized, resp.StatusCode)
+	}
+
+	resp := send(`{"password":"password123","code":"` + nextTOTPCodeForTest(test, secret) + `"}`)
+	assert.Equal(test, fiber.StatusTooManyRequests, resp.StatusCode)
+	credential, err := service.repository.GetTOTPCredential(u.ID)
+	require.NoError(test, err)
+	assert.NotNil(test, credential.ConfirmedAt, "2FA stays enabled while the throttle is locked")
+}
+
+// --- Reauthenticate ---
+
+// En: TestReauthenticateUnlocksRecentAuthRoutes checks a stale token is refused by RequireRecentAuth until
+// POST /auth/reauthenticate returns an elevated token.
+// Es: TestReauthenticateUnlocksRecentAuthRoutes comprueba que RequireRecentAuth rechaza un token antiguo hasta que
+// POST /auth/reauthenticate devuelve un token elevado.
+func TestReauthenticateUnlocksRecentAuthRoutes(test *testing.T) {
+	handler, service := SetupAuthHandlerTest(test)
+	handler.WithLoginThrottle(NewMemoryLoginThrottle())
+	u := createVerifiedTestUser(test, "Alice", "alice@example.com", "password123")
+	pair, err := service.Login("alice@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	claims, err := service.parseAccessToken(pair.AccessToken)
+	require.NoError(test, err)
+	staleToken, err := service.signAccessToken(u, claims.SessionID, time.Now().Add(-time.Hour), time.Now().Add(time.Minute))
+	require.NoError(test, err)
+
+	authMiddleware := middleware.RequireAuth(service)
+	app := fiber.New()
+	app.Post("/auth/reauthenticate", authMiddleware, handler.Reauthenticate)
+	app.Delete("/users/me", authMiddleware, middleware.RequireRecentAuth(RecentAuthMaxAge), func(c fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	send := func(method, path, accessToken, body string) *http.Response {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+		require.NoError(test, err)
+		test.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := send("DELETE", "/users/me", staleToken, "")
+	require.Equal(test, fiber.StatusForbidden, resp.StatusCode)
+	assert.Equal(test, runtimeError.CodeReauthenticationRequired, DecodeErrorResponse(test, resp.Body).Error.Code)
+
+	resp = send("POST", "/auth/reauthenticate", staleToken, `{}`)
+	require.Equal(test, fiber.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(test, runtimeError.CodeValidationError, DecodeErrorResponse(test, resp.Body).Error.Code)
+
+	resp = send("POST", "/auth/reauthenticate", staleToken, `{"password":"wrongpassword"}`)
+	require.Equal(test, fiber.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(test, runtimeError.CodeInvalidCredentials, DecodeErrorResponse(test, resp.Body).Error.Code)
+
+	resp = send("POST", "/auth/reauthenticate", staleToken, `{"password":"password123"}`)
+	require.Equal(test, fiber.StatusOK, resp.StatusCode)
+	var elevated struct {
+		Data ElevatedToken `json:"data"`
+	}
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&elevated))
+	assert.NotEmpty(test, elevated.Data.AccessToken)
+	assert.WithinDuration(test, time.Now(), elevated.Data.AuthTime, 2*time.Second)
+
+	resp = send("DELETE", "/users/me", elevated.Data.AccessToken, "")
+	assert.Equal(test, fiber.StatusNoContent, resp.StatusCode)
+}
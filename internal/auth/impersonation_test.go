@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudflax/api.cloudflax/internal/shared/database"
+	"github.com/cloudflax/api.cloudflax/internal/shared/middleware"
+	runtimeError "github.com/cloudflax/api.cloudflax/internal/shared/runtimeerror"
+	"github.com/cloudflax/api.cloudflax/internal/user"
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// En: setupImpersonationTest mounts the impersonation route and a protected read/write route behind the real auth middleware.
+// Es: setupImpersonationTest monta la ruta de suplantación y una ruta protegida de lectura/escritura tras el middleware de auth real.
+func setupImpersonationTest(test *testing.T) (*fiber.App, *Service, *user.User) {
+	test.Helper()
+	handler, service := SetupAuthHandlerTest(test)
+	admin := createVerifiedTestUser(test, "Support", "support@example.com", "password123")
+	admin.PlatformRole = user.PlatformRoleAdmin
+	require.NoError(test, database.DB.Save(admin).Error)
+
+	authMiddleware := middleware.RequireAuth(service)
+	app := fiber.New()
+	app.Post("/admin/impersonate/:userID", authMiddleware, handler.Impersonate)
+	whoAmI := func(c fiber.Ctx) error {
+		actorID, _ := c.Locals("actorID").(string)
+		return c.JSON(fiber.Map{"data": fiber.Map{"user_id": c.Locals("userID"), "actor_id": actorID}})
+	}
+	app.Get("/resource", authMiddleware, whoAmI)
+	app.Post("/resource", authMiddleware, whoAmI)
+	return app, service, admin
+}
+
+// En: impersonate calls POST /admin/impersonate/:userID with the given bearer token and body.
+// Es: impersonate llama a POST /admin/impersonate/:userID con el bearer token y el cuerpo indicados.
+func impersonate(test *testing.T, app *fiber.App, accessToken, userID, body string) (int, map[string]any) {
+	test.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/admin/impersonate/"+userID, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	return doOAuthRequest(test, app, req)
+}
+
+// En: bearerRequest sends a request to the protected test route with the given bearer token.
+// Es: bearerRequest envía una solicitud a la ruta protegida de prueba con el bearer token indicado.
+func bearerRequest(test *testing.T, app *fiber.App, method, accessToken string) (int, map[string]any) {
+	test.Helper()
+	req := httptest.NewRequest(method, "/resource", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	return doOAuthRequest(test, app, req)
+}
+
+// En: TestImpersonationIssuesReadOnlyTokenWithActor checks the token carries the customer and the admin, and refuses writes by default.
+// Es: TestImpersonationIssuesReadOnlyTokenWithActor comprueba que el token lleva al cliente y al admin, y rechaza escrituras por defecto.
+func TestImpersonationIssuesReadOnlyTokenWithActor(test *testing.T) {
+	app, service, admin := setupImpersonationTest(test)
+	customer := createVerifiedTestUser(test, "Customer", "customer@example.com", "password123")
+	adminToken, _, err := service.IssueAccessToken(admin.ID, "")
+	require.NoError(test, err)
+
+	status, body := impersonate(test, app, adminToken, customer.ID, `{"reason":"Ticket #4521: invoices missing"}`)
+	require.Equal(test, fiber.StatusCreated, status, body)
+	data := body["data"].(map[string]any)
+	assert.Equal(test, customer.ID, data["user_id"])
+	assert.Equal(test, admin.ID, data["actor_id"])
+	assert.Equal(test, true, data["read_only"])
+	accessToken := data["access_token"].(string)
+
+	claims, err := service.parseAccessToken(accessToken)
+	require.NoError(test, err)
+	assert.Equal(test, customer.ID, claims.UserID)
+	require.NotNil(test, claims.Actor)
+	assert.Equal(test, admin.ID, claims.Actor.Subject)
+	assert.True(test, claims.ReadOnly)
+	assert.Empty(test, claims.SessionID)
+	assert.LessOrEqual(test, claims.ExpiresAt.Sub(claims.IssuedAt.Time), maxImpersonationDuration)
+
+	status, body = bearerRequest(test, app, http.MethodGet, accessToken)
+	require.Equal(test, fiber.StatusOK, status, body)
+	assert.Equal(test, customer.ID, body["data"].(map[string]any)["user_id"])
+	assert.Equal(test, admin.ID, body["data"].(map[string]any)["actor_id"])
+
+	status, body = bearerRequest(test, app, http.MethodPost, accessToken)
+	assert.Equal(test, fiber.StatusForbidden, status)
+	assert.Equal(test, string(runtimeError.CodeImpersonationReadOnly), body["error"].(map[string]any)["code"])
+}
+
+// En: TestImpersonationAllowWrites checks allow_writes lifts the read-only mode but the token still cannot impersonate again.
+// Es: TestImpersonationAllowWrites comprueba que allow_writes levanta el solo lectura pero el token sigue sin poder suplantar de nuevo.
+func TestImpersonationAllowWrites(test *testing.T) {
+	app, service, admin := setupImpersonationTest(test)
+	customer := createVerifiedTestUser(test, "Customer", "customer@example.com", "password123")
+	other := createVerifiedTestUser(test, "Other", "other@example.com", "password123")
+	adminToken, _, err := service.IssueAccessToken(admin.ID, "")
+	require.NoError(test, err)
+
+	status, body := impersonate(test, app, adminToken, customer.ID, `{"reason":"Fix billing address","allow_writes":true}`)
+	require.Equal(test, fiber.StatusCreated, status, body)
+	accessToken := body["data"].(map[string]any)["access_token"].(string)
+
+	status, body = bearerRequest(test, app, http.MethodPost, accessToken)
+	assert.Equal(test, fiber.StatusOK, status, body)
+
+	status, _ = impersonate(test, app, accessToken, other.ID, `{"reason":"Chained impersonation"}`)
+	assert.Equal(test, fiber.StatusForbidden, status)
+}
+
+// En: TestImpersonationRejectsInvalidRequests checks the role, target and body checks of POST /admin/impersonate/:userID.
+// Es: TestImpersonationRejectsInvalidRequests comprueba las validaciones de rol, objetivo y cuerpo de POST /admin/impersonate/:userID.
+func TestImpersonationRejectsInvalidRequests(test *testing.T) {
+	app, service, admin := setupImpersonationTest(test)
+	customer := createVerifiedTestUser(test, "Customer", "customer@example.com", "password123")
+	otherAdmin := createVerifiedTestUser(test, "Support Two", "support2@example.com", "password123")
+	otherAdmin.PlatformRole = user.PlatformRoleAdmin
+	require.NoError(test, database.DB.Save(otherAdmin).Error)
+	adminToken, _, err := service.IssueAccessToken(admin.ID, "")
+	require.NoError(test, err)
+	customerToken, _, err := service.IssueAccessToken(customer.ID, "")
+	require.NoError(test, err)
+
+	reason := `{"reason":"Ticket #4521"}`
+	cases := []struct {
+		name   string
+		token  string
+		target string
+		body   string
+		status int
+		code   runtimeError.ErrorCode
+	}{
+		{"not a platform admin", customerToken, admin.ID, reason, fiber.StatusForbidden, runtimeError.CodeForbidden},
+		{"self", adminToken, admin.ID, reason, fiber.StatusForbidden, runtimeError.CodeForbidden},
+		{"another platform admin", adminToken, otherAdmin.ID, reason, fiber.StatusForbidden, runtimeError.CodeForbidden},
+		{"unknown user", adminToken, "00000000-0000-0000-0000-000000000000", reason, fiber.StatusNotFound, runtimeError.CodeUserNotFound},
+		{"missing reason", adminToken, customer.ID, `{}`, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError},
+	}
+	for _, tc := range cases {
+		test.Run(tc.name, func(test *testing.T) {
+			status, body := impersonate(test, app, tc.token, tc.target, tc.body)
+			assert.Equal(test, tc.status, status, body)
+			assert.Equal(test, string(tc.code), body["error"].(map[string]any)["code"])
+		})
+	}
+}
+
+// En: TestImpersonationCannotMintCredentialsOrChangeIdentity checks that even a writable impersonation token is refused on
+// routes that hand out credentials or change how the user signs in.
+// Es: TestImpersonationCannotMintCredentialsOrChangeIdentity comprueba que incluso un token de suplantación con escritura se
+// rechaza en las rutas que entregan credenciales o cambian cómo inicia sesión el usuario.
+func TestImpersonationCannotMintCredentialsOrChangeIdentity(test *testing.T) {
+	app, service, admin := setupImpersonationTest(test)
+	handler := NewHandler(service)
+	authMiddleware := middleware.RequireAuth(service)
+	app.Post("/auth/device/approve", authMiddleware, handler.ApproveDevice)
+	app.Post("/oauth/authorize", authMiddleware, handler.DecideOAuthAuthorization)
+	app.Post("/users/me/email", authMiddleware, handler.RequestEmailChange)
+	app.Post("/users/me/auth-providers/:provider/link", authMiddleware, handler.StartLinkAuthProvider)
+	app.Post("/users/me/auth-providers/:provider/link/callback", authMiddleware, handler.CompleteLinkAuthProvider)
+	app.Post("/auth/2fa/enroll", authMiddleware, handler.EnrollTwoFactor)
+	app.Post("/auth/2fa/confirm", authMiddleware, handler.ConfirmTwoFactor)
+
+	customer := createVerifiedTestUser(test, "Customer", "customer@example.com", "password123")
+	adminToken, _, err := service.IssueAccessToken(admin.ID, "")
+	require.NoError(test, err)
+	status, body := impersonate(test, app, adminToken, customer.ID, `{"reason":"Fix billing address","allow_writes":true}`)
+	require.Equal(test, fiber.StatusCreated, status, body)
+	accessToken := body["data"].(map[string]any)["access_token"].(string)
+
+	for _, path := range []string{
+		"/auth/device/approve",
+		"/oauth/authorize",
+		"/users/me/email",
+		"/users/me/auth-providers/google/link",
+		"/users/me/auth-providers/google/link/callback",
+		"/auth/2fa/enroll",
+		"/auth/2fa/confirm",
+	} {
+		test.Run(path, func(test *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+			status, body := doOAuthRequest(test, app, req)
+			assert.Equal(test, fiber.StatusForbidden, status, body)
+			assert.Equal(test, string(runtimeError.CodeForbidden), body["error"].(map[string]any)["code"])
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// En: newTestLoginThrottle builds a login throttle over an in-memory DynamoDB table with a controllable clock.
+// Es: newTestLoginThrottle crea un throttle de login sobre una tabla DynamoDB en memoria con un reloj controlable.
+func newTestLoginThrottle(now *time.Time) *loginThrottle {
+	table := &fakeDynamoTable{items: make(map[string]map[string]types.AttributeValue)}
+	return &loginThrottle{
+		store: &dynamoThrottleStore{client: table, tableName: "throttle"},
+		now:   func() time.Time { return *now },
+	}
+}
+
+// En: TestLoginThrottleLocksEmailAfterMaxFailures verifies the email lock, its expiry and the reset on success.
+// Es: TestLoginThrottleLocksEmailAfterMaxFailures verifica el bloqueo por email, su expiración y el reinicio tras un login correcto.
+func TestLoginThrottleLocksEmailAfterMaxFailures(test *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	throttle := newTestLoginThrottle(&now)
+
+	for range loginEmailMaxFailures - 1 {
+		require.NoError(test, throttle.RecordFailure(ctx, "User@Example.com", "10.0.0.1"))
+	}
+	require.NoError(test, throttle.Check(ctx, "user@example.com", "10.0.0.1"))
+
+	require.NoError(test, throttle.RecordFailure(ctx, "user@example.com", "10.0.0.1"))
+	err := throttle.Check(ctx, "user@example.com", "10.0.0.2")
+	require.ErrorIs(test, err, ErrRateLimited)
+	var limitErr *RateLimitError
+	require.True(test, errors.As(err, &limitErr))
+	assert.Equal(test, time.Duration(loginLockSeconds)*time.Second, limitErr.RetryAfter)
+	require.NoError(test, throttle.Check(ctx, "other@example.com", "10.0.0.2"), "other emails are not affected")
+
+	now = now.Add(time.Duration(loginLockSeconds) * time.Second)
+	require.NoError(test, throttle.Check(ctx, "user@example.com", "10.0.0.1"))
+
+	require.NoError(test, throttle.RecordFailure(ctx, "user@example.com", "10.0.0.1"))
+	require.NoError(test, throttle.Reset(ctx, "user@example.com"))
+	for range loginEmailMaxFailures - 1 {
+		require.NoError(test, throttle.RecordFailure(ctx, "user@example.com", "10.0.0.1"))
+	}
+	assert.NoError(test, throttle.Check(ctx, "user@example.com", "10.0.0.1"), "reset restarts the count")
+}
+
+// En: TestLoginThrottleLocksIPAcrossEmails verifies that failures for many emails from one IP lock that IP.
+// Es: TestLoginThrottleLocksIPAcrossEmails verifica que los fallos de muchos emails desde una IP bloquean esa IP.
+func TestLoginThrottleLocksIPAcrossEmails(test *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	throttle := newTestLoginThrottle(&now)
+
+	for i := range loginIPMaxFailures {
+		email := "spray" + string(rune('a'+i)) + "@example.com"
+		require.NoError(test, throttle.RecordFailure(ctx, email, "10.0.0.9"))
+	}
+
+	assert.ErrorIs(test, throttle.Check(ctx, "fresh@example.com", "10.0.0.9"), ErrRateLimited)
+	assert.NoError(test, throttle.Check(ctx, "fresh@example.com", "10.0.0.10"))
+	require.NoError(test, throttle.Reset(ctx, "fresh@example.com"))
+	assert.ErrorIs(test, throttle.Check(ctx, "fresh@example.com", "10.0.0.9"), ErrRateLimited, "a successful login does not unlock the IP")
+}
+
+// En: TestEvaluateThrottleStateWindowExpires verifies that failures older than the window no longer count.
+// Es: TestEvaluateThrottleStateWindowExpires verifica que los fallos más antiguos que la ventana dejan de contar.
+func TestEvaluateThrottleStateWindowExpires(test *testing.T) {
+	now := int64(1_700_000_000)
+	current := &resendGuardState{
+		Exists:      true,
+		Version:     4,
+		Count:       loginEmailMaxFailures - 1,
+		WindowStart: now - loginFailureWindowSeconds,
+		CreatedAt:   now - loginFailureWindowSeconds,
+	}
+
+	next, err := evaluateThrottleState(loginEmailPolicy, current, now)
+	require.NoError(test, err)
+	assert.Equal(test, int64(1), next.Count)
+	assert.Equal(test, now, next.WindowStart)
+	assert.Equal(test, int64(0), next.LockUntil)
+}
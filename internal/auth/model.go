@@ -46,13 +46,17 @@ func (p *UserAuthProvider) BeforeCreate(_ *gorm.DB) error {
 }
 
 // En: RefreshToken represents a stored refresh token tied to a user session.
+// Tokens rotated from the same login share a FamilyID; RotatedAt marks a token already exchanged, so presenting it again is reuse.
 // Es: RefreshToken representa un token de actualización almacenado asociado a una sesión de usuario.
+// Los tokens rotados desde el mismo login comparten FamilyID; RotatedAt marca un token ya intercambiado, así que volver a presentarlo es reutilización.
 type RefreshToken struct {
 	ID        string         `gorm:"type:uuid;primaryKey" json:"-"`
 	UserID    string         `gorm:"type:uuid;not null;index" json:"-"`
 	TokenHash string         `gorm:"column:token_hash;not null;uniqueIndex" json:"-"`
+	FamilyID  string         `gorm:"type:uuid;index" json:"-"`
 	ExpiresAt time.Time      `gorm:"not null" json:"-"`
 	RevokedAt *time.Time     `gorm:"index" json:"-"`
+	RotatedAt *time.Time     `json:"-"`
 	CreatedAt time.Time      `json:"-"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
@@ -83,3 +87,488 @@ func (rt *RefreshToken) IsExpired() bool {
 func (rt *RefreshToken) IsRevoked() bool {
 	return rt.RevokedAt != nil
 }
+
+// En: IsRotated returns true if the token was already exchanged for a newer token of its family.
+// Es: IsRotated devuelve true si el token ya fue intercambiado por uno más reciente de su familia.
+func (rt *RefreshToken) IsRotated() bool {
+	return rt.RotatedAt != nil
+}
+
+// En: Family returns the family (session) ID of the token; legacy tokens without one form their own family.
+// Es: Family devuelve el ID de familia (sesión) del token; los tokens antiguos sin familia forman la suya propia.
+func (rt *RefreshToken) Family() string {
+	if rt.FamilyID == "" {
+		return rt.ID
+	}
+	return rt.FamilyID
+}
+
+// En: PasswordResetToken represents a single-use password reset token (stored by hash) issued by forgot-password.
+// Es: PasswordResetToken representa un token de restablecimiento de contraseña de un solo uso (almacenado por hash) emitido por forgot-password.
+type PasswordResetToken struct {
+	ID        string     `gorm:"type:uuid;primaryKey" json:"-"`
+	UserID    string     `gorm:"type:uuid;not null;index" json:"-"`
+	TokenHash string     `gorm:"column:token_hash;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
+
+// En: TableName overrides the table name.
+// Es: TableName sobrescribe el nombre de la tabla.
+func (PasswordResetToken) TableName() string {
+	return "password_reset_tokens"
+}
+
+// En: BeforeCreate generates UUID before insert.
+// Es: BeforeCreate genera UUID antes de insertar.
+func (prt *PasswordResetToken) BeforeCreate(_ *gorm.DB) error {
+	if prt.ID == "" {
+		prt.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// En: IsExpired returns true if the reset token has passed its expiry time.
+// Es: IsExpired devuelve true si el token de restablecimiento ha pasado su tiempo de expiración.
+func (prt *PasswordResetToken) IsExpired() bool {
+	return time.Now().After(prt.ExpiresAt)
+}
+
+// En: IsUsed returns true if the reset token has already been consumed.
+// Es: IsUsed devuelve true si el token de restablecimiento ya fue consumido.
+func (prt *PasswordResetToken) IsUsed() bool {
+	return prt.UsedAt != nil
+}
+
+// En: EmailVerificationCode is the six-digit alternative to the verification link (stored by hash, one per user).
+// Es: EmailVerificationCode es la alternativa de seis dígitos al enlace de verificación (almacenada por hash, una por usuario).
+type EmailVerificationCode struct {
+	ID        string    `gorm:"type:uuid;primaryKey" json:"-"`
+	UserID    string    `gorm:"type:uuid;not null;uniqueIndex" json:"-"`
+	CodeHash  string    `gorm:"column:code_hash;not null" json:"-"`
+	Attempts  int       `gorm:"not null;default:0" json:"-"`
+	ExpiresAt time.Time `gorm:"not null" json:"-"`
+	CreatedAt time.Time `json:"-"`
+}
+
+// En: TableName overrides the table name.
+// Es: TableName sobrescribe el nombre de la tabla.
+func (EmailVerificationCode) TableName() string {
+	return "email_verification_codes"
+}
+
+// En: BeforeCreate generates UUID before insert.
+// Es: BeforeCreate genera UUID antes de insertar.
+func (evc *EmailVerificationCode) BeforeCreate(_ *gorm.DB) error {
+	if evc.ID == "" {
+		evc.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// En: IsExpired returns true if the verification code has passed its expiry time.
+// Es: IsExpired devuelve true si el código de verificación ha pasado su tiempo de expiración.
+func (evc *EmailVerificationCode) IsExpired() bool {
+	return time.Now().After(evc.ExpiresAt)
+}
+
+// En: MagicLinkToken is a single-use passwordless login token (stored by hash) emailed by POST /auth/magic-link.
+// Es: MagicLinkToken es un token de login sin contraseña de un solo uso (almacenado por hash) enviado por POST /auth/magic-link.
+type MagicLinkToken struct {
+	ID        string     `gorm:"type:uuid;primaryKey" json:"-"`
+	UserID    string     `gorm:"type:uuid;not null;index" json:"-"`
+	TokenHash string     `gorm:"column:token_hash;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
+
+// En: TableName overrides the table name.
+// Es: TableName sobrescribe el nombre de la tabla.
+func (MagicLinkToken) TableName() string {
+	return "magic_link_tokens"
+}
+
+// En: BeforeCreate generates UUID before insert.
+// Es: BeforeCreate genera UUID antes de insertar.
+func (mlt *MagicLinkToken) BeforeCreate(_ *gorm.DB) error {
+	if mlt.ID == "" {
+		mlt.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// En: IsExpired returns true if the magic link token has passed its expiry time.
+// Es: IsExpired devuelve true si el token de magic link ha pasado su tiempo de expiración.
+func (mlt *MagicLinkToken) IsExpired() bool {
+	return time.Now().After(mlt.ExpiresAt)
+}
+
+// En: IsUsed returns true if the magic link token has already been consumed.
+// Es: IsUsed devuelve true si el token de magic link ya fue consumido.
+func (mlt *MagicLinkToken) IsUsed() bool {
+	return mlt.UsedAt != nil
+}
+
+// En: DeviceAuthorization is a pending OAuth 2.0 device authorization grant (RFC 8628). The device polls with the
+// device code while a logged-in user approves or denies the user code; both codes are stored by hash.
+// Es: DeviceAuthorization es una concesión de autorización de dispositivo OAuth 2.0 (RFC 8628) pendiente. El dispositivo
+// consulta con el device code mientras un usuario con sesión aprueba o deniega el user code; ambos códigos se guardan por hash.
+type DeviceAuthorization struct {
+	ID              string     `gorm:"type:uuid;primaryKey" json:"-"`
+	DeviceCodeHash  string     `gorm:"column:device_code_hash;not null;uniqueIndex" json:"-"`
+	UserCodeHash    string     `gorm:"column:user_code_hash;not null;index" json:"-"`
+	ClientID        string     `gorm:"column:client_id" json:"-"`
+	UserID          *string    `gorm:"type:uuid;index" json:"-"`
+	IntervalSeconds int        `gorm:"not null" json:"-"`
+	LastPolledAt    *time.Time `json:"-"`
+	ApprovedAt      *time.Time `json:"-"`
+	DeniedAt        *time.Time `json:"-"`
+	ConsumedAt      *time.Time `json:"-"`
+	ExpiresAt       time.Time  `gorm:"not null" json:"-"`
+	CreatedAt       time.Time  `json:"-"`
+}
+
+// En: TableName overrides the table name.
+// Es: TableName sobrescribe el nombre de la tabla.
+func (DeviceAuthorization) TableName() string {
+	return "device_authorizations"
+}
+
+// En: BeforeCreate generates UUID before insert.
+// Es: BeforeCreate genera UUID antes de insertar.
+func (da *DeviceAuthorization) BeforeCreate(_ *gorm.DB) error {
+	if da.ID == "" {
+		da.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// En: IsExpired returns true if the device authorization has passed its expiry time.
+// Es: IsExpired devuelve true si la autorización de dispositivo ha pasado su tiempo de expiración.
+func (da *DeviceAuthorization) IsExpired() bool {
+	return time.Now().After(da.ExpiresAt)
+}
+
+// En: IsDecided returns true once the user approved or denied the request.
+// Es: IsDecided devuelve true cuando el usuario ya aprobó o denegó la solicitud.
+func (da *DeviceAuthorization) IsDecided() bool {
+	return da.ApprovedAt != nil || da.DeniedAt != nil
+}
+
+// En: OAuthAuthorizationCode is a single-use authorization code issued to a third-party OAuth client after the user
+// consented; it stores the PKCE challenge, the redirect URI and the granted scopes and account. Stored by hash.
+// Es: OAuthAuthorizationCode es un código de autorización de un solo uso emitido a un cliente OAuth de terceros tras el
+// consentimiento del usuario; guarda el desafío PKCE, la redirect URI y los scopes y la cuenta concedidos. Se guarda por hash.
+type OAuthAuthorizationCode struct {
+	ID            string     `gorm:"type:uuid;primaryKey" json:"-"`
+	CodeHash      string     `gorm:"column:code_hash;not null;uniqueIndex" json:"-"`
+	ClientID      string     `gorm:"type:uuid;not null;index" json:"-"`
+	UserID        string     `gorm:"type:uuid;not null" json:"-"`
+	AccountID     string     `gorm:"column:account_id" json:"-"`
+	RedirectURI   string     `gorm:"not null" json:"-"`
+	Scopes        []string   `gorm:"serializer:json" json:"-"`
+	CodeChallenge string     `gorm:"not null" json:"-"`
+	Nonce         string     `json:"-"`
+	ExpiresAt     time.Time  `gorm:"not null" json:"-"`
+	UsedAt        *time.Time `json:"-"`
+	CreatedAt     time.Time  `json:"-"`
+}
+
+// En: TableName overrides the table name.
+// Es: TableName sobrescribe el nombre de la tabla.
+func (OAuthAuthorizationCode) TableName() string {
+	return "oauth_authorization_codes"
+}
+
+// En: BeforeCreate generates UUID before insert.
+// Es: BeforeCreate genera UUID antes de insertar.
+func (c *OAuthAuthorizationCode) BeforeCreate(_ *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// En: IsExpired returns true if the authorization code has passed its expiry time.
+// Es: IsExpired devuelve true si el código de autorización ha pasado su tiempo de expiración.
+func (c *OAuthAuthorizationCode) IsExpired() bool {
+	return time.Now().After(c.ExpiresAt)
+}
+
+// En: OAuthGrant is the delegation a user gave a third-party OAuth client on one account with a set of scopes.
+// It holds the hash of the current client refresh token (rotated on each use); its ID is the "sid" of the client's
+// access tokens, so revoking the grant denylists them like a session.
+// Es: OAuthGrant es la delegación que un usuario dio a un cliente OAuth de terceros sobre una cuenta con un conjunto de scopes.
+// Guarda el hash del refresh token vigente del cliente (rotado en cada uso); su ID es el "sid" de los tokens de acceso
+// del cliente, así que revocar la concesión los deniega como a una sesión.
+type OAuthGrant struct {
+	ID               string     `gorm:"type:uuid;primaryKey" json:"-"`
+	ClientID         string     `gorm:"type:uuid;not null;index" json:"-"`
+	UserID           string     `gorm:"type:uuid;not null;index" json:"-"`
+	AccountID        string     `gorm:"column:account_id" json:"-"`
+	Scopes           []string   `gorm:"serializer:json" json:"-"`
+	RefreshTokenHash string     `gorm:"column:refresh_token_hash;not null;uniqueIndex" json:"-"`
+	ExpiresAt        time.Time  `gorm:"not null" json:"-"`
+	RevokedAt        *time.Time `json:"-"`
+	CreatedAt        time.Time  `json:"-"`
+	UpdatedAt        time.Time  `json:"-"`
+}
+
+// En: TableName overrides the table name.
+// Es: TableName sobrescribe el nombre de la tabla.
+func (OAuthGrant) TableName() string {
+	return "oauth_grants"
+}
+
+// En: BeforeCreate generates UUID before insert.
+// Es: BeforeCreate genera UUID antes de insertar.
+func (g *OAuthGrant) BeforeCreate(_ *gorm.DB) error {
+	if g.ID == "" {
+		g.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// En: IsActive reports whether the grant is neither revoked nor expired.
+// Es: IsActive indica si la concesión no está revocada ni expirada.
+func (g *OAuthGrant) IsActive() bool {
+	return g.RevokedAt == nil && time.Now().Before(g.ExpiresAt)
+}
+
+// En: EmailChangeToken is a single-use token (stored by hash) that confirms a pending change of the user's email to NewEmail.
+// Es: EmailChangeToken es un token de un solo uso (almacenado por hash) que confirma un cambio pendiente del email del usuario a NewEmail.
+type EmailChangeToken struct {
+	ID        string     `gorm:"type:uuid;primaryKey" json:"-"`
+	UserID    string     `gorm:"type:uuid;not null;index" json:"-"`
+	NewEmail  string     `gorm:"not null" json:"-"`
+	TokenHash string     `gorm:"column:token_hash;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
+
+// En: TableName overrides the table name.
+// Es: TableName sobrescribe el nombre de la tabla.
+func (EmailChangeToken) TableName() string {
+	return "email_change_tokens"
+}
+
+// En: BeforeCreate generates UUID before insert.
+// Es: BeforeCreate genera UUID antes de insertar.
+func (ect *EmailChangeToken) BeforeCreate(_ *gorm.DB) error {
+	if ect.ID == "" {
+		ect.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// En: IsExpired returns true if the email change token has passed its expiry time.
+// Es: IsExpired devuelve true si el token de cambio de email ha pasado su tiempo de expiración.
+func (ect *EmailChangeToken) IsExpired() bool {
+	return time.Now().After(ect.ExpiresAt)
+}
+
+// En: IsUsed returns true if the email change token has already been consumed.
+// Es: IsUsed devuelve true si el token de cambio de email ya fue consumido.
+func (ect *EmailChangeToken) IsUsed() bool {
+	return ect.UsedAt != nil
+}
+
+// En: OAuthState stores the PKCE verifier and nonce of an in-flight social sign-in or link, keyed by the hash of its state.
+// Es: OAuthState almacena el verificador PKCE y el nonce de un inicio de sesión social o enlace en curso, indexado por el hash de su state.
+type OAuthState struct {
+	ID           string       `gorm:"type:uuid;primaryKey" json:"-"`
+	StateHash    string       `gorm:"column:state_hash;not null;uniqueIndex" json:"-"`
+	Provider     ProviderType `gorm:"not null" json:"-"`
+	UserID       *string      `gorm:"type:uuid" json:"-"` // set when an authenticated user links a provider
+	CodeVerifier string       `gorm:"not null" json:"-"`
+	Nonce        string       `gorm:"not null" json:"-"`
+	ExpiresAt    time.Time    `gorm:"not null;index" json:"-"`
+	CreatedAt    time.Time    `json:"-"`
+}
+
+// En: TableName overrides the table name.
+// Es: TableName sobrescribe el nombre de la tabla.
+func (OAuthState) TableName() string {
+	return "oauth_states"
+}
+
+// En: BeforeCreate generates UUID before insert.
+// Es: BeforeCreate genera UUID antes de insertar.
+func (s *OAuthState) BeforeCreate(_ *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// En: IsExpired returns true if the sign-in attempt has passed its expiry time.
+// Es: IsExpired devuelve true si el intento de inicio de sesión ha pasado su tiempo de expiración.
+func (s *OAuthState) IsExpired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
+
+// En: TOTPCredential holds the TOTP secret of a user; 2FA is enabled once ConfirmedAt is set.
+// Es: TOTPCredential guarda el secreto TOTP de un usuario; el 2FA queda activo cuando ConfirmedAt está definido.
+type TOTPCredential struct {
+	ID     string `gorm:"type:uuid;primaryKey" json:"-"`
+	UserID string `gorm:"type:uuid;not null;uniqueIndex" json:"-"`
+	Secret string `gorm:"not null" json:"-"`
+	// LastUsedStep is the last accepted time step; codes of that step or earlier are rejected (replay protection).
+	LastUsedStep int64      `gorm:"not null;default:0" json:"-"`
+	ConfirmedAt  *time.Time `json:"-"`
+	CreatedAt    time.Time  `json:"-"`
+	UpdatedAt    time.Time  `json:"-"`
+}
+
+// En: TableName overrides the table name.
+// Es: TableName sobrescribe el nombre de la tabla.
+func (TOTPCredential) TableName() string {
+	return "totp_credentials"
+}
+
+// En: BeforeCreate generates UUID before insert.
+// Es: BeforeCreate genera UUID antes de insertar.
+func (c *TOTPCredential) BeforeCreate(_ *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// En: IsConfirmed returns true if the enrollment was confirmed with a first valid code.
+// Es: IsConfirmed devuelve true si la inscripción se confirmó con un primer código válido.
+func (c *TOTPCredential) IsConfirmed() bool {
+	return c.ConfirmedAt != nil
+}
+
+// En: RecoveryCode is a one-time 2FA recovery code, stored by hash.
+// Es: RecoveryCode es un código de recuperación 2FA de un solo uso, almacenado por hash.
+type RecoveryCode struct {
+	ID        string     `gorm:"type:uuid;primaryKey" json:"-"`
+	UserID    string     `gorm:"type:uuid;not null;index" json:"-"`
+	CodeHash  string     `gorm:"column:code_hash;not null;index" json:"-"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
+
+// En: TableName overrides the table name.
+// Es: TableName sobrescribe el nombre de la tabla.
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
+
+// En: BeforeCreate generates UUID before insert.
+// Es: BeforeCreate genera UUID antes de insertar.
+func (rc *RecoveryCode) BeforeCreate(_ *gorm.DB) error {
+	if rc.ID == "" {
+		rc.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// En: MFAChallenge is the short-lived, attempt-limited token issued by login when the user has 2FA enabled.
+// Es: MFAChallenge es el token de corta duración y con intentos limitados emitido por el login cuando el usuario tiene 2FA activo.
+type MFAChallenge struct {
+	ID        string     `gorm:"type:uuid;primaryKey" json:"-"`
+	UserID    string     `gorm:"type:uuid;not null;index" json:"-"`
+	TokenHash string     `gorm:"column:token_hash;not null;uniqueIndex" json:"-"`
+	Attempts  int        `gorm:"not null;default:0" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
+
+// En: TableName overrides the table name.
+// Es: TableName sobrescribe el nombre de la tabla.
+func (MFAChallenge) TableName() string {
+	return "mfa_challenges"
+}
+
+// En: BeforeCreate generates UUID before insert.
+// Es: BeforeCreate genera UUID antes de insertar.
+func (mc *MFAChallenge) BeforeCreate(_ *gorm.DB) error {
+	if mc.ID == "" {
+		mc.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// En: IsExpired returns true if the challenge has passed its expiry time.
+// Es: IsExpired devuelve true si el desafío ha pasado su tiempo de expiración.
+func (mc *MFAChallenge) IsExpired() bool {
+	return time.Now().After(mc.ExpiresAt)
+}
+
+// En: IsUsed returns true if the challenge was already completed.
+// Es: IsUsed devuelve true si el desafío ya fue completado.
+func (mc *MFAChallenge) IsUsed() bool {
+	return mc.UsedAt != nil
+}
+
+// En: Session is a login session (one per device); its ID is the FamilyID shared by the refresh tokens rotated from that login.
+// Es: Session es una sesión de inicio (una por dispositivo); su ID es el FamilyID compartido por los tokens de actualización rotados desde ese login.
+type Session struct {
+	ID         string     `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID     string     `gorm:"type:uuid;not null;index" json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `gorm:"column:ip_address" json:"ip_address"`
+	DeviceName string     `json:"device_name,omitempty"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	LastUsedAt time.Time  `gorm:"not null" json:"last_used_at"`
+	RevokedAt  *time.Time `gorm:"index" json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// En: TableName overrides the table name.
+// Es: TableName sobrescribe el nombre de la tabla.
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// En: BeforeCreate generates UUID before insert.
+// Es: BeforeCreate genera UUID antes de insertar.
+func (s *Session) BeforeCreate(_ *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// En: RevokedAccessToken is a denylist entry for access tokens revoked before they expire; ID is a "jti:" or "sid:" key.
+// Es: RevokedAccessToken es una entrada de la lista de denegación de tokens de acceso revocados antes de expirar; ID es una clave "jti:" o "sid:".
+type RevokedAccessToken struct {
+	ID        string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+// En: TableName overrides the table name.
+// Es: TableName sobrescribe el nombre de la tabla.
+func (RevokedAccessToken) TableName() string {
+	return "revoked_access_tokens"
+}
+
+// En: ThrottleState is the Postgres row of one throttle key (resend verification, forgot-password or login);
+// ID is the "THROTTLE#<scope>#<dimension>#<hash>" key and the counters are epoch seconds like the DynamoDB item.
+// Es: ThrottleState es la fila en Postgres de una clave de throttle (reenvío de verificación, contraseña olvidada o login);
+// ID es la clave "THROTTLE#<scope>#<dimensión>#<hash>" y los contadores son segundos epoch como en el ítem de DynamoDB.
+type ThrottleState struct {
+	ID            string `gorm:"primaryKey"`
+	Version       int64  `gorm:"not null"`
+	Count         int64  `gorm:"not null"`
+	WindowStart   int64  `gorm:"not null"`
+	NextAllowedAt int64  `gorm:"not null"`
+	LockUntil     int64  `gorm:"not null"`
+	CreatedAt     int64  `gorm:"not null;autoCreateTime:false"`
+	UpdatedAt     int64  `gorm:"not null;autoUpdateTime:false"`
+	ExpiresAt     int64  `gorm:"not null;index"`
+}
+
+// En: TableName overrides the table name.
+// Es: TableName sobrescribe el nombre de la tabla.
+func (ThrottleState) TableName() string {
+	return "throttle_states"
+}
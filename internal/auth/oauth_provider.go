@@ -0,0 +1,555 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cloudflax/api.cloudflax/internal/account"
+	"github.com/cloudflax/api.cloudflax/internal/shared/validator"
+	"github.com/cloudflax/api.cloudflax/internal/user"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// oauthAuthorizationCodeDuration is how long a client has to exchange an authorization code.
+	oauthAuthorizationCodeDuration = 5 * time.Minute
+	// oauthGrantDuration is how long a client refresh token (and the grant behind it) stays valid without use.
+	oauthGrantDuration = 30 * 24 * time.Hour
+	// pkceMethodS256 is the only PKCE method accepted; "plain" is not allowed.
+	pkceMethodS256 = "S256"
+)
+
+// OAuth grant types accepted by POST /oauth/token.
+const (
+	OAuthGrantTypeAuthorizationCode = "authorization_code"
+	OAuthGrantTypeRefreshToken      = "refresh_token"
+)
+
+// oauthSupportedScopes are the scopes a client can be registered with and request, as listed in the discovery document.
+var oauthSupportedScopes = []string{
+	account.OAuthScopeOpenID,
+	account.OAuthScopeEmail,
+	account.OAuthScopeProfile,
+	account.APIKeyScopeInvoicesRead,
+	account.APIKeyScopeInvoicesWrite,
+}
+
+// En: OAuthConsent describes an authorization request for the consent page: which client asks for which scopes.
+// Es: OAuthConsent describe una solicitud de autorización para la página de consentimiento: qué cliente pide qué scopes.
+type OAuthConsent struct {
+	ClientID        string   `json:"client_id"`
+	ClientName      string   `json:"client_name"`
+	Scopes          []string `json:"scopes"`
+	RedirectURI     string   `json:"redirect_uri"`
+	RequiresAccount bool     `json:"requires_account"`
+}
+
+// En: OAuthClientCredentials identifies the client calling the token or introspection endpoint.
+// Es: OAuthClientCredentials identifica al cliente que llama al endpoint de token o de introspección.
+type OAuthClientCredentials struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// En: OAuthTokenResponse is the RFC 6749 token response returned to third-party clients.
+// Es: OAuthTokenResponse es la respuesta de token RFC 6749 devuelta a los clientes de terceros.
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// En: IDTokenClaims are the claims of the OIDC ID token issued when the client requested the openid scope.
+// Es: IDTokenClaims son los claims del ID token OIDC emitido cuando el cliente pidió el scope openid.
+type IDTokenClaims struct {
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Nonce         string `json:"nonce,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// En: OAuthIntrospection is the RFC 7662 introspection response; only Active is set for inactive tokens.
+// Es: OAuthIntrospection es la respuesta de introspección RFC 7662; para tokens inactivos solo se informa Active.
+type OAuthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	AccountID string `json:"account_id,omitempty"`
+}
+
+// En: OpenIDConfiguration is the OIDC discovery document served at /.well-known/openid-configuration.
+// Es: OpenIDConfiguration es el documento de descubrimiento OIDC servido en /.well-known/openid-configuration.
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// En: OpenIDConfiguration returns the discovery document; the authorization endpoint is the consent page of the frontend.
+// Es: OpenIDConfiguration devuelve el documento de descubrimiento; el endpoint de autorización es la página de consentimiento del frontend.
+func (service *Service) OpenIDConfiguration() (*OpenIDConfiguration, error) {
+	if !service.oauthServerEnabled() {
+		return nil, ErrOAuthServerDisabled
+	}
+	signingAlgorithm := jwt.SigningMethodHS256.Alg()
+	if service.signingKeys != nil {
+		signingAlgorithm = service.signingKeys.active.Algorithm
+	}
+	authorizationEndpoint := service.issuer + "/oauth/authorize"
+	if service.frontendURL != "" {
+		authorizationEndpoint = service.frontendURL + "/oauth/authorize"
+	}
+	return &OpenIDConfiguration{
+		Issuer:                            service.issuer,
+		AuthorizationEndpoint:             authorizationEndpoint,
+		TokenEndpoint:                     service.issuer + "/oauth/token",
+		IntrospectionEndpoint:             service.issuer + "/oauth/introspect",
+		JWKSURI:                           service.issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   oauthSupportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{OAuthGrantTypeAuthorizationCode, OAuthGrantTypeRefreshToken},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{signingAlgorithm},
+		CodeChallengeMethodsSupported:     []string{pkceMethodS256},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+	}, nil
+}
+
+// En: ValidateOAuthAuthorization checks an authorization request before the consent page shows it; invalid
+// parameters come back as validator.ValidationErrors and must not be redirected to the client.
+// Es: ValidateOAuthAuthorization comprueba una solicitud de autorización antes de que la página de consentimiento la
+// muestre; los parámetros inválidos vuelven como validator.ValidationErrors y no deben redirigirse al cliente.
+func (service *Service) ValidateOAuthAuthorization(req OAuthAuthorizationRequest) (*OAuthConsent, error) {
+	client, scopes, err := service.checkAuthorizationRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthConsent{
+		ClientID:        client.ID,
+		ClientName:      client.Name,
+		Scopes:          scopes,
+		RedirectURI:     req.RedirectURI,
+		RequiresAccount: requiresAccount(scopes),
+	}, nil
+}
+
+// En: AuthorizeOAuthClient records the user's consent decision and returns the client redirect URL: with a single-use
+// code when approved, or with error=access_denied when denied. An empty accountID delegates the user's active account.
+// Es: AuthorizeOAuthClient registra la decisión de consentimiento del usuario y devuelve la URL de redirección del cliente:
+// con un código de un solo uso si aprueba, o con error=access_denied si deniega. Un accountID vacío delega la cuenta activa del usuario.
+func (service *Service) AuthorizeOAuthClient(userID string, req OAuthAuthorizationRequest, accountID string, approve bool) (string, error) {
+	client, scopes, err := service.checkAuthorizationRequest(req)
+	if err != nil {
+		return "", err
+	}
+	if !approve {
+		return oauthRedirect(req.RedirectURI, map[string]string{"error": "access_denied", "state": req.State})
+	}
+
+	delegatedAccountID, err := service.delegatedAccount(userID, accountID, requiresAccount(scopes))
+	if err != nil {
+		return "", err
+	}
+	rawCode, err := generateSecureToken()
+	if err != nil {
+		return "", fmt.Errorf("generate authorization code: %w", err)
+	}
+	code := &OAuthAuthorizationCode{
+		CodeHash:      hashToken(rawCode),
+		ClientID:      client.ID,
+		UserID:        userID,
+		AccountID:     delegatedAccountID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		ExpiresAt:     time.Now().Add(oauthAuthorizationCodeDuration),
+	}
+	if err := service.repository.CreateOAuthAuthorizationCode(code); err != nil {
+		return "", err
+	}
+	return oauthRedirect(req.RedirectURI, map[string]string{"code": rawCode, "state": req.State})
+}
+
+// En: ExchangeOAuthAuthorizationCode redeems an authorization code (once) after checking the client, the redirect URI
+// and the PKCE verifier, and starts a grant with a client refresh token. An ID token is added for the openid scope.
+// Es: ExchangeOAuthAuthorizationCode canjea un código de autorización (una vez) tras comprobar el cliente, la redirect URI
+// y el verificador PKCE, e inicia una concesión con un refresh token de cliente. Se añade un ID token con el scope openid.
+func (service *Service) ExchangeOAuthAuthorizationCode(creds OAuthClientCredentials, rawCode, redirectURI, codeVerifier string) (*OAuthTokenResponse, error) {
+	client, err := service.authenticateOAuthClient(creds)
+	if err != nil {
+		return nil, err
+	}
+	code, err := service.repository.ConsumeOAuthAuthorizationCode(hashToken(strings.TrimSpace(rawCode)))
+	if err != nil {
+		return nil, err
+	}
+	if code.ClientID != client.ID || code.IsExpired() || code.RedirectURI != redirectURI || !verifyPKCE(code.CodeChallenge, codeVerifier) {
+		return nil, ErrInvalidOAuthGrant
+	}
+	u, err := service.userRepository.GetUser(code.UserID)
+	if err != nil {
+		return nil, ErrInvalidOAuthGrant
+	}
+
+	rawRefresh, err := generateSecureToken()
+	if err != nil {
+		return nil, fmt.Errorf("generate refresh token: %w", err)
+	}
+	grant := &OAuthGrant{
+		ClientID:         client.ID,
+		UserID:           u.ID,
+		AccountID:        code.AccountID,
+		Scopes:           code.Scopes,
+		RefreshTokenHash: hashToken(rawRefresh),
+		ExpiresAt:        time.Now().Add(oauthGrantDuration),
+	}
+	if err := service.repository.CreateOAuthGrant(grant); err != nil {
+		return nil, err
+	}
+
+	response, err := service.issueOAuthAccessToken(u, grant, rawRefresh)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(grant.Scopes, account.OAuthScopeOpenID) {
+		idToken, err := service.signIDToken(u, client.ID, grant.Scopes, code.Nonce)
+		if err != nil {
+			return nil, fmt.Errorf("sign id token: %w", err)
+		}
+		response.IDToken = idToken
+	}
+	return response, nil
+}
+
+// En: RefreshOAuthToken rotates a client refresh token and issues a new access token with the scopes of the grant.
+// Es: RefreshOAuthToken rota un refresh token de cliente y emite un nuevo token de acceso con los scopes de la concesión.
+func (service *Service) RefreshOAuthToken(creds OAuthClientCredentials, rawRefreshToken string) (*OAuthTokenResponse, error) {
+	client, err := service.authenticateOAuthClient(creds)
+	if err != nil {
+		return nil, err
+	}
+	currentHash := hashToken(strings.TrimSpace(rawRefreshToken))
+	grant, err := service.repository.GetOAuthGrantByRefreshTokenHash(currentHash)
+	if err != nil {
+		return nil, err
+	}
+	if grant.ClientID != client.ID || !grant.IsActive() {
+		return nil, ErrInvalidOAuthGrant
+	}
+	u, err := service.userRepository.GetUser(grant.UserID)
+	if err != nil {
+		return nil, ErrInvalidOAuthGrant
+	}
+
+	rawRefresh, err := generateSecureToken()
+	if err != nil {
+		return nil, fmt.Errorf("generate refresh token: %w", err)
+	}
+	if err := service.repository.RotateOAuthGrantRefreshToken(grant.ID, currentHash, hashToken(rawRefresh)); err != nil {
+		return nil, err
+	}
+	return service.issueOAuthAccessToken(u, grant, rawRefresh)
+}
+
+// En: IntrospectOAuthToken reports whether an access or refresh token issued to the calling client is active (RFC 7662).
+// Only confidential clients may introspect, and only their own tokens; anything else is reported as inactive.
+// Es: IntrospectOAuthToken indica si un token de acceso o de actualización emitido al cliente que llama está activo (RFC 7662).
+// Solo los clientes confidenciales pueden hacer introspección, y solo de sus propios tokens; el resto se informa como inactivo.
+func (service *Service) IntrospectOAuthToken(ctx context.Context, creds OAuthClientCredentials, token string) (*OAuthIntrospection, error) {
+	client, err := service.authenticateOAuthClient(creds)
+	if err != nil {
+		return nil, err
+	}
+	if !client.Confidential {
+		return nil, ErrInvalidOAuthClient
+	}
+	token = strings.TrimSpace(token)
+	inactive := &OAuthIntrospection{Active: false}
+
+	if claims, err := service.parseAccessToken(token); err == nil {
+		if claims.ClientID != client.ID {
+			return inactive, nil
+		}
+		revoked, err := service.IsAccessTokenRevoked(ctx, claims.middlewareClaims())
+		if err != nil {
+			return nil, fmt.Errorf("check token revocation: %w", err)
+		}
+		if revoked {
+			return inactive, nil
+		}
+		result := &OAuthIntrospection{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientID:  claims.ClientID,
+			Username:  claims.Email,
+			TokenType: "Bearer",
+			Subject:   claims.Subject,
+			Issuer:    claims.Issuer,
+			AccountID: claims.AccountID,
+		}
+		if claims.ExpiresAt != nil {
+			result.ExpiresAt = claims.ExpiresAt.Unix()
+		}
+		if claims.IssuedAt != nil {
+			result.IssuedAt = claims.IssuedAt.Unix()
+		}
+		return result, nil
+	}
+
+	grant, err := service.repository.GetOAuthGrantByRefreshTokenHash(hashToken(token))
+	if err != nil {
+		if errors.Is(err, ErrInvalidOAuthGrant) {
+			return inactive, nil
+		}
+		return nil, err
+	}
+	if grant.ClientID != client.ID || !grant.IsActive() {
+		return inactive, nil
+	}
+	return &OAuthIntrospection{
+		Active:    true,
+		Scope:     strings.Join(grant.Scopes, " "),
+		ClientID:  grant.ClientID,
+		TokenType: OAuthGrantTypeRefreshToken,
+		ExpiresAt: grant.ExpiresAt.Unix(),
+		IssuedAt:  grant.UpdatedAt.Unix(),
+		Subject:   grant.UserID,
+		Issuer:    service.issuer,
+		AccountID: grant.AccountID,
+	}, nil
+}
+
+// oauthServerEnabled reports whether the issuer URL and the client registry are configured.
+func (service *Service) oauthServerEnabled() bool {
+	return service.issuer != "" && service.oauthClients != nil
+}
+
+// lookupOAuthClient returns the active client with the given id, or ErrInvalidOAuthClient.
+func (service *Service) lookupOAuthClient(clientID string) (*account.OAuthClient, error) {
+	if !service.oauthServerEnabled() {
+		return nil, ErrOAuthServerDisabled
+	}
+	client, err := service.oauthClients.GetOAuthClient(strings.TrimSpace(clientID))
+	if err != nil {
+		if errors.Is(err, account.ErrOAuthClientNotFound) {
+			return nil, ErrInvalidOAuthClient
+		}
+		return nil, fmt.Errorf("lookup oauth client: %w", err)
+	}
+	return client, nil
+}
+
+// authenticateOAuthClient resolves the calling client; confidential clients must present their secret.
+func (service *Service) authenticateOAuthClient(creds OAuthClientCredentials) (*account.OAuthClient, error) {
+	client, err := service.lookupOAuthClient(creds.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.Confidential && !client.CheckSecret(creds.ClientSecret) {
+		return nil, ErrInvalidOAuthClient
+	}
+	return client, nil
+}
+
+// checkAuthorizationRequest validates the client, redirect URI, response type, scopes and PKCE challenge of a request.
+func (service *Service) checkAuthorizationRequest(req OAuthAuthorizationRequest) (*account.OAuthClient, []string, error) {
+	client, err := service.lookupOAuthClient(req.ClientID)
+	if err != nil {
+		if errors.Is(err, ErrInvalidOAuthClient) {
+			return nil, nil, validator.ValidationErrors{{Field: "client_id", Message: "Unknown client"}}
+		}
+		return nil, nil, err
+	}
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		return nil, nil, validator.ValidationErrors{{Field: "redirect_uri", Message: "Redirect URI is not registered for this client"}}
+	}
+
+	var problems validator.ValidationErrors
+	if req.ResponseType != "code" {
+		problems = append(problems, validator.FieldError{Field: "response_type", Message: "Only the code response type is supported"})
+	}
+	var scopes []string
+	for _, scope := range strings.Fields(req.Scope) {
+		if !client.AllowsScope(scope) {
+			problems = append(problems, validator.FieldError{Field: "scope", Message: "Scope " + scope + " is not allowed for this client"})
+			continue
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(strings.Fields(req.Scope)) == 0 {
+		problems = append(problems, validator.FieldError{Field: "scope", Message: "At least one scope is required"})
+	}
+	if req.CodeChallengeMethod != pkceMethodS256 {
+		problems = append(problems, validator.FieldError{Field: "code_challenge_method", Message: "Only S256 is supported"})
+	}
+	if len(req.CodeChallenge) < 43 || len(req.CodeChallenge) > 128 {
+		problems = append(problems, validator.FieldError{Field: "code_challenge", Message: "Must be between 43 and 128 characters"})
+	}
+	if len(problems) > 0 {
+		return nil, nil, problems
+	}
+	return client, scopes, nil
+}
+
+// delegatedAccount resolves the account the user delegates: accountID when the user is a member there, else the
+// active account. It fails with ErrOAuthAccountNotAllowed when an account is required and none applies.
+func (service *Service) delegatedAccount(userID, accountID string, required bool) (string, error) {
+	if accountID == "" {
+		u, err := service.userRepository.GetUser(userID)
+		if err != nil {
+			return "", fmt.Errorf("lookup user: %w", err)
+		}
+		if u.ActiveAccountID != nil {
+			accountID = *u.ActiveAccountID
+		}
+	}
+	if accountID == "" {
+		if required {
+			return "", ErrOAuthAccountNotAllowed
+		}
+		return "", nil
+	}
+	memberAccountID, _, err := service.accountRole(accountID, userID)
+	if err != nil {
+		return "", err
+	}
+	if memberAccountID == "" {
+		return "", ErrOAuthAccountNotAllowed
+	}
+	return memberAccountID, nil
+}
+
+// issueOAuthAccessToken signs a client access token for the grant and builds the token response around rawRefresh.
+func (service *Service) issueOAuthAccessToken(u *user.User, grant *OAuthGrant, rawRefresh string) (*OAuthTokenResponse, error) {
+	var accountRole account.RoleType
+	if grant.AccountID != "" {
+		accountID, role, err := service.accountRole(grant.AccountID, u.ID)
+		if err != nil {
+			return nil, err
+		}
+		// The user left the account (or lost the role) since consenting; the delegation no longer holds.
+		if accountID == "" {
+			return nil, ErrInvalidOAuthGrant
+		}
+		accountRole = role
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(service.accessTokenDuration)
+	scope := strings.Join(grant.Scopes, " ")
+	claims := &Claims{
+		UserID:      u.ID,
+		SessionID:   grant.ID,
+		AccountID:   grant.AccountID,
+		AccountRole: accountRole,
+		ClientID:    grant.ClientID,
+		Scope:       scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    service.issuer,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Subject:   u.ID,
+		},
+	}
+	if slices.Contains(grant.Scopes, account.OAuthScopeEmail) {
+		claims.Email = u.Email
+	}
+	accessToken, err := service.signJWT(claims)
+	if err != nil {
+		return nil, fmt.Errorf("sign access token: %w", err)
+	}
+	return &OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(service.accessTokenDuration / time.Second),
+		RefreshToken: rawRefresh,
+		Scope:        scope,
+	}, nil
+}
+
+// signIDToken signs an OIDC ID token for the client; email and profile claims follow the granted scopes.
+func (service *Service) signIDToken(u *user.User, clientID string, scopes []string, nonce string) (string, error) {
+	now := time.Now()
+	claims := &IDTokenClaims{
+		Nonce: nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    service.issuer,
+			Subject:   u.ID,
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(service.accessTokenDuration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	if slices.Contains(scopes, account.OAuthScopeEmail) {
+		verified := u.IsEmailVerified()
+		claims.Email = u.Email
+		claims.EmailVerified = &verified
+	}
+	if slices.Contains(scopes, account.OAuthScopeProfile) {
+		claims.Name = u.Name
+	}
+	return service.signJWT(claims)
+}
+
+// requiresAccount reports whether the scopes act on account data, so the grant must be bound to an account.
+func requiresAccount(scopes []string) bool {
+	return slices.Contains(scopes, account.APIKeyScopeInvoicesRead) || slices.Contains(scopes, account.APIKeyScopeInvoicesWrite)
+}
+
+// verifyPKCE checks an S256 code verifier against the stored challenge (RFC 7636 section 4.6).
+func verifyPKCE(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// oauthRedirect appends the non-empty params to the registered redirect URI, keeping its own query.
+func oauthRedirect(redirectURI string, params map[string]string) (string, error) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", fmt.Errorf("parse redirect uri: %w", err)
+	}
+	query := target.Query()
+	for key, value := range params {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	target.RawQuery = query.Encode()
+	return target.String(), nil
+}
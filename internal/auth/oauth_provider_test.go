@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cloudflax/api.cloudflax/internal/account"
+	"github.com/cloudflax/api.cloudflax/internal/shared/database"
+	runtimeError "github.com/cloudflax/api.cloudflax/internal/shared/runtimeerror"
+	"github.com/cloudflax/api.cloudflax/internal/user"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPKCEVerifier is the code verifier of RFC 7636 appendix B.
+const testPKCEVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+const testRedirectURI = "https://partner.example/callback"
+
+// En: oauthProviderFixture holds the app, service and seeded records of an OAuth provider test.
+// Es: oauthProviderFixture contiene la app, el servicio y los registros sembrados de una prueba del proveedor OAuth.
+type oauthProviderFixture struct {
+	app     *fiber.App
+	service *Service
+	user    *user.User
+	account *account.Account
+	client  *account.OAuthClient
+	secret  string
+}
+
+// En: setupOAuthProviderTest enables the OAuth provider and registers a confidential client on the user's active account.
+// Es: setupOAuthProviderTest habilita el proveedor OAuth y registra un cliente confidencial en la cuenta activa del usuario.
+func setupOAuthProviderTest(test *testing.T) *oauthProviderFixture {
+	test.Helper()
+	handler, service := SetupAuthHandlerTest(test)
+	require.NoError(test, database.RunMigrations(&account.Account{}, &account.AccountMember{}, &account.OAuthClient{}))
+	accountRepository := account.NewRepository(database.DB)
+	accountService := account.NewService(accountRepository, user.NewRepository(database.DB))
+	service.accountMembers = accountRepository
+	service.oauthClients = accountService
+	service.issuer = "http://api.test"
+
+	u := createVerifiedTestUser(test, "Olga", "olga@example.com", "password123")
+	acc := &account.Account{Name: "Olga Org", Slug: "olga-org"}
+	require.NoError(test, accountRepository.CreateAccount(acc))
+	require.NoError(test, accountRepository.CreateMember(&account.AccountMember{AccountID: acc.ID, UserID: u.ID, Role: account.RoleOwner}))
+	u.ActiveAccountID = &acc.ID
+	require.NoError(test, database.DB.Save(u).Error)
+
+	client, secret, err := accountService.CreateOAuthClient(acc.ID, u.ID, "Partner App", []string{testRedirectURI},
+		[]string{account.OAuthScopeOpenID, account.OAuthScopeEmail, account.APIKeyScopeInvoicesRead}, false)
+	require.NoError(test, err)
+
+	authenticated := func(c fiber.Ctx) error {
+		c.Locals("userID", u.ID)
+		return c.Next()
+	}
+	app := fiber.New()
+	app.Get("/.well-known/openid-configuration", handler.OpenIDConfiguration)
+	app.Get("/oauth/authorize", authenticated, handler.GetOAuthAuthorization)
+	app.Post("/oauth/authorize", authenticated, handler.DecideOAuthAuthorization)
+	app.Post("/oauth/token", handler.OAuthToken)
+	app.Post("/oauth/introspect", handler.OAuthIntrospect)
+
+	return &oauthProviderFixture{app: app, service: service, user: u, account: acc, client: client, secret: secret}
+}
+
+// En: authorizationQuery builds the query of a valid authorization request for the fixture client.
+// Es: authorizationQuery construye la query de una solicitud de autorización válida para el cliente del fixture.
+func (fixture *oauthProviderFixture) authorizationQuery() url.Values {
+	sum := sha256.Sum256([]byte(testPKCEVerifier))
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {fixture.client.ID},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"openid email invoices:read"},
+		"state":                 {"xyz"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+		"nonce":                 {"n-0S6"},
+	}
+}
+
+// En: decide posts the consent decision for the query and returns the status and decoded body.
+// Es: decide envía la decisión de consentimiento para la query y devuelve el estado y el cuerpo decodificado.
+func (fixture *oauthProviderFixture) decide(test *testing.T, query url.Values, approve bool) (int, map[string]any) {
+	test.Helper()
+	body := map[string]any{"approve": approve}
+	for key := range query {
+		body[key] = query.Get(key)
+	}
+	payload, err := json.Marshal(body)
+	require.NoError(test, err)
+	req := httptest.NewRequest("POST", "/oauth/authorize", strings.NewReader(string(payload)))
+	req.Header.Set("Content-Type", "application/json")
+	return doOAuthRequest(test, fixture.app, req)
+}
+
+// En: postOAuthForm posts a form to a client endpoint, authenticating with HTTP Basic when clientID is set.
+// Es: postOAuthForm envía un formulario a un endpoint de cliente, autenticándose con HTTP Basic si clientID está definido.
+func (fixture *oauthProviderFixture) postOAuthForm(test *testing.T, path string, form url.Values, clientID, clientSecret string) (int, map[string]any) {
+	test.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(clientID, clientSecret)
+	}
+	return doOAuthRequest(test, fixture.app, req)
+}
+
+// En: doOAuthRequest runs the request against the app and decodes the JSON body.
+// Es: doOAuthRequest ejecuta la solicitud contra la app y decodifica el cuerpo JSON.
+func doOAuthRequest(test *testing.T, app *fiber.App, req *http.Request) (int, map[string]any) {
+	test.Helper()
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	var body map[string]any
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body
+}
+
+// En: redirectParams parses the redirect_to URL returned by the consent endpoint.
+// Es: redirectParams analiza la URL redirect_to devuelta por el endpoint de consentimiento.
+func redirectParams(test *testing.T, body map[string]any) url.Values {
+	test.Helper()
+	data, ok := body["data"].(map[string]any)
+	require.True(test, ok, "response has data")
+	redirectTo, _ := data["redirect_to"].(string)
+	require.True(test, strings.HasPrefix(redirectTo, testRedirectURI+"?"), redirectTo)
+	parsed, err := url.Parse(redirectTo)
+	require.NoError(test, err)
+	return parsed.Query()
+}
+
+// En: TestOAuthProviderAuthorizationCodeFlow covers discovery, consent, code exchange with PKCE, the ID token,
+// refresh rotation, introspection and the revocation of grants on logout.
+// Es: TestOAuthProviderAuthorizationCodeFlow cubre el descubrimiento, el consentimiento, el canje del código con PKCE,
+// el ID token, la rotación del refresh, la introspección y la revocación de concesiones al cerrar sesión.
+func TestOAuthProviderAuthorizationCodeFlow(test *testing.T) {
+	fixture := setupOAuthProviderTest(test)
+
+	status, discovery := doOAuthRequest(test, fixture.app, httptest.NewRequest("GET", "/.well-known/openid-configuration", nil))
+	require.Equal(test, fiber.StatusOK, status)
+	assert.Equal(test, "http://api.test", discovery["issuer"])
+	assert.Equal(test, "http://test/oauth/authorize", discovery["authorization_endpoint"])
+	assert.Equal(test, "http://api.test/oauth/token", discovery["token_endpoint"])
+	assert.Equal(test, "http://api.test/oauth/introspect", discovery["introspection_endpoint"])
+	assert.Equal(test, []any{"S256"}, discovery["code_challenge_methods_supported"])
+
+	query := fixture.authorizationQuery()
+	status, body := doOAuthRequest(test, fixture.app, httptest.NewRequest("GET", "/oauth/authorize?"+query.Encode(), nil))
+	require.Equal(test, fiber.StatusOK, status)
+	consent := body["data"].(map[string]any)
+	assert.Equal(test, "Partner App", consent["client_name"])
+	assert.Equal(test, []any{"openid", "email", "invoices:read"}, consent["scopes"])
+	assert.Equal(test, true, consent["requires_account"])
+
+	status, body = fixture.decide(test, query, true)
+	require.Equal(test, fiber.StatusOK, status)
+	params := redirectParams(test, body)
+	assert.Equal(test, "xyz", params.Get("state"))
+	code := params.Get("code")
+	require.NotEmpty(test, code)
+
+	exchange := url.Values{
+		"grant_type":    {OAuthGrantTypeAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testPKCEVerifier},
+	}
+	status, tokens := fixture.postOAuthForm(test, "/oauth/token", exchange, fixture.client.ID, fixture.secret)
+	require.Equal(test, fiber.StatusOK, status, tokens)
+	assert.Equal(test, "Bearer", tokens["token_type"])
+	assert.Equal(test, "openid email invoices:read", tokens["scope"])
+	accessToken := tokens["access_token"].(string)
+	refreshToken := tokens["refresh_token"].(string)
+
+	claims, err := fixture.service.ValidateAccessTokenClaims(accessToken)
+	require.NoError(test, err)
+	assert.Equal(test, fixture.user.ID, claims.UserID)
+	assert.Equal(test, fixture.client.ID, claims.ClientID)
+	assert.Equal(test, []string{"openid", "email", "invoices:read"}, claims.Scopes)
+	assert.Equal(test, fixture.account.ID, claims.AccountID)
+	assert.Equal(test, account.RoleOwner, claims.AccountRole)
+
+	idToken := tokens["id_token"].(string)
+	idClaims := &IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(idToken, idClaims, func(*jwt.Token) (any, error) { return []byte(testJWTSecret), nil })
+	require.NoError(test, err)
+	assert.Equal(test, jwt.ClaimStrings{fixture.client.ID}, idClaims.Audience)
+	assert.Equal(test, "n-0S6", idClaims.Nonce)
+	assert.Equal(test, "olga@example.com", idClaims.Email)
+	_, err = fixture.service.ValidateAccessTokenClaims(idToken)
+	assert.Error(test, err, "an ID token is not an access token")
+
+	status, body = fixture.postOAuthForm(test, "/oauth/token", exchange, fixture.client.ID, fixture.secret)
+	assert.Equal(test, fiber.StatusBadRequest, status)
+	assert.Equal(test, "invalid_grant", body["error"], "codes are single-use")
+
+	refresh := url.Values{"grant_type": {OAuthGrantTypeRefreshToken}, "refresh_token": {refreshToken}}
+	status, rotated := fixture.postOAuthForm(test, "/oauth/token", refresh, fixture.client.ID, fixture.secret)
+	require.Equal(test, fiber.StatusOK, status, rotated)
+	assert.NotEqual(test, refreshToken, rotated["refresh_token"])
+	assert.Empty(test, rotated["id_token"])
+	status, body = fixture.postOAuthForm(test, "/oauth/token", refresh, fixture.client.ID, fixture.secret)
+	assert.Equal(test, fiber.StatusBadRequest, status)
+	assert.Equal(test, "invalid_grant", body["error"], "rotated refresh tokens cannot be reused")
+
+	status, body = fixture.postOAuthForm(test, "/oauth/introspect", url.Values{"token": {accessToken}}, fixture.client.ID, fixture.secret)
+	require.Equal(test, fiber.StatusOK, status)
+	assert.Equal(test, true, body["active"])
+	assert.Equal(test, fixture.client.ID, body["client_id"])
+	assert.Equal(test, "openid email invoices:read", body["scope"])
+	assert.Equal(test, fixture.account.ID, body["account_id"])
+
+	status, body = fixture.postOAuthForm(test, "/oauth/introspect", url.Values{"token": {refreshToken}}, fixture.client.ID, fixture.secret)
+	require.Equal(test, fiber.StatusOK, status)
+	assert.Equal(test, map[string]any{"active": false}, body)
+
+	status, body = fixture.postOAuthForm(test, "/oauth/introspect", url.Values{"token": {accessToken}}, fixture.client.ID, "wrong-secret")
+	assert.Equal(test, fiber.StatusUnauthorized, status)
+	assert.Equal(test, "invalid_client", body["error"])
+
+	require.NoError(test, fixture.service.Logout(fixture.user.ID))
+	revoked, err := fixture.service.IsAccessTokenRevoked(context.Background(), claims)
+	require.NoError(test, err)
+	assert.False(test, revoked, "a plain logout keeps the grants to third-party clients")
+
+	require.NoError(test, fixture.service.RevokeAllByUserID(fixture.user.ID))
+	revoked, err = fixture.service.IsAccessTokenRevoked(context.Background(), claims)
+	require.NoError(test, err)
+	assert.True(test, revoked, "logging out everywhere also cuts off third-party clients")
+	refresh.Set("refresh_token", rotated["refresh_token"].(string))
+	status, body = fixture.postOAuthForm(test, "/oauth/token", refresh, fixture.client.ID, fixture.secret)
+	assert.Equal(test, fiber.StatusBadRequest, status)
+	assert.Equal(test, "invalid_grant", body["error"])
+}
+
+// En: TestOAuthProviderRejectsInvalidRequests covers invalid authorization requests, denial, a wrong PKCE verifier,
+// missing client authentication and a disabled provider.
+// Es: TestOAuthProviderRejectsInvalidRequests cubre solicitudes de autorización inválidas, la denegación, un verificador
+// PKCE incorrecto, la falta de autenticación del cliente y un proveedor deshabilitado.
+func TestOAuthProviderRejectsInvalidRequests(test *testing.T) {
+	fixture := setupOAuthProviderTest(test)
+
+	query := fixture.authorizationQuery()
+	query.Set("redirect_uri", "https://attacker.example/callback")
+	resp, err := fixture.app.Test(httptest.NewRequest("GET", "/oauth/authorize?"+query.Encode(), nil), fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusBadRequest, resp.StatusCode)
+	errorResponse := DecodeErrorResponse(test, resp.Body)
+	assert.Equal(test, runtimeError.CodeInvalidAuthorizationRequest, errorResponse.Error.Code)
+	require.Len(test, errorResponse.Error.Details, 1)
+	assert.Equal(test, "redirect_uri", errorResponse.Error.Details[0].Field)
+
+	query = fixture.authorizationQuery()
+	query.Set("code_challenge_method", "plain")
+	query.Set("scope", "openid invoices:write")
+	resp, err = fixture.app.Test(httptest.NewRequest("GET", "/oauth/authorize?"+query.Encode(), nil), fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusBadRequest, resp.StatusCode)
+	errorResponse = DecodeErrorResponse(test, resp.Body)
+	var fields []string
+	for _, detail := range errorResponse.Error.Details {
+		fields = append(fields, detail.Field)
+	}
+	assert.ElementsMatch(test, []string{"scope", "code_challenge_method"}, fields)
+
+	status, body := fixture.decide(test, fixture.authorizationQuery(), false)
+	require.Equal(test, fiber.StatusOK, status)
+	params := redirectParams(test, body)
+	assert.Equal(test, "access_denied", params.Get("error"))
+	assert.Equal(test, "xyz", params.Get("state"))
+	assert.Empty(test, params.Get("code"))
+
+	status, body = fixture.decide(test, fixture.authorizationQuery(), true)
+	require.Equal(test, fiber.StatusOK, status)
+	exchange := url.Values{
+		"grant_type":    {OAuthGrantTypeAuthorizationCode},
+		"code":          {redirectParams(test, body).Get("code")},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {strings.Repeat("x", 43)},
+	}
+	status, body = fixture.postOAuthForm(test, "/oauth/token", exchange, "", "")
+	assert.Equal(test, fiber.StatusUnauthorized, status)
+	assert.Equal(test, "invalid_client", body["error"], "confidential clients must authenticate")
+	status, body = fixture.postOAuthForm(test, "/oauth/token", exchange, fixture.client.ID, fixture.secret)
+	assert.Equal(test, fiber.StatusBadRequest, status)
+	assert.Equal(test, "invalid_grant", body["error"], "the PKCE verifier must match the challenge")
+
+	status, body = fixture.postOAuthForm(test, "/oauth/token", url.Values{"grant_type": {"password"}}, fixture.client.ID, fixture.secret)
+	assert.Equal(test, fiber.StatusBadRequest, status)
+	assert.Equal(test, "unsupported_grant_type", body["error"])
+
+	fixture.service.issuer = ""
+	resp, err = fixture.app.Test(httptest.NewRequest("GET", "/.well-known/openid-configuration", nil), fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	assert.Equal(test, fiber.StatusNotFound, resp.StatusCode)
+	assert.Equal(test, runtimeError.CodeOAuthServerDisabled, DecodeErrorResponse(test, resp.Body).Error.Code)
+}
@@ -0,0 +1,377 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oidcHTTPTimeout   = 10 * time.Second
+	oidcMaxBodyBytes  = 1 << 20
+	pkceVerifierBytes = 32
+	// oidcJWKSRefreshCooldown is the minimum time between two JWKS fetches, so tokens with
+	// made-up kids cannot make every request hit the provider.
+	oidcJWKSRefreshCooldown = time.Minute
+	// googleIssuerURL is Google's OIDC issuer; its ID tokens may also carry googleIssuerHost
+	// (the same issuer without the scheme) as "iss".
+	googleIssuerURL  = "https://accounts.google.com"
+	googleIssuerHost = "accounts.google.com"
+)
+
+// En: OIDCProviderConfig configures an OpenID Connect provider used for social sign-in.
+// Es: OIDCProviderConfig configura un proveedor OpenID Connect usado para el inicio de sesión social.
+type OIDCProviderConfig struct {
+	Provider     ProviderType
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes requested on the authorization endpoint; empty defaults to openid, email and profile.
+	Scopes []string
+}
+
+// oidcDiscovery is the subset of the OpenID provider metadata this API uses.
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcIDTokenClaims holds the ID token claims read during sign-in.
+type oidcIDTokenClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Nonce         string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// oidcIdentity is the verified identity extracted from an ID token.
+type oidcIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// jsonWebKey is a single entry of a JWKS document (RSA and EC public keys).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// oidcProvider talks to one OpenID provider: discovery, code exchange and ID token verification.
+// Discovery metadata and signing keys are cached; keys are refetched when an unknown kid shows up,
+// at most once per oidcJWKSRefreshCooldown.
+type oidcProvider struct {
+	config     OIDCProviderConfig
+	httpClient *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+// newOIDCProvider builds a provider client from its configuration.
+func newOIDCProvider(config OIDCProviderConfig, httpClient *http.Client) *oidcProvider {
+	config.IssuerURL = strings.TrimSuffix(strings.TrimSpace(config.IssuerURL), "/")
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: oidcHTTPTimeout}
+	}
+	return &oidcProvider{config: config, httpClient: httpClient}
+}
+
+// authorizationURL builds the authorization-code + PKCE (S256) redirect URL.
+func (p *oidcProvider) authorizationURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// exchangeCode redeems the authorization code at the token endpoint and returns the raw ID token.
+func (p *oidcProvider) exchangeCode(ctx context.Context, code, codeVerifier string) (string, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxBodyBytes)).Decode(&body); err != nil {
+		return "", fmt.Errorf("decode token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, body.Error)
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("token response has no id_token")
+	}
+	return body.IDToken, nil
+}
+
+// verifyIDToken validates signature (JWKS), issuer, audience, expiry and nonce of an ID token.
+func (p *oidcProvider) verifyIDToken(ctx context.Context, rawIDToken, expectedNonce string) (*oidcIdentity, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &oidcIDTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.signingKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("verify id token: %w", err)
+	}
+	if !acceptsIssuer(discovery.Issuer, claims.Issuer) {
+		return nil, fmt.Errorf("verify id token: issuer %q not accepted", claims.Issuer)
+	}
+	if claims.Nonce == "" || claims.Nonce != expectedNonce {
+		return nil, fmt.Errorf("verify id token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("verify id token: missing subject")
+	}
+
+	return &oidcIdentity{
+		Subject:       claims.Subject,
+		Email:         strings.ToLower(strings.TrimSpace(claims.Email)),
+		EmailVerified: claims.EmailVerified,
+		Name:          strings.TrimSpace(claims.Name),
+	}, nil
+}
+
+// getDiscovery returns the cached provider metadata, fetching it on first use. The fetch runs
+// outside the lock so a slow provider does not block other requests waiting on the cache.
+func (p *oidcProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	cached := p.discovery
+	p.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(ctx, p.config.IssuerURL+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.config.IssuerURL {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match configured %q", discovery.Issuer, p.config.IssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery: incomplete provider metadata")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery == nil {
+		p.discovery = &discovery
+	}
+	return p.discovery, nil
+}
+
+// acceptsIssuer reports whether an ID token "iss" matches the discovered issuer. Google
+// documents both "https://accounts.google.com" and "accounts.google.com", so both are accepted.
+func acceptsIssuer(discoveredIssuer, tokenIssuer string) bool {
+	if tokenIssuer == discoveredIssuer {
+		return true
+	}
+	return strings.TrimSuffix(discoveredIssuer, "/") == googleIssuerURL && tokenIssuer == googleIssuerHost
+}
+
+// signingKey returns the public key for kid, refreshing the JWKS when it is unknown and the
+// last fetch is older than oidcJWKSRefreshCooldown.
+func (p *oidcProvider) signingKey(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	if ok {
+		p.mu.Unlock()
+		return key, nil
+	}
+	if p.discovery == nil {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("oidc provider metadata not loaded")
+	}
+	if !p.keysFetchedAt.IsZero() && time.Since(p.keysFetchedAt) < oidcJWKSRefreshCooldown {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("no signing key for kid %q", kid)
+	}
+	jwksURI := p.discovery.JWKSURI
+	p.keysFetchedAt = time.Now()
+	p.mu.Unlock()
+
+	var document struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURI, &document); err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	keys := make(map[string]any, len(document.Keys))
+	for _, jwk := range document.Keys {
+		publicKey, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = publicKey
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	key, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("no signing key for kid %q", kid)
+	}
+	return key, nil
+}
+
+// getJSON performs a GET request and decodes a JSON body.
+func (p *oidcProvider) getJSON(ctx context.Context, target string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, target)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, oidcMaxBodyBytes)).Decode(out)
+}
+
+// publicKey converts the JWK into an *rsa.PublicKey or *ecdsa.PublicKey.
+func (jwk jsonWebKey) publicKey() (any, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("decode modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("decode exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("decode x: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("decode y: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+// generatePKCEVerifier creates a random RFC 7636 code verifier (43 characters, base64url).
+func generatePKCEVerifier() (string, error) {
+	raw := make([]byte, pkceVerifierBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// pkceChallengeS256 derives the S256 code challenge of a verifier.
+func pkceChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,472 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudflax/api.cloudflax/internal/shared/database"
+	"github.com/cloudflax/api.cloudflax/internal/shared/verificationnotify"
+	"github.com/cloudflax/api.cloudflax/internal/user"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	mockOIDCClientID = "test-client"
+	mockOIDCKeyID    = "test-key"
+	mockOIDCCode     = "valid-code"
+)
+
+// En: mockOIDCServer is a minimal OpenID provider (discovery, JWKS and token endpoint) for tests.
+// Es: mockOIDCServer es un proveedor OpenID mínimo (discovery, JWKS y endpoint de tokens) para pruebas.
+type mockOIDCServer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu            sync.Mutex
+	codeChallenge string
+	nonce         string
+	subject       string
+	email         string
+	emailVerified bool
+	jwksFetches   int
+}
+
+// En: newMockOIDCServer starts a mock OIDC provider that is closed when the test ends.
+// Es: newMockOIDCServer arranca un proveedor OIDC simulado que se cierra al terminar la prueba.
+func newMockOIDCServer(test *testing.T) *mockOIDCServer {
+	test.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(test, err)
+
+	mock := &mockOIDCServer{key: key, subject: "google-subject-1", email: "oauth@example.com", emailVerified: true}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 mock.server.URL,
+			"authorization_endpoint": mock.server.URL + "/authorize",
+			"token_endpoint":         mock.server.URL + "/token",
+			"jwks_uri":               mock.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		mock.mu.Lock()
+		mock.jwksFetches++
+		mock.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []jsonWebKey{{
+			Kty: "RSA",
+			Kid: mockOIDCKeyID,
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", mock.handleToken)
+	mock.server = httptest.NewServer(mux)
+	test.Cleanup(mock.server.Close)
+	return mock
+}
+
+// En: handleToken checks the code and PKCE verifier and returns a signed ID token.
+// Es: handleToken comprueba el código y el verificador PKCE y devuelve un ID token firmado.
+func (mock *mockOIDCServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.FormValue("code") != mockOIDCCode || pkceChallengeS256(r.FormValue("code_verifier")) != mock.codeChallenge {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, &oidcIDTokenClaims{
+		Email:         mock.email,
+		EmailVerified: mock.emailVerified,
+		Name:          "OAuth User",
+		Nonce:         mock.nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    mock.server.URL,
+			Subject:   mock.subject,
+			Audience:  jwt.ClaimStrings{mockOIDCClientID},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+	token.Header["kid"] = mockOIDCKeyID
+	signed, err := token.SignedString(mock.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+}
+
+// En: authorize records what the browser would send to the authorization endpoint and returns the state.
+// Es: authorize registra lo que el navegador enviaría al endpoint de autorización y devuelve el state.
+func (mock *mockOIDCServer) authorize(test *testing.T, authorizationURL string) string {
+	test.Helper()
+	parsed, err := url.Parse(authorizationURL)
+	require.NoError(test, err)
+	query := parsed.Query()
+	require.Equal(test, "S256", query.Get("code_challenge_method"))
+	require.Equal(test, mockOIDCClientID, query.Get("client_id"))
+
+	mock.mu.Lock()
+	mock.codeChallenge = query.Get("code_challenge")
+	mock.nonce = query.Get("nonce")
+	mock.mu.Unlock()
+	return query.Get("state")
+}
+
+// En: providerConfig returns the Google provider configuration pointing at the mock server.
+// Es: providerConfig devuelve la configuración del proveedor Google apuntando al servidor simulado.
+func (mock *mockOIDCServer) providerConfig() OIDCProviderConfig {
+	return OIDCProviderConfig{
+		Provider:     ProviderGoogle,
+		IssuerURL:    mock.server.URL,
+		ClientID:     mockOIDCClientID,
+		ClientSecret: "test-secret",
+		RedirectURL:  "http://test/auth/oauth/google/callback",
+	}
+}
+
+// En: fetchCount returns how many times the JWKS document was served.
+// Es: fetchCount devuelve cuántas veces se sirvió el documento JWKS.
+func (mock *mockOIDCServer) fetchCount() int {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	return mock.jwksFetches
+}
+
+// En: setupOAuthServiceTest sets up the auth service with Google sign-in backed by a mock OIDC server.
+// Es: setupOAuthServiceTest configura el servicio de auth con inicio de sesión Google respaldado por un servidor OIDC simulado.
+func setupOAuthServiceTest(test *testing.T) (*Service, *mockOIDCServer) {
+	test.Helper()
+	require.NoError(test, database.InitForTesting())
+	require.NoError(test, database.RunMigrations(&user.User{}, &UserAuthProvider{}, &RefreshToken{}, &PasswordResetToken{}, &OAuthState{}, &TOTPCredential{}, &RecoveryCode{}, &MFAChallenge{}, &Session{}, &RevokedAccessToken{}, &EmailChangeToken{}, &MagicLinkToken{}, &EmailVerificationCode{}, &DeviceAuthorization{}, &OAuthAuthorizationCode{}, &OAuthGrant{}))
+
+	mock := newMockOIDCServer(test)
+	service := NewService(NewRepository(database.DB), user.NewRepository(database.DB), ServiceOptions{
+		JWTSecret:            testJWTSecret,
+		VerificationNotifier: verificationnotify.NoopNotifier{},
+		FrontendURL:          "http://test",
+		OAuthProviders:       []OIDCProviderConfig{mock.providerConfig()},
+	})
+	return service, mock
+}
+
+// En: TestServiceOAuthCreatesUser verifies that a first social sign-in creates a verified user linked to the provider.
+// Es: TestServiceOAuthCreatesUser verifica que el primer inicio de sesión social crea un usuario verificado enlazado al proveedor.
+func TestServiceOAuthCreatesUser(test *testing.T) {
+	service, mock := setupOAuthServiceTest(test)
+	ctx := context.Background()
+
+	authorizationURL, err := service.StartOAuth(ctx, ProviderGoogle)
+	require.NoError(test, err)
+	state := mock.authorize(test, authorizationURL)
+
+	pair, err := service.CompleteOAuth(ctx, ProviderGoogle, mockOIDCCode, state, SessionMetadata{})
+	require.NoError(test, err)
+	assert.NotEmpty(test, pair.AccessToken)
+
+	var created user.User
+	require.NoError(test, database.DB.Where("email = ?", "oauth@example.com").First(&created).Error)
+	assert.True(test, created.IsEmailVerified())
+	assert.Equal(test, "OAuth User", created.Name)
+
+	link, err := service.repository.FindByProviderAndSubject(ProviderGoogle, "google-subject-1")
+	require.NoError(test, err)
+	assert.Equal(test, created.ID, link.UserID)
+
+	// A second sign-in resolves the same user through the provider link.
+	authorizationURL, err = service.StartOAuth(ctx, ProviderGoogle)
+	require.NoError(test, err)
+	state = mock.authorize(test, authorizationURL)
+	_, err = service.CompleteOAuth(ctx, ProviderGoogle, mockOIDCCode, state, SessionMetadata{})
+	require.NoError(test, err)
+
+	var count int64
+	database.DB.Model(&user.User{}).Count(&count)
+	assert.Equal(test, int64(1), count)
+}
+
+// En: TestServiceOAuthLinksExistingUser verifies that the provider is linked to the user owning the verified email.
+// Es: TestServiceOAuthLinksExistingUser verifica que el proveedor se enlaza al usuario dueño del correo verificado.
+func TestServiceOAuthLinksExistingUser(test *testing.T) {
+	service, mock := setupOAuthServiceTest(test)
+	existing := seedVerifiedUser(test, "Alice", "oauth@example.com", "password123")
+	ctx := context.Background()
+
+	authorizationURL, err := service.StartOAuth(ctx, ProviderGoogle)
+	require.NoError(test, err)
+	_, err = service.CompleteOAuth(ctx, ProviderGoogle, mockOIDCCode, mock.authorize(test, authorizationURL), SessionMetadata{})
+	require.NoError(test, err)
+
+	link, err := service.repository.FindByProviderAndSubject(ProviderGoogle, "google-subject-1")
+	require.NoError(test, err)
+	assert.Equal(test, existing.ID, link.UserID)
+
+	_, err = service.Login("oauth@example.com", "password123", SessionMetadata{})
+	assert.NoError(test, err)
+}
+
+// En: TestServiceOAuthUnverifiedExistingUser verifies that linking to an unverified account drops its unproven password.
+// Es: TestServiceOAuthUnverifiedExistingUser verifica que enlazar una cuenta no verificada descarta su contraseña no comprobada.
+func TestServiceOAuthUnverifiedExistingUser(test *testing.T) {
+	service, mock := setupOAuthServiceTest(test)
+	seedUser(test, "Squatter", "oauth@example.com", "password123")
+	ctx := context.Background()
+
+	authorizationURL, err := service.StartOAuth(ctx, ProviderGoogle)
+	require.NoError(test, err)
+	_, err = service.CompleteOAuth(ctx, ProviderGoogle, mockOIDCCode, mock.authorize(test, authorizationURL), SessionMetadata{})
+	require.NoError(test, err)
+
+	_, err = service.Login("oauth@example.com", "password123", SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidCredentials)
+}
+
+// En: TestServiceOAuthStateIsSingleUse verifies that a state cannot be replayed.
+// Es: TestServiceOAuthStateIsSingleUse verifica que un state no puede reutilizarse.
+func TestServiceOAuthStateIsSingleUse(test *testing.T) {
+	service, mock := setupOAuthServiceTest(test)
+	ctx := context.Background()
+
+	authorizationURL, err := service.StartOAuth(ctx, ProviderGoogle)
+	require.NoError(test, err)
+	state := mock.authorize(test, authorizationURL)
+
+	_, err = service.CompleteOAuth(ctx, ProviderGoogle, mockOIDCCode, state, SessionMetadata{})
+	require.NoError(test, err)
+	_, err = service.CompleteOAuth(ctx, ProviderGoogle, mockOIDCCode, state, SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidOAuthState)
+}
+
+// En: TestServiceOAuthRejectsWrongVerifier verifies that the code exchange fails when PKCE does not match.
+// Es: TestServiceOAuthRejectsWrongVerifier verifica que el intercambio falla cuando PKCE no coincide.
+func TestServiceOAuthRejectsWrongVerifier(test *testing.T) {
+	service, mock := setupOAuthServiceTest(test)
+	ctx := context.Background()
+
+	authorizationURL, err := service.StartOAuth(ctx, ProviderGoogle)
+	require.NoError(test, err)
+	state := mock.authorize(test, authorizationURL)
+	mock.mu.Lock()
+	mock.codeChallenge = pkceChallengeS256("another-verifier")
+	mock.mu.Unlock()
+
+	_, err = service.CompleteOAuth(ctx, ProviderGoogle, mockOIDCCode, state, SessionMetadata{})
+	assert.ErrorIs(test, err, ErrOAuthFailed)
+}
+
+// En: TestServiceOAuthRejectsNonceMismatch verifies that an ID token minted for another nonce is rejected.
+// Es: TestServiceOAuthRejectsNonceMismatch verifica que se rechaza un ID token emitido para otro nonce.
+func TestServiceOAuthRejectsNonceMismatch(test *testing.T) {
+	service, mock := setupOAuthServiceTest(test)
+	ctx := context.Background()
+
+	authorizationURL, err := service.StartOAuth(ctx, ProviderGoogle)
+	require.NoError(test, err)
+	state := mock.authorize(test, authorizationURL)
+	mock.mu.Lock()
+	mock.nonce = "another-nonce"
+	mock.mu.Unlock()
+
+	_, err = service.CompleteOAuth(ctx, ProviderGoogle, mockOIDCCode, state, SessionMetadata{})
+	assert.ErrorIs(test, err, ErrOAuthFailed)
+}
+
+// En: TestServiceOAuthRequiresVerifiedEmail verifies that new users are not created from unverified provider emails.
+// Es: TestServiceOAuthRequiresVerifiedEmail verifica que no se crean usuarios a partir de correos no verificados por el proveedor.
+func TestServiceOAuthRequiresVerifiedEmail(test *testing.T) {
+	service, mock := setupOAuthServiceTest(test)
+	mock.emailVerified = false
+	ctx := context.Background()
+
+	authorizationURL, err := service.StartOAuth(ctx, ProviderGoogle)
+	require.NoError(test, err)
+	_, err = service.CompleteOAuth(ctx, ProviderGoogle, mockOIDCCode, mock.authorize(test, authorizationURL), SessionMetadata{})
+	assert.ErrorIs(test, err, ErrEmailNotVerified)
+}
+
+// En: TestServiceOAuthProviderNotConfigured verifies that unknown providers are rejected.
+// Es: TestServiceOAuthProviderNotConfigured verifica que se rechazan proveedores desconocidos.
+func TestServiceOAuthProviderNotConfigured(test *testing.T) {
+	service, _ := setupOAuthServiceTest(test)
+
+	_, err := service.StartOAuth(context.Background(), ProviderFacebook)
+	assert.ErrorIs(test, err, ErrOAuthProviderNotConfigured)
+}
+
+// En: TestServiceOAuthLinkToCurrentUser verifies that a logged-in user can attach a provider identity.
+// Es: TestServiceOAuthLinkToCurrentUser verifica que un usuario autenticado puede asociar una identidad de proveedor.
+func TestServiceOAuthLinkToCurrentUser(test *testing.T) {
+	service, mock := setupOAuthServiceTest(test)
+	u := seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+	ctx := context.Background()
+
+	authorizationURL, err := service.StartOAuthLink(ctx, u.ID, ProviderGoogle)
+	require.NoError(test, err)
+	state := mock.authorize(test, authorizationURL)
+
+	link, err := service.CompleteOAuthLink(ctx, u.ID, ProviderGoogle, mockOIDCCode, state)
+	require.NoError(test, err)
+	assert.Equal(test, u.ID, link.UserID)
+	assert.Equal(test, "google-subject-1", link.ProviderSubjectID)
+
+	// Signing in with the linked identity resolves the same user even though the emails differ.
+	authorizationURL, err = service.StartOAuth(ctx, ProviderGoogle)
+	require.NoError(test, err)
+	_, err = service.CompleteOAuth(ctx, ProviderGoogle, mockOIDCCode, mock.authorize(test, authorizationURL), SessionMetadata{})
+	require.NoError(test, err)
+
+	var count int64
+	database.DB.Model(&user.User{}).Count(&count)
+	assert.Equal(test, int64(1), count)
+}
+
+// En: TestServiceOAuthLinkStateBoundToUser verifies that a link state cannot be redeemed by another user or for login.
+// Es: TestServiceOAuthLinkStateBoundToUser verifica que un state de enlace no puede canjearlo otro usuario ni usarse para login.
+func TestServiceOAuthLinkStateBoundToUser(test *testing.T) {
+	service, mock := setupOAuthServiceTest(test)
+	alice := seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+	bob := seedVerifiedUser(test, "Bob", "bob@example.com", "password123")
+	ctx := context.Background()
+
+	authorizationURL, err := service.StartOAuthLink(ctx, alice.ID, ProviderGoogle)
+	require.NoError(test, err)
+	_, err = service.CompleteOAuthLink(ctx, bob.ID, ProviderGoogle, mockOIDCCode, mock.authorize(test, authorizationURL))
+	assert.ErrorIs(test, err, ErrInvalidOAuthState)
+
+	authorizationURL, err = service.StartOAuthLink(ctx, alice.ID, ProviderGoogle)
+	require.NoError(test, err)
+	_, err = service.CompleteOAuth(ctx, ProviderGoogle, mockOIDCCode, mock.authorize(test, authorizationURL), SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidOAuthState)
+}
+
+// En: TestServiceOAuthLinkAlreadyLinkedToAnotherUser verifies that one provider identity cannot belong to two users.
+// Es: TestServiceOAuthLinkAlreadyLinkedToAnotherUser verifica que una identidad de proveedor no puede pertenecer a dos usuarios.
+func TestServiceOAuthLinkAlreadyLinkedToAnotherUser(test *testing.T) {
+	service, mock := setupOAuthServiceTest(test)
+	alice := seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+	bob := seedVerifiedUser(test, "Bob", "bob@example.com", "password123")
+	require.NoError(test, service.repository.CreateAuthProvider(&UserAuthProvider{
+		UserID: alice.ID, Provider: ProviderGoogle, ProviderSubjectID: "google-subject-1",
+	}))
+	ctx := context.Background()
+
+	authorizationURL, err := service.StartOAuthLink(ctx, bob.ID, ProviderGoogle)
+	require.NoError(test, err)
+	_, err = service.CompleteOAuthLink(ctx, bob.ID, ProviderGoogle, mockOIDCCode, mock.authorize(test, authorizationURL))
+	assert.ErrorIs(test, err, ErrAuthProviderAlreadyLinked)
+}
+
+// En: TestOIDCProviderUnknownKidRefetchCooldown verifies that unknown kids refetch the JWKS at most once per cooldown.
+// Es: TestOIDCProviderUnknownKidRefetchCooldown verifica que los kid desconocidos recargan el JWKS como máximo una vez por intervalo.
+func TestOIDCProviderUnknownKidRefetchCooldown(test *testing.T) {
+	mock := newMockOIDCServer(test)
+	provider := newOIDCProvider(mock.providerConfig(), nil)
+	ctx := context.Background()
+	_, err := provider.getDiscovery(ctx)
+	require.NoError(test, err)
+
+	_, err = provider.signingKey(ctx, mockOIDCKeyID)
+	require.NoError(test, err)
+	require.Equal(test, 1, mock.fetchCount())
+
+	for range 3 {
+		_, err = provider.signingKey(ctx, "unknown-kid")
+		assert.Error(test, err)
+	}
+	assert.Equal(test, 1, mock.fetchCount())
+
+	provider.mu.Lock()
+	provider.keysFetchedAt = time.Now().Add(-oidcJWKSRefreshCooldown)
+	provider.mu.Unlock()
+	_, err = provider.signingKey(ctx, "unknown-kid")
+	assert.Error(test, err)
+	assert.Equal(test, 2, mock.fetchCount())
+
+	_, err = provider.signingKey(ctx, mockOIDCKeyID)
+	assert.NoError(test, err)
+	assert.Equal(test, 2, mock.fetchCount())
+}
+
+// En: TestOIDCProviderDiscoveryFetchDoesNotHoldLock verifies that a slow discovery request does not keep the provider locked.
+// Es: TestOIDCProviderDiscoveryFetchDoesNotHoldLock verifica que una petición de discovery lenta no mantiene bloqueado el proveedor.
+func TestOIDCProviderDiscoveryFetchDoesNotHoldLock(test *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	test.Cleanup(slow.Close)
+
+	provider := newOIDCProvider(OIDCProviderConfig{Provider: ProviderGoogle, IssuerURL: slow.URL, ClientID: mockOIDCClientID}, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := provider.getDiscovery(context.Background())
+		done <- err
+	}()
+	<-started
+
+	locked := provider.mu.TryLock()
+	if locked {
+		provider.mu.Unlock()
+	}
+	close(release)
+	<-done
+	assert.True(test, locked)
+}
+
+// En: TestOIDCProviderAcceptsGoogleIssuerForms verifies that Google ID tokens are accepted with and without the https scheme in "iss".
+// Es: TestOIDCProviderAcceptsGoogleIssuerForms verifica que los ID tokens de Google se aceptan con y sin el esquema https en "iss".
+func TestOIDCProviderAcceptsGoogleIssuerForms(test *testing.T) {
+	mock := newMockOIDCServer(test)
+	provider := newOIDCProvider(mock.providerConfig(), nil)
+	provider.discovery = &oidcDiscovery{
+		Issuer:                googleIssuerURL,
+		AuthorizationEndpoint: mock.server.URL + "/authorize",
+		TokenEndpoint:         mock.server.URL + "/token",
+		JWKSURI:               mock.server.URL + "/jwks",
+	}
+	ctx := context.Background()
+
+	for issuer, accepted := range map[string]bool{googleIssuerURL: true, googleIssuerHost: true, "https://evil.example.com": false} {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, &oidcIDTokenClaims{
+			Nonce: "nonce",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    issuer,
+				Subject:   "google-subject-1",
+				Audience:  jwt.ClaimStrings{mockOIDCClientID},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		})
+		token.Header["kid"] = mockOIDCKeyID
+		signed, err := token.SignedString(mock.key)
+		require.NoError(test, err)
+
+		identity, err := provider.verifyIDToken(ctx, signed, "nonce")
+		if !accepted {
+			assert.Error(test, err, issuer)
+			continue
+		}
+		require.NoError(test, err, issuer)
+		assert.Equal(test, "google-subject-1", identity.Subject)
+	}
+}
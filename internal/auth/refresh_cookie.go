@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"time"
+
+	runtimeError "github.com/cloudflax/api.cloudflax/internal/shared/runtimeerror"
+	"github.com/gofiber/fiber/v3"
+)
+
+// En: Names of the refresh cookie, the CSRF cookie and the header that must echo the CSRF token in cookie mode.
+// Es: Nombres de la cookie de refresh, la cookie CSRF y el header que debe repetir el token CSRF en modo cookie.
+const (
+	RefreshTokenCookieName = "cfx_refresh_token"
+	CSRFTokenCookieName    = "cfx_csrf_token"
+	CSRFTokenHeader        = "X-CSRF-Token"
+)
+
+// refreshTokenCookiePath limits the refresh cookie to the auth endpoints that consume it.
+const refreshTokenCookiePath = "/auth"
+
+// En: RefreshTokenCookieOptions configures refresh token delivery via an HttpOnly cookie.
+// Es: RefreshTokenCookieOptions configura la entrega del refresh token mediante una cookie HttpOnly.
+type RefreshTokenCookieOptions struct {
+	// SameSite is Strict, Lax or None; empty defaults to Strict.
+	SameSite string
+	// Domain shares the cookies with the frontend host (e.g. "example.com"); empty keeps them host-only.
+	Domain string
+}
+
+// En: WithRefreshTokenCookie switches token responses to cookie mode: the refresh token is set as a
+// Secure, HttpOnly, SameSite cookie scoped to /auth and never returned in the body, and refresh and
+// logout accept it from the cookie only together with a matching X-CSRF-Token header (double submit).
+// Es: WithRefreshTokenCookie cambia las respuestas de tokens a modo cookie: el refresh token se define como
+// cookie Secure, HttpOnly y SameSite limitada a /auth y nunca se devuelve en el cuerpo, y refresh y logout
+// lo aceptan desde la cookie solo junto con un header X-CSRF-Token que coincida (double submit).
+func (handler *Handler) WithRefreshTokenCookie(opts RefreshTokenCookieOptions) *Handler {
+	if opts.SameSite == "" {
+		opts.SameSite = fiber.CookieSameSiteStrictMode
+	}
+	handler.refreshCookie = &opts
+	return handler
+}
+
+// En: respondTokenPair writes a token pair: in the body by default, or split between cookies and body in cookie mode.
+// Es: respondTokenPair escribe un par de tokens: en el cuerpo por defecto, o repartido entre cookies y cuerpo en modo cookie.
+func (handler *Handler) respondTokenPair(ctx fiber.Ctx, pair *TokenPair) error {
+	if handler.refreshCookie == nil {
+		return ctx.JSON(fiber.Map{"data": pair})
+	}
+
+	csrfToken, err := generateSecureToken()
+	if err != nil {
+		slog.Error("generate csrf token", "error", err)
+		return runtimeError.Respond(ctx, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not issue tokens")
+	}
+	maxAge := int(refreshTokenDuration / time.Second)
+	handler.setCookie(ctx, RefreshTokenCookieName, pair.RefreshToken, refreshTokenCookiePath, true, maxAge)
+	handler.setCookie(ctx, CSRFTokenCookieName, csrfToken, "/", false, maxAge)
+	return ctx.JSON(fiber.Map{"data": CookieTokenResponse{
+		AccessToken: pair.AccessToken,
+		ExpiresAt:   pair.ExpiresAt,
+		CSRFToken:   csrfToken,
+	}})
+}
+
+// En: cookieRefreshToken returns the refresh token of the cookie after checking the double-submit CSRF token.
+// It returns "" when cookie mode is off or no cookie was sent, and ErrInvalidCSRFToken when the header does not match.
+// Es: cookieRefreshToken devuelve el refresh token de la cookie tras comprobar el token CSRF de double submit.
+// Devuelve "" si el modo cookie está apagado o no se envió cookie, y ErrInvalidCSRFToken si el header no coincide.
+func (handler *Handler) cookieRefreshToken(ctx fiber.Ctx) (string, error) {
+	if handler.refreshCookie == nil {
+		return "", nil
+	}
+	refreshToken := ctx.Cookies(RefreshTokenCookieName)
+	if refreshToken == "" {
+		return "", nil
+	}
+	header := ctx.Get(CSRFTokenHeader)
+	cookie := ctx.Cookies(CSRFTokenCookieName)
+	if header == "" || cookie == "" || subtle.ConstantTimeCompare([]byte(header), []byte(cookie)) != 1 {
+		return "", ErrInvalidCSRFToken
+	}
+	return refreshToken, nil
+}
+
+// En: clearRefreshTokenCookies expires the refresh and CSRF cookies; it does nothing outside cookie mode.
+// Es: clearRefreshTokenCookies expira las cookies de refresh y CSRF; no hace nada fuera del modo cookie.
+func (handler *Handler) clearRefreshTokenCookies(ctx fiber.Ctx) {
+	if handler.refreshCookie == nil {
+		return
+	}
+	handler.setCookie(ctx, RefreshTokenCookieName, "", refreshTokenCookiePath, true, -1)
+	handler.setCookie(ctx, CSRFTokenCookieName, "", "/", false, -1)
+}
+
+// setCookie writes one Secure cookie with the configured SameSite and domain; a negative maxAge deletes it.
+func (handler *Handler) setCookie(ctx fiber.Ctx, name, value, path string, httpOnly bool, maxAge int) {
+	ctx.Cookie(&fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   handler.refreshCookie.Domain,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HTTPOnly: httpOnly,
+		SameSite: handler.refreshCookie.SameSite,
+	})
+}
+
+// respondInvalidCSRFToken answers 403 when a cookie-borne refresh token lacks a matching X-CSRF-Token header.
+func respondInvalidCSRFToken(ctx fiber.Ctx) error {
+	return runtimeError.Respond(ctx, fiber.StatusForbidden, runtimeError.CodeCSRFTokenInvalid, "Missing or invalid CSRF token")
+}
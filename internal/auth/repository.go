@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/cloudflax/api.cloudflax/internal/account"
 	"github.com/cloudflax/api.cloudflax/internal/user"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 )
 
@@ -57,18 +59,199 @@ func (repository *Repository) Revoke(id string) error {
 	return nil
 }
 
-// En: RevokeAllByUserID revokes all active refresh tokens for a given user (used on logout).
-// Es: Revoca todos los tokens de actualización activos para un usuario dado (usado en el cierre de sesión).
+// En: Rotate revokes a refresh token because it was exchanged for a new one; it fails with ErrRefreshTokenReused
+// if the token was already revoked (e.g. a concurrent refresh with the same token).
+// Es: Rotate revoca un token de actualización porque se intercambió por uno nuevo; falla con ErrRefreshTokenReused
+// si el token ya estaba revocado (p. ej. un refresh concurrente con el mismo token).
+func (repository *Repository) Rotate(id string) error {
+	now := time.Now()
+	result := repository.db.Model(&RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]any{"revoked_at": now, "rotated_at": now})
+	if result.Error != nil {
+		return fmt.Errorf("rotate refresh token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrRefreshTokenReused
+	}
+	return nil
+}
+
+// En: RevokeFamily revokes every active refresh token of a family and ends its session.
+// Es: RevokeFamily revoca todos los tokens de actualización activos de una familia y cierra su sesión.
+func (repository *Repository) RevokeFamily(familyID string) error {
+	now := time.Now()
+	return repository.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&RefreshToken{}).
+			Where("(family_id = ? OR id = ?) AND revoked_at IS NULL", familyID, familyID).
+			Update("revoked_at", now).Error; err != nil {
+			return fmt.Errorf("revoke refresh token family: %w", err)
+		}
+		if err := tx.Model(&Session{}).
+			Where("id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", now).Error; err != nil {
+			return fmt.Errorf("revoke session: %w", err)
+		}
+		return nil
+	})
+}
+
+// En: RevokeSessionsByUserID revokes all active refresh tokens and sessions for a given user (used on logout).
+// OAuth client grants are kept.
+// Es: Revoca todos los tokens de actualización y sesiones activos para un usuario dado (usado en el cierre de sesión).
+// Las concesiones a clientes OAuth se conservan.
+func (repository *Repository) RevokeSessionsByUserID(userID string) error {
+	return repository.db.Transaction(func(tx *gorm.DB) error {
+		return revokeUserSessions(tx, userID, time.Now())
+	})
+}
+
+// En: RevokeAllByUserID revokes all active refresh tokens, sessions and OAuth client grants for a given user.
+// Es: Revoca todos los tokens de actualización, sesiones y concesiones a clientes OAuth activos para un usuario dado.
 func (repository *Repository) RevokeAllByUserID(userID string) error {
 	now := time.Now()
-	if err := repository.db.Model(&RefreshToken{}).
+	return repository.db.Transaction(func(tx *gorm.DB) error {
+		if err := revokeUserSessions(tx, userID, now); err != nil {
+			return err
+		}
+		if err := tx.Model(&OAuthGrant{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error; err != nil {
+			return fmt.Errorf("revoke all user oauth grants: %w", err)
+		}
+		return nil
+	})
+}
+
+// revokeUserSessions revokes the active refresh tokens and sessions of the user inside tx.
+func revokeUserSessions(tx *gorm.DB, userID string, now time.Time) error {
+	if err := tx.Model(&RefreshToken{}).
 		Where("user_id = ? AND revoked_at IS NULL", userID).
 		Update("revoked_at", now).Error; err != nil {
 		return fmt.Errorf("revoke all user tokens: %w", err)
 	}
+	if err := tx.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error; err != nil {
+		return fmt.Errorf("revoke all user sessions: %w", err)
+	}
+	return nil
+}
+
+// En: DeleteStaleRefreshTokens hard-deletes up to limit refresh tokens that expired before now or were revoked
+// before revokedBefore. Rotated tokens are kept until they expire so a replay is still detected as reuse.
+// Es: DeleteStaleRefreshTokens borra físicamente hasta limit tokens de actualización que expiraron antes de now o
+// se revocaron antes de revokedBefore. Los tokens rotados se conservan hasta expirar para seguir detectando su reutilización.
+func (repository *Repository) DeleteStaleRefreshTokens(now, revokedBefore time.Time, limit int) (int64, error) {
+	batch := repository.db.Unscoped().Model(&RefreshToken{}).
+		Select("id").
+		Where("expires_at < ? OR (revoked_at < ? AND rotated_at IS NULL)", now, revokedBefore).
+		Limit(limit)
+	result := repository.db.Unscoped().Where("id IN (?)", batch).Delete(&RefreshToken{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("delete stale refresh tokens: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// En: CreateSession persists the metadata of a new login session.
+// Es: CreateSession persiste los metadatos de una nueva sesión de inicio.
+func (repository *Repository) CreateSession(session *Session) error {
+	if err := repository.db.Create(session).Error; err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	return nil
+}
+
+// En: TouchSession records a refresh on an active session: last use, client IP (when known) and the new expiry.
+// Es: TouchSession registra un refresh en una sesión activa: último uso, IP del cliente (si se conoce) y la nueva expiración.
+func (repository *Repository) TouchSession(id, ipAddress string, expiresAt time.Time) error {
+	updates := map[string]any{"last_used_at": time.Now(), "expires_at": expiresAt}
+	if ipAddress != "" {
+		updates["ip_address"] = ipAddress
+	}
+	if err := repository.db.Model(&Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(updates).Error; err != nil {
+		return fmt.Errorf("touch session: %w", err)
+	}
 	return nil
 }
 
+// En: GetActiveSession returns a session of the user that is neither revoked nor expired, or ErrSessionNotFound.
+// Es: GetActiveSession devuelve una sesión del usuario que no está revocada ni expirada, o ErrSessionNotFound.
+func (repository *Repository) GetActiveSession(userID, id string) (*Session, error) {
+	var session Session
+	err := repository.db.
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", id, userID, time.Now()).
+		First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("get session: %w", err)
+	}
+	return &session, nil
+}
+
+// En: ListActiveSessionsByUserID returns the sessions of a user that are neither revoked nor expired, most recently used first.
+// Es: ListActiveSessionsByUserID devuelve las sesiones de un usuario que no están revocadas ni expiradas, las de uso más reciente primero.
+func (repository *Repository) ListActiveSessionsByUserID(userID string) ([]Session, error) {
+	var sessions []Session
+	if err := repository.db.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error; err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// En: RevokeSession ends one session of the user and revokes its refresh tokens; it returns ErrSessionNotFound
+// when nothing active matched (unknown id, another user's session or one already ended).
+// Es: RevokeSession cierra una sesión del usuario y revoca sus tokens de actualización; devuelve ErrSessionNotFound
+// cuando nada activo coincide (id desconocido, sesión de otro usuario o ya cerrada).
+func (repository *Repository) RevokeSession(userID, id string) error {
+	now := time.Now()
+	return repository.db.Transaction(func(tx *gorm.DB) error {
+		sessions := tx.Model(&Session{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+			Update("revoked_at", now)
+		if sessions.Error != nil {
+			return fmt.Errorf("revoke session: %w", sessions.Error)
+		}
+		tokens := tx.Model(&RefreshToken{}).
+			Where("user_id = ? AND (family_id = ? OR id = ?) AND revoked_at IS NULL", userID, id, id).
+			Update("revoked_at", now)
+		if tokens.Error != nil {
+			return fmt.Errorf("revoke session tokens: %w", tokens.Error)
+		}
+		if sessions.RowsAffected == 0 && tokens.RowsAffected == 0 {
+			return ErrSessionNotFound
+		}
+		return nil
+	})
+}
+
+// En: RevokeOtherSessions ends every session of the user except keepID, together with their refresh tokens.
+// Es: RevokeOtherSessions cierra todas las sesiones del usuario excepto keepID, junto con sus tokens de actualización.
+func (repository *Repository) RevokeOtherSessions(userID, keepID string) error {
+	now := time.Now()
+	return repository.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Session{}).
+			Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepID).
+			Update("revoked_at", now).Error; err != nil {
+			return fmt.Errorf("revoke other sessions: %w", err)
+		}
+		if err := tx.Model(&RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL AND id <> ? AND (family_id IS NULL OR family_id <> ?)", userID, keepID, keepID).
+			Update("revoked_at", now).Error; err != nil {
+			return fmt.Errorf("revoke other session tokens: %w", err)
+		}
+		return nil
+	})
+}
+
 // En: CreateAuthProvider persists a new UserAuthProvider record.
 // Es: CreateAuthProvider persiste un nuevo registro de UserAuthProvider.
 func (repository *Repository) CreateAuthProvider(provider *UserAuthProvider) error {
@@ -87,13 +270,36 @@ func (repository *Repository) FindByProviderAndSubject(provider ProviderType, su
 		First(&p).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrTokenNotFound
+			return nil, ErrAuthProviderNotFound
 		}
 		return nil, fmt.Errorf("find auth provider: %w", err)
 	}
 	return &p, nil
 }
 
+// En: ListAuthProvidersByUserID returns every provider linked to the user, oldest first.
+// Es: ListAuthProvidersByUserID devuelve todos los proveedores enlazados al usuario, del más antiguo al más reciente.
+func (repository *Repository) ListAuthProvidersByUserID(userID string) ([]UserAuthProvider, error) {
+	var providers []UserAuthProvider
+	if err := repository.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&providers).Error; err != nil {
+		return nil, fmt.Errorf("list auth providers: %w", err)
+	}
+	return providers, nil
+}
+
+// En: DeleteAuthProvider removes a provider link owned by the user.
+// Es: DeleteAuthProvider elimina un enlace de proveedor perteneciente al usuario.
+func (repository *Repository) DeleteAuthProvider(userID, id string) error {
+	result := repository.db.Where("id = ? AND user_id = ?", id, userID).Delete(&UserAuthProvider{})
+	if result.Error != nil {
+		return fmt.Errorf("delete auth provider: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrAuthProviderNotFound
+	}
+	return nil
+}
+
 // En: FindByVerificationToken returns the user that owns the given email verification token.
 // Es: FindByVerificationToken devuelve el usuario que posee el token de verificación de correo electrónico dado.
 func (repository *Repository) FindByVerificationToken(token string) (*user.User, error) {
@@ -107,3 +313,684 @@ func (repository *Repository) FindByVerificationToken(token string) (*user.User,
 	}
 	return &u, nil
 }
+
+// En: ReplaceEmailVerificationCode stores the user's verification code, replacing any previous one.
+// Es: ReplaceEmailVerificationCode guarda el código de verificación del usuario, reemplazando el anterior si existe.
+func (repository *Repository) ReplaceEmailVerificationCode(code *EmailVerificationCode) error {
+	return repository.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", code.UserID).Delete(&EmailVerificationCode{}).Error; err != nil {
+			return fmt.Errorf("delete email verification code: %w", err)
+		}
+		if err := tx.Create(code).Error; err != nil {
+			return fmt.Errorf("create email verification code: %w", err)
+		}
+		return nil
+	})
+}
+
+// En: GetEmailVerificationCode returns the pending verification code of the user.
+// Es: GetEmailVerificationCode devuelve el código de verificación pendiente del usuario.
+func (repository *Repository) GetEmailVerificationCode(userID string) (*EmailVerificationCode, error) {
+	var code EmailVerificationCode
+	if err := repository.db.Where("user_id = ?", userID).First(&code).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidVerificationCode
+		}
+		return nil, fmt.Errorf("get email verification code: %w", err)
+	}
+	return &code, nil
+}
+
+// En: ClaimEmailVerificationCodeAttempt reserves one guess of the verification code before it is compared. The
+// conditional update keeps concurrent requests from going past maxAttempts; it fails with ErrInvalidVerificationCode
+// when the code expired or is out of attempts.
+// Es: ClaimEmailVerificationCodeAttempt reserva un intento del código de verificación antes de compararlo. La
+// actualización condicional impide que peticiones concurrentes superen maxAttempts; falla con ErrInvalidVerificationCode
+// si el código expiró o no le quedan intentos.
+func (repository *Repository) ClaimEmailVerificationCodeAttempt(id string, maxAttempts int) error {
+	result := repository.db.Model(&EmailVerificationCode{}).
+		Where("id = ? AND expires_at > ? AND attempts < ?", id, time.Now(), maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("claim email verification code attempt: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidVerificationCode
+	}
+	return nil
+}
+
+// En: DeleteEmailVerificationCode removes the verification code of the user once the email is verified.
+// Es: DeleteEmailVerificationCode elimina el código de verificación del usuario cuando el email queda verificado.
+func (repository *Repository) DeleteEmailVerificationCode(userID string) error {
+	if err := repository.db.Where("user_id = ?", userID).Delete(&EmailVerificationCode{}).Error; err != nil {
+		return fmt.Errorf("delete email verification code: %w", err)
+	}
+	return nil
+}
+
+// En: CreatePasswordResetToken persists a new password reset token.
+// Es: CreatePasswordResetToken persiste un nuevo token de restablecimiento de contraseña.
+func (repository *Repository) CreatePasswordResetToken(token *PasswordResetToken) error {
+	if err := repository.db.Create(token).Error; err != nil {
+		return fmt.Errorf("create password reset token: %w", err)
+	}
+	return nil
+}
+
+// En: GetPasswordResetTokenByHash returns a password reset token by its SHA-256 hash.
+// Es: GetPasswordResetTokenByHash devuelve un token de restablecimiento de contraseña por su hash SHA-256.
+func (repository *Repository) GetPasswordResetTokenByHash(hash string) (*PasswordResetToken, error) {
+	var token PasswordResetToken
+	if err := repository.db.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidResetToken
+		}
+		return nil, fmt.Errorf("get password reset token by hash: %w", err)
+	}
+	return &token, nil
+}
+
+// En: InvalidatePasswordResetTokensByUserID marks every pending reset token of the user as used.
+// Es: InvalidatePasswordResetTokensByUserID marca como usados todos los tokens de restablecimiento pendientes del usuario.
+func (repository *Repository) InvalidatePasswordResetTokensByUserID(userID string) error {
+	now := time.Now()
+	if err := repository.db.Model(&PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", now).Error; err != nil {
+		return fmt.Errorf("invalidate password reset tokens: %w", err)
+	}
+	return nil
+}
+
+// En: CreateMagicLinkToken persists a new magic link token.
+// Es: CreateMagicLinkToken persiste un nuevo token de magic link.
+func (repository *Repository) CreateMagicLinkToken(token *MagicLinkToken) error {
+	if err := repository.db.Create(token).Error; err != nil {
+		return fmt.Errorf("create magic link token: %w", err)
+	}
+	return nil
+}
+
+// En: GetMagicLinkTokenByHash returns a magic link token by its SHA-256 hash.
+// Es: GetMagicLinkTokenByHash devuelve un token de magic link por su hash SHA-256.
+func (repository *Repository) GetMagicLinkTokenByHash(hash string) (*MagicLinkToken, error) {
+	var token MagicLinkToken
+	if err := repository.db.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidMagicLinkToken
+		}
+		return nil, fmt.Errorf("get magic link token by hash: %w", err)
+	}
+	return &token, nil
+}
+
+// En: MarkMagicLinkTokenUsed consumes a magic link token; it fails with ErrInvalidMagicLinkToken if it was already used.
+// Es: MarkMagicLinkTokenUsed consume un token de magic link; falla con ErrInvalidMagicLinkToken si ya fue usado.
+func (repository *Repository) MarkMagicLinkTokenUsed(id string) error {
+	now := time.Now()
+	result := repository.db.Model(&MagicLinkToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", now)
+	if result.Error != nil {
+		return fmt.Errorf("mark magic link token used: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMagicLinkToken
+	}
+	return nil
+}
+
+// En: InvalidateMagicLinkTokensByUserID marks every pending magic link token of the user as used.
+// Es: InvalidateMagicLinkTokensByUserID marca como usados todos los tokens de magic link pendientes del usuario.
+func (repository *Repository) InvalidateMagicLinkTokensByUserID(userID string) error {
+	now := time.Now()
+	if err := repository.db.Model(&MagicLinkToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", now).Error; err != nil {
+		return fmt.Errorf("invalidate magic link tokens: %w", err)
+	}
+	return nil
+}
+
+// En: CreateDeviceAuthorization persists a new device authorization request.
+// Es: CreateDeviceAuthorization persiste una nueva solicitud de autorización de dispositivo.
+func (repository *Repository) CreateDeviceAuthorization(authorization *DeviceAuthorization) error {
+	if err := repository.db.Create(authorization).Error; err != nil {
+		return fmt.Errorf("create device authorization: %w", err)
+	}
+	return nil
+}
+
+// En: GetDeviceAuthorizationByDeviceCodeHash returns a device authorization by the SHA-256 hash of its device code.
+// Es: GetDeviceAuthorizationByDeviceCodeHash devuelve una autorización de dispositivo por el hash SHA-256 de su device code.
+func (repository *Repository) GetDeviceAuthorizationByDeviceCodeHash(hash string) (*DeviceAuthorization, error) {
+	var authorization DeviceAuthorization
+	if err := repository.db.Where("device_code_hash = ?", hash).First(&authorization).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidDeviceCode
+		}
+		return nil, fmt.Errorf("get device authorization: %w", err)
+	}
+	return &authorization, nil
+}
+
+// En: GetPendingDeviceAuthorizationByUserCodeHash returns the newest unexpired, undecided request with that user code hash.
+// Es: GetPendingDeviceAuthorizationByUserCodeHash devuelve la solicitud más reciente, no expirada y sin decidir, con ese hash de user code.
+func (repository *Repository) GetPendingDeviceAuthorizationByUserCodeHash(hash string) (*DeviceAuthorization, error) {
+	var authorization DeviceAuthorization
+	err := repository.db.
+		Where("user_code_hash = ? AND approved_at IS NULL AND denied_at IS NULL AND expires_at > ?", hash, time.Now()).
+		Order("created_at DESC").
+		First(&authorization).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidUserCode
+		}
+		return nil, fmt.Errorf("get pending device authorization: %w", err)
+	}
+	return &authorization, nil
+}
+
+// En: DecideDeviceAuthorization records the user's approval or denial; it fails with ErrInvalidUserCode if already decided.
+// Es: DecideDeviceAuthorization registra la aprobación o el rechazo del usuario; falla con ErrInvalidUserCode si ya se decidió.
+func (repository *Repository) DecideDeviceAuthorization(id, userID string, approved bool) error {
+	column := "denied_at"
+	if approved {
+		column = "approved_at"
+	}
+	result := repository.db.Model(&DeviceAuthorization{}).
+		Where("id = ? AND approved_at IS NULL AND denied_at IS NULL", id).
+		Updates(map[string]any{column: time.Now(), "user_id": userID})
+	if result.Error != nil {
+		return fmt.Errorf("decide device authorization: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidUserCode
+	}
+	return nil
+}
+
+// En: RecordDeviceAuthorizationPoll stores the time of a token poll and the polling interval now in force.
+// Es: RecordDeviceAuthorizationPoll guarda la hora de una consulta de token y el intervalo de consulta vigente.
+func (repository *Repository) RecordDeviceAuthorizationPoll(id string, polledAt time.Time, intervalSeconds int) error {
+	if err := repository.db.Model(&DeviceAuthorization{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"last_polled_at": polledAt, "interval_seconds": intervalSeconds}).Error; err != nil {
+		return fmt.Errorf("record device authorization poll: %w", err)
+	}
+	return nil
+}
+
+// En: ConsumeDeviceAuthorization marks an approved request as exchanged for tokens; it fails with ErrInvalidDeviceCode
+// if the tokens were already issued.
+// Es: ConsumeDeviceAuthorization marca una solicitud aprobada como canjeada por tokens; falla con ErrInvalidDeviceCode
+// si los tokens ya se emitieron.
+func (repository *Repository) ConsumeDeviceAuthorization(id string) error {
+	result := repository.db.Model(&DeviceAuthorization{}).
+		Where("id = ? AND approved_at IS NOT NULL AND consumed_at IS NULL", id).
+		Update("consumed_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("consume device authorization: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidDeviceCode
+	}
+	return nil
+}
+
+// En: CreateOAuthAuthorizationCode persists a new authorization code issued to an OAuth client.
+// Es: CreateOAuthAuthorizationCode persiste un nuevo código de autorización emitido a un cliente OAuth.
+func (repository *Repository) CreateOAuthAuthorizationCode(code *OAuthAuthorizationCode) error {
+	if err := repository.db.Create(code).Error; err != nil {
+		return fmt.Errorf("create oauth authorization code: %w", err)
+	}
+	return nil
+}
+
+// En: ConsumeOAuthAuthorizationCode marks the unused code with the given hash as used and returns it, so a code is
+// exchanged at most once. Returns ErrInvalidOAuthGrant when the code is unknown or already used.
+// Es: ConsumeOAuthAuthorizationCode marca como usado el código sin usar con el hash dado y lo devuelve, de modo que un
+// código se canjea como mucho una vez. Devuelve ErrInvalidOAuthGrant si el código es desconocido o ya se usó.
+func (repository *Repository) ConsumeOAuthAuthorizationCode(codeHash string) (*OAuthAuthorizationCode, error) {
+	var code OAuthAuthorizationCode
+	if err := repository.db.Where("code_hash = ? AND used_at IS NULL", codeHash).First(&code).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidOAuthGrant
+		}
+		return nil, fmt.Errorf("get oauth authorization code: %w", err)
+	}
+	result := repository.db.Model(&OAuthAuthorizationCode{}).
+		Where("id = ? AND used_at IS NULL", code.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, fmt.Errorf("consume oauth authorization code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidOAuthGrant
+	}
+	return &code, nil
+}
+
+// En: CreateOAuthGrant persists the delegation created when an OAuth client exchanges an authorization code.
+// Es: CreateOAuthGrant persiste la delegación creada cuando un cliente OAuth canjea un código de autorización.
+func (repository *Repository) CreateOAuthGrant(grant *OAuthGrant) error {
+	if err := repository.db.Create(grant).Error; err != nil {
+		return fmt.Errorf("create oauth grant: %w", err)
+	}
+	return nil
+}
+
+// En: GetOAuthGrantByRefreshTokenHash returns the grant whose current client refresh token has the given hash.
+// Returns ErrInvalidOAuthGrant when none matches.
+// Es: GetOAuthGrantByRefreshTokenHash devuelve la concesión cuyo refresh token de cliente vigente tiene el hash dado.
+// Devuelve ErrInvalidOAuthGrant si ninguna coincide.
+func (repository *Repository) GetOAuthGrantByRefreshTokenHash(tokenHash string) (*OAuthGrant, error) {
+	var grant OAuthGrant
+	if err := repository.db.Where("refresh_token_hash = ?", tokenHash).First(&grant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidOAuthGrant
+		}
+		return nil, fmt.Errorf("get oauth grant: %w", err)
+	}
+	return &grant, nil
+}
+
+// En: ListActiveOAuthGrantIDsByUserID returns the ids of the grants of a user that are neither revoked nor expired.
+// Es: ListActiveOAuthGrantIDsByUserID devuelve los ids de las concesiones de un usuario que no están revocadas ni expiradas.
+func (repository *Repository) ListActiveOAuthGrantIDsByUserID(userID string) ([]string, error) {
+	var ids []string
+	if err := repository.db.Model(&OAuthGrant{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("list oauth grants: %w", err)
+	}
+	return ids, nil
+}
+
+// En: RotateOAuthGrantRefreshToken replaces the client refresh token of the grant only if it is still currentHash,
+// so two concurrent refreshes with the same token cannot both succeed. Returns ErrInvalidOAuthGrant otherwise.
+// Es: RotateOAuthGrantRefreshToken reemplaza el refresh token de cliente de la concesión solo si sigue siendo currentHash,
+// así dos refrescos concurrentes con el mismo token no pueden tener éxito ambos. Si no, devuelve ErrInvalidOAuthGrant.
+func (repository *Repository) RotateOAuthGrantRefreshToken(id, currentHash, newHash string) error {
+	result := repository.db.Model(&OAuthGrant{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", id, currentHash).
+		Update("refresh_token_hash", newHash)
+	if result.Error != nil {
+		return fmt.Errorf("rotate oauth grant refresh token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidOAuthGrant
+	}
+	return nil
+}
+
+// En: CreateEmailChangeToken persists a new email change token.
+// Es: CreateEmailChangeToken persiste un nuevo token de cambio de email.
+func (repository *Repository) CreateEmailChangeToken(token *EmailChangeToken) error {
+	if err := repository.db.Create(token).Error; err != nil {
+		return fmt.Errorf("create email change token: %w", err)
+	}
+	return nil
+}
+
+// En: GetEmailChangeTokenByHash returns an email change token by its SHA-256 hash.
+// Es: GetEmailChangeTokenByHash devuelve un token de cambio de email por su hash SHA-256.
+func (repository *Repository) GetEmailChangeTokenByHash(hash string) (*EmailChangeToken, error) {
+	var token EmailChangeToken
+	if err := repository.db.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidEmailChangeToken
+		}
+		return nil, fmt.Errorf("get email change token by hash: %w", err)
+	}
+	return &token, nil
+}
+
+// En: InvalidateEmailChangeTokensByUserID marks every pending email change token of the user as used.
+// Es: InvalidateEmailChangeTokensByUserID marca como usados todos los tokens de cambio de email pendientes del usuario.
+func (repository *Repository) InvalidateEmailChangeTokensByUserID(userID string) error {
+	now := time.Now()
+	if err := repository.db.Model(&EmailChangeToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", now).Error; err != nil {
+		return fmt.Errorf("invalidate email change tokens: %w", err)
+	}
+	return nil
+}
+
+// En: CreateInvitedUser stores a user registered from an invitation, its credentials provider and its membership, and
+// accepts the invitation, all in one transaction. Fails with account.ErrInvitationNotFound if the invitation is no
+// longer pending and with user.ErrDuplicateEmail if the email is taken; nothing is stored in either case.
+// Es: CreateInvitedUser guarda un usuario registrado desde una invitación, su proveedor de credenciales y su membresía,
+// y acepta la invitación, todo en una sola transacción. Falla con account.ErrInvitationNotFound si la invitación ya no
+// está pendiente y con user.ErrDuplicateEmail si el email está en uso; en ambos casos no se guarda nada.
+func (repository *Repository) CreateInvitedUser(u *user.User, provider *UserAuthProvider, invitationID string, member *account.AccountMember) error {
+	return repository.db.Transaction(func(tx *gorm.DB) error {
+		if err := user.NewRepository(tx).Create(u); err != nil {
+			return err
+		}
+		provider.UserID = u.ID
+		if err := tx.Create(provider).Error; err != nil {
+			return fmt.Errorf("create auth provider: %w", err)
+		}
+		member.UserID = u.ID
+		return account.NewRepository(tx).AcceptInvitation(invitationID, member)
+	})
+}
+
+// En: ApplyPasswordReset consumes the reset token and, in the same transaction, stores the new password hash of the
+// user and makes sure the user has a credentials provider. Fails with ErrInvalidResetToken if the token was already used,
+// and leaves it unused if the password cannot be stored.
+// Es: ApplyPasswordReset consume el token de restablecimiento y, en la misma transacción, guarda el nuevo hash de contraseña
+// del usuario y asegura que tenga un proveedor de credenciales. Falla con ErrInvalidResetToken si el token ya fue usado,
+// y lo deja sin usar si la contraseña no se puede guardar.
+func (repository *Repository) ApplyPasswordReset(tokenID string, u *user.User) error {
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", tokenID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return fmt.Errorf("mark password reset token used: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		if err := tx.Model(&user.User{}).
+			Where("id = ?", u.ID).
+			Update("password_hash", u.PasswordHash).Error; err != nil {
+			return fmt.Errorf("update password: %w", err)
+		}
+
+		provider := UserAuthProvider{UserID: u.ID, Provider: ProviderCredentials, ProviderSubjectID: u.Email}
+		if err := tx.Where("provider = ? AND provider_subject_id = ?", ProviderCredentials, u.Email).
+			FirstOrCreate(&provider).Error; err != nil {
+			return fmt.Errorf("ensure credentials provider: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidResetToken) {
+			return err
+		}
+		return fmt.Errorf("apply password reset: %w", err)
+	}
+	return nil
+}
+
+// En: ApplyEmailChange consumes the token and, in the same transaction, moves the user and its credentials provider
+// to the new email, which counts as verified. Fails with ErrInvalidEmailChangeToken if the token was already used
+// and with user.ErrDuplicateEmail if another user took the address meanwhile.
+// Es: ApplyEmailChange consume el token y, en la misma transacción, pasa el usuario y su proveedor de credenciales
+// al nuevo email, que queda verificado. Falla con ErrInvalidEmailChangeToken si el token ya fue usado
+// y con user.ErrDuplicateEmail si otro usuario tomó la dirección entretanto.
+func (repository *Repository) ApplyEmailChange(token *EmailChangeToken) error {
+	now := time.Now()
+	err := repository.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&EmailChangeToken{}).
+			Where("id = ? AND used_at IS NULL", token.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return fmt.Errorf("mark email change token used: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidEmailChangeToken
+		}
+
+		if err := tx.Model(&user.User{}).
+			Where("id = ?", token.UserID).
+			Updates(map[string]any{
+				"email":                         token.NewEmail,
+				"email_verified_at":             now,
+				"email_verification_token":      nil,
+				"email_verification_expires_at": nil,
+			}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&UserAuthProvider{}).
+			Where("user_id = ? AND provider = ?", token.UserID, ProviderCredentials).
+			Update("provider_subject_id", token.NewEmail).Error; err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return user.ErrDuplicateEmail
+		}
+		if errors.Is(err, ErrInvalidEmailChangeToken) {
+			return err
+		}
+		return fmt.Errorf("apply email change: %w", err)
+	}
+	return nil
+}
+
+// En: DeleteExpiredOAuthStates hard-deletes up to limit OAuth states that expired before now without being consumed.
+// Es: DeleteExpiredOAuthStates borra físicamente hasta limit states de OAuth que expiraron antes de now sin consumirse.
+func (repository *Repository) DeleteExpiredOAuthStates(now time.Time, limit int) (int64, error) {
+	batch := repository.db.Model(&OAuthState{}).Select("id").Where("expires_at < ?", now).Limit(limit)
+	result := repository.db.Where("id IN (?)", batch).Delete(&OAuthState{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("delete expired oauth states: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// En: DeleteExpiredRevokedAccessTokens hard-deletes up to limit denylist entries whose tokens expired before now.
+// Es: DeleteExpiredRevokedAccessTokens borra físicamente hasta limit entradas de la lista de denegación cuyos tokens expiraron antes de now.
+func (repository *Repository) DeleteExpiredRevokedAccessTokens(now time.Time, limit int) (int64, error) {
+	batch := repository.db.Model(&RevokedAccessToken{}).Select("id").Where("expires_at < ?", now).Limit(limit)
+	result := repository.db.Where("id IN (?)", batch).Delete(&RevokedAccessToken{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("delete expired revoked access tokens: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// En: DeleteExpiredThrottleStates hard-deletes up to limit throttle_states rows that expired before now.
+// Es: DeleteExpiredThrottleStates borra físicamente hasta limit filas de throttle_states que expiraron antes de now.
+func (repository *Repository) DeleteExpiredThrottleStates(now time.Time, limit int) (int64, error) {
+	batch := repository.db.Model(&ThrottleState{}).Select("id").Where("expires_at < ?", now.Unix()).Limit(limit)
+	result := repository.db.Where("id IN (?)", batch).Delete(&ThrottleState{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("delete expired throttle states: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// En: CreateOAuthState persists the state of a social sign-in attempt.
+// Es: CreateOAuthState persiste el state de un intento de inicio de sesión social.
+func (repository *Repository) CreateOAuthState(state *OAuthState) error {
+	if err := repository.db.Create(state).Error; err != nil {
+		return fmt.Errorf("create oauth state: %w", err)
+	}
+	return nil
+}
+
+// En: ConsumeOAuthState loads and deletes the OAuth state with the given hash so it can only be used once.
+// Es: ConsumeOAuthState carga y elimina el state de OAuth con el hash dado para que solo pueda usarse una vez.
+func (repository *Repository) ConsumeOAuthState(hash string) (*OAuthState, error) {
+	var state OAuthState
+	if err := repository.db.Where("state_hash = ?", hash).First(&state).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidOAuthState
+		}
+		return nil, fmt.Errorf("get oauth state: %w", err)
+	}
+	result := repository.db.Where("id = ?", state.ID).Delete(&OAuthState{})
+	if result.Error != nil {
+		return nil, fmt.Errorf("delete oauth state: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidOAuthState
+	}
+	return &state, nil
+}
+
+// En: GetTOTPCredential returns the TOTP credential of the user.
+// Es: GetTOTPCredential devuelve la credencial TOTP del usuario.
+func (repository *Repository) GetTOTPCredential(userID string) (*TOTPCredential, error) {
+	var credential TOTPCredential
+	if err := repository.db.Where("user_id = ?", userID).First(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTwoFactorNotEnabled
+		}
+		return nil, fmt.Errorf("get totp credential: %w", err)
+	}
+	return &credential, nil
+}
+
+// En: ReplacePendingTOTPCredential stores a new unconfirmed secret, replacing any previous pending enrollment.
+// Es: ReplacePendingTOTPCredential guarda un nuevo secreto sin confirmar, reemplazando cualquier inscripción pendiente previa.
+func (repository *Repository) ReplacePendingTOTPCredential(credential *TOTPCredential) error {
+	return repository.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND confirmed_at IS NULL", credential.UserID).Delete(&TOTPCredential{}).Error; err != nil {
+			return fmt.Errorf("delete pending totp credential: %w", err)
+		}
+		if err := tx.Create(credential).Error; err != nil {
+			return fmt.Errorf("create totp credential: %w", err)
+		}
+		return nil
+	})
+}
+
+// En: ConfirmTOTPCredential enables 2FA, records the accepted step and replaces the recovery codes in one transaction.
+// Es: ConfirmTOTPCredential activa el 2FA, registra el paso aceptado y reemplaza los códigos de recuperación en una transacción.
+func (repository *Repository) ConfirmTOTPCredential(id string, step int64, recoveryCodes []RecoveryCode) error {
+	return repository.db.Transaction(func(tx *gorm.DB) error {
+		var credential TOTPCredential
+		if err := tx.Where("id = ?", id).First(&credential).Error; err != nil {
+			return fmt.Errorf("get totp credential: %w", err)
+		}
+		result := tx.Model(&TOTPCredential{}).
+			Where("id = ? AND confirmed_at IS NULL", id).
+			Updates(map[string]any{"confirmed_at": time.Now(), "last_used_step": step})
+		if result.Error != nil {
+			return fmt.Errorf("confirm totp credential: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrTwoFactorAlreadyEnabled
+		}
+		if err := tx.Where("user_id = ?", credential.UserID).Delete(&RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("delete recovery codes: %w", err)
+		}
+		if err := tx.Create(&recoveryCodes).Error; err != nil {
+			return fmt.Errorf("create recovery codes: %w", err)
+		}
+		return nil
+	})
+}
+
+// En: AdvanceTOTPStep records an accepted time step; it fails if that step (or a later one) was already used.
+// Es: AdvanceTOTPStep registra un paso de tiempo aceptado; falla si ese paso (o uno posterior) ya fue usado.
+func (repository *Repository) AdvanceTOTPStep(id string, step int64) error {
+	result := repository.db.Model(&TOTPCredential{}).
+		Where("id = ? AND last_used_step < ?", id, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return fmt.Errorf("advance totp step: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// En: DeleteTwoFactor removes the TOTP credential and the recovery codes of the user.
+// Es: DeleteTwoFactor elimina la credencial TOTP y los códigos de recuperación del usuario.
+func (repository *Repository) DeleteTwoFactor(userID string) error {
+	return repository.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&TOTPCredential{}).Error; err != nil {
+			return fmt.Errorf("delete totp credential: %w", err)
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("delete recovery codes: %w", err)
+		}
+		return nil
+	})
+}
+
+// En: ConsumeRecoveryCode marks an unused recovery code of the user as used; it fails if none matches.
+// Es: ConsumeRecoveryCode marca como usado un código de recuperación sin usar del usuario; falla si ninguno coincide.
+func (repository *Repository) ConsumeRecoveryCode(userID, hash string) error {
+	result := repository.db.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("consume recovery code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// En: CountUnusedRecoveryCodes returns how many recovery codes the user has left.
+// Es: CountUnusedRecoveryCodes devuelve cuántos códigos de recuperación le quedan al usuario.
+func (repository *Repository) CountUnusedRecoveryCodes(userID string) (int64, error) {
+	var count int64
+	if err := repository.db.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// En: CreateMFAChallenge persists a new MFA challenge.
+// Es: CreateMFAChallenge persiste un nuevo desafío MFA.
+func (repository *Repository) CreateMFAChallenge(challenge *MFAChallenge) error {
+	if err := repository.db.Create(challenge).Error; err != nil {
+		return fmt.Errorf("create mfa challenge: %w", err)
+	}
+	return nil
+}
+
+// En: GetMFAChallengeByHash returns an MFA challenge by its SHA-256 hash.
+// Es: GetMFAChallengeByHash devuelve un desafío MFA por su hash SHA-256.
+func (repository *Repository) GetMFAChallengeByHash(hash string) (*MFAChallenge, error) {
+	var challenge MFAChallenge
+	if err := repository.db.Where("token_hash = ?", hash).First(&challenge).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidMFAToken
+		}
+		return nil, fmt.Errorf("get mfa challenge by hash: %w", err)
+	}
+	return &challenge, nil
+}
+
+// En: ClaimMFAChallengeAttempt reserves one verification attempt on a pending challenge before the code is checked.
+// The conditional update keeps concurrent requests from going past maxAttempts; it fails with ErrInvalidMFAToken
+// when the challenge is used, expired or out of attempts.
+// Es: ClaimMFAChallengeAttempt reserva un intento de verificación en un desafío pendiente antes de comprobar el código.
+// La actualización condicional impide que peticiones concurrentes superen maxAttempts; falla con ErrInvalidMFAToken
+// si el desafío está usado, expirado o sin intentos.
+func (repository *Repository) ClaimMFAChallengeAttempt(id string, maxAttempts int) error {
+	result := repository.db.Model(&MFAChallenge{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ? AND attempts < ?", id, time.Now(), maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("claim mfa challenge attempt: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFAToken
+	}
+	return nil
+}
+
+// En: MarkMFAChallengeUsed completes a challenge; it fails with ErrInvalidMFAToken if it was already used.
+// Es: MarkMFAChallengeUsed completa un desafío; falla con ErrInvalidMFAToken si ya fue usado.
+func (repository *Repository) MarkMFAChallengeUsed(id string) error {
+	result := repository.db.Model(&MFAChallenge{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("mark mfa challenge used: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFAToken
+	}
+	return nil
+}
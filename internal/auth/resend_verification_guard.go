@@ -2,19 +2,12 @@ package auth
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
-	shareddynamodb "github.com/cloudflax/api.cloudflax/internal/shared/dynamodb"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"gorm.io/gorm"
 )
 
 const (
@@ -22,7 +15,79 @@ const (
 	resendMaxSends        = int64(3)
 	resendLockSeconds     = int64(2 * 60 * 60)
 	resendStateTTLSeconds = int64(24 * 60 * 60)
-	resendStateSK         = "STATE"
+	resendStateSK         = throttleStateSK
+
+	resendIPMaxSends      = int64(10)
+	resendIPWindowSeconds = int64(60 * 60)
+	resendIPLockSeconds   = int64(60 * 60)
+)
+
+// resendThrottlePolicy allows three sends five minutes apart, then locks the address for two hours.
+var resendThrottlePolicy = throttlePolicy{
+	CooldownSeconds: resendCooldownSeconds,
+	MaxAttempts:     resendMaxSends,
+	LockSeconds:     resendLockSeconds,
+	StateTTLSeconds: resendStateTTLSeconds,
+}
+
+// resendIPThrottlePolicy allows ten sends per hour from one client IP, whatever the addresses, then locks it for an hour.
+var resendIPThrottlePolicy = throttlePolicy{
+	MaxAttempts:     resendIPMaxSends,
+	LockSeconds:     resendIPLockSeconds,
+	WindowSeconds:   resendIPWindowSeconds,
+	StateTTLSeconds: resendStateTTLSeconds,
+}
+
+// En: Throttle dimensions reported in RateLimitError.Dimension and ResendVerificationRateLimitError.Dimension.
+// Es: Dimensiones de throttle informadas en RateLimitError.Dimension y ResendVerificationRateLimitError.Dimension.
+const (
+	ThrottleDimensionEmail = "email"
+	ThrottleDimensionIP    = "ip"
+)
+
+// En: ThrottleLimits overrides the policy of one throttle dimension; zero fields keep the default.
+// Es: ThrottleLimits sobrescribe la política de una dimensión de throttle; los campos en cero mantienen el valor por defecto.
+type ThrottleLimits struct {
+	Cooldown    time.Duration
+	MaxAttempts int64
+	Lock        time.Duration
+	// Window restarts the count once the first attempt is older than it; zero counts until the lock.
+	Window time.Duration
+}
+
+// En: ResendVerificationLimits configures the email and IP dimensions of a resend guard.
+// Es: ResendVerificationLimits configura las dimensiones de email e IP de un guard de reenvío.
+type ResendVerificationLimits struct {
+	Email ThrottleLimits
+	IP    ThrottleLimits
+}
+
+// policy applies the non-zero limits over the default policy.
+func (limits ThrottleLimits) policy(defaults throttlePolicy) throttlePolicy {
+	policy := defaults
+	if limits.Cooldown > 0 {
+		policy.CooldownSeconds = int64(limits.Cooldown.Seconds())
+	}
+	if limits.MaxAttempts > 0 {
+		policy.MaxAttempts = limits.MaxAttempts
+	}
+	if limits.Lock > 0 {
+		policy.LockSeconds = int64(limits.Lock.Seconds())
+	}
+	if limits.Window > 0 {
+		policy.WindowSeconds = int64(limits.Window.Seconds())
+	}
+	return policy
+}
+
+// En: Throttle scopes namespace the DynamoDB keys so each guarded flow keeps its own counters.
+// Es: Los scopes de throttle separan las claves en DynamoDB para que cada flujo protegido tenga sus propios contadores.
+const (
+	ThrottleScopeResendVerification = "RESEND_VERIFICATION"
+	ThrottleScopeForgotPassword     = "FORGOT_PASSWORD"
+	ThrottleScopeLogin              = "LOGIN"
+	ThrottleScopeMagicLink          = "MAGIC_LINK"
+	ThrottleScopeDeviceCode         = "DEVICE_CODE"
 )
 
 // En: ErrResendVerificationRateLimited indicates resend throttle limits were reached.
@@ -44,12 +109,19 @@ type DynamoResendVerificationGuardOptions struct {
 	Profile         string
 	AccessKeyID     string
 	SecretAccessKey string
+	// Scope namespaces the throttle keys; empty defaults to ThrottleScopeResendVerification.
+	Scope string
+	// Limits overrides the default email and IP policies.
+	Limits ResendVerificationLimits
 }
 
-// En: ResendVerificationRateLimitError includes retry delay for throttled resend calls.
-// Es: ResendVerificationRateLimitError incluye demora de reintento para reenvio bloqueado.
+// En: ResendVerificationRateLimitError includes retry delay for throttled resend calls
+// and the dimension (ThrottleDimensionEmail or ThrottleDimensionIP) that tripped.
+// Es: ResendVerificationRateLimitError incluye demora de reintento para reenvio bloqueado
+// y la dimensión (ThrottleDimensionEmail o ThrottleDimensionIP) que lo activó.
 type ResendVerificationRateLimitError struct {
 	RetryAfter time.Duration
+	Dimension  string
 }
 
 // En: Error returns the throttle reason message.
@@ -64,47 +136,44 @@ func (e *ResendVerificationRateLimitError) Is(target error) bool {
 	return target == ErrResendVerificationRateLimited
 }
 
-type resendGuardState struct {
-	Exists         bool
-	Version        int64
-	Count          int64
-	WindowStart    int64
-	NextAllowedAt  int64
-	LockUntil      int64
-	CreatedAt      int64
-	UpdatedAt      int64
-	ExpiresAt      int64
-	OriginalPK     string
-	OriginalSK     string
-	OriginalItem   map[string]types.AttributeValue
-	HasLockUntil   bool
-	HasCount       bool
-	HasVersion     bool
-	HasWindowStart bool
+// En: resendVerificationGuard applies the resend policies per email and per client IP on top of a throttle store.
+// Es: resendVerificationGuard aplica las políticas de reenvío por email y por IP del cliente sobre un almacén de throttle.
+type resendVerificationGuard struct {
+	store       throttleStore
+	scope       string
+	emailPolicy throttlePolicy
+	ipPolicy    throttlePolicy
+	now         func() time.Time
 }
 
-type dynamoAPI interface {
-	GetItem(ctx context.Context, params *awsdynamodb.GetItemInput, optFns ...func(*awsdynamodb.Options)) (*awsdynamodb.GetItemOutput, error)
-	PutItem(ctx context.Context, params *awsdynamodb.PutItemInput, optFns ...func(*awsdynamodb.Options)) (*awsdynamodb.PutItemOutput, error)
+// newResendVerificationGuard builds a guard over store with the given scope and limits.
+func newResendVerificationGuard(store throttleStore, scope string, limits ResendVerificationLimits) *resendVerificationGuard {
+	return &resendVerificationGuard{
+		store:       store,
+		scope:       resendGuardScope(scope),
+		emailPolicy: limits.Email.policy(resendThrottlePolicy),
+		ipPolicy:    limits.IP.policy(resendIPThrottlePolicy),
+		now:         time.Now,
+	}
 }
 
-// En: dynamoResendVerificationGuard stores throttle state in DynamoDB.
-// Es: dynamoResendVerificationGuard guarda estado de throttle en DynamoDB.
-type dynamoResendVerificationGuard struct {
-	client    dynamoAPI
-	tableName string
-	now       func() time.Time
+// En: NewMemoryResendVerificationGuard builds an in-process resend guard for local development and tests.
+// Es: NewMemoryResendVerificationGuard crea un guard de reenvío en memoria para desarrollo local y tests.
+func NewMemoryResendVerificationGuard(scope string, limits ResendVerificationLimits) ResendVerificationGuard {
+	return newResendVerificationGuard(newMemoryThrottleStore(time.Now), scope, limits)
+}
+
+// En: NewPostgresResendVerificationGuard builds a resend guard backed by the throttle_states table.
+// Es: NewPostgresResendVerificationGuard crea un guard de reenvío respaldado por la tabla throttle_states.
+func NewPostgresResendVerificationGuard(db *gorm.DB, scope string, limits ResendVerificationLimits) ResendVerificationGuard {
+	return newResendVerificationGuard(&postgresThrottleStore{db: db, now: time.Now}, scope, limits)
 }
 
 // En: NewDynamoResendVerificationGuard builds a DynamoDB-backed resend guard.
 // Es: NewDynamoResendVerificationGuard crea un guard de reenvio con DynamoDB.
 func NewDynamoResendVerificationGuard(ctx context.Context, opts DynamoResendVerificationGuardOptions) (ResendVerificationGuard, error) {
-	tableName := strings.TrimSpace(opts.TableName)
-	if tableName == "" {
-		return nil, nil
-	}
-
-	client, err := shareddynamodb.NewClient(ctx, shareddynamodb.ClientOptions{
+	store, err := newDynamoThrottleStore(ctx, DynamoThrottleOptions{
+		TableName:       opts.TableName,
 		EndpointURL:     opts.EndpointURL,
 		Region:          opts.Region,
 		Profile:         opts.Profile,
@@ -112,227 +181,56 @@ func NewDynamoResendVerificationGuard(ctx context.Context, opts DynamoResendVeri
 		SecretAccessKey: opts.SecretAccessKey,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("create dynamodb client for resend guard: %w", err)
+		return nil, fmt.Errorf("create resend guard: %w", err)
 	}
-
-	return &dynamoResendVerificationGuard{
-		client:    client,
-		tableName: tableName,
-		now:       time.Now,
-	}, nil
-}
-
-// En: CheckAndConsume validates limits and consumes one resend quota atomically.
-// Es: CheckAndConsume valida limites y consume una cuota de reenvio.
-func (g *dynamoResendVerificationGuard) CheckAndConsume(ctx context.Context, email, _ string) error {
-	normalizedEmail := strings.ToLower(strings.TrimSpace(email))
-	if normalizedEmail == "" {
-		return nil
+	if store == nil {
+		return nil, nil
 	}
+	return newResendVerificationGuard(store, opts.Scope, opts.Limits), nil
+}
 
-	emailHash := sha256Hex(normalizedEmail)
-	pk := fmt.Sprintf("THROTTLE#RESEND_VERIFICATION#EMAIL#%s", emailHash)
-
-	const maxRetries = 4
-	for range maxRetries {
-		now := g.now().Unix()
-		current, err := g.getState(ctx, pk)
-		if err != nil {
-			return fmt.Errorf("load resend throttle state: %w", err)
-		}
-
-		next, limitErr := evaluateResendState(current, now)
-		if limitErr != nil {
-			return limitErr
-		}
-		if next.OriginalPK == "" {
-			next.OriginalPK = pk
-		}
-		if next.OriginalSK == "" {
-			next.OriginalSK = resendStateSK
+// En: CheckAndConsume validates limits and consumes one resend quota for the client IP and then for the email.
+// The IP goes first so a request blocked by it does not use up the quota of the address. An empty email only
+// checks the IP, for flows that have no address (device authorization).
+// Es: CheckAndConsume valida limites y consume una cuota de reenvio para la IP del cliente y luego para el email.
+// La IP va primero para que una solicitud bloqueada por ella no gaste la cuota de la dirección. Un email vacío solo
+// comprueba la IP, para flujos sin dirección (autorización de dispositivo).
+func (g *resendVerificationGuard) CheckAndConsume(ctx context.Context, email, ip string) error {
+	if normalizedIP := strings.TrimSpace(ip); normalizedIP != "" {
+		if err := g.consume(ctx, ThrottleDimensionIP, normalizedIP, g.ipPolicy); err != nil {
+			return err
 		}
+	}
 
-		if err := g.putState(ctx, current, next); err != nil {
-			var ccf *types.ConditionalCheckFailedException
-			if errors.As(err, &ccf) {
-				continue
-			}
-			return fmt.Errorf("store resend throttle state: %w", err)
-		}
+	normalizedEmail := strings.ToLower(strings.TrimSpace(email))
+	if normalizedEmail == "" {
 		return nil
 	}
-
-	return fmt.Errorf("store resend throttle state: too much contention")
+	return g.consume(ctx, ThrottleDimensionEmail, normalizedEmail, g.emailPolicy)
 }
 
-func (g *dynamoResendVerificationGuard) getState(ctx context.Context, pk string) (*resendGuardState, error) {
-	out, err := g.client.GetItem(ctx, &awsdynamodb.GetItemInput{
-		TableName:      aws.String(g.tableName),
-		ConsistentRead: aws.Bool(true),
-		Key: map[string]types.AttributeValue{
-			"pk": &types.AttributeValueMemberS{Value: pk},
-			"sk": &types.AttributeValueMemberS{Value: resendStateSK},
-		},
+// consume applies policy to the record of one dimension, tagging a rate-limit error with that dimension.
+func (g *resendVerificationGuard) consume(ctx context.Context, dimension, value string, policy throttlePolicy) error {
+	pk := throttleKey(g.scope, strings.ToUpper(dimension), value)
+	err := g.store.update(ctx, pk, func(current *resendGuardState) (*resendGuardState, error) {
+		return evaluateThrottleState(policy, current, g.now().Unix())
 	})
-	if err != nil {
-		return nil, err
+	var limitErr *ResendVerificationRateLimitError
+	if errors.As(err, &limitErr) {
+		limitErr.Dimension = dimension
 	}
-
-	state := &resendGuardState{}
-	if len(out.Item) == 0 {
-		return state, nil
-	}
-
-	state.Exists = true
-	state.OriginalItem = out.Item
-	state.OriginalPK = attrString(out.Item["pk"])
-	state.OriginalSK = attrString(out.Item["sk"])
-	state.Version, state.HasVersion = attrInt64(out.Item["version"])
-	state.Count, state.HasCount = attrInt64(out.Item["count"])
-	state.WindowStart, state.HasWindowStart = attrInt64(out.Item["window_start"])
-	state.NextAllowedAt, _ = attrInt64(out.Item["next_allowed_at"])
-	state.LockUntil, state.HasLockUntil = attrInt64(out.Item["lock_until"])
-	state.CreatedAt, _ = attrInt64(out.Item["created_at"])
-	state.UpdatedAt, _ = attrInt64(out.Item["updated_at"])
-	state.ExpiresAt, _ = attrInt64(out.Item["expires_at"])
-
-	return state, nil
-}
-
-func (g *dynamoResendVerificationGuard) putState(ctx context.Context, current, next *resendGuardState) error {
-	item := map[string]types.AttributeValue{
-		"pk":              &types.AttributeValueMemberS{Value: next.OriginalPK},
-		"sk":              &types.AttributeValueMemberS{Value: next.OriginalSK},
-		"version":         &types.AttributeValueMemberN{Value: strconv.FormatInt(next.Version, 10)},
-		"count":           &types.AttributeValueMemberN{Value: strconv.FormatInt(next.Count, 10)},
-		"window_start":    &types.AttributeValueMemberN{Value: strconv.FormatInt(next.WindowStart, 10)},
-		"next_allowed_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(next.NextAllowedAt, 10)},
-		"created_at":      &types.AttributeValueMemberN{Value: strconv.FormatInt(next.CreatedAt, 10)},
-		"updated_at":      &types.AttributeValueMemberN{Value: strconv.FormatInt(next.UpdatedAt, 10)},
-		"expires_at":      &types.AttributeValueMemberN{Value: strconv.FormatInt(next.ExpiresAt, 10)},
-	}
-	if next.LockUntil > 0 {
-		item["lock_until"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(next.LockUntil, 10)}
-	}
-
-	input := &awsdynamodb.PutItemInput{
-		TableName: aws.String(g.tableName),
-		Item:      item,
-	}
-	if current.Exists {
-		input.ConditionExpression = aws.String("#version = :expectedVersion")
-		input.ExpressionAttributeNames = map[string]string{
-			"#version": "version",
-		}
-		input.ExpressionAttributeValues = map[string]types.AttributeValue{
-			":expectedVersion": &types.AttributeValueMemberN{Value: strconv.FormatInt(current.Version, 10)},
-		}
-	} else {
-		input.ConditionExpression = aws.String("attribute_not_exists(pk) AND attribute_not_exists(sk)")
-	}
-
-	_, err := g.client.PutItem(ctx, input)
 	return err
 }
 
-func evaluateResendState(current *resendGuardState, now int64) (*resendGuardState, error) {
-	if current == nil || !current.Exists {
-		return buildFreshState(now), nil
-	}
-
-	if current.LockUntil > now {
-		return nil, &ResendVerificationRateLimitError{
-			RetryAfter: time.Duration(current.LockUntil-now) * time.Second,
-		}
-	}
-
-	if current.Count >= resendMaxSends {
-		return buildFreshStateFrom(current, now), nil
-	}
-
-	if current.NextAllowedAt > now {
-		return nil, &ResendVerificationRateLimitError{
-			RetryAfter: time.Duration(current.NextAllowedAt-now) * time.Second,
-		}
-	}
-
-	next := buildFreshStateFrom(current, now)
-	next.Count = current.Count + 1
-	next.NextAllowedAt = now + resendCooldownSeconds
-	next.ExpiresAt = next.NextAllowedAt + resendStateTTLSeconds
-	if next.Count >= resendMaxSends {
-		next.LockUntil = now + resendLockSeconds
-		next.ExpiresAt = next.LockUntil + resendStateTTLSeconds
-	}
-
-	return next, nil
-}
-
-func buildFreshState(now int64) *resendGuardState {
-	return &resendGuardState{
-		OriginalPK:    "",
-		OriginalSK:    resendStateSK,
-		Version:       1,
-		Count:         1,
-		WindowStart:   now,
-		NextAllowedAt: now + resendCooldownSeconds,
-		CreatedAt:     now,
-		UpdatedAt:     now,
-		ExpiresAt:     now + resendCooldownSeconds + resendStateTTLSeconds,
-	}
-}
-
-func buildFreshStateFrom(current *resendGuardState, now int64) *resendGuardState {
-	if current == nil {
-		return buildFreshState(now)
-	}
-
-	createdAt := current.CreatedAt
-	if createdAt == 0 {
-		createdAt = now
-	}
-
-	return &resendGuardState{
-		Exists:        current.Exists,
-		OriginalPK:    current.OriginalPK,
-		OriginalSK:    current.OriginalSK,
-		Version:       current.Version + 1,
-		Count:         1,
-		WindowStart:   now,
-		CreatedAt:     createdAt,
-		UpdatedAt:     now,
-		NextAllowedAt: now + resendCooldownSeconds,
-		ExpiresAt:     now + resendCooldownSeconds + resendStateTTLSeconds,
+// resendGuardScope defaults an empty scope to ThrottleScopeResendVerification.
+func resendGuardScope(scope string) string {
+	scope = strings.TrimSpace(scope)
+	if scope == "" {
+		return ThrottleScopeResendVerification
 	}
+	return scope
 }
 
-func attrInt64(v types.AttributeValue) (int64, bool) {
-	if v == nil {
-		return 0, false
-	}
-	nv, ok := v.(*types.AttributeValueMemberN)
-	if !ok {
-		return 0, false
-	}
-	n, err := strconv.ParseInt(nv.Value, 10, 64)
-	if err != nil {
-		return 0, false
-	}
-	return n, true
-}
-
-func attrString(v types.AttributeValue) string {
-	if v == nil {
-		return ""
-	}
-	sv, ok := v.(*types.AttributeValueMemberS)
-	if !ok {
-		return ""
-	}
-	return sv.Value
-}
-
-func sha256Hex(input string) string {
-	sum := sha256.Sum256([]byte(input))
-	return hex.EncodeToString(sum[:])
+func evaluateResendState(current *resendGuardState, now int64) (*resendGuardState, error) {
+	return evaluateThrottleState(resendThrottlePolicy, current, now)
 }
@@ -1,12 +1,15 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflax/api.cloudflax/internal/shared/database"
 )
 
 // En: TestEvaluateResendStateFirstSendAllows verifies first resend attempt is allowed.
@@ -107,3 +110,112 @@ func TestEvaluateResendStateAfterLockResets(test *testing.T) {
 	assert.Equal(test, now+resendCooldownSeconds, next.NextAllowedAt)
 	assert.Equal(test, int64(0), next.LockUntil)
 }
+
+// En: TestResendVerificationGuardBackends verifies that the memory and Postgres guards apply the same policy.
+// Es: TestResendVerificationGuardBackends verifica que los guards en memoria y Postgres aplican la misma política.
+func TestResendVerificationGuardBackends(test *testing.T) {
+	require.NoError(test, database.InitForTesting())
+	require.NoError(test, database.RunMigrations(&ThrottleState{}))
+
+	guards := map[string]ResendVerificationGuard{
+		"memory":   NewMemoryResendVerificationGuard("", ResendVerificationLimits{}),
+		"postgres": NewPostgresResendVerificationGuard(database.DB, ThrottleScopeResendVerification, ResendVerificationLimits{}),
+	}
+	for name, guard := range guards {
+		test.Run(name, func(test *testing.T) {
+			ctx := context.Background()
+			require.NoError(test, guard.CheckAndConsume(ctx, "Guard@Example.com", "10.0.0.1"))
+
+			err := guard.CheckAndConsume(ctx, "guard@example.com", "10.0.0.1")
+			var limitErr *ResendVerificationRateLimitError
+			require.True(test, errors.As(err, &limitErr), "second send inside the cooldown is blocked")
+			assert.Equal(test, ThrottleDimensionEmail, limitErr.Dimension)
+			assert.InDelta(test, float64(resendCooldownSeconds), limitErr.RetryAfter.Seconds(), 2)
+
+			assert.NoError(test, guard.CheckAndConsume(ctx, "other@example.com", "10.0.0.1"))
+		})
+	}
+
+	var stored ThrottleState
+	require.NoError(test, database.DB.Where("id = ?", throttleKey(ThrottleScopeResendVerification, "EMAIL", "guard@example.com")).Take(&stored).Error)
+	assert.Equal(test, int64(1), stored.Count)
+	assert.Equal(test, int64(1), stored.Version)
+}
+
+// En: TestPostgresThrottleStoreUpdatesExistingRow verifies that later attempts update the locked row and bump its version.
+// Es: TestPostgresThrottleStoreUpdatesExistingRow verifica que los intentos siguientes actualizan la fila bloqueada e incrementan su versión.
+func TestPostgresThrottleStoreUpdatesExistingRow(test *testing.T) {
+	require.NoError(test, database.InitForTesting())
+	require.NoError(test, database.RunMigrations(&ThrottleState{}))
+	ctx := context.Background()
+	now := int64(1_700_000_000)
+	store := &postgresThrottleStore{db: database.DB, now: func() time.Time { return time.Unix(now, 0) }}
+
+	for i := range resendMaxSends {
+		attemptAt := now + i*resendCooldownSeconds
+		require.NoError(test, store.update(ctx, "THROTTLE#TEST#EMAIL#hash", func(current *resendGuardState) (*resendGuardState, error) {
+			return evaluateResendState(current, attemptAt)
+		}))
+	}
+
+	state, err := store.load(ctx, "THROTTLE#TEST#EMAIL#hash")
+	require.NoError(test, err)
+	assert.True(test, state.Exists)
+	assert.Equal(test, resendMaxSends, state.Count)
+	assert.Equal(test, resendMaxSends, state.Version)
+	assert.Equal(test, now+2*resendCooldownSeconds+resendLockSeconds, state.LockUntil)
+}
+
+// En: TestPostgresThrottleStoreIgnoresExpiredRows verifies that a row past expires_at reads as absent and is
+// overwritten with a fresh state on the next attempt.
+// Es: TestPostgresThrottleStoreIgnoresExpiredRows verifica que una fila con expires_at vencido se lee como ausente y
+// se sobrescribe con un estado nuevo en el siguiente intento.
+func TestPostgresThrottleStoreIgnoresExpiredRows(test *testing.T) {
+	require.NoError(test, database.InitForTesting())
+	require.NoError(test, database.RunMigrations(&ThrottleState{}))
+	ctx := context.Background()
+	now := int64(1_700_000_000)
+	store := &postgresThrottleStore{db: database.DB, now: func() time.Time { return time.Unix(now, 0) }}
+	key := "THROTTLE#TEST#EMAIL#hash"
+	require.NoError(test, database.DB.Create(&ThrottleState{ID: key, Version: 3, Count: 3, WindowStart: now - 7200, LockUntil: now - 60, ExpiresAt: now - 1}).Error)
+
+	state, err := store.load(ctx, key)
+	require.NoError(test, err)
+	assert.False(test, state.Exists)
+
+	require.NoError(test, store.update(ctx, key, func(current *resendGuardState) (*resendGuardState, error) {
+		assert.False(test, current.Exists, "expired rows are handed to the policy as absent")
+		return evaluateResendState(current, now)
+	}))
+	state, err = store.load(ctx, key)
+	require.NoError(test, err)
+	assert.True(test, state.Exists)
+	assert.Equal(test, int64(1), state.Count)
+	assert.Zero(test, state.LockUntil)
+}
+
+// En: TestResendVerificationGuardIPDimension verifies that one IP spraying many addresses is locked on its own limits.
+// Es: TestResendVerificationGuardIPDimension verifica que una IP que envía a muchas direcciones se bloquea con sus propios límites.
+func TestResendVerificationGuardIPDimension(test *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	guard := newResendVerificationGuard(newMemoryThrottleStore(func() time.Time { return now }), "", ResendVerificationLimits{
+		IP: ThrottleLimits{MaxAttempts: 3, Lock: 10 * time.Minute},
+	})
+	guard.now = func() time.Time { return now }
+
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		require.NoError(test, guard.CheckAndConsume(ctx, email, "10.0.0.1"))
+	}
+
+	err := guard.CheckAndConsume(ctx, "d@example.com", "10.0.0.1")
+	var limitErr *ResendVerificationRateLimitError
+	require.True(test, errors.As(err, &limitErr))
+	assert.Equal(test, ThrottleDimensionIP, limitErr.Dimension)
+	assert.Equal(test, 10*time.Minute, limitErr.RetryAfter)
+
+	require.NoError(test, guard.CheckAndConsume(ctx, "d@example.com", "10.0.0.2"), "the blocked request did not consume the email quota")
+
+	now = now.Add(10 * time.Minute)
+	assert.NoError(test, guard.CheckAndConsume(ctx, "e@example.com", "10.0.0.1"))
+}
@@ -6,16 +6,62 @@ import (
 	"github.com/gofiber/fiber/v3"
 )
 
-// En: Routes mounts auth routes on the given router.
-// Es: Monta las rutas de autenticación en el router dado.
-func Routes(router fiber.Router, handler *Handler, authMiddleware fiber.Handler) {
+// En: Routes mounts auth routes on the given router. recentAuthMiddleware guards the changes to how the user signs in:
+// the email, disabling 2FA and linking or unlinking providers.
+// Es: Monta las rutas de autenticación en el router dado. recentAuthMiddleware protege los cambios en cómo inicia sesión
+// el usuario: el email, desactivar el 2FA y enlazar o desenlazar proveedores.
+func Routes(router fiber.Router, handler *Handler, authMiddleware, recentAuthMiddleware fiber.Handler) {
+	router.Get("/.well-known/jwks.json", handler.JWKS)
+	router.Get("/.well-known/openid-configuration", handler.OpenIDConfiguration)
+
 	auth := router.Group("/auth")
 	auth.Post("/register", handler.Register)
 	auth.Get("/verify-email", handler.VerifyEmail)
+	auth.Post("/verify-email/code", handler.VerifyEmailCode)
 	auth.Post("/resend-verification", handler.ResendVerification)
 	auth.Post("/login", handler.Login)
+	auth.Post("/login/2fa", handler.VerifyMFA)
+	auth.Post("/magic-link", handler.RequestMagicLink)
+	auth.Post("/magic-link/verify", handler.VerifyMagicLink)
+	auth.Post("/device/code", handler.DeviceAuthorization)
+	auth.Post("/device/token", handler.DeviceToken)
+	auth.Post("/device/approve", authMiddleware, handler.ApproveDevice)
+	auth.Post("/device/deny", authMiddleware, handler.DenyDevice)
 	auth.Post("/refresh", handler.Refresh)
 	auth.Post("/logout", authMiddleware, handler.Logout)
+	auth.Post("/reauthenticate", authMiddleware, handler.Reauthenticate)
+	auth.Get("/sessions", authMiddleware, handler.ListSessions)
+	auth.Post("/sessions/logout-others", authMiddleware, handler.LogoutOtherSessions)
+	auth.Delete("/sessions/:id", authMiddleware, handler.RevokeSession)
+	auth.Post("/forgot-password", handler.ForgotPassword)
+	auth.Post("/reset-password", handler.ResetPassword)
+	auth.Post("/confirm-email-change", handler.ConfirmEmailChange)
+	auth.Post("/2fa/enroll", authMiddleware, handler.EnrollTwoFactor)
+	auth.Post("/2fa/confirm", authMiddleware, handler.ConfirmTwoFactor)
+	auth.Post("/2fa/disable", authMiddleware, recentAuthMiddleware, handler.DisableTwoFactor)
+	auth.Get("/oauth/:provider/start", handler.OAuthStart)
+	auth.Get("/oauth/:provider/callback", handler.OAuthCallback)
+
+	// OAuth 2.0 / OIDC provider for third-party clients registered by accounts. The consent page of the
+	// frontend reads and answers /oauth/authorize for the signed-in user; clients call token and introspect.
+	oauth := router.Group("/oauth")
+	oauth.Get("/authorize", authMiddleware, handler.GetOAuthAuthorization)
+	oauth.Post("/authorize", authMiddleware, handler.DecideOAuthAuthorization)
+	oauth.Post("/token", handler.OAuthToken)
+	oauth.Post("/introspect", handler.OAuthIntrospect)
+
+	// Support staff impersonation; the service checks the platform-admin role of the caller.
+	router.Post("/admin/impersonate/:userID", authMiddleware, handler.Impersonate)
+
+	// Email change of the authenticated user; the new address must be confirmed.
+	router.Post("/users/me/email", authMiddleware, recentAuthMiddleware, handler.RequestEmailChange)
+
+	// Login methods of the authenticated user (UserAuthProvider records).
+	providers := router.Group("/users/me/auth-providers", authMiddleware)
+	providers.Get("/", handler.ListAuthProviders)
+	providers.Post("/:provider/link", recentAuthMiddleware, handler.StartLinkAuthProvider)
+	providers.Post("/:provider/link/callback", recentAuthMiddleware, handler.CompleteLinkAuthProvider)
+	providers.Delete("/:id", recentAuthMiddleware, handler.UnlinkAuthProvider)
 
 	// Development-only helpers.
 	// Mounted in non-production environments (e.g. development or test).
@@ -24,7 +24,7 @@ func TestRoutesDevVerifyEmailTokenMountedOnlyInNonProduction(test *testing.T) {
 	_, _, err := authService.Register("Dev User", "dev@example.com", "password123")
 	require.NoError(test, err)
 
-	Routes(app, handler, func(c fiber.Ctx) error { return c.Next() })
+	Routes(app, handler, func(c fiber.Ctx) error { return c.Next() }, func(c fiber.Ctx) error { return c.Next() })
 
 	req := httptest.NewRequest("POST", "/auth/dev/verify-email-token", strings.NewReader(`{"email":"dev@example.com"}`))
 	req.Header.Set("Content-Type", "application/json")
@@ -37,7 +37,7 @@ func TestRoutesDevVerifyEmailTokenMountedOnlyInNonProduction(test *testing.T) {
 	app2 := fiber.New()
 	handler2, _ := SetupAuthHandlerTest(test)
 
-	Routes(app2, handler2, func(c fiber.Ctx) error { return c.Next() })
+	Routes(app2, handler2, func(c fiber.Ctx) error { return c.Next() }, func(c fiber.Ctx) error { return c.Next() })
 
 	req2 := httptest.NewRequest("POST", "/auth/dev/verify-email-token", strings.NewReader(`{"email":"dev@example.com"}`))
 	req2.Header.Set("Content-Type", "application/json")
@@ -45,3 +45,34 @@ func TestRoutesDevVerifyEmailTokenMountedOnlyInNonProduction(test *testing.T) {
 	require.NoError(test, err)
 	assert.Equal(test, fiber.StatusNotFound, resp2.StatusCode, "route must not exist when APP_ENV=production")
 }
+
+// En: TestRoutesRequireRecentAuth checks the changes to how the user signs in go through the recent authentication middleware.
+// Es: TestRoutesRequireRecentAuth comprueba que los cambios en cómo inicia sesión el usuario pasan por el middleware de
+// autenticación reciente.
+func TestRoutesRequireRecentAuth(test *testing.T) {
+	handler, _ := SetupAuthHandlerTest(test)
+	app := fiber.New()
+	notRecent := func(c fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+	Routes(app, handler, func(c fiber.Ctx) error { return c.Next() }, notRecent)
+
+	cases := []struct {
+		method string
+		path   string
+	}{
+		{"POST", "/users/me/email"},
+		{"POST", "/auth/2fa/disable"},
+		{"POST", "/users/me/auth-providers/google/link"},
+		{"POST", "/users/me/auth-providers/google/link/callback"},
+		{"DELETE", "/users/me/auth-providers/00000000-0000-0000-0000-000000000000"},
+	}
+	for _, tc := range cases {
+		test.Run(tc.method+" "+tc.path, func(test *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(tc.method, tc.path, nil), fiber.TestConfig{Timeout: 0})
+			require.NoError(test, err)
+			defer resp.Body.Close()
+			assert.Equal(test, fiber.StatusForbidden, resp.StatusCode)
+		})
+	}
+}
@@ -4,34 +4,81 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math/big"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 
+	"github.com/cloudflax/api.cloudflax/internal/account"
+	"github.com/cloudflax/api.cloudflax/internal/shared/middleware"
+	"github.com/cloudflax/api.cloudflax/internal/shared/validator"
 	"github.com/cloudflax/api.cloudflax/internal/shared/verificationnotify"
 	"github.com/cloudflax/api.cloudflax/internal/user"
 )
 
 const (
-	defaultAccessTokenDuration = 15 * time.Minute
-	refreshTokenDuration       = 7 * 24 * time.Hour
-	refreshTokenBytes          = 32
-	verificationTokenDuration  = 24 * time.Hour
+	defaultAccessTokenDuration  = 15 * time.Minute
+	refreshTokenDuration        = 7 * 24 * time.Hour
+	refreshTokenBytes           = 32
+	verificationTokenDuration   = 24 * time.Hour
+	verificationCodeDuration    = 30 * time.Minute
+	verificationCodeMaxAttempts = 5
+	verificationCodeDigits      = 6
+	passwordResetTokenDuration  = time.Hour
+	emailChangeTokenDuration    = 24 * time.Hour
+	magicLinkTokenDuration      = 15 * time.Minute
+	oauthStateDuration          = 10 * time.Minute
+	mfaChallengeDuration        = 5 * time.Minute
+	mfaChallengeMaxAttempts     = 5
+	deviceAuthorizationDuration = 10 * time.Minute
+	deviceAuthorizationInterval = 5
+	deviceSlowDownStep          = 5
+	recoveryCodeCount           = 10
+	recoveryCodeBytes           = 5
+	defaultTOTPIssuer           = "Cloudflax"
 )
 
+// En: RecentAuthMaxAge is how long after proving their credentials (auth_time) a user may call sensitive routes;
+// elevated tokens from POST /auth/reauthenticate live as long.
+// Es: RecentAuthMaxAge es cuánto tiempo después de demostrar sus credenciales (auth_time) puede un usuario llamar a rutas
+// sensibles; los tokens elevados de POST /auth/reauthenticate duran lo mismo.
+const RecentAuthMaxAge = 5 * time.Minute
+
 // En: Claims holds the JWT payload for access tokens.
 // Es: Claims contiene el payload del JWT para los tokens de acceso.
 type Claims struct {
 	UserID string `json:"user_id"`
 	Email  string `json:"email"`
+	// SessionID is the login session (refresh token family) the token was issued for.
+	SessionID string `json:"sid,omitempty"`
+	// AccountID and AccountRole scope the token to the active account of the user and its role there.
+	AccountID   string           `json:"account_id,omitempty"`
+	AccountRole account.RoleType `json:"account_role,omitempty"`
+	// ClientID and Scope (space-separated) are set on tokens issued to third-party OAuth clients.
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// Actor (RFC 8693 "act") is the platform admin impersonating UserID; ReadOnly limits the token to safe methods.
+	Actor    *ActorClaim `json:"act,omitempty"`
+	ReadOnly bool        `json:"read_only,omitempty"`
+	// AuthTime (OIDC "auth_time") is when the user last proved their credentials: the login of the session, or
+	// the reauthentication behind an elevated token. Sensitive routes require it to be recent.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// En: ActorClaim identifies who is acting on behalf of the subject of an impersonation token.
+// Es: ActorClaim identifica quién actúa en nombre del sujeto de un token de suplantación.
+type ActorClaim struct {
+	Subject string `json:"sub"`
+}
+
 // En: TokenPair holds the access token and refresh token issued after a successful login or refresh.
 // Es: TokenPair contiene el token de acceso y el token de actualización emitidos después de un inicio de sesión o actualización exitosos.
 type TokenPair struct {
@@ -40,6 +87,44 @@ type TokenPair struct {
 	ExpiresAt    time.Time `json:"expires_at"`
 }
 
+// En: ElevatedToken is the short-lived access token issued by POST /auth/reauthenticate; its auth_time is the
+// reauthentication, so routes that require recent authentication accept it until it expires.
+// Es: ElevatedToken es el token de acceso de corta duración emitido por POST /auth/reauthenticate; su auth_time es la
+// reautenticación, así que las rutas que exigen autenticación reciente lo aceptan hasta que expira.
+type ElevatedToken struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	AuthTime    time.Time `json:"auth_time"`
+}
+
+// En: DeviceAuthorizationGrant is the RFC 8628 device authorization response: the device keeps DeviceCode secret and polls
+// with it every Interval seconds, while the user opens VerificationURI and enters UserCode.
+// Es: DeviceAuthorizationGrant es la respuesta de autorización de dispositivo RFC 8628: el dispositivo guarda DeviceCode en secreto
+// y consulta con él cada Interval segundos, mientras el usuario abre VerificationURI e introduce UserCode.
+type DeviceAuthorizationGrant struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// En: TwoFactorEnrollment holds the TOTP secret and otpauth URI shown to the user while enrolling 2FA.
+// Es: TwoFactorEnrollment contiene el secreto TOTP y el URI otpauth que se muestran al usuario al inscribir 2FA.
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// En: SessionMetadata describes the client that starts or refreshes a session (shown in the sessions list).
+// Es: SessionMetadata describe el cliente que inicia o actualiza una sesión (se muestra en la lista de sesiones).
+type SessionMetadata struct {
+	UserAgent  string
+	IPAddress  string
+	DeviceName string
+}
+
 // En: UserRepository is the subset of the user repository that the authentication service depends on.
 // Es: UserRepository es el subconjunto del repositorio de usuarios en el que depende el servicio de autenticación.
 type UserRepository interface {
@@ -47,27 +132,89 @@ type UserRepository interface {
 	GetUserByEmail(email string) (*user.User, error)
 	Create(u *user.User) error
 	Update(u *user.User) error
+	ExistsByEmail(email, excludeID string) (bool, error)
+}
+
+// En: AccountMemberLookup resolves the membership of a user in an account so access tokens can carry its role.
+// Es: AccountMemberLookup resuelve la membresía de un usuario en una cuenta para que los tokens de acceso lleven su rol.
+type AccountMemberLookup interface {
+	GetMember(accountID, userID string) (*account.AccountMember, error)
+}
+
+// En: OAuthClientLookup resolves an active third-party OAuth client registered by an account.
+// Es: OAuthClientLookup resuelve un cliente OAuth de terceros activo registrado por una cuenta.
+type OAuthClientLookup interface {
+	GetOAuthClient(clientID string) (*account.OAuthClient, error)
+}
+
+// En: AccountInvitationAcceptor resolves the account invitations a user can register from; the repository accepts them
+// together with the creation of the user.
+// Es: AccountInvitationAcceptor resuelve las invitaciones a cuentas desde las que un usuario puede registrarse; el
+// repositorio las acepta junto con la creación del usuario.
+type AccountInvitationAcceptor interface {
+	GetPendingInvitation(rawToken string) (*account.AccountInvitation, error)
 }
 
 // En: ServiceOptions configures JWT signing, verification email delivery and frontend URL for auth links.
 // Es: ServiceOptions configura la firma JWT, el envío del correo de verificación y la URL del frontend para enlaces de auth.
 type ServiceOptions struct {
+	// JWTSecret signs access tokens with HS256 when SigningKeys is nil (local development).
 	JWTSecret            string
 	VerificationNotifier verificationnotify.Notifier
-	FrontendURL          string
+	// PasswordResetNotifier delivers forgot-password links; nil defaults to a no-op notifier.
+	PasswordResetNotifier verificationnotify.PasswordResetNotifier
+	// MagicLinkNotifier delivers passwordless login links; nil defaults to a no-op notifier.
+	MagicLinkNotifier verificationnotify.MagicLinkNotifier
+	// EmailChangeNotifier warns the current address when an email change is requested; nil defaults to a no-op notifier.
+	EmailChangeNotifier verificationnotify.EmailChangeNotifier
+	// EmailChangeConfirmationNotifier delivers the confirmation link to the new address of an email change; nil
+	// defaults to a no-op notifier.
+	EmailChangeConfirmationNotifier verificationnotify.EmailChangeConfirmationNotifier
+	FrontendURL                     string
 	// AccessTokenDuration is the JWT access token lifetime; zero defaults to 15 minutes.
 	AccessTokenDuration time.Duration
+	// TOTPIssuer is the issuer label shown by authenticator apps; empty defaults to "Cloudflax".
+	TOTPIssuer string
+	// OAuthProviders enables social sign-in (authorization code + PKCE) for each configured OIDC provider.
+	OAuthProviders []OIDCProviderConfig
+	// SigningKeys switches access tokens to RS256/EdDSA with a kid header; HS256 tokens are then rejected.
+	SigningKeys *SigningKeySet
+	// RevocationStore denylists access tokens on logout, password change and user deletion; nil disables the check.
+	RevocationStore TokenRevocationStore
+	// AccountMembers scopes access tokens to the active account of the user; nil issues tokens without account claims.
+	AccountMembers AccountMemberLookup
+	// PasswordPolicy checks new passwords (register and reset) for strength and breaches; nil only applies the DTO length rules.
+	PasswordPolicy *validator.PasswordPolicy
+	// Issuer is the public base URL of this API (APP_URL); with OAuthClients it enables the OAuth 2.0 / OIDC provider.
+	Issuer string
+	// OAuthClients resolves the third-party clients registered by accounts; nil disables the OAuth provider endpoints.
+	OAuthClients OAuthClientLookup
+	// AccountInvitations lets users register from an invitation link; nil rejects every invitation token on register.
+	AccountInvitations AccountInvitationAcceptor
 }
 
 // En: Service handles the business logic of authentication.
 // Es: Service maneja la lógica de negocios de la autenticación.
 type Service struct {
-	repository           *Repository
-	userRepository       UserRepository
-	jwtSecret            []byte
-	verificationNotifier verificationnotify.Notifier
-	frontendURL          string
-	accessTokenDuration  time.Duration
+	repository                      *Repository
+	userRepository                  UserRepository
+	jwtSecret                       []byte
+	signingKeys                     *SigningKeySet
+	revocationStore                 TokenRevocationStore
+	accountMembers                  AccountMemberLookup
+	passwordPolicy                  *validator.PasswordPolicy
+	verificationNotifier            verificationnotify.Notifier
+	passwordResetNotifier           verificationnotify.PasswordResetNotifier
+	magicLinkNotifier               verificationnotify.MagicLinkNotifier
+	emailChangeNotifier             verificationnotify.EmailChangeNotifier
+	emailChangeConfirmationNotifier verificationnotify.EmailChangeConfirmationNotifier
+	frontendURL                     string
+	accessTokenDuration             time.Duration
+	oauthProviders                  map[ProviderType]*oidcProvider
+	totpIssuer                      string
+	issuer                          string
+	oauthClients                    OAuthClientLookup
+	accountInvitations              AccountInvitationAcceptor
 }
 
 // En: NewService creates a new authentication service.
@@ -77,24 +224,66 @@ func NewService(repository *Repository, userRepository UserRepository, opts Serv
 	if notifier == nil {
 		notifier = verificationnotify.NoopNotifier{}
 	}
+	resetNotifier := opts.PasswordResetNotifier
+	if resetNotifier == nil {
+		resetNotifier = verificationnotify.NoopNotifier{}
+	}
+	magicLinkNotifier := opts.MagicLinkNotifier
+	if magicLinkNotifier == nil {
+		magicLinkNotifier = verificationnotify.NoopNotifier{}
+	}
+	emailChangeNotifier := opts.EmailChangeNotifier
+	if emailChangeNotifier == nil {
+		emailChangeNotifier = verificationnotify.NoopNotifier{}
+	}
+	emailChangeConfirmationNotifier := opts.EmailChangeConfirmationNotifier
+	if emailChangeConfirmationNotifier == nil {
+		emailChangeConfirmationNotifier = verificationnotify.NoopNotifier{}
+	}
 	accessDur := opts.AccessTokenDuration
 	if accessDur <= 0 {
 		accessDur = defaultAccessTokenDuration
 	}
+	totpIssuer := strings.TrimSpace(opts.TOTPIssuer)
+	if totpIssuer == "" {
+		totpIssuer = defaultTOTPIssuer
+	}
+	oauthProviders := make(map[ProviderType]*oidcProvider, len(opts.OAuthProviders))
+	for _, providerConfig := range opts.OAuthProviders {
+		oauthProviders[providerConfig.Provider] = newOIDCProvider(providerConfig, nil)
+	}
 	return &Service{
-		repository:           repository,
-		userRepository:       userRepository,
-		jwtSecret:            []byte(opts.JWTSecret),
-		verificationNotifier: notifier,
-		frontendURL:          strings.TrimSuffix(strings.TrimSpace(opts.FrontendURL), "/"),
-		accessTokenDuration:  accessDur,
+		repository:                      repository,
+		userRepository:                  userRepository,
+		jwtSecret:                       []byte(opts.JWTSecret),
+		signingKeys:                     opts.SigningKeys,
+		revocationStore:                 opts.RevocationStore,
+		accountMembers:                  opts.AccountMembers,
+		passwordPolicy:                  opts.PasswordPolicy,
+		verificationNotifier:            notifier,
+		passwordResetNotifier:           resetNotifier,
+		magicLinkNotifier:               magicLinkNotifier,
+		emailChangeNotifier:             emailChangeNotifier,
+		emailChangeConfirmationNotifier: emailChangeConfirmationNotifier,
+		frontendURL:                     strings.TrimSuffix(strings.TrimSpace(opts.FrontendURL), "/"),
+		accessTokenDuration:             accessDur,
+		oauthProviders:                  oauthProviders,
+		totpIssuer:                      totpIssuer,
+		issuer:                          strings.TrimSuffix(strings.TrimSpace(opts.Issuer), "/"),
+		oauthClients:                    opts.OAuthClients,
+		accountInvitations:              opts.AccountInvitations,
 	}
 }
 
 // En: Register creates a new user with an email/password credential and a pending email verification token.
+// A password rejected by the password policy returns validator.ValidationErrors.
 // Es: Register crea un nuevo usuario con una credencial de correo electrónico/contraseña y un token de verificación de correo electrónico pendiente.
+// Una contraseña rechazada por la política de contraseñas devuelve validator.ValidationErrors.
 func (service *Service) Register(name, email, password string) (*user.User, string, error) {
 	normalizedEmail := strings.ToLower(strings.TrimSpace(email))
+	if err := service.checkPassword(password, normalizedEmail, name); err != nil {
+		return nil, "", err
+	}
 
 	token := uuid.New().String()
 	expiresAt := time.Now().Add(verificationTokenDuration)
@@ -121,20 +310,89 @@ func (service *Service) Register(name, email, password string) (*user.User, stri
 		return nil, "", fmt.Errorf("create auth provider: %w", err)
 	}
 
-	if err := service.sendVerificationEmail(context.Background(), u.Email, u.Name, token); err != nil {
+	code, err := service.issueVerificationCode(u.ID)
+	if err != nil {
+		slog.Error("issue verification code after register", "email", u.Email, "error", err)
+	}
+	if err := service.sendVerificationEmail(context.Background(), u.Email, u.Name, token, code); err != nil {
 		slog.Error("send verification email after register", "email", u.Email, "error", err)
 	}
 
 	return u, token, nil
 }
 
-// sendVerificationEmail enqueues verification delivery (async Lambda) with name and verification link.
-func (service *Service) sendVerificationEmail(ctx context.Context, toAddress, toName, token string) error {
+// En: RegisterWithInvitation creates a user from an account invitation link and adds them to the account.
+// The email must be the invited one (account.ErrInvitationEmailMismatch); since the token reached that mailbox the
+// email is verified at once and no verification email is sent. The user, its credentials provider and the membership
+// are stored in one transaction. Unusable tokens return account.ErrInvitationNotFound.
+// Es: RegisterWithInvitation crea un usuario desde el enlace de una invitación a una cuenta y lo añade a la cuenta.
+// El email debe ser el invitado (account.ErrInvitationEmailMismatch); como el token llegó a ese buzón el email
+// queda verificado al momento y no se envía correo de verificación. El usuario, su proveedor de credenciales y la
+// membresía se guardan en una sola transacción. Los tokens no válidos devuelven account.ErrInvitationNotFound.
+func (service *Service) RegisterWithInvitation(name, email, password, invitationToken string) (*user.User, *account.AccountMember, error) {
+	if service.accountInvitations == nil {
+		return nil, nil, account.ErrInvitationNotFound
+	}
+	normalizedEmail := strings.ToLower(strings.TrimSpace(email))
+	invitation, err := service.accountInvitations.GetPendingInvitation(invitationToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if invitation.Email != normalizedEmail {
+		return nil, nil, account.ErrInvitationEmailMismatch
+	}
+	if err := service.checkPassword(password, normalizedEmail, name); err != nil {
+		return nil, nil, err
+	}
+
+	verifiedAt := time.Now()
+	accountID := invitation.AccountID
+	u := &user.User{
+		Name:            name,
+		Email:           normalizedEmail,
+		EmailVerifiedAt: &verifiedAt,
+		ActiveAccountID: &accountID,
+	}
+	if err := u.SetPassword(password); err != nil {
+		return nil, nil, fmt.Errorf("hash password: %w", err)
+	}
+	provider := &UserAuthProvider{
+		Provider:          ProviderCredentials,
+		ProviderSubjectID: normalizedEmail,
+	}
+	member := &account.AccountMember{
+		AccountID: invitation.AccountID,
+		Role:      invitation.Role,
+	}
+	if err := service.repository.CreateInvitedUser(u, provider, invitation.ID, member); err != nil {
+		return nil, nil, err
+	}
+	return u, member, nil
+}
+
+// sendVerificationEmail enqueues verification delivery (async Lambda) with name, verification link and code.
+func (service *Service) sendVerificationEmail(ctx context.Context, toAddress, toName, token, code string) error {
 	if service.frontendURL == "" {
 		return fmt.Errorf("frontend URL is required to build verification link")
 	}
 	link := fmt.Sprintf("%s/auth/verify-email?token=%s", service.frontendURL, token)
-	return service.verificationNotifier.NotifyVerificationEmail(ctx, toAddress, toName, link)
+	return service.verificationNotifier.NotifyVerificationEmail(ctx, toAddress, toName, link, code)
+}
+
+// issueVerificationCode stores a new six-digit verification code for the user, replacing the previous one.
+func (service *Service) issueVerificationCode(userID string) (string, error) {
+	code, err := generateVerificationCode()
+	if err != nil {
+		return "", fmt.Errorf("generate verification code: %w", err)
+	}
+	if err := service.repository.ReplaceEmailVerificationCode(&EmailVerificationCode{
+		UserID:    userID,
+		CodeHash:  hashVerificationCode(userID, code),
+		ExpiresAt: time.Now().Add(verificationCodeDuration),
+	}); err != nil {
+		return "", err
+	}
+	return code, nil
 }
 
 // En: VerifyEmail marks the user's email as verified using the token previously issued during registration (or after a verification resend request).
@@ -149,12 +407,55 @@ func (service *Service) VerifyEmail(token string) error {
 		return ErrInvalidVerificationToken
 	}
 
+	return service.markEmailVerified(u)
+}
+
+// En: VerifyEmailCode marks the user's email as verified using the six-digit code sent with the verification link.
+// Each code allows a few wrong guesses; after that (or once expired) a new one must be requested through resend.
+// Es: VerifyEmailCode marca el correo del usuario como verificado usando el código de seis dígitos enviado junto al enlace.
+// Cada código admite pocos intentos fallidos; después (o al expirar) hay que pedir uno nuevo mediante el reenvío.
+func (service *Service) VerifyEmailCode(email, code string) error {
+	normalizedEmail := strings.ToLower(strings.TrimSpace(email))
+
+	u, err := service.userRepository.GetUserByEmail(normalizedEmail)
+	if err != nil {
+		return ErrInvalidVerificationCode
+	}
+	if u.IsEmailVerified() {
+		return ErrEmailAlreadyVerified
+	}
+
+	stored, err := service.repository.GetEmailVerificationCode(u.ID)
+	if err != nil {
+		return err
+	}
+	if stored.IsExpired() || stored.Attempts >= verificationCodeMaxAttempts {
+		return ErrInvalidVerificationCode
+	}
+	if err := service.repository.ClaimEmailVerificationCodeAttempt(stored.ID, verificationCodeMaxAttempts); err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(stored.CodeHash), []byte(hashVerificationCode(u.ID, strings.TrimSpace(code)))) != 1 {
+		return ErrInvalidVerificationCode
+	}
+
+	return service.markEmailVerified(u)
+}
+
+// markEmailVerified sets email_verified_at, clears the pending link token and drops the pending code.
+func (service *Service) markEmailVerified(u *user.User) error {
 	now := time.Now()
 	u.EmailVerifiedAt = &now
 	u.EmailVerificationToken = nil
 	u.EmailVerificationExpiresAt = nil
 
-	return service.userRepository.Update(u)
+	if err := service.userRepository.Update(u); err != nil {
+		return err
+	}
+	if err := service.repository.DeleteEmailVerificationCode(u.ID); err != nil {
+		slog.Error("delete email verification code", "user_id", u.ID, "error", err)
+	}
+	return nil
 }
 
 // En: ResendVerification generates a new email verification token for the given email.
@@ -179,7 +480,12 @@ func (service *Service) ResendVerification(email string) (string, error) {
 		return "", fmt.Errorf("update verification token: %w", err)
 	}
 
-	if err := service.sendVerificationEmail(context.Background(), u.Email, u.Name, token); err != nil {
+	code, err := service.issueVerificationCode(u.ID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := service.sendVerificationEmail(context.Background(), u.Email, u.Name, token, code); err != nil {
 		slog.Error("send verification email after resend", "email", u.Email, "error", err)
 		return "", fmt.Errorf("send verification email after resend: %w", err)
 	}
@@ -187,9 +493,171 @@ func (service *Service) ResendVerification(email string) (string, error) {
 	return token, nil
 }
 
+// En: ForgotPassword issues a single-use password reset token for the given email and sends the reset link.
+// Returns user.ErrNotFound when no user has that email so the handler can answer generically.
+// Es: ForgotPassword emite un token de restablecimiento de contraseña de un solo uso para el correo dado y envía el enlace.
+// Devuelve user.ErrNotFound cuando ningún usuario tiene ese correo para que el handler responda de forma genérica.
+func (service *Service) ForgotPassword(email string) (string, error) {
+	normalizedEmail := strings.ToLower(strings.TrimSpace(email))
+
+	u, err := service.userRepository.GetUserByEmail(normalizedEmail)
+	if err != nil {
+		return "", user.ErrNotFound
+	}
+
+	// Only the most recent link is valid.
+	if err := service.repository.InvalidatePasswordResetTokensByUserID(u.ID); err != nil {
+		return "", fmt.Errorf("invalidate previous reset tokens: %w", err)
+	}
+
+	rawToken, err := generateSecureToken()
+	if err != nil {
+		return "", fmt.Errorf("generate reset token: %w", err)
+	}
+	resetToken := &PasswordResetToken{
+		UserID:    u.ID,
+		TokenHash: hashToken(rawToken),
+		ExpiresAt: time.Now().Add(passwordResetTokenDuration),
+	}
+	if err := service.repository.CreatePasswordResetToken(resetToken); err != nil {
+		return "", fmt.Errorf("store reset token: %w", err)
+	}
+
+	// A delivery failure is only logged: answering differently than for an unknown email would reveal the account.
+	if err := service.sendPasswordResetEmail(context.Background(), u.Email, u.Name, rawToken); err != nil {
+		slog.Error("send password reset email", "user_id", u.ID, "error", err)
+	}
+
+	return rawToken, nil
+}
+
+// sendPasswordResetEmail enqueues delivery of the reset link built from the frontend URL.
+func (service *Service) sendPasswordResetEmail(ctx context.Context, toAddress, toName, token string) error {
+	if service.frontendURL == "" {
+		return fmt.Errorf("frontend URL is required to build password reset link")
+	}
+	link := fmt.Sprintf("%s/auth/reset-password?token=%s", service.frontendURL, token)
+	return service.passwordResetNotifier.NotifyPasswordReset(ctx, toAddress, toName, link)
+}
+
+// En: ResetPassword consumes a reset token, sets the new password and revokes every refresh token of the user.
+// A password rejected by the password policy returns validator.ValidationErrors and leaves the token unused.
+// Es: ResetPassword consume un token de restablecimiento, establece la nueva contraseña y revoca todos los refresh tokens del usuario.
+// Una contraseña rechazada por la política de contraseñas devuelve validator.ValidationErrors y no consume el token.
+func (service *Service) ResetPassword(rawToken, newPassword string) error {
+	stored, err := service.repository.GetPasswordResetTokenByHash(hashToken(strings.TrimSpace(rawToken)))
+	if err != nil {
+		return err
+	}
+	if stored.IsUsed() || stored.IsExpired() {
+		return ErrInvalidResetToken
+	}
+	u, err := service.userRepository.GetUser(stored.UserID)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	if err := service.checkPassword(newPassword, u.Email, u.Name); err != nil {
+		return err
+	}
+	if err := u.SetPassword(newPassword); err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	if err := service.repository.ApplyPasswordReset(stored.ID, u); err != nil {
+		return err
+	}
+
+	if err := service.RevokeAllByUserID(u.ID); err != nil {
+		return fmt.Errorf("revoke sessions after password reset: %w", err)
+	}
+	return nil
+}
+
+// En: RequestEmailChange stores a pending change of the user's email, sends a confirmation link to the new address
+// and warns the current one. The email itself only changes in ConfirmEmailChange.
+// Es: RequestEmailChange guarda un cambio pendiente del email del usuario, envía un enlace de confirmación a la nueva dirección
+// y avisa a la actual. El email solo cambia en ConfirmEmailChange.
+func (service *Service) RequestEmailChange(userID, newEmail string) (string, error) {
+	normalizedEmail := strings.ToLower(strings.TrimSpace(newEmail))
+
+	u, err := service.userRepository.GetUser(userID)
+	if err != nil {
+		return "", err
+	}
+	if normalizedEmail == u.Email {
+		return "", ErrEmailUnchanged
+	}
+	exists, err := service.userRepository.ExistsByEmail(normalizedEmail, u.ID)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", user.ErrDuplicateEmail
+	}
+
+	// Only the most recent request is valid.
+	if err := service.repository.InvalidateEmailChangeTokensByUserID(u.ID); err != nil {
+		return "", fmt.Errorf("invalidate previous email change tokens: %w", err)
+	}
+
+	rawToken, err := generateSecureToken()
+	if err != nil {
+		return "", fmt.Errorf("generate email change token: %w", err)
+	}
+	changeToken := &EmailChangeToken{
+		UserID:    u.ID,
+		NewEmail:  normalizedEmail,
+		TokenHash: hashToken(rawToken),
+		ExpiresAt: time.Now().Add(emailChangeTokenDuration),
+	}
+	if err := service.repository.CreateEmailChangeToken(changeToken); err != nil {
+		return "", fmt.Errorf("store email change token: %w", err)
+	}
+
+	if err := service.sendEmailChangeConfirmation(context.Background(), normalizedEmail, u.Name, rawToken); err != nil {
+		slog.Error("send email change confirmation", "user_id", u.ID, "error", err)
+		return "", fmt.Errorf("send email change confirmation: %w", err)
+	}
+	if err := service.emailChangeNotifier.NotifyEmailChangeRequested(context.Background(), u.Email, u.Name, normalizedEmail); err != nil {
+		slog.Error("notify current email of email change", "user_id", u.ID, "error", err)
+	}
+
+	return rawToken, nil
+}
+
+// sendEmailChangeConfirmation sends the confirmation link for a pending email change to the new address.
+func (service *Service) sendEmailChangeConfirmation(ctx context.Context, toAddress, toName, token string) error {
+	if service.frontendURL == "" {
+		return fmt.Errorf("frontend URL is required to build email change link")
+	}
+	link := fmt.Sprintf("%s/auth/confirm-email-change?token=%s", service.frontendURL, token)
+	return service.emailChangeConfirmationNotifier.NotifyEmailChangeConfirmation(ctx, toAddress, toName, link)
+}
+
+// En: ConfirmEmailChange consumes an email change token and swaps the user's email and credentials login to the new address.
+// Es: ConfirmEmailChange consume un token de cambio de email y cambia el email del usuario y su login con credenciales a la nueva dirección.
+func (service *Service) ConfirmEmailChange(rawToken string) error {
+	stored, err := service.repository.GetEmailChangeTokenByHash(hashToken(strings.TrimSpace(rawToken)))
+	if err != nil {
+		return err
+	}
+	if stored.IsUsed() || stored.IsExpired() {
+		return ErrInvalidEmailChangeToken
+	}
+
+	// The address may have been taken since the request.
+	exists, err := service.userRepository.ExistsByEmail(stored.NewEmail, stored.UserID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return user.ErrDuplicateEmail
+	}
+	return service.repository.ApplyEmailChange(stored)
+}
+
 // En: Login verifies the credentials and emits a token pair in case of success.
 // Es: Login verifica las credenciales y emite un par de tokens en caso de éxito.
-func (service *Service) Login(email, password string) (*TokenPair, error) {
+func (service *Service) Login(email, password string, meta SessionMetadata) (*TokenPair, error) {
 	normalizedEmail := strings.ToLower(strings.TrimSpace(email))
 	u, err := service.userRepository.GetUserByEmail(normalizedEmail)
 	if err != nil {
@@ -201,135 +669,1226 @@ func (service *Service) Login(email, password string) (*TokenPair, error) {
 	if !u.IsEmailVerified() {
 		return nil, ErrEmailNotVerified
 	}
-	return service.generateTokenPair(u)
+	service.rehashPassword(u, password)
+	return service.issueSession(u, meta)
 }
 
-// En: RefreshTokens validates an existing refresh token, revokes it (rotation) and emits a new token pair.
-// Es: RefreshTokens valida un token de actualización existente, lo revoca (rotación) y emite un nuevo par de tokens.
-func (service *Service) RefreshTokens(rawRefreshToken string) (*TokenPair, error) {
-	rawRefreshToken = strings.TrimSpace(rawRefreshToken)
-	if looksLikeJWT(rawRefreshToken) {
-		return nil, ErrJWTUsedAsRefreshToken
+// checkPassword applies the password policy, if any, to a new password of the user with that email and name.
+func (service *Service) checkPassword(password, email, name string) error {
+	if service.passwordPolicy == nil {
+		return nil
 	}
+	return service.passwordPolicy.Check(context.Background(), "password", password, validator.PasswordSubject{Email: email, Name: name})
+}
 
-	tokenHash := hashToken(rawRefreshToken)
-	stored, err := service.repository.GetByTokenHash(tokenHash)
-	if err != nil {
-		return nil, ErrInvalidCredentials
+// rehashPassword upgrades a hash made under an older password policy while the plain password is at hand.
+// Failures are only logged: the old hash still verifies and the upgrade is retried on the next login.
+func (service *Service) rehashPassword(u *user.User, password string) {
+	if !u.PasswordNeedsRehash() {
+		return
 	}
-	if stored.IsRevoked() || stored.IsExpired() {
-		return nil, ErrInvalidCredentials
+	previousHash := u.PasswordHash
+	if err := u.SetPassword(password); err != nil {
+		slog.Warn("rehash password", "user_id", u.ID, "error", err)
+		return
 	}
+	if err := service.userRepository.Update(u); err != nil {
+		u.PasswordHash = previousHash
+		slog.Warn("save rehashed password", "user_id", u.ID, "error", err)
+	}
+}
 
-	if err := service.repository.Revoke(stored.ID); err != nil {
-		return nil, fmt.Errorf("revoke old refresh token: %w", err)
+// En: RequestMagicLink issues a short-lived, single-use login token for the given email and sends the login link.
+// Returns user.ErrNotFound when no user has that email so the handler can answer generically.
+// Es: RequestMagicLink emite un token de login de un solo uso y corta duración para el correo dado y envía el enlace.
+// Devuelve user.ErrNotFound cuando ningún usuario tiene ese correo para que el handler responda de forma genérica.
+func (service *Service) RequestMagicLink(email string) (string, error) {
+	normalizedEmail := strings.ToLower(strings.TrimSpace(email))
+
+	u, err := service.userRepository.GetUserByEmail(normalizedEmail)
+	if err != nil {
+		return "", user.ErrNotFound
 	}
 
-	u, err := service.userRepository.GetUser(stored.UserID)
+	// Only the most recent link is valid.
+	if err := service.repository.InvalidateMagicLinkTokensByUserID(u.ID); err != nil {
+		return "", fmt.Errorf("invalidate previous magic link tokens: %w", err)
+	}
+
+	rawToken, err := generateSecureToken()
 	if err != nil {
-		return nil, ErrInvalidCredentials
+		return "", fmt.Errorf("generate magic link token: %w", err)
 	}
-	if !u.IsEmailVerified() {
-		return nil, ErrEmailNotVerified
+	magicLinkToken := &MagicLinkToken{
+		UserID:    u.ID,
+		TokenHash: hashToken(rawToken),
+		ExpiresAt: time.Now().Add(magicLinkTokenDuration),
 	}
-	return service.generateTokenPair(u)
+	if err := service.repository.CreateMagicLinkToken(magicLinkToken); err != nil {
+		return "", fmt.Errorf("store magic link token: %w", err)
+	}
+
+	// A delivery failure is only logged: answering differently than for an unknown email would reveal the account.
+	if err := service.sendMagicLinkEmail(context.Background(), u.Email, u.Name, rawToken); err != nil {
+		slog.Error("send magic link email", "user_id", u.ID, "error", err)
+	}
+
+	return rawToken, nil
 }
 
-// En: Logout revokes all active refresh tokens for the given user.
-// Es: Logout revoca todos los tokens de actualización activos para el usuario dado.
-func (service *Service) Logout(userID string) error {
-	return service.repository.RevokeAllByUserID(userID)
+// sendMagicLinkEmail enqueues delivery of the login link built from the frontend URL.
+func (service *Service) sendMagicLinkEmail(ctx context.Context, toAddress, toName, token string) error {
+	if service.frontendURL == "" {
+		return fmt.Errorf("frontend URL is required to build magic link")
+	}
+	link := fmt.Sprintf("%s/auth/magic-link?token=%s", service.frontendURL, token)
+	return service.magicLinkNotifier.NotifyMagicLink(ctx, toAddress, toName, link)
 }
 
-// En: ValidateAccessToken validates and analyzes a JWT access token.
-// Es: ValidateAccessToken analiza y valida un token de acceso JWT.
-func (service *Service) ValidateAccessToken(tokenString string) (string, string, error) {
-	claims, err := service.parseAccessToken(tokenString)
+// En: VerifyMagicLink consumes a magic link token and logs the user in. Receiving the link proves ownership of the
+// address, so an unverified email is marked verified on first use. Users with 2FA still get an *MFARequiredError.
+// Es: VerifyMagicLink consume un token de magic link e inicia la sesión del usuario. Recibir el enlace prueba la propiedad
+// de la dirección, así que un email sin verificar queda verificado en el primer uso. Los usuarios con 2FA siguen recibiendo un *MFARequiredError.
+func (service *Service) VerifyMagicLink(rawToken string, meta SessionMetadata) (*TokenPair, error) {
+	stored, err := service.repository.GetMagicLinkTokenByHash(hashToken(strings.TrimSpace(rawToken)))
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+	if stored.IsUsed() || stored.IsExpired() {
+		return nil, ErrInvalidMagicLinkToken
+	}
+	if err := service.repository.MarkMagicLinkTokenUsed(stored.ID); err != nil {
+		return nil, err
 	}
-	return claims.UserID, claims.Email, nil
-}
 
-// En: parseAccessToken analyzes the JWT and returns the complete Claims struct.
-// Es: parseAccessToken analiza el JWT y devuelve el struct Claims completo.
-func (service *Service) parseAccessToken(tokenString string) (*Claims, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	u, err := service.userRepository.GetUser(stored.UserID)
+	if err != nil {
+		return nil, ErrInvalidMagicLinkToken
+	}
+	if !u.IsEmailVerified() {
+		if err := service.markEmailVerified(u); err != nil {
+			return nil, fmt.Errorf("mark email verified: %w", err)
 		}
-		return service.jwtSecret, nil
-	})
-	if err != nil || !token.Valid {
-		return nil, fmt.Errorf("invalid token: %w", err)
 	}
-	return claims, nil
+	return service.issueSession(u, meta)
 }
 
-// En: generateTokenPair creates and stores a new access token and refresh token pair for the given user.
-// Es: generateTokenPair crea y almacena un nuevo par de tokens de acceso y actualización para el usuario dado.
-func (service *Service) generateTokenPair(u *user.User) (*TokenPair, error) {
-	expiresAt := time.Now().Add(service.accessTokenDuration)
-	accessToken, err := service.signAccessToken(u, expiresAt)
+// En: StartDeviceAuthorization begins an RFC 8628 device grant for clientID (a label such as "cloudflax-cli" shown as
+// the session device name) and returns the device and user codes with the frontend verification URL.
+// Es: StartDeviceAuthorization inicia una concesión de dispositivo RFC 8628 para clientID (una etiqueta como "cloudflax-cli"
+// que se muestra como nombre de dispositivo de la sesión) y devuelve los códigos de dispositivo y de usuario con la URL de verificación del frontend.
+func (service *Service) StartDeviceAuthorization(clientID string) (*DeviceAuthorizationGrant, error) {
+	if service.frontendURL == "" {
+		return nil, fmt.Errorf("frontend URL is required to build the device verification link")
+	}
+	deviceCode, err := generateSecureToken()
 	if err != nil {
-		return nil, fmt.Errorf("sign access token: %w", err)
+		return nil, fmt.Errorf("generate device code: %w", err)
 	}
-
-	rawRefresh, err := generateSecureToken()
+	userCode, err := generateUserCode()
 	if err != nil {
-		return nil, fmt.Errorf("generate refresh token: %w", err)
+		return nil, fmt.Errorf("generate user code: %w", err)
 	}
 
-	refreshRecord := &RefreshToken{
-		UserID:    u.ID,
-		TokenHash: hashToken(rawRefresh),
-		ExpiresAt: time.Now().Add(refreshTokenDuration),
+	authorization := &DeviceAuthorization{
+		DeviceCodeHash:  hashToken(deviceCode),
+		UserCodeHash:    hashToken(normalizeUserCode(userCode)),
+		ClientID:        strings.TrimSpace(clientID),
+		IntervalSeconds: deviceAuthorizationInterval,
+		ExpiresAt:       time.Now().Add(deviceAuthorizationDuration),
 	}
-	if err := service.repository.Create(refreshRecord); err != nil {
-		return nil, fmt.Errorf("store refresh token: %w", err)
+	if err := service.repository.CreateDeviceAuthorization(authorization); err != nil {
+		return nil, err
 	}
 
-	return &TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: rawRefresh,
-		ExpiresAt:    expiresAt,
+	verificationURI := service.frontendURL + "/device"
+	return &DeviceAuthorizationGrant{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + userCode,
+		ExpiresIn:               int(deviceAuthorizationDuration / time.Second),
+		Interval:                deviceAuthorizationInterval,
 	}, nil
 }
 
-// En: signAccessToken builds and signs a JWT for the given user.
-// Es: signAccessToken construye y firma un JWT para el usuario dado.
-func (service *Service) signAccessToken(u *user.User, expiresAt time.Time) (string, error) {
-	claims := &Claims{
-		UserID: u.ID,
-		Email:  u.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expiresAt),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   u.ID,
-		},
+// En: ApproveDeviceAuthorization lets the authenticated user grant the device that shows userCode; its next poll gets a TokenPair.
+// Es: ApproveDeviceAuthorization permite al usuario autenticado autorizar el dispositivo que muestra userCode; su siguiente consulta recibe un TokenPair.
+func (service *Service) ApproveDeviceAuthorization(userID, userCode string) error {
+	return service.decideDeviceAuthorization(userID, userCode, true)
+}
+
+// En: DenyDeviceAuthorization rejects the device that shows userCode; its next poll gets access_denied.
+// Es: DenyDeviceAuthorization rechaza el dispositivo que muestra userCode; su siguiente consulta recibe access_denied.
+func (service *Service) DenyDeviceAuthorization(userID, userCode string) error {
+	return service.decideDeviceAuthorization(userID, userCode, false)
+}
+
+// decideDeviceAuthorization records the user's decision on the pending request matching userCode.
+func (service *Service) decideDeviceAuthorization(userID, userCode string, approved bool) error {
+	normalized := normalizeUserCode(userCode)
+	if normalized == "" {
+		return ErrInvalidUserCode
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(service.jwtSecret)
+	authorization, err := service.repository.GetPendingDeviceAuthorizationByUserCodeHash(hashToken(normalized))
+	if err != nil {
+		return err
+	}
+	return service.repository.DecideDeviceAuthorization(authorization.ID, userID, approved)
 }
 
-// En: generateSecureToken creates a cryptographically random hex-encoded token.
-// Es: generateSecureToken crea un token hex-codificado de forma criptográficamente aleatoria.
-func generateSecureToken() (string, error) {
-	bytes := make([]byte, refreshTokenBytes)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
+// En: PollDeviceAuthorization answers a device token poll: ErrDeviceAuthorizationPending until the user decides,
+// ErrDeviceSlowDown when polled faster than the interval, ErrDeviceAccessDenied or ErrDeviceCodeExpired as final
+// answers, and once approved a TokenPair for a new session, issued only once.
+// Es: PollDeviceAuthorization responde a una consulta de token del dispositivo: ErrDeviceAuthorizationPending hasta que el
+// usuario decide, ErrDeviceSlowDown si consulta más rápido que el intervalo, ErrDeviceAccessDenied o ErrDeviceCodeExpired como
+// respuestas finales y, una vez aprobado, un TokenPair para una nueva sesión, emitido una sola vez.
+func (service *Service) PollDeviceAuthorization(deviceCode string, meta SessionMetadata) (*TokenPair, error) {
+	authorization, err := service.repository.GetDeviceAuthorizationByDeviceCodeHash(hashToken(strings.TrimSpace(deviceCode)))
+	if err != nil {
+		return nil, err
 	}
-	return hex.EncodeToString(bytes), nil
+	switch {
+	case authorization.ConsumedAt != nil:
+		return nil, ErrInvalidDeviceCode
+	case authorization.DeniedAt != nil:
+		return nil, ErrDeviceAccessDenied
+	case authorization.IsExpired():
+		return nil, ErrDeviceCodeExpired
+	}
+
+	now := time.Now()
+	interval := authorization.IntervalSeconds
+	tooFast := authorization.LastPolledAt != nil && now.Sub(*authorization.LastPolledAt) < time.Duration(interval)*time.Second
+	if tooFast {
+		interval += deviceSlowDownStep
+	}
+	if err := service.repository.RecordDeviceAuthorizationPoll(authorization.ID, now, interval); err != nil {
+		return nil, err
+	}
+	if tooFast {
+		return nil, ErrDeviceSlowDown
+	}
+	if authorization.ApprovedAt == nil || authorization.UserID == nil {
+		return nil, ErrDeviceAuthorizationPending
+	}
+
+	if err := service.repository.ConsumeDeviceAuthorization(authorization.ID); err != nil {
+		return nil, err
+	}
+	u, err := service.userRepository.GetUser(*authorization.UserID)
+	if err != nil {
+		return nil, ErrInvalidDeviceCode
+	}
+	if meta.DeviceName == "" {
+		meta.DeviceName = authorization.ClientID
+	}
+	// The user approved from an authenticated session, which already passed any second factor.
+	return service.generateTokenPair(u, meta)
 }
 
-// En: hashToken returns the SHA-256 hex hash of a raw token string.
-// Es: hashToken devuelve el hash SHA-256 hex de una cadena de token sin procesar.
+// En: StartOAuth begins a social sign-in: it stores state, nonce and PKCE verifier and returns the provider authorization URL.
+// Es: StartOAuth inicia un inicio de sesión social: guarda state, nonce y verificador PKCE y devuelve la URL de autorización del proveedor.
+func (service *Service) StartOAuth(ctx context.Context, provider ProviderType) (string, error) {
+	return service.startOAuth(ctx, provider, nil)
+}
+
+// En: StartOAuthLink begins linking a provider identity to an already authenticated user; the state is bound to that user.
+// Es: StartOAuthLink inicia el enlace de una identidad de proveedor a un usuario ya autenticado; el state queda ligado a ese usuario.
+func (service *Service) StartOAuthLink(ctx context.Context, userID string, provider ProviderType) (string, error) {
+	return service.startOAuth(ctx, provider, &userID)
+}
+
+// startOAuth stores a new OAuth state (optionally bound to a user for linking) and builds the authorization URL.
+func (service *Service) startOAuth(ctx context.Context, provider ProviderType, userID *string) (string, error) {
+	oidc, ok := service.oauthProviders[provider]
+	if !ok {
+		return "", ErrOAuthProviderNotConfigured
+	}
+
+	state, err := generateSecureToken()
+	if err != nil {
+		return "", fmt.Errorf("generate oauth state: %w", err)
+	}
+	nonce, err := generateSecureToken()
+	if err != nil {
+		return "", fmt.Errorf("generate oauth nonce: %w", err)
+	}
+	verifier, err := generatePKCEVerifier()
+	if err != nil {
+		return "", fmt.Errorf("generate pkce verifier: %w", err)
+	}
+
+	authorizationURL, err := oidc.authorizationURL(ctx, state, nonce, pkceChallengeS256(verifier))
+	if err != nil {
+		return "", fmt.Errorf("build authorization url: %w", err)
+	}
+
+	record := &OAuthState{
+		StateHash:    hashToken(state),
+		Provider:     provider,
+		UserID:       userID,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oauthStateDuration),
+	}
+	if err := service.repository.CreateOAuthState(record); err != nil {
+		return "", err
+	}
+	return authorizationURL, nil
+}
+
+// En: CompleteOAuth consumes the state, exchanges the code, verifies the ID token and issues a token pair for the resolved user.
+// Es: CompleteOAuth consume el state, intercambia el código, verifica el ID token y emite un par de tokens para el usuario resuelto.
+func (service *Service) CompleteOAuth(ctx context.Context, provider ProviderType, code, state string, meta SessionMetadata) (*TokenPair, error) {
+	stored, identity, err := service.completeOAuth(ctx, provider, code, state)
+	if err != nil {
+		return nil, err
+	}
+	if stored.UserID != nil {
+		// Link states are only redeemable by the user who started them.
+		return nil, ErrInvalidOAuthState
+	}
+
+	u, err := service.resolveOAuthUser(provider, identity)
+	if err != nil {
+		return nil, err
+	}
+	return service.issueSession(u, meta)
+}
+
+// En: CompleteOAuthLink finishes a link flow and attaches the verified provider identity to the authenticated user.
+// Es: CompleteOAuthLink finaliza un flujo de enlace y asocia la identidad verificada del proveedor al usuario autenticado.
+func (service *Service) CompleteOAuthLink(ctx context.Context, userID string, provider ProviderType, code, state string) (*UserAuthProvider, error) {
+	stored, identity, err := service.completeOAuth(ctx, provider, code, state)
+	if err != nil {
+		return nil, err
+	}
+	if stored.UserID == nil || *stored.UserID != userID {
+		return nil, ErrInvalidOAuthState
+	}
+
+	existing, err := service.repository.FindByProviderAndSubject(provider, identity.Subject)
+	if err == nil {
+		if existing.UserID == userID {
+			return existing, nil
+		}
+		return nil, ErrAuthProviderAlreadyLinked
+	}
+	if !errors.Is(err, ErrAuthProviderNotFound) {
+		return nil, err
+	}
+
+	providers, err := service.repository.ListAuthProvidersByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range providers {
+		if p.Provider == provider {
+			return nil, ErrAuthProviderAlreadyLinked
+		}
+	}
+
+	link := &UserAuthProvider{
+		UserID:            userID,
+		Provider:          provider,
+		ProviderSubjectID: identity.Subject,
+	}
+	if err := service.repository.CreateAuthProvider(link); err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// completeOAuth consumes the state and returns it together with the identity verified by the provider.
+func (service *Service) completeOAuth(ctx context.Context, provider ProviderType, code, state string) (*OAuthState, *oidcIdentity, error) {
+	oidc, ok := service.oauthProviders[provider]
+	if !ok {
+		return nil, nil, ErrOAuthProviderNotConfigured
+	}
+
+	stored, err := service.repository.ConsumeOAuthState(hashToken(strings.TrimSpace(state)))
+	if err != nil {
+		return nil, nil, err
+	}
+	if stored.Provider != provider || stored.IsExpired() {
+		return nil, nil, ErrInvalidOAuthState
+	}
+
+	rawIDToken, err := oidc.exchangeCode(ctx, code, stored.CodeVerifier)
+	if err != nil {
+		slog.Warn("oauth code exchange", "provider", provider, "error", err)
+		return nil, nil, ErrOAuthFailed
+	}
+	identity, err := oidc.verifyIDToken(ctx, rawIDToken, stored.Nonce)
+	if err != nil {
+		slog.Warn("oauth id token verification", "provider", provider, "error", err)
+		return nil, nil, ErrOAuthFailed
+	}
+	return stored, identity, nil
+}
+
+// En: ListAuthProviders returns the login methods linked to the user.
+// Es: ListAuthProviders devuelve los métodos de inicio de sesión enlazados al usuario.
+func (service *Service) ListAuthProviders(userID string) ([]UserAuthProvider, error) {
+	return service.repository.ListAuthProvidersByUserID(userID)
+}
+
+// En: UnlinkAuthProvider removes one of the user's login methods; the last remaining one cannot be removed.
+// Removing the credentials provider also clears the password so it can no longer be used to log in.
+// Es: UnlinkAuthProvider elimina uno de los métodos de inicio de sesión del usuario; el último no puede eliminarse.
+// Eliminar el proveedor de credenciales también borra la contraseña para que ya no sirva para iniciar sesión.
+func (service *Service) UnlinkAuthProvider(userID, providerID string) error {
+	u, err := service.userRepository.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	providers, err := service.repository.ListAuthProvidersByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	var target *UserAuthProvider
+	usable := 0
+	for i := range providers {
+		if providers[i].ID == providerID {
+			target = &providers[i]
+		}
+		if providers[i].Provider != ProviderCredentials || u.PasswordHash != "" {
+			usable++
+		}
+	}
+	if target == nil {
+		return ErrAuthProviderNotFound
+	}
+	targetUsable := target.Provider != ProviderCredentials || u.PasswordHash != ""
+	if targetUsable && usable <= 1 {
+		return ErrLastLoginMethod
+	}
+
+	if err := service.repository.DeleteAuthProvider(userID, target.ID); err != nil {
+		return err
+	}
+	if target.Provider == ProviderCredentials && u.PasswordHash != "" {
+		u.PasswordHash = ""
+		if err := service.userRepository.Update(u); err != nil {
+			return fmt.Errorf("clear password: %w", err)
+		}
+	}
+	return nil
+}
+
+// resolveOAuthUser returns the user linked to the provider subject. Without a link, the provider
+// identity is attached to the user owning the same (provider-verified) email, or a new verified user is created.
+func (service *Service) resolveOAuthUser(provider ProviderType, identity *oidcIdentity) (*user.User, error) {
+	link, err := service.repository.FindByProviderAndSubject(provider, identity.Subject)
+	if err == nil {
+		return service.userRepository.GetUser(link.UserID)
+	}
+	if !errors.Is(err, ErrAuthProviderNotFound) {
+		return nil, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	now := time.Now()
+	u, err := service.userRepository.GetUserByEmail(identity.Email)
+	switch {
+	case err == nil:
+		if !u.IsEmailVerified() {
+			// The address was never proven by whoever registered it; drop that password so only
+			// the provider-verified owner can sign in.
+			u.PasswordHash = ""
+			u.EmailVerifiedAt = &now
+			u.EmailVerificationToken = nil
+			u.EmailVerificationExpiresAt = nil
+			if err := service.userRepository.Update(u); err != nil {
+				return nil, fmt.Errorf("verify user from oauth: %w", err)
+			}
+		}
+	case errors.Is(err, user.ErrNotFound):
+		name := identity.Name
+		if name == "" {
+			name = strings.Split(identity.Email, "@")[0]
+		}
+		u = &user.User{
+			Name:            name,
+			Email:           identity.Email,
+			EmailVerifiedAt: &now,
+		}
+		if err := service.userRepository.Create(u); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if err := service.repository.CreateAuthProvider(&UserAuthProvider{
+		UserID:            u.ID,
+		Provider:          provider,
+		ProviderSubjectID: identity.Subject,
+	}); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// issueSession emits a token pair after the first factor, or an *MFARequiredError carrying a
+// challenge token when the user has confirmed 2FA.
+func (service *Service) issueSession(u *user.User, meta SessionMetadata) (*TokenPair, error) {
+	credential, err := service.repository.GetTOTPCredential(u.ID)
+	if err != nil && !errors.Is(err, ErrTwoFactorNotEnabled) {
+		return nil, err
+	}
+	if credential == nil || !credential.IsConfirmed() {
+		return service.generateTokenPair(u, meta)
+	}
+
+	rawToken, err := generateSecureToken()
+	if err != nil {
+		return nil, fmt.Errorf("generate mfa token: %w", err)
+	}
+	challenge := &MFAChallenge{
+		UserID:    u.ID,
+		TokenHash: hashToken(rawToken),
+		ExpiresAt: time.Now().Add(mfaChallengeDuration),
+	}
+	if err := service.repository.CreateMFAChallenge(challenge); err != nil {
+		return nil, err
+	}
+	return nil, &MFARequiredError{MFAToken: rawToken, ExpiresAt: challenge.ExpiresAt}
+}
+
+// En: VerifyMFA completes a two-step login with a TOTP or recovery code and emits the token pair.
+// Es: VerifyMFA completa un login en dos pasos con un código TOTP o de recuperación y emite el par de tokens.
+func (service *Service) VerifyMFA(rawToken, code string, meta SessionMetadata) (*TokenPair, error) {
+	challenge, err := service.repository.GetMFAChallengeByHash(hashToken(strings.TrimSpace(rawToken)))
+	if err != nil {
+		return nil, err
+	}
+	if challenge.IsUsed() || challenge.IsExpired() || challenge.Attempts >= mfaChallengeMaxAttempts {
+		return nil, ErrInvalidMFAToken
+	}
+	if err := service.repository.ClaimMFAChallengeAttempt(challenge.ID, mfaChallengeMaxAttempts); err != nil {
+		return nil, err
+	}
+
+	if err := service.verifySecondFactor(challenge.UserID, code); err != nil {
+		return nil, err
+	}
+	if err := service.repository.MarkMFAChallengeUsed(challenge.ID); err != nil {
+		return nil, err
+	}
+
+	u, err := service.userRepository.GetUser(challenge.UserID)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+	return service.generateTokenPair(u, meta)
+}
+
+// En: MFAChallengeEmail returns the email of the user a pending MFA challenge belongs to, so the login throttle
+// can count second-factor failures per user instead of per challenge.
+// Es: MFAChallengeEmail devuelve el email del usuario al que pertenece un desafío MFA pendiente, para que el throttle
+// de login cuente los fallos del segundo factor por usuario y no por desafío.
+func (service *Service) MFAChallengeEmail(rawToken string) (string, error) {
+	challenge, err := service.repository.GetMFAChallengeByHash(hashToken(strings.TrimSpace(rawToken)))
+	if err != nil {
+		return "", err
+	}
+	if challenge.IsUsed() || challenge.IsExpired() {
+		return "", ErrInvalidMFAToken
+	}
+	u, err := service.userRepository.GetUser(challenge.UserID)
+	if err != nil {
+		return "", ErrInvalidMFAToken
+	}
+	return u.Email, nil
+}
+
+// En: EnrollTwoFactor creates a pending TOTP secret for the user and returns it with its otpauth URI.
+// Es: EnrollTwoFactor crea un secreto TOTP pendiente para el usuario y lo devuelve con su URI otpauth.
+func (service *Service) EnrollTwoFactor(userID string) (*TwoFactorEnrollment, error) {
+	u, err := service.userRepository.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := service.repository.GetTOTPCredential(userID)
+	if err != nil && !errors.Is(err, ErrTwoFactorNotEnabled) {
+		return nil, err
+	}
+	if existing != nil && existing.IsConfirmed() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("generate totp secret: %w", err)
+	}
+	if err := service.repository.ReplacePendingTOTPCredential(&TOTPCredential{UserID: userID, Secret: secret}); err != nil {
+		return nil, err
+	}
+	return &TwoFactorEnrollment{
+		Secret:     secret,
+		OTPAuthURI: totpProvisioningURI(service.totpIssuer, u.Email, secret),
+	}, nil
+}
+
+// En: ConfirmTwoFactor enables 2FA with a first valid code and returns the one-time recovery codes (shown only once).
+// Es: ConfirmTwoFactor activa el 2FA con un primer código válido y devuelve los códigos de recuperación (se muestran una sola vez).
+func (service *Service) ConfirmTwoFactor(userID, code string) ([]string, error) {
+	credential, err := service.repository.GetTOTPCredential(userID)
+	if err != nil {
+		return nil, err
+	}
+	if credential.IsConfirmed() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	step, ok := verifyTOTP(credential.Secret, code, time.Now(), credential.LastUsedStep)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	rawCodes := make([]string, recoveryCodeCount)
+	records := make([]RecoveryCode, recoveryCodeCount)
+	for i := range rawCodes {
+		raw, err := generateRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("generate recovery code: %w", err)
+		}
+		rawCodes[i] = raw
+		records[i] = RecoveryCode{UserID: userID, CodeHash: hashToken(normalizeRecoveryCode(raw))}
+	}
+	if err := service.repository.ConfirmTOTPCredential(credential.ID, step, records); err != nil {
+		return nil, err
+	}
+	return rawCodes, nil
+}
+
+// En: DisableTwoFactor turns 2FA off after re-authenticating with the password (when the user has one) and a second-factor code.
+// Es: DisableTwoFactor desactiva el 2FA tras reautenticar con la contraseña (si el usuario tiene una) y un código de segundo factor.
+func (service *Service) DisableTwoFactor(userID, password, code string) error {
+	u, err := service.userRepository.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if u.PasswordHash != "" && !u.CheckPassword(password) {
+		return ErrInvalidCredentials
+	}
+	if err := service.verifySecondFactor(userID, code); err != nil {
+		return err
+	}
+	return service.repository.DeleteTwoFactor(userID)
+}
+
+// verifySecondFactor accepts a current TOTP code (not replayed) or an unused recovery code of the user.
+func (service *Service) verifySecondFactor(userID, code string) error {
+	credential, err := service.repository.GetTOTPCredential(userID)
+	if err != nil {
+		return err
+	}
+	if !credential.IsConfirmed() {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		step, ok := verifyTOTP(credential.Secret, code, time.Now(), credential.LastUsedStep)
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		return service.repository.AdvanceTOTPStep(credential.ID, step)
+	}
+	return service.repository.ConsumeRecoveryCode(userID, hashToken(normalizeRecoveryCode(code)))
+}
+
+// En: Reauthenticate confirms the identity of a signed-in user with their password or, when no password is given, a
+// TOTP or recovery code, and issues an elevated access token for the same session whose auth_time is now. It returns
+// ErrInvalidCredentials for a wrong password (or a user without one), ErrInvalidTwoFactorCode or ErrTwoFactorNotEnabled
+// for the code, and ErrSessionNotFound when the session already ended.
+// Es: Reauthenticate confirma la identidad de un usuario con sesión iniciada con su contraseña o, si no la envía, un
+// código TOTP o de recuperación, y emite un token de acceso elevado para la misma sesión cuyo auth_time es ahora.
+// Devuelve ErrInvalidCredentials si la contraseña es incorrecta (o el usuario no tiene), ErrInvalidTwoFactorCode o
+// ErrTwoFactorNotEnabled para el código, y ErrSessionNotFound cuando la sesión ya terminó.
+func (service *Service) Reauthenticate(userID, sessionID, password, code string) (*ElevatedToken, error) {
+	u, err := service.userRepository.GetUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("lookup user: %w", err)
+	}
+	if sessionID != "" {
+		if _, err := service.repository.GetActiveSession(userID, sessionID); err != nil {
+			return nil, err
+		}
+	}
+	if password != "" {
+		if u.PasswordHash == "" || !u.CheckPassword(password) {
+			return nil, ErrInvalidCredentials
+		}
+	} else if err := service.verifySecondFactor(userID, code); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(min(service.accessTokenDuration, RecentAuthMaxAge))
+	accessToken, err := service.signAccessToken(u, sessionID, now, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("sign elevated token: %w", err)
+	}
+	return &ElevatedToken{AccessToken: accessToken, ExpiresAt: expiresAt, AuthTime: now}, nil
+}
+
+// En: RefreshTokens validates an existing refresh token, revokes it (rotation), emits a new token pair and records the session use.
+// Es: RefreshTokens valida un token de actualización existente, lo revoca (rotación), emite un nuevo par de tokens y registra el uso de la sesión.
+func (service *Service) RefreshTokens(rawRefreshToken string, meta SessionMetadata) (*TokenPair, error) {
+	rawRefreshToken = strings.TrimSpace(rawRefreshToken)
+	if looksLikeJWT(rawRefreshToken) {
+		return nil, ErrJWTUsedAsRefreshToken
+	}
+
+	tokenHash := hashToken(rawRefreshToken)
+	stored, err := service.repository.GetByTokenHash(tokenHash)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if stored.IsRotated() {
+		return nil, service.handleRefreshTokenReuse(stored)
+	}
+	if stored.IsRevoked() || stored.IsExpired() {
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := service.repository.Rotate(stored.ID); err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			return nil, service.handleRefreshTokenReuse(stored)
+		}
+		return nil, fmt.Errorf("revoke old refresh token: %w", err)
+	}
+
+	u, err := service.userRepository.GetUser(stored.UserID)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if !u.IsEmailVerified() {
+		return nil, ErrEmailNotVerified
+	}
+	authTime, err := service.sessionAuthTime(u.ID, stored.Family())
+	if err != nil {
+		return nil, err
+	}
+	pair, err := service.issueTokenPair(u, stored.Family(), authTime)
+	if err != nil {
+		return nil, err
+	}
+	if err := service.repository.TouchSession(stored.Family(), meta.IPAddress, time.Now().Add(refreshTokenDuration)); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// sessionAuthTime returns when the user logged in to the session, or zero for refresh tokens issued before sessions existed.
+func (service *Service) sessionAuthTime(userID, sessionID string) (time.Time, error) {
+	session, err := service.repository.GetActiveSession(userID, sessionID)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return session.CreatedAt, nil
+}
+
+// handleRefreshTokenReuse revokes the whole family of a replayed refresh token and logs the security event.
+// Either the legitimate client or an attacker holds a stolen token; ending the session stops both.
+func (service *Service) handleRefreshTokenReuse(stored *RefreshToken) error {
+	slog.Warn("security event: refresh token reuse detected, revoking token family",
+		"event", "refresh_token_reuse",
+		"user_id", stored.UserID,
+		"family_id", stored.Family(),
+		"token_id", stored.ID,
+	)
+	if err := service.repository.RevokeFamily(stored.Family()); err != nil {
+		return fmt.Errorf("revoke refresh token family: %w", err)
+	}
+	if err := service.revokeSessionAccessTokens(stored.Family()); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidCredentials, ErrRefreshTokenReused)
+}
+
+// En: Logout revokes all active refresh tokens and sessions for the given user, and the access tokens issued for them.
+// Grants to third-party OAuth clients are kept; RevokeAllByUserID also ends those.
+// Es: Logout revoca todos los tokens de actualización y sesiones activos para el usuario dado, y los tokens de acceso emitidos para ellos.
+// Las concesiones a clientes OAuth de terceros se conservan; RevokeAllByUserID también las cierra.
+func (service *Service) Logout(userID string) error {
+	sessions, err := service.repository.ListActiveSessionsByUserID(userID)
+	if err != nil {
+		return err
+	}
+	if err := service.repository.RevokeSessionsByUserID(userID); err != nil {
+		return err
+	}
+	sessionIDs := make([]string, len(sessions))
+	for i, session := range sessions {
+		sessionIDs[i] = session.ID
+	}
+	return service.revokeSessionAccessTokens(sessionIDs...)
+}
+
+// En: RevokeAllByUserID ends every session of the user and every grant to third-party OAuth clients, and denylists
+// their access tokens (logout with scope "all", password change and user deletion).
+// Es: RevokeAllByUserID cierra todas las sesiones del usuario y todas las concesiones a clientes OAuth de terceros, y agrega
+// sus tokens de acceso a la lista de denegación (logout con scope "all", cambio de contraseña y eliminación de usuario).
+func (service *Service) RevokeAllByUserID(userID string) error {
+	sessions, err := service.repository.ListActiveSessionsByUserID(userID)
+	if err != nil {
+		return err
+	}
+	grantIDs, err := service.repository.ListActiveOAuthGrantIDsByUserID(userID)
+	if err != nil {
+		return err
+	}
+	if err := service.repository.RevokeAllByUserID(userID); err != nil {
+		return err
+	}
+	sessionIDs := make([]string, len(sessions), len(sessions)+len(grantIDs))
+	for i, session := range sessions {
+		sessionIDs[i] = session.ID
+	}
+	// Client access tokens carry the grant id as "sid", so they are denylisted like a session.
+	return service.revokeSessionAccessTokens(append(sessionIDs, grantIDs...)...)
+}
+
+// En: RevokeAccessToken denylists one access token by its jti until it expires.
+// Es: RevokeAccessToken agrega un token de acceso a la lista de denegación por su jti hasta que expire.
+func (service *Service) RevokeAccessToken(tokenID string, expiresAt time.Time) error {
+	if service.revocationStore == nil || tokenID == "" || !expiresAt.After(time.Now()) {
+		return nil
+	}
+	if err := service.revocationStore.Revoke(context.Background(), revokedTokenKey(tokenID), expiresAt); err != nil {
+		return fmt.Errorf("revoke access token: %w", err)
+	}
+	return nil
+}
+
+// revokeSessionAccessTokens denylists the access tokens of the sessions for the longest time one can still be valid.
+func (service *Service) revokeSessionAccessTokens(sessionIDs ...string) error {
+	if service.revocationStore == nil {
+		return nil
+	}
+	expiresAt := time.Now().Add(service.accessTokenDuration)
+	for _, sessionID := range sessionIDs {
+		if err := service.revocationStore.Revoke(context.Background(), revokedSessionKey(sessionID), expiresAt); err != nil {
+			return fmt.Errorf("revoke session access tokens: %w", err)
+		}
+	}
+	return nil
+}
+
+// En: IsAccessTokenRevoked reports whether the token, or the session it belongs to, was revoked before it expired.
+// Es: IsAccessTokenRevoked indica si el token, o la sesión a la que pertenece, fue revocado antes de expirar.
+func (service *Service) IsAccessTokenRevoked(ctx context.Context, claims *middleware.AccessTokenClaims) (bool, error) {
+	if service.revocationStore == nil {
+		return false, nil
+	}
+	if claims.TokenID != "" {
+		revoked, err := service.revocationStore.IsRevoked(ctx, revokedTokenKey(claims.TokenID))
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+	if claims.SessionID != "" {
+		revoked, err := service.revocationStore.IsRevoked(ctx, revokedSessionKey(claims.SessionID))
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+	if claims.AccountID != "" {
+		return service.revocationStore.IsRevoked(ctx, revokedAccountMemberKey(claims.AccountID, claims.UserID, claims.AccountRole))
+	}
+	return false, nil
+}
+
+// En: RevokeAccountMemberTokens denylists the access tokens that claim role in the account for the user; call it when
+// that membership is removed or its role changes so clients must refresh to get a token with the current role.
+// Es: RevokeAccountMemberTokens deniega los tokens de acceso que declaran role en la cuenta para el usuario; llámalo cuando
+// esa membresía se elimina o cambia de rol para que los clientes deban refrescar y obtener un token con el rol actual.
+func (service *Service) RevokeAccountMemberTokens(accountID, userID string, role account.RoleType) error {
+	if service.revocationStore == nil {
+		return nil
+	}
+	expiresAt := time.Now().Add(service.accessTokenDuration)
+	if err := service.revocationStore.Revoke(context.Background(), revokedAccountMemberKey(accountID, userID, role), expiresAt); err != nil {
+		return fmt.Errorf("revoke account member tokens: %w", err)
+	}
+	return nil
+}
+
+// revokedTokenKey is the denylist key of a single access token.
+func revokedTokenKey(tokenID string) string {
+	return "jti:" + tokenID
+}
+
+// revokedSessionKey is the denylist key covering every access token of a session.
+func revokedSessionKey(sessionID string) string {
+	return "sid:" + sessionID
+}
+
+// revokedAccountMemberKey is the denylist key covering the access tokens that claim role in the account for the user.
+func revokedAccountMemberKey(accountID, userID string, role account.RoleType) string {
+	return "acm:" + accountID + ":" + userID + ":" + string(role)
+}
+
+// En: LogoutSession ends only the current session, identified by its refresh token or, when absent, by the sid claim of the access token.
+// Es: LogoutSession cierra solo la sesión actual, identificada por su token de actualización o, si no se envía, por el claim sid del token de acceso.
+func (service *Service) LogoutSession(userID, sessionID, rawRefreshToken string) error {
+	currentID, err := service.resolveSessionID(userID, sessionID, rawRefreshToken)
+	if err != nil {
+		return err
+	}
+	if err := service.repository.RevokeSession(userID, currentID); err != nil {
+		return err
+	}
+	return service.revokeSessionAccessTokens(currentID)
+}
+
+// En: ListSessions returns the active sessions of the user.
+// Es: ListSessions devuelve las sesiones activas del usuario.
+func (service *Service) ListSessions(userID string) ([]Session, error) {
+	return service.repository.ListActiveSessionsByUserID(userID)
+}
+
+// En: RevokeSession ends one session of the user (e.g. a lost device) and revokes its refresh tokens.
+// Es: RevokeSession cierra una sesión del usuario (p. ej. un dispositivo perdido) y revoca sus tokens de actualización.
+func (service *Service) RevokeSession(userID, sessionID string) error {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return ErrSessionNotFound
+	}
+	if err := service.repository.RevokeSession(userID, sessionID); err != nil {
+		return err
+	}
+	return service.revokeSessionAccessTokens(sessionID)
+}
+
+// En: RevokeOtherSessions ends every session of the user except the current one (identified like in LogoutSession).
+// Es: RevokeOtherSessions cierra todas las sesiones del usuario excepto la actual (identificada como en LogoutSession).
+func (service *Service) RevokeOtherSessions(userID, sessionID, rawRefreshToken string) error {
+	currentID, err := service.resolveSessionID(userID, sessionID, rawRefreshToken)
+	if err != nil {
+		return err
+	}
+	sessions, err := service.repository.ListActiveSessionsByUserID(userID)
+	if err != nil {
+		return err
+	}
+	if err := service.repository.RevokeOtherSessions(userID, currentID); err != nil {
+		return err
+	}
+	otherIDs := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		if session.ID != currentID {
+			otherIDs = append(otherIDs, session.ID)
+		}
+	}
+	return service.revokeSessionAccessTokens(otherIDs...)
+}
+
+// resolveSessionID returns the session of a refresh token owned by the user, or sessionID when no token is given.
+func (service *Service) resolveSessionID(userID, sessionID, rawRefreshToken string) (string, error) {
+	rawRefreshToken = strings.TrimSpace(rawRefreshToken)
+	if rawRefreshToken == "" {
+		if sessionID == "" {
+			return "", ErrSessionNotFound
+		}
+		return sessionID, nil
+	}
+
+	stored, err := service.repository.GetByTokenHash(hashToken(rawRefreshToken))
+	if err != nil {
+		if errors.Is(err, ErrTokenNotFound) {
+			return "", ErrSessionNotFound
+		}
+		return "", err
+	}
+	if stored.UserID != userID {
+		return "", ErrSessionNotFound
+	}
+	return stored.Family(), nil
+}
+
+// En: ValidateAccessToken validates and analyzes a JWT access token.
+// Es: ValidateAccessToken analiza y valida un token de acceso JWT.
+func (service *Service) ValidateAccessToken(tokenString string) (string, string, error) {
+	claims, err := service.parseAccessToken(tokenString)
+	if err != nil {
+		return "", "", err
+	}
+	return claims.UserID, claims.Email, nil
+}
+
+// En: ValidateAccessTokenClaims validates a JWT access token and returns the identity the auth middleware publishes.
+// Es: ValidateAccessTokenClaims valida un token de acceso JWT y devuelve la identidad que publica el middleware de auth.
+func (service *Service) ValidateAccessTokenClaims(tokenString string) (*middleware.AccessTokenClaims, error) {
+	claims, err := service.parseAccessToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	return claims.middlewareClaims(), nil
+}
+
+// middlewareClaims maps the JWT claims to the identity the auth middleware publishes.
+func (claims *Claims) middlewareClaims() *middleware.AccessTokenClaims {
+	result := &middleware.AccessTokenClaims{
+		UserID:      claims.UserID,
+		Email:       claims.Email,
+		SessionID:   claims.SessionID,
+		TokenID:     claims.ID,
+		AccountID:   claims.AccountID,
+		AccountRole: claims.AccountRole,
+		ClientID:    claims.ClientID,
+		Scopes:      strings.Fields(claims.Scope),
+		ReadOnly:    claims.ReadOnly,
+	}
+	if claims.Actor != nil {
+		result.ActorID = claims.Actor.Subject
+	}
+	if claims.AuthTime != nil {
+		result.AuthTime = claims.AuthTime.Time
+	}
+	if claims.ExpiresAt != nil {
+		result.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return result
+}
+
+// En: parseAccessToken analyzes the JWT and returns the complete Claims struct.
+// Es: parseAccessToken analiza el JWT y devuelve el struct Claims completo.
+func (service *Service) parseAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, service.verificationKey)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	// ID tokens share the signing key but carry no user_id claim; they never authenticate requests.
+	if claims.UserID == "" {
+		return nil, fmt.Errorf("invalid token: missing user_id claim")
+	}
+	return claims, nil
+}
+
+// jwks returns the public keys that verify access tokens; it is empty when tokens are signed with HS256.
+func (service *Service) jwks() []jsonWebKey {
+	if service.signingKeys == nil {
+		return []jsonWebKey{}
+	}
+	return service.signingKeys.jwks()
+}
+
+// En: generateTokenPair starts a new session (token family) for the given user and issues its first access and refresh token pair.
+// Es: generateTokenPair inicia una nueva sesión (familia de tokens) para el usuario dado y emite su primer par de tokens de acceso y actualización.
+func (service *Service) generateTokenPair(u *user.User, meta SessionMetadata) (*TokenPair, error) {
+	now := time.Now()
+	session := &Session{
+		UserID:     u.ID,
+		UserAgent:  meta.UserAgent,
+		IPAddress:  meta.IPAddress,
+		DeviceName: strings.TrimSpace(meta.DeviceName),
+		ExpiresAt:  now.Add(refreshTokenDuration),
+		LastUsedAt: now,
+	}
+	if err := service.repository.CreateSession(session); err != nil {
+		return nil, err
+	}
+	return service.issueTokenPair(u, session.ID, session.CreatedAt)
+}
+
+// issueTokenPair signs an access token and stores a refresh token that belongs to familyID; authTime is the login of the session.
+func (service *Service) issueTokenPair(u *user.User, familyID string, authTime time.Time) (*TokenPair, error) {
+	expiresAt := time.Now().Add(service.accessTokenDuration)
+	accessToken, err := service.signAccessToken(u, familyID, authTime, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("sign access token: %w", err)
+	}
+
+	rawRefresh, err := generateSecureToken()
+	if err != nil {
+		return nil, fmt.Errorf("generate refresh token: %w", err)
+	}
+
+	refreshRecord := &RefreshToken{
+		UserID:    u.ID,
+		TokenHash: hashToken(rawRefresh),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(refreshTokenDuration),
+	}
+	if err := service.repository.Create(refreshRecord); err != nil {
+		return nil, fmt.Errorf("store refresh token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: rawRefresh,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// En: IssueAccessToken signs a new access token for the user within an active session, e.g. after the active
+// account changed; an empty sessionID issues a token without session. It returns ErrSessionNotFound when the
+// session is unknown, ended or belongs to another user.
+// Es: IssueAccessToken firma un nuevo token de acceso para el usuario dentro de una sesión activa, p. ej. tras cambiar
+// la cuenta activa; un sessionID vacío emite un token sin sesión. Devuelve ErrSessionNotFound cuando la sesión es
+// desconocida, terminó o pertenece a otro usuario.
+func (service *Service) IssueAccessToken(userID, sessionID string) (string, time.Time, error) {
+	var authTime time.Time
+	if sessionID != "" {
+		session, err := service.repository.GetActiveSession(userID, sessionID)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		authTime = session.CreatedAt
+	}
+	u, err := service.userRepository.GetUser(userID)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("lookup user: %w", err)
+	}
+	expiresAt := time.Now().Add(service.accessTokenDuration)
+	accessToken, err := service.signAccessToken(u, sessionID, authTime, expiresAt)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("sign access token: %w", err)
+	}
+	return accessToken, expiresAt, nil
+}
+
+// En: signAccessToken builds and signs a JWT for the given user and session, scoped to the active account of the user.
+// A zero authTime leaves out the auth_time claim.
+// Es: signAccessToken construye y firma un JWT para el usuario y la sesión dados, limitado a la cuenta activa del usuario.
+// Un authTime cero omite el claim auth_time.
+func (service *Service) signAccessToken(u *user.User, sessionID string, authTime, expiresAt time.Time) (string, error) {
+	accountID, accountRole, err := service.accountScope(u)
+	if err != nil {
+		return "", err
+	}
+	claims := &Claims{
+		UserID:      u.ID,
+		Email:       u.Email,
+		SessionID:   sessionID,
+		AccountID:   accountID,
+		AccountRole: accountRole,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   u.ID,
+		},
+	}
+	if !authTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(authTime)
+	}
+	return service.signJWT(claims)
+}
+
+// signJWT signs claims with the active key of the key set, or with HS256 and the shared secret.
+func (service *Service) signJWT(claims jwt.Claims) (string, error) {
+	if service.signingKeys != nil {
+		return service.signingKeys.sign(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(service.jwtSecret)
+}
+
+// accountScope returns the active account of the user and the role there, or empty values when the user has no
+// active account, is no longer a member, or tokens claiming that role were revoked (the claim would be rejected).
+func (service *Service) accountScope(u *user.User) (string, account.RoleType, error) {
+	if u.ActiveAccountID == nil || *u.ActiveAccountID == "" {
+		return "", "", nil
+	}
+	return service.accountRole(*u.ActiveAccountID, u.ID)
+}
+
+// accountRole returns the account and the role of the user there, or empty values when there is no lookup,
+// the user is not a member, or tokens claiming that role were revoked.
+func (service *Service) accountRole(accountID, userID string) (string, account.RoleType, error) {
+	if service.accountMembers == nil {
+		return "", "", nil
+	}
+	member, err := service.accountMembers.GetMember(accountID, userID)
+	if err != nil {
+		if errors.Is(err, account.ErrMemberNotFound) {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("lookup account member: %w", err)
+	}
+	if service.revocationStore != nil {
+		revoked, err := service.revocationStore.IsRevoked(context.Background(), revokedAccountMemberKey(member.AccountID, userID, member.Role))
+		if err != nil {
+			return "", "", fmt.Errorf("check account member revocation: %w", err)
+		}
+		if revoked {
+			return "", "", nil
+		}
+	}
+	return member.AccountID, member.Role, nil
+}
+
+// verificationKey resolves the key that verifies an access token: by kid from the key set,
+// or the shared secret when the service signs with HS256.
+func (service *Service) verificationKey(token *jwt.Token) (any, error) {
+	if service.signingKeys != nil {
+		return service.signingKeys.verificationKey(token)
+	}
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return service.jwtSecret, nil
+}
+
+// En: generateSecureToken creates a cryptographically random hex-encoded token.
+// Es: generateSecureToken crea un token hex-codificado de forma criptográficamente aleatoria.
+func generateSecureToken() (string, error) {
+	bytes := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// generateRecoveryCode returns a random recovery code formatted as two groups of five hex characters.
+func generateRecoveryCode() (string, error) {
+	bytes := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	raw := hex.EncodeToString(bytes)
+	return raw[:5] + "-" + raw[5:], nil
+}
+
+// normalizeRecoveryCode lowercases a recovery code and strips separators so user input matches the stored hash.
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
+
+// En: hashToken returns the SHA-256 hex hash of a raw token string.
+// Es: hashToken devuelve el hash SHA-256 hex de una cadena de token sin procesar.
 func hashToken(raw string) string {
 	sum := sha256.Sum256([]byte(raw))
 	return hex.EncodeToString(sum[:])
 }
 
+// generateVerificationCode returns a uniformly random six-digit code (leading zeros kept).
+func generateVerificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", verificationCodeDigits, n.Int64()), nil
+}
+
+// hashVerificationCode binds the code to the user before hashing, so equal codes of different users do not share a hash.
+func hashVerificationCode(userID, code string) string {
+	return hashToken(userID + ":" + code)
+}
+
 // looksLikeJWT reports whether s has the typical three Base64URL segments of a JWT.
 // Refresh tokens in this API are opaque hex strings without dots.
 func looksLikeJWT(s string) bool {
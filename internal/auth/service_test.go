@@ -5,22 +5,45 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/cloudflax/api.cloudflax/internal/account"
 	"github.com/cloudflax/api.cloudflax/internal/shared/database"
 	"github.com/cloudflax/api.cloudflax/internal/shared/verificationnotify"
 	"github.com/cloudflax/api.cloudflax/internal/user"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 type failingNotifier struct{}
 
-func (failingNotifier) NotifyVerificationEmail(context.Context, string, string, string) error {
+func (failingNotifier) NotifyVerificationEmail(context.Context, string, string, string, string) error {
 	return errors.New("notifier failed")
 }
 
+func (failingNotifier) NotifyPasswordReset(context.Context, string, string, string) error {
+	return errors.New("notifier failed")
+}
+
+func (failingNotifier) NotifyMagicLink(context.Context, string, string, string) error {
+	return errors.New("notifier failed")
+}
+
+// recordingNotifier keeps the last verification link and code sent.
+type recordingNotifier struct {
+	link string
+	code string
+}
+
+func (n *recordingNotifier) NotifyVerificationEmail(_ context.Context, _, _, link, code string) error {
+	n.link = link
+	n.code = code
+	return nil
+}
+
 // En: hashTokenForTest calculates the SHA-256 hash of a test token.
 // Es: hashTokenForTest calcula el hash SHA-256 de un token de prueba.
 func hashTokenForTest(raw string) string {
@@ -33,7 +56,7 @@ func hashTokenForTest(raw string) string {
 func setupServiceTest(test *testing.T) *Service {
 	test.Helper()
 	require.NoError(test, database.InitForTesting())
-	require.NoError(test, database.RunMigrations(&user.User{}, &UserAuthProvider{}, &RefreshToken{}))
+	require.NoError(test, database.RunMigrations(&user.User{}, &UserAuthProvider{}, &RefreshToken{}, &PasswordResetToken{}, &OAuthState{}, &TOTPCredential{}, &RecoveryCode{}, &MFAChallenge{}, &Session{}, &RevokedAccessToken{}, &EmailChangeToken{}, &MagicLinkToken{}, &EmailVerificationCode{}, &DeviceAuthorization{}, &OAuthAuthorizationCode{}, &OAuthGrant{}))
 
 	userRepository := user.NewRepository(database.DB)
 	authRepository := NewRepository(database.DB)
@@ -41,6 +64,7 @@ func setupServiceTest(test *testing.T) *Service {
 		JWTSecret:            testJWTSecret,
 		VerificationNotifier: verificationnotify.NoopNotifier{},
 		FrontendURL:          "http://test",
+		RevocationStore:      NewMemoryTokenRevocationStore(),
 	})
 }
 
@@ -71,20 +95,60 @@ func TestServiceLoginSuccess(test *testing.T) {
 	service := setupServiceTest(test)
 	seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
 
-	pair, err := service.Login("alice@example.com", "password123")
+	pair, err := service.Login("alice@example.com", "password123", SessionMetadata{})
 	require.NoError(test, err)
 	assert.NotEmpty(test, pair.AccessToken)
 	assert.NotEmpty(test, pair.RefreshToken)
 	assert.False(test, pair.ExpiresAt.IsZero())
 }
 
+// En: TestServiceLoginRehashesPassword verifies that a login upgrades hashes made under an older policy
+// (bcrypt, or argon2id with other parameters) and leaves hashes that already match the policy untouched.
+// Es: TestServiceLoginRehashesPassword verifica que un login actualiza los hashes generados con una política anterior
+// (bcrypt, o argon2id con otros parámetros) y no toca los que ya cumplen la política.
+func TestServiceLoginRehashesPassword(test *testing.T) {
+	service := setupServiceTest(test)
+	test.Cleanup(func() { require.NoError(test, user.SetPasswordPolicy(user.DefaultPasswordPolicy)) })
+
+	require.NoError(test, user.SetPasswordPolicy(user.PasswordPolicy{Algorithm: user.PasswordAlgorithmBcrypt, BcryptCost: 4}))
+	legacy := seedVerifiedUser(test, "Legacy", "legacy@example.com", "password123")
+	require.NoError(test, user.SetPasswordPolicy(user.PasswordPolicy{Algorithm: user.PasswordAlgorithmArgon2id, Argon2Memory: 1024, Argon2Iterations: 2, Argon2Parallelism: 1}))
+	weak := seedVerifiedUser(test, "Weak", "weak@example.com", "password123")
+
+	policy := user.PasswordPolicy{Algorithm: user.PasswordAlgorithmArgon2id, Argon2Memory: 2048, Argon2Iterations: 1, Argon2Parallelism: 1}
+	require.NoError(test, user.SetPasswordPolicy(policy))
+	current := seedVerifiedUser(test, "Current", "current@example.com", "password123")
+
+	_, err := service.Login("legacy@example.com", "wrongpassword", SessionMetadata{})
+	require.ErrorIs(test, err, ErrInvalidCredentials)
+	var reloaded user.User
+	require.NoError(test, database.DB.First(&reloaded, "id = ?", legacy.ID).Error)
+	assert.Equal(test, legacy.PasswordHash, reloaded.PasswordHash, "a failed login does not rehash")
+
+	for _, seeded := range []*user.User{legacy, weak, current} {
+		_, err := service.Login(seeded.Email, "password123", SessionMetadata{})
+		require.NoError(test, err)
+
+		var stored user.User
+		require.NoError(test, database.DB.First(&stored, "id = ?", seeded.ID).Error)
+		assert.True(test, strings.HasPrefix(stored.PasswordHash, "$argon2id$v=19$m=2048,t=1,p=1$"), seeded.Email)
+		assert.False(test, stored.PasswordNeedsRehash(), seeded.Email)
+		assert.True(test, stored.CheckPassword("password123"), seeded.Email)
+		if seeded == current {
+			assert.Equal(test, current.PasswordHash, stored.PasswordHash, "hashes matching the policy are not rewritten")
+		} else {
+			assert.NotEqual(test, seeded.PasswordHash, stored.PasswordHash, seeded.Email)
+		}
+	}
+}
+
 // En: TestServiceLoginInvalidCredentials tests the login with invalid credentials.
 // Es: TestServiceLoginInvalidCredentials prueba el inicio de sesión con credenciales inválidas.
 func TestServiceLoginInvalidCredentials(test *testing.T) {
 	service := setupServiceTest(test)
 	seedUser(test, "Bob", "bob@example.com", "correctpass")
 
-	_, err := service.Login("bob@example.com", "wrongpass")
+	_, err := service.Login("bob@example.com", "wrongpass", SessionMetadata{})
 	assert.ErrorIs(test, err, ErrInvalidCredentials)
 }
 
@@ -93,7 +157,7 @@ func TestServiceLoginInvalidCredentials(test *testing.T) {
 func TestServiceLoginUnknownEmail(test *testing.T) {
 	service := setupServiceTest(test)
 
-	_, err := service.Login("ghost@example.com", "password123")
+	_, err := service.Login("ghost@example.com", "password123", SessionMetadata{})
 	assert.ErrorIs(test, err, ErrInvalidCredentials)
 }
 
@@ -103,7 +167,7 @@ func TestServiceLoginEmailNotVerified(test *testing.T) {
 	service := setupServiceTest(test)
 	seedUser(test, "Unverified", "unverified@example.com", "password123")
 
-	_, err := service.Login("unverified@example.com", "password123")
+	_, err := service.Login("unverified@example.com", "password123", SessionMetadata{})
 	assert.ErrorIs(test, err, ErrEmailNotVerified)
 }
 
@@ -113,7 +177,7 @@ func TestServiceValidateAccessTokenValid(test *testing.T) {
 	service := setupServiceTest(test)
 	seedVerifiedUser(test, "Carol", "carol@example.com", "password123")
 
-	pair, err := service.Login("carol@example.com", "password123")
+	pair, err := service.Login("carol@example.com", "password123", SessionMetadata{})
 	require.NoError(test, err)
 
 	userID, email, err := service.ValidateAccessToken(pair.AccessToken)
@@ -137,7 +201,7 @@ func TestServiceValidateAccessTokenWrongSecret(test *testing.T) {
 	service := setupServiceTest(test)
 	seedVerifiedUser(test, "Dave", "dave@example.com", "password123")
 
-	pair, err := service.Login("dave@example.com", "password123")
+	pair, err := service.Login("dave@example.com", "password123", SessionMetadata{})
 	require.NoError(test, err)
 
 	otherService := NewService(NewRepository(database.DB), user.NewRepository(database.DB), ServiceOptions{
@@ -155,10 +219,10 @@ func TestServiceRefreshTokensSuccess(test *testing.T) {
 	service := setupServiceTest(test)
 	seedVerifiedUser(test, "Eve", "eve@example.com", "password123")
 
-	pair, err := service.Login("eve@example.com", "password123")
+	pair, err := service.Login("eve@example.com", "password123", SessionMetadata{})
 	require.NoError(test, err)
 
-	newPair, err := service.RefreshTokens(pair.RefreshToken)
+	newPair, err := service.RefreshTokens(pair.RefreshToken, SessionMetadata{})
 	require.NoError(test, err)
 	assert.NotEmpty(test, newPair.AccessToken)
 	assert.NotEmpty(test, newPair.RefreshToken)
@@ -171,22 +235,338 @@ func TestServiceRefreshTokensRotation(test *testing.T) {
 	service := setupServiceTest(test)
 	seedVerifiedUser(test, "Frank", "frank@example.com", "password123")
 
-	pair, err := service.Login("frank@example.com", "password123")
+	pair, err := service.Login("frank@example.com", "password123", SessionMetadata{})
 	require.NoError(test, err)
 
-	_, err = service.RefreshTokens(pair.RefreshToken)
+	_, err = service.RefreshTokens(pair.RefreshToken, SessionMetadata{})
 	require.NoError(test, err)
 
-	_, err = service.RefreshTokens(pair.RefreshToken)
+	_, err = service.RefreshTokens(pair.RefreshToken, SessionMetadata{})
 	assert.ErrorIs(test, err, ErrInvalidCredentials, "reusing a rotated refresh token must fail")
 }
 
+// En: TestServiceRefreshTokenReuseRevokesFamily verifies that replaying a rotated token revokes the whole family.
+// Es: TestServiceRefreshTokenReuseRevokesFamily verifica que reutilizar un token rotado revoca toda la familia.
+func TestServiceRefreshTokenReuseRevokesFamily(test *testing.T) {
+	service := setupServiceTest(test)
+	seedVerifiedUser(test, "Frank", "frank@example.com", "password123")
+
+	pair, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	otherSession, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+
+	rotated, err := service.RefreshTokens(pair.RefreshToken, SessionMetadata{})
+	require.NoError(test, err)
+
+	_, err = service.RefreshTokens(pair.RefreshToken, SessionMetadata{})
+	assert.ErrorIs(test, err, ErrRefreshTokenReused)
+	assert.ErrorIs(test, err, ErrInvalidCredentials)
+
+	// The newest token of the compromised family no longer works...
+	_, err = service.RefreshTokens(rotated.RefreshToken, SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidCredentials)
+
+	// ...while other sessions (families) of the user are untouched.
+	_, err = service.RefreshTokens(otherSession.RefreshToken, SessionMetadata{})
+	assert.NoError(test, err)
+}
+
+// En: TestServiceRefreshTokensKeepFamily verifies that rotation keeps the token in its family.
+// Es: TestServiceRefreshTokensKeepFamily verifica que la rotación mantiene el token en su familia.
+func TestServiceRefreshTokensKeepFamily(test *testing.T) {
+	service := setupServiceTest(test)
+	seedVerifiedUser(test, "Frank", "frank@example.com", "password123")
+
+	pair, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	rotated, err := service.RefreshTokens(pair.RefreshToken, SessionMetadata{})
+	require.NoError(test, err)
+
+	original, err := service.repository.GetByTokenHash(hashTokenForTest(pair.RefreshToken))
+	require.NoError(test, err)
+	next, err := service.repository.GetByTokenHash(hashTokenForTest(rotated.RefreshToken))
+	require.NoError(test, err)
+	assert.NotEmpty(test, original.FamilyID)
+	assert.Equal(test, original.FamilyID, next.FamilyID)
+	assert.True(test, original.IsRotated())
+}
+
+// En: TestServiceRefreshAfterLogoutIsNotReuse verifies that tokens revoked by logout are rejected without a reuse event.
+// Es: TestServiceRefreshAfterLogoutIsNotReuse verifica que los tokens revocados por logout se rechazan sin evento de reutilización.
+func TestServiceRefreshAfterLogoutIsNotReuse(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Frank", "frank@example.com", "password123")
+
+	pair, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	require.NoError(test, service.Logout(u.ID))
+
+	_, err = service.RefreshTokens(pair.RefreshToken, SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidCredentials)
+	assert.NotErrorIs(test, err, ErrRefreshTokenReused)
+}
+
+// En: TestServiceLoginCreatesSession verifies that login stores the session metadata and binds the access token to it.
+// Es: TestServiceLoginCreatesSession verifica que el login guarda los metadatos de la sesión y asocia el token de acceso a ella.
+func TestServiceLoginCreatesSession(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Frank", "frank@example.com", "password123")
+
+	pair, err := service.Login("frank@example.com", "password123", SessionMetadata{
+		UserAgent:  "Mozilla/5.0",
+		IPAddress:  "203.0.113.7",
+		DeviceName: "Work laptop",
+	})
+	require.NoError(test, err)
+
+	sessions, err := service.ListSessions(u.ID)
+	require.NoError(test, err)
+	require.Len(test, sessions, 1)
+	assert.Equal(test, "Mozilla/5.0", sessions[0].UserAgent)
+	assert.Equal(test, "203.0.113.7", sessions[0].IPAddress)
+	assert.Equal(test, "Work laptop", sessions[0].DeviceName)
+
+	claims, err := service.ValidateAccessTokenClaims(pair.AccessToken)
+	require.NoError(test, err)
+	assert.Equal(test, sessions[0].ID, claims.SessionID)
+
+	rotated, err := service.RefreshTokens(pair.RefreshToken, SessionMetadata{IPAddress: "198.51.100.2"})
+	require.NoError(test, err)
+	claims, err = service.ValidateAccessTokenClaims(rotated.AccessToken)
+	require.NoError(test, err)
+	assert.Equal(test, sessions[0].ID, claims.SessionID)
+
+	sessions, err = service.ListSessions(u.ID)
+	require.NoError(test, err)
+	require.Len(test, sessions, 1)
+	assert.Equal(test, "198.51.100.2", sessions[0].IPAddress)
+	assert.Equal(test, "Work laptop", sessions[0].DeviceName)
+}
+
+// En: TestServiceLogoutSessionEndsOnlyCurrent verifies that logging out one session keeps the others alive.
+// Es: TestServiceLogoutSessionEndsOnlyCurrent verifica que cerrar una sesión mantiene activas las demás.
+func TestServiceLogoutSessionEndsOnlyCurrent(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Frank", "frank@example.com", "password123")
+
+	laptop, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	phone, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+
+	require.NoError(test, service.LogoutSession(u.ID, "", laptop.RefreshToken))
+
+	_, err = service.RefreshTokens(laptop.RefreshToken, SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidCredentials)
+	_, err = service.RefreshTokens(phone.RefreshToken, SessionMetadata{})
+	assert.NoError(test, err)
+
+	sessions, err := service.ListSessions(u.ID)
+	require.NoError(test, err)
+	assert.Len(test, sessions, 1)
+
+	assert.ErrorIs(test, service.LogoutSession(u.ID, "", ""), ErrSessionNotFound)
+}
+
+// En: TestServiceRevokeSessionOfAnotherUser verifies that a user cannot end another user's session.
+// Es: TestServiceRevokeSessionOfAnotherUser verifica que un usuario no puede cerrar la sesión de otro usuario.
+func TestServiceRevokeSessionOfAnotherUser(test *testing.T) {
+	service := setupServiceTest(test)
+	owner := seedVerifiedUser(test, "Frank", "frank@example.com", "password123")
+	other := seedVerifiedUser(test, "Grace", "grace@example.com", "password123")
+
+	pair, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	sessions, err := service.ListSessions(owner.ID)
+	require.NoError(test, err)
+	require.Len(test, sessions, 1)
+
+	assert.ErrorIs(test, service.RevokeSession(other.ID, sessions[0].ID), ErrSessionNotFound)
+	assert.ErrorIs(test, service.RevokeSession(owner.ID, "not-a-uuid"), ErrSessionNotFound)
+
+	require.NoError(test, service.RevokeSession(owner.ID, sessions[0].ID))
+	_, err = service.RefreshTokens(pair.RefreshToken, SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidCredentials)
+	assert.ErrorIs(test, service.RevokeSession(owner.ID, sessions[0].ID), ErrSessionNotFound)
+}
+
+// En: TestServiceRevokeOtherSessions verifies that "log out other sessions" keeps only the current one.
+// Es: TestServiceRevokeOtherSessions verifica que "cerrar las demás sesiones" conserva solo la actual.
+func TestServiceRevokeOtherSessions(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Frank", "frank@example.com", "password123")
+
+	current, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	other, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	claims, err := service.ValidateAccessTokenClaims(current.AccessToken)
+	require.NoError(test, err)
+
+	require.NoError(test, service.RevokeOtherSessions(u.ID, claims.SessionID, ""))
+
+	_, err = service.RefreshTokens(other.RefreshToken, SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidCredentials)
+	_, err = service.RefreshTokens(current.RefreshToken, SessionMetadata{})
+	assert.NoError(test, err)
+}
+
+// En: TestServiceRevokeAllByUserIDRevokesAccessTokens verifies that ending every session (password change,
+// user deletion) denylists the access tokens already issued, and that new logins are not affected.
+// Es: TestServiceRevokeAllByUserIDRevokesAccessTokens verifica que cerrar todas las sesiones (cambio de contraseña,
+// eliminación de usuario) deniega los tokens de acceso ya emitidos y que los nuevos logins no se ven afectados.
+func TestServiceRevokeAllByUserIDRevokesAccessTokens(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Frank", "frank@example.com", "password123")
+
+	pair, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	claims, err := service.ValidateAccessTokenClaims(pair.AccessToken)
+	require.NoError(test, err)
+	assert.NotEmpty(test, claims.TokenID)
+
+	revoked, err := service.IsAccessTokenRevoked(context.Background(), claims)
+	require.NoError(test, err)
+	assert.False(test, revoked)
+
+	require.NoError(test, service.RevokeAllByUserID(u.ID))
+	revoked, err = service.IsAccessTokenRevoked(context.Background(), claims)
+	require.NoError(test, err)
+	assert.True(test, revoked)
+
+	next, err := service.Login("frank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	nextClaims, err := service.ValidateAccessTokenClaims(next.AccessToken)
+	require.NoError(test, err)
+	revoked, err = service.IsAccessTokenRevoked(context.Background(), nextClaims)
+	require.NoError(test, err)
+	assert.False(test, revoked)
+}
+
+// En: TestServiceAccountScopedAccessToken verifies the account claims of the active account and their revocation on a role change.
+// Es: TestServiceAccountScopedAccessToken verifica los claims de la cuenta activa y su revocación al cambiar el rol.
+func TestServiceAccountScopedAccessToken(test *testing.T) {
+	service := setupServiceTest(test)
+	require.NoError(test, database.RunMigrations(&account.Account{}, &account.AccountMember{}))
+	accountRepository := account.NewRepository(database.DB)
+	service.accountMembers = accountRepository
+	u := seedVerifiedUser(test, "Gina", "gina@example.com", "password123")
+
+	pair, err := service.Login("gina@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	claims, err := service.ValidateAccessTokenClaims(pair.AccessToken)
+	require.NoError(test, err)
+	assert.Empty(test, claims.AccountID, "users without an active account get unscoped tokens")
+
+	acc := &account.Account{Name: "Gina Org", Slug: "gina-org"}
+	require.NoError(test, accountRepository.CreateAccount(acc))
+	require.NoError(test, accountRepository.CreateMember(&account.AccountMember{AccountID: acc.ID, UserID: u.ID, Role: account.RoleAdmin}))
+	u.ActiveAccountID = &acc.ID
+	require.NoError(test, database.DB.Save(u).Error)
+
+	accessToken, _, err := service.IssueAccessToken(u.ID, claims.SessionID)
+	require.NoError(test, err)
+	claims, err = service.ValidateAccessTokenClaims(accessToken)
+	require.NoError(test, err)
+	assert.Equal(test, acc.ID, claims.AccountID)
+	assert.Equal(test, account.RoleAdmin, claims.AccountRole)
+
+	require.NoError(test, service.RevokeAccountMemberTokens(acc.ID, u.ID, account.RoleAdmin))
+	revoked, err := service.IsAccessTokenRevoked(context.Background(), claims)
+	require.NoError(test, err)
+	assert.True(test, revoked, "tokens claiming the old role are rejected")
+
+	accessToken, _, err = service.IssueAccessToken(u.ID, claims.SessionID)
+	require.NoError(test, err)
+	claims, err = service.ValidateAccessTokenClaims(accessToken)
+	require.NoError(test, err)
+	assert.Empty(test, claims.AccountID, "a revoked role is not embedded again until its denylist entry expires")
+
+	_, _, err = service.IssueAccessToken(u.ID, uuid.NewString())
+	assert.ErrorIs(test, err, ErrSessionNotFound)
+}
+
+// En: staleInvitationLookup returns an invitation that was already resolved, as if it were accepted or declined
+// between the lookup and the registration.
+// Es: staleInvitationLookup devuelve una invitación ya resuelta, como si se hubiera aceptado o rechazado entre la
+// consulta y el registro.
+type staleInvitationLookup struct {
+	invitation *account.AccountInvitation
+}
+
+func (lookup staleInvitationLookup) GetPendingInvitation(string) (*account.AccountInvitation, error) {
+	return lookup.invitation, nil
+}
+
+// En: TestServiceRegisterWithInvitationIsAtomic checks that no user or provider is left behind when the invitation
+// can no longer be accepted.
+// Es: TestServiceRegisterWithInvitationIsAtomic comprueba que no queda ningún usuario ni proveedor cuando la invitación
+// ya no se puede aceptar.
+func TestServiceRegisterWithInvitationIsAtomic(test *testing.T) {
+	service := setupServiceTest(test)
+	require.NoError(test, database.RunMigrations(&account.Account{}, &account.AccountMember{}, &account.AccountInvitation{}))
+	accountService := account.NewService(account.NewRepository(database.DB), user.NewRepository(database.DB))
+
+	owner := seedVerifiedUser(test, "Hana", "hana@example.com", "password123")
+	acc, _, err := accountService.CreateAccount("Hana Org", "", owner.ID)
+	require.NoError(test, err)
+	_, invitationToken, err := accountService.CreateInvitation(acc.ID, owner.ID, "invitee@example.com", account.RoleMember)
+	require.NoError(test, err)
+	invitation, err := accountService.GetPendingInvitation(invitationToken)
+	require.NoError(test, err)
+	require.NoError(test, accountService.DeclineInvitation(invitationToken))
+	service.accountInvitations = staleInvitationLookup{invitation: invitation}
+
+	_, _, err = service.RegisterWithInvitation("Invitee", "invitee@example.com", "password123", invitationToken)
+	assert.ErrorIs(test, err, account.ErrInvitationNotFound)
+
+	_, err = service.userRepository.GetUserByEmail("invitee@example.com")
+	assert.ErrorIs(test, err, user.ErrNotFound, "the user is rolled back with the invitation")
+	var providers int64
+	require.NoError(test, database.DB.Model(&UserAuthProvider{}).Where("provider_subject_id = ?", "invitee@example.com").Count(&providers).Error)
+	assert.Zero(test, providers)
+}
+
+// En: TestServiceAccountRoleChangeRejectsOldToken checks that changing a member's role through the account service
+// makes the access token that still claims the old role revoked.
+// Es: TestServiceAccountRoleChangeRejectsOldToken comprueba que cambiar el rol de un miembro desde el servicio de cuentas
+// revoca el token de acceso que aún declara el rol anterior.
+func TestServiceAccountRoleChangeRejectsOldToken(test *testing.T) {
+	service := setupServiceTest(test)
+	require.NoError(test, database.RunMigrations(&account.Account{}, &account.AccountMember{}))
+	accountRepository := account.NewRepository(database.DB)
+	service.accountMembers = accountRepository
+	accountService := account.NewService(accountRepository, user.NewRepository(database.DB)).WithMemberTokenRevoker(service)
+
+	owner := seedVerifiedUser(test, "Hana", "hana@example.com", "password123")
+	acc, _, err := accountService.CreateAccount("Hana Org", "", owner.ID)
+	require.NoError(test, err)
+	admin := seedVerifiedUser(test, "Ivan", "ivan@example.com", "password123")
+	require.NoError(test, accountRepository.CreateMember(&account.AccountMember{AccountID: acc.ID, UserID: admin.ID, Role: account.RoleAdmin}))
+	_, err = accountService.SetActiveAccountForUser(admin.ID, acc.ID)
+	require.NoError(test, err)
+
+	pair, err := service.Login("ivan@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	claims, err := service.ValidateAccessTokenClaims(pair.AccessToken)
+	require.NoError(test, err)
+	require.Equal(test, account.RoleAdmin, claims.AccountRole)
+
+	_, err = accountService.UpdateMemberRole(acc.ID, owner.ID, admin.ID, account.RoleMember)
+	require.NoError(test, err)
+
+	revoked, err := service.IsAccessTokenRevoked(context.Background(), claims)
+	require.NoError(test, err)
+	assert.True(test, revoked, "the token claiming the old admin role is rejected")
+}
+
 // En: TestServiceRefreshTokensInvalidToken tests the refresh of tokens with an invalid token.
 // Es: TestServiceRefreshTokensInvalidToken prueba el refresco de tokens con token inválido.
 func TestServiceRefreshTokensInvalidToken(test *testing.T) {
 	service := setupServiceTest(test)
 
-	_, err := service.RefreshTokens("random-invalid-token")
+	_, err := service.RefreshTokens("random-invalid-token", SessionMetadata{})
 	assert.ErrorIs(test, err, ErrInvalidCredentials)
 }
 
@@ -206,7 +586,7 @@ func TestServiceRefreshTokensEmailNotVerified(test *testing.T) {
 		ExpiresAt: expiresAt,
 	}))
 
-	_, err := service.RefreshTokens(rawToken)
+	_, err := service.RefreshTokens(rawToken, SessionMetadata{})
 	assert.ErrorIs(test, err, ErrEmailNotVerified)
 }
 
@@ -264,6 +644,76 @@ func TestServiceVerifyEmailInvalidToken(test *testing.T) {
 	assert.ErrorIs(test, err, ErrInvalidVerificationToken)
 }
 
+// En: TestServiceVerifyEmailCode verifies the email with the six-digit code sent next to the link.
+// Es: TestServiceVerifyEmailCode verifica el correo con el código de seis dígitos enviado junto al enlace.
+func TestServiceVerifyEmailCode(test *testing.T) {
+	service := setupServiceTest(test)
+	notifier := &recordingNotifier{}
+	service.verificationNotifier = notifier
+
+	_, token, err := service.Register("Cody", "cody@example.com", "password123")
+	require.NoError(test, err)
+	assert.Contains(test, notifier.link, token)
+	require.Len(test, notifier.code, 6)
+
+	wrong := "000000"
+	if notifier.code == wrong {
+		wrong = "111111"
+	}
+	assert.ErrorIs(test, service.VerifyEmailCode("cody@example.com", wrong), ErrInvalidVerificationCode)
+	require.NoError(test, service.VerifyEmailCode("CODY@example.com", notifier.code))
+
+	var u user.User
+	require.NoError(test, database.DB.Where("email = ?", "cody@example.com").First(&u).Error)
+	assert.NotNil(test, u.EmailVerifiedAt)
+	assert.Nil(test, u.EmailVerificationToken, "the link stops working once the code is used")
+
+	assert.ErrorIs(test, service.VerifyEmailCode("cody@example.com", notifier.code), ErrEmailAlreadyVerified)
+}
+
+// En: TestServiceVerifyEmailCodeAttemptLimit rejects even the right code once the wrong guesses are used up.
+// Es: TestServiceVerifyEmailCodeAttemptLimit rechaza incluso el código correcto cuando se agotan los intentos fallidos.
+func TestServiceVerifyEmailCodeAttemptLimit(test *testing.T) {
+	service := setupServiceTest(test)
+	notifier := &recordingNotifier{}
+	service.verificationNotifier = notifier
+
+	_, _, err := service.Register("Dora", "dora@example.com", "password123")
+	require.NoError(test, err)
+	code := notifier.code
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for range verificationCodeMaxAttempts {
+		assert.ErrorIs(test, service.VerifyEmailCode("dora@example.com", wrong), ErrInvalidVerificationCode)
+	}
+	assert.ErrorIs(test, service.VerifyEmailCode("dora@example.com", code), ErrInvalidVerificationCode)
+
+	_, err = service.ResendVerification("dora@example.com")
+	require.NoError(test, err)
+	assert.NoError(test, service.VerifyEmailCode("dora@example.com", notifier.code), "resend issues a fresh code")
+}
+
+// En: TestRepositoryClaimEmailVerificationCodeAttemptIsConditional verifies that concurrent guesses cannot push the
+// attempt counter past the limit.
+// Es: TestRepositoryClaimEmailVerificationCodeAttemptIsConditional verifica que los intentos concurrentes no pueden
+// llevar el contador de intentos más allá del límite.
+func TestRepositoryClaimEmailVerificationCodeAttemptIsConditional(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Dora", "dora@example.com", "password123")
+	code := &EmailVerificationCode{UserID: u.ID, CodeHash: hashVerificationCode(u.ID, "123456"), ExpiresAt: time.Now().Add(time.Minute), Attempts: verificationCodeMaxAttempts - 1}
+	require.NoError(test, service.repository.ReplaceEmailVerificationCode(code))
+
+	require.NoError(test, service.repository.ClaimEmailVerificationCodeAttempt(code.ID, verificationCodeMaxAttempts))
+	assert.ErrorIs(test, service.repository.ClaimEmailVerificationCodeAttempt(code.ID, verificationCodeMaxAttempts), ErrInvalidVerificationCode)
+
+	stored, err := service.repository.GetEmailVerificationCode(u.ID)
+	require.NoError(test, err)
+	assert.Equal(test, verificationCodeMaxAttempts, stored.Attempts)
+}
+
 // En: TestServiceResendVerificationSuccess tests the successful email verification resend.
 // Es: TestServiceResendVerificationSuccess prueba el envío de correo de verificación exitoso.
 func TestServiceResendVerificationSuccess(test *testing.T) {
@@ -295,7 +745,7 @@ func TestServiceResendVerificationAlreadyVerified(test *testing.T) {
 // Es: TestServiceResendVerificationEmailSendFailure devuelve error si falla notifier.
 func TestServiceResendVerificationEmailSendFailure(test *testing.T) {
 	require.NoError(test, database.InitForTesting())
-	require.NoError(test, database.RunMigrations(&user.User{}, &UserAuthProvider{}, &RefreshToken{}))
+	require.NoError(test, database.RunMigrations(&user.User{}, &UserAuthProvider{}, &RefreshToken{}, &PasswordResetToken{}, &OAuthState{}, &TOTPCredential{}, &RecoveryCode{}, &MFAChallenge{}, &Session{}, &RevokedAccessToken{}, &EmailChangeToken{}, &MagicLinkToken{}, &EmailVerificationCode{}, &DeviceAuthorization{}, &OAuthAuthorizationCode{}, &OAuthGrant{}))
 
 	userRepository := user.NewRepository(database.DB)
 	authRepository := NewRepository(database.DB)
@@ -319,16 +769,487 @@ func TestServiceLogoutRevokesAllTokens(test *testing.T) {
 	service := setupServiceTest(test)
 	u := seedVerifiedUser(test, "Grace", "grace@example.com", "password123")
 
-	pair1, err := service.Login("grace@example.com", "password123")
+	pair1, err := service.Login("grace@example.com", "password123", SessionMetadata{})
 	require.NoError(test, err)
-	pair2, err := service.Login("grace@example.com", "password123")
+	pair2, err := service.Login("grace@example.com", "password123", SessionMetadata{})
 	require.NoError(test, err)
 
 	require.NoError(test, service.Logout(u.ID))
 
-	_, err = service.RefreshTokens(pair1.RefreshToken)
+	_, err = service.RefreshTokens(pair1.RefreshToken, SessionMetadata{})
 	assert.ErrorIs(test, err, ErrInvalidCredentials, "first session token should be revoked after logout")
 
-	_, err = service.RefreshTokens(pair2.RefreshToken)
+	_, err = service.RefreshTokens(pair2.RefreshToken, SessionMetadata{})
 	assert.ErrorIs(test, err, ErrInvalidCredentials, "second session token should be revoked after logout")
 }
+
+// En: TestServiceForgotPasswordUnknownEmail returns user.ErrNotFound for unknown emails.
+// Es: TestServiceForgotPasswordUnknownEmail devuelve user.ErrNotFound para correos desconocidos.
+func TestServiceForgotPasswordUnknownEmail(test *testing.T) {
+	service := setupServiceTest(test)
+
+	_, err := service.ForgotPassword("nobody@example.com")
+	assert.ErrorIs(test, err, user.ErrNotFound)
+}
+
+// En: TestServiceForgotPasswordDeliveryFailureIsNotReported answers as for any email when the reset email cannot be sent,
+// so the response does not reveal that the account exists.
+// Es: TestServiceForgotPasswordDeliveryFailureIsNotReported responde como para cualquier email cuando el correo no se puede enviar,
+// para que la respuesta no revele que la cuenta existe.
+func TestServiceForgotPasswordDeliveryFailureIsNotReported(test *testing.T) {
+	service := setupServiceTest(test)
+	service.passwordResetNotifier = failingNotifier{}
+	seedVerifiedUser(test, "Hank", "hank@example.com", "password123")
+
+	token, err := service.ForgotPassword("hank@example.com")
+	require.NoError(test, err)
+	assert.NoError(test, service.ResetPassword(token, "newpassword456"))
+}
+
+// En: TestServiceResetPasswordSuccess changes the password, consumes the token and revokes sessions.
+// Es: TestServiceResetPasswordSuccess cambia la contraseña, consume el token y revoca las sesiones.
+func TestServiceResetPasswordSuccess(test *testing.T) {
+	service := setupServiceTest(test)
+	seedVerifiedUser(test, "Hank", "hank@example.com", "password123")
+
+	pair, err := service.Login("hank@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+
+	token, err := service.ForgotPassword("HANK@example.com")
+	require.NoError(test, err)
+	require.NotEmpty(test, token)
+
+	var stored PasswordResetToken
+	require.NoError(test, database.DB.Where("token_hash = ?", hashTokenForTest(token)).First(&stored).Error)
+	assert.Nil(test, stored.UsedAt)
+
+	require.NoError(test, service.ResetPassword(token, "newpassword456"))
+
+	_, err = service.Login("hank@example.com", "password123", SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidCredentials, "old password must stop working")
+	_, err = service.Login("hank@example.com", "newpassword456", SessionMetadata{})
+	assert.NoError(test, err)
+
+	_, err = service.RefreshTokens(pair.RefreshToken, SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidCredentials, "sessions must be revoked after a password reset")
+
+	err = service.ResetPassword(token, "anotherpassword789")
+	assert.ErrorIs(test, err, ErrInvalidResetToken, "reset tokens are single-use")
+}
+
+// En: TestServiceResetPasswordExpiredToken rejects expired reset tokens.
+// Es: TestServiceResetPasswordExpiredToken rechaza tokens de restablecimiento expirados.
+func TestServiceResetPasswordExpiredToken(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Ivy", "ivy@example.com", "password123")
+
+	rawToken := "expired-reset-token"
+	require.NoError(test, service.repository.CreatePasswordResetToken(&PasswordResetToken{
+		UserID:    u.ID,
+		TokenHash: hashTokenForTest(rawToken),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}))
+
+	err := service.ResetPassword(rawToken, "newpassword456")
+	assert.ErrorIs(test, err, ErrInvalidResetToken)
+}
+
+// En: TestServiceForgotPasswordInvalidatesPreviousTokens keeps only the latest reset link usable.
+// Es: TestServiceForgotPasswordInvalidatesPreviousTokens mantiene utilizable solo el último enlace de restablecimiento.
+func TestServiceForgotPasswordInvalidatesPreviousTokens(test *testing.T) {
+	service := setupServiceTest(test)
+	seedVerifiedUser(test, "Jack", "jack@example.com", "password123")
+
+	first, err := service.ForgotPassword("jack@example.com")
+	require.NoError(test, err)
+	second, err := service.ForgotPassword("jack@example.com")
+	require.NoError(test, err)
+
+	assert.ErrorIs(test, service.ResetPassword(first, "newpassword456"), ErrInvalidResetToken)
+	assert.NoError(test, service.ResetPassword(second, "newpassword456"))
+}
+
+// En: TestServiceMagicLinkVerifiesEmailAndIsSingleUse logs in with a magic link, marks the email verified and rejects reuse.
+// Es: TestServiceMagicLinkVerifiesEmailAndIsSingleUse inicia sesión con un magic link, marca el email verificado y rechaza la reutilización.
+func TestServiceMagicLinkVerifiesEmailAndIsSingleUse(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedUser(test, "Quinn", "quinn@example.com", "password123")
+
+	first, err := service.RequestMagicLink("QUINN@example.com")
+	require.NoError(test, err)
+	token, err := service.RequestMagicLink("quinn@example.com")
+	require.NoError(test, err)
+
+	_, err = service.VerifyMagicLink(first, SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidMagicLinkToken, "only the latest link is valid")
+
+	pair, err := service.VerifyMagicLink(token, SessionMetadata{})
+	require.NoError(test, err)
+	assert.NotEmpty(test, pair.AccessToken)
+	assert.NotEmpty(test, pair.RefreshToken)
+
+	updated, err := service.userRepository.GetUser(u.ID)
+	require.NoError(test, err)
+	assert.True(test, updated.IsEmailVerified())
+
+	_, err = service.VerifyMagicLink(token, SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidMagicLinkToken, "magic link tokens are single-use")
+
+	_, err = service.RequestMagicLink("nobody@example.com")
+	assert.ErrorIs(test, err, user.ErrNotFound)
+}
+
+// En: TestServiceVerifyMagicLinkExpiredToken rejects expired magic link tokens.
+// Es: TestServiceVerifyMagicLinkExpiredToken rechaza tokens de magic link expirados.
+func TestServiceVerifyMagicLinkExpiredToken(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Rita", "rita@example.com", "password123")
+
+	rawToken := "expired-magic-link-token"
+	require.NoError(test, service.repository.CreateMagicLinkToken(&MagicLinkToken{
+		UserID:    u.ID,
+		TokenHash: hashTokenForTest(rawToken),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}))
+
+	_, err := service.VerifyMagicLink(rawToken, SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidMagicLinkToken)
+}
+
+// recordingEmailChangeNotifier captures the notices sent to the current address.
+type recordingEmailChangeNotifier struct {
+	toEmail  string
+	newEmail string
+}
+
+func (n *recordingEmailChangeNotifier) NotifyEmailChangeRequested(_ context.Context, toEmail, _, newEmail string) error {
+	n.toEmail = toEmail
+	n.newEmail = newEmail
+	return nil
+}
+
+// recordingEmailChangeConfirmationNotifier captures the confirmation links sent to the new address.
+type recordingEmailChangeConfirmationNotifier struct {
+	toEmail string
+	link    string
+}
+
+func (n *recordingEmailChangeConfirmationNotifier) NotifyEmailChangeConfirmation(_ context.Context, toEmail, _, link string) error {
+	n.toEmail = toEmail
+	n.link = link
+	return nil
+}
+
+// En: TestServiceEmailChangeSuccess swaps the email and the credentials login only once the new address confirms.
+// Es: TestServiceEmailChangeSuccess cambia el email y el login con credenciales solo cuando la nueva dirección confirma.
+func TestServiceEmailChangeSuccess(test *testing.T) {
+	service := setupServiceTest(test)
+	notifier := &recordingEmailChangeNotifier{}
+	service.emailChangeNotifier = notifier
+	confirmationNotifier := &recordingEmailChangeConfirmationNotifier{}
+	service.emailChangeConfirmationNotifier = confirmationNotifier
+	u := seedVerifiedUser(test, "Lara", "lara@example.com", "password123")
+	require.NoError(test, service.repository.CreateAuthProvider(&UserAuthProvider{
+		UserID: u.ID, Provider: ProviderCredentials, ProviderSubjectID: u.Email,
+	}))
+
+	token, err := service.RequestEmailChange(u.ID, " Lara@NewCo.com ")
+	require.NoError(test, err)
+	assert.Equal(test, "lara@example.com", notifier.toEmail)
+	assert.Equal(test, "lara@newco.com", notifier.newEmail)
+	assert.Equal(test, "lara@newco.com", confirmationNotifier.toEmail)
+	assert.Equal(test, service.frontendURL+"/auth/confirm-email-change?token="+token, confirmationNotifier.link)
+
+	_, err = service.Login("lara@example.com", "password123", SessionMetadata{})
+	assert.NoError(test, err, "the email does not change before confirmation")
+
+	require.NoError(test, service.ConfirmEmailChange(token))
+
+	_, err = service.Login("lara@newco.com", "password123", SessionMetadata{})
+	assert.NoError(test, err)
+	_, err = service.repository.FindByProviderAndSubject(ProviderCredentials, "lara@newco.com")
+	assert.NoError(test, err)
+	_, err = service.repository.FindByProviderAndSubject(ProviderCredentials, "lara@example.com")
+	assert.ErrorIs(test, err, ErrAuthProviderNotFound)
+
+	assert.ErrorIs(test, service.ConfirmEmailChange(token), ErrInvalidEmailChangeToken, "email change tokens are single-use")
+}
+
+// En: TestServiceEmailChangeRejectsTakenOrCurrentEmail rejects the current address and addresses of other users,
+// also when the address is taken between request and confirmation.
+// Es: TestServiceEmailChangeRejectsTakenOrCurrentEmail rechaza la dirección actual y las de otros usuarios,
+// también cuando la dirección se ocupa entre la solicitud y la confirmación.
+func TestServiceEmailChangeRejectsTakenOrCurrentEmail(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Mia", "mia@example.com", "password123")
+	seedVerifiedUser(test, "Ned", "ned@example.com", "password123")
+
+	_, err := service.RequestEmailChange(u.ID, "MIA@example.com")
+	assert.ErrorIs(test, err, ErrEmailUnchanged)
+	_, err = service.RequestEmailChange(u.ID, "ned@example.com")
+	assert.ErrorIs(test, err, user.ErrDuplicateEmail)
+
+	token, err := service.RequestEmailChange(u.ID, "mia@newco.com")
+	require.NoError(test, err)
+	seedVerifiedUser(test, "Other Mia", "mia@newco.com", "password123")
+	assert.ErrorIs(test, service.ConfirmEmailChange(token), user.ErrDuplicateEmail)
+}
+
+// En: TestServiceConfirmEmailChangeExpiredToken rejects expired email change tokens.
+// Es: TestServiceConfirmEmailChangeExpiredToken rechaza tokens de cambio de email expirados.
+func TestServiceConfirmEmailChangeExpiredToken(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Olga", "olga@example.com", "password123")
+
+	rawToken := "expired-email-change-token"
+	require.NoError(test, service.repository.CreateEmailChangeToken(&EmailChangeToken{
+		UserID:    u.ID,
+		NewEmail:  "olga@newco.com",
+		TokenHash: hashTokenForTest(rawToken),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}))
+
+	assert.ErrorIs(test, service.ConfirmEmailChange(rawToken), ErrInvalidEmailChangeToken)
+}
+
+// En: TestServiceUnlinkAuthProvider verifies that a provider can be unlinked while another login method remains.
+// Es: TestServiceUnlinkAuthProvider verifica que un proveedor puede desenlazarse mientras quede otro método de inicio de sesión.
+func TestServiceUnlinkAuthProvider(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+	credentials := &UserAuthProvider{UserID: u.ID, Provider: ProviderCredentials, ProviderSubjectID: u.Email}
+	google := &UserAuthProvider{UserID: u.ID, Provider: ProviderGoogle, ProviderSubjectID: "google-subject-1"}
+	require.NoError(test, service.repository.CreateAuthProvider(credentials))
+	require.NoError(test, service.repository.CreateAuthProvider(google))
+
+	require.NoError(test, service.UnlinkAuthProvider(u.ID, google.ID))
+
+	providers, err := service.ListAuthProviders(u.ID)
+	require.NoError(test, err)
+	require.Len(test, providers, 1)
+	assert.Equal(test, ProviderCredentials, providers[0].Provider)
+
+	err = service.UnlinkAuthProvider(u.ID, credentials.ID)
+	assert.ErrorIs(test, err, ErrLastLoginMethod)
+}
+
+// En: TestServiceUnlinkCredentialsClearsPassword verifies that removing the credentials provider disables password login.
+// Es: TestServiceUnlinkCredentialsClearsPassword verifica que eliminar el proveedor de credenciales deshabilita el login con contraseña.
+func TestServiceUnlinkCredentialsClearsPassword(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+	credentials := &UserAuthProvider{UserID: u.ID, Provider: ProviderCredentials, ProviderSubjectID: u.Email}
+	require.NoError(test, service.repository.CreateAuthProvider(credentials))
+	require.NoError(test, service.repository.CreateAuthProvider(&UserAuthProvider{
+		UserID: u.ID, Provider: ProviderGoogle, ProviderSubjectID: "google-subject-1",
+	}))
+
+	require.NoError(test, service.UnlinkAuthProvider(u.ID, credentials.ID))
+
+	_, err := service.Login("alice@example.com", "password123", SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidCredentials)
+}
+
+// En: TestServiceUnlinkAuthProviderNotOwned verifies that another user's provider is reported as not found.
+// Es: TestServiceUnlinkAuthProviderNotOwned verifica que el proveedor de otro usuario se reporta como no encontrado.
+func TestServiceUnlinkAuthProviderNotOwned(test *testing.T) {
+	service := setupServiceTest(test)
+	alice := seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+	bob := seedVerifiedUser(test, "Bob", "bob@example.com", "password123")
+	aliceProvider := &UserAuthProvider{UserID: alice.ID, Provider: ProviderGoogle, ProviderSubjectID: "google-subject-1"}
+	require.NoError(test, service.repository.CreateAuthProvider(aliceProvider))
+
+	err := service.UnlinkAuthProvider(bob.ID, aliceProvider.ID)
+	assert.ErrorIs(test, err, ErrAuthProviderNotFound)
+}
+
+// En: enableTwoFactorForTest enrolls and confirms TOTP for the user and returns the secret and recovery codes.
+// Es: enableTwoFactorForTest inscribe y confirma TOTP para el usuario y devuelve el secreto y los códigos de recuperación.
+func enableTwoFactorForTest(test *testing.T, service *Service, userID string) (string, []string) {
+	test.Helper()
+	enrollment, err := service.EnrollTwoFactor(userID)
+	require.NoError(test, err)
+	code, err := totpCodeAt(enrollment.Secret, time.Now())
+	require.NoError(test, err)
+	recoveryCodes, err := service.ConfirmTwoFactor(userID, code)
+	require.NoError(test, err)
+	return enrollment.Secret, recoveryCodes
+}
+
+// En: nextTOTPCodeForTest returns the code of the next time step (the current one is consumed by confirmation).
+// Es: nextTOTPCodeForTest devuelve el código del siguiente paso de tiempo (el actual lo consume la confirmación).
+func nextTOTPCodeForTest(test *testing.T, secret string) string {
+	test.Helper()
+	code, err := totpCodeAt(secret, time.Now().Add(totpPeriod))
+	require.NoError(test, err)
+	return code
+}
+
+// En: TestServiceTwoFactorLoginWithTOTP verifies the two-step login with a TOTP code.
+// Es: TestServiceTwoFactorLoginWithTOTP verifica el login en dos pasos con un código TOTP.
+func TestServiceTwoFactorLoginWithTOTP(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+	secret, recoveryCodes := enableTwoFactorForTest(test, service, u.ID)
+	assert.Len(test, recoveryCodes, recoveryCodeCount)
+
+	pair, err := service.Login("alice@example.com", "password123", SessionMetadata{})
+	assert.Nil(test, pair)
+	var mfaErr *MFARequiredError
+	require.ErrorAs(test, err, &mfaErr)
+	assert.NotEmpty(test, mfaErr.MFAToken)
+
+	code := nextTOTPCodeForTest(test, secret)
+	pair, err = service.VerifyMFA(mfaErr.MFAToken, code, SessionMetadata{})
+	require.NoError(test, err)
+	assert.NotEmpty(test, pair.AccessToken)
+
+	// The challenge is single-use.
+	_, err = service.VerifyMFA(mfaErr.MFAToken, code, SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidMFAToken)
+}
+
+// En: TestServiceTwoFactorRecoveryCodeSingleUse verifies that a recovery code works once.
+// Es: TestServiceTwoFactorRecoveryCodeSingleUse verifica que un código de recuperación funciona una sola vez.
+func TestServiceTwoFactorRecoveryCodeSingleUse(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+	_, recoveryCodes := enableTwoFactorForTest(test, service, u.ID)
+
+	var mfaErr *MFARequiredError
+	_, err := service.Login("alice@example.com", "password123", SessionMetadata{})
+	require.ErrorAs(test, err, &mfaErr)
+	_, err = service.VerifyMFA(mfaErr.MFAToken, strings.ToUpper(recoveryCodes[0]), SessionMetadata{})
+	require.NoError(test, err)
+
+	_, err = service.Login("alice@example.com", "password123", SessionMetadata{})
+	require.ErrorAs(test, err, &mfaErr)
+	_, err = service.VerifyMFA(mfaErr.MFAToken, recoveryCodes[0], SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidTwoFactorCode)
+
+	remaining, err := service.repository.CountUnusedRecoveryCodes(u.ID)
+	require.NoError(test, err)
+	assert.Equal(test, int64(recoveryCodeCount-1), remaining)
+}
+
+// En: TestServiceTwoFactorChallengeAttemptLimit verifies that a challenge stops working after too many wrong codes.
+// Es: TestServiceTwoFactorChallengeAttemptLimit verifica que un desafío deja de funcionar tras demasiados códigos erróneos.
+func TestServiceTwoFactorChallengeAttemptLimit(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+	secret, _ := enableTwoFactorForTest(test, service, u.ID)
+
+	var mfaErr *MFARequiredError
+	_, err := service.Login("alice@example.com", "password123", SessionMetadata{})
+	require.ErrorAs(test, err, &mfaErr)
+	for range mfaChallengeMaxAttempts {
+		_, err = service.VerifyMFA(mfaErr.MFAToken, "000000", SessionMetadata{})
+		require.ErrorIs(test, err, ErrInvalidTwoFactorCode)
+	}
+
+	_, err = service.VerifyMFA(mfaErr.MFAToken, nextTOTPCodeForTest(test, secret), SessionMetadata{})
+	assert.ErrorIs(test, err, ErrInvalidMFAToken)
+}
+
+// En: TestRepositoryClaimMFAChallengeAttemptIsConditional verifies that the attempt counter never goes past the
+// limit, even for a caller that read the challenge before the last attempt was taken.
+// Es: TestRepositoryClaimMFAChallengeAttemptIsConditional verifica que el contador de intentos nunca supera el
+// límite, aunque quien llama haya leído el desafío antes de que se tomara el último intento.
+func TestRepositoryClaimMFAChallengeAttemptIsConditional(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+	challenge := &MFAChallenge{UserID: u.ID, TokenHash: hashTokenForTest("challenge"), ExpiresAt: time.Now().Add(time.Minute), Attempts: mfaChallengeMaxAttempts - 1}
+	require.NoError(test, service.repository.CreateMFAChallenge(challenge))
+
+	require.NoError(test, service.repository.ClaimMFAChallengeAttempt(challenge.ID, mfaChallengeMaxAttempts))
+	assert.ErrorIs(test, service.repository.ClaimMFAChallengeAttempt(challenge.ID, mfaChallengeMaxAttempts), ErrInvalidMFAToken)
+
+	stored, err := service.repository.GetMFAChallengeByHash(challenge.TokenHash)
+	require.NoError(test, err)
+	assert.Equal(test, mfaChallengeMaxAttempts, stored.Attempts)
+}
+
+// En: TestServiceTwoFactorEnrollAlreadyEnabled verifies that a confirmed user cannot re-enroll.
+// Es: TestServiceTwoFactorEnrollAlreadyEnabled verifica que un usuario confirmado no puede volver a inscribirse.
+func TestServiceTwoFactorEnrollAlreadyEnabled(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+	enableTwoFactorForTest(test, service, u.ID)
+
+	_, err := service.EnrollTwoFactor(u.ID)
+	assert.ErrorIs(test, err, ErrTwoFactorAlreadyEnabled)
+}
+
+// En: TestServiceDisableTwoFactor verifies that disabling requires the password and a code, then login is single-step again.
+// Es: TestServiceDisableTwoFactor verifica que desactivar requiere contraseña y código, y luego el login vuelve a ser de un paso.
+func TestServiceDisableTwoFactor(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+	secret, _ := enableTwoFactorForTest(test, service, u.ID)
+	code := nextTOTPCodeForTest(test, secret)
+
+	err := service.DisableTwoFactor(u.ID, "wrongpassword", code)
+	assert.ErrorIs(test, err, ErrInvalidCredentials)
+
+	require.NoError(test, service.DisableTwoFactor(u.ID, "password123", code))
+
+	pair, err := service.Login("alice@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	assert.NotEmpty(test, pair.AccessToken)
+}
+
+// En: TestServiceTokensCarryAuthTime verifies access tokens claim the login of their session, also after a refresh.
+// Es: TestServiceTokensCarryAuthTime verifica que los tokens de acceso declaran el login de su sesión, también tras un refresh.
+func TestServiceTokensCarryAuthTime(test *testing.T) {
+	service := setupServiceTest(test)
+	seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+
+	pair, err := service.Login("alice@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	claims, err := service.parseAccessToken(pair.AccessToken)
+	require.NoError(test, err)
+	require.NotNil(test, claims.AuthTime)
+	assert.WithinDuration(test, time.Now(), claims.AuthTime.Time, 2*time.Second)
+
+	refreshed, err := service.RefreshTokens(pair.RefreshToken, SessionMetadata{})
+	require.NoError(test, err)
+	refreshedClaims, err := service.parseAccessToken(refreshed.AccessToken)
+	require.NoError(test, err)
+	require.NotNil(test, refreshedClaims.AuthTime)
+	assert.Equal(test, claims.AuthTime.Unix(), refreshedClaims.AuthTime.Unix())
+}
+
+// En: TestServiceReauthenticate verifies the elevated token and the password, code and session checks.
+// Es: TestServiceReauthenticate verifica el token elevado y las comprobaciones de contraseña, código y sesión.
+func TestServiceReauthenticate(test *testing.T) {
+	service := setupServiceTest(test)
+	u := seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+	pair, err := service.Login("alice@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+	loginClaims, err := service.parseAccessToken(pair.AccessToken)
+	require.NoError(test, err)
+
+	_, err = service.Reauthenticate(u.ID, loginClaims.SessionID, "wrongpassword", "")
+	assert.ErrorIs(test, err, ErrInvalidCredentials)
+	_, err = service.Reauthenticate(u.ID, loginClaims.SessionID, "", "123456")
+	assert.ErrorIs(test, err, ErrTwoFactorNotEnabled)
+
+	elevated, err := service.Reauthenticate(u.ID, loginClaims.SessionID, "password123", "")
+	require.NoError(test, err)
+	claims, err := service.parseAccessToken(elevated.AccessToken)
+	require.NoError(test, err)
+	assert.Equal(test, loginClaims.SessionID, claims.SessionID)
+	require.NotNil(test, claims.AuthTime)
+	assert.WithinDuration(test, time.Now(), claims.AuthTime.Time, 2*time.Second)
+	assert.LessOrEqual(test, time.Until(elevated.ExpiresAt), RecentAuthMaxAge)
+
+	secret, _ := enableTwoFactorForTest(test, service, u.ID)
+	_, err = service.Reauthenticate(u.ID, loginClaims.SessionID, "", "000000")
+	assert.ErrorIs(test, err, ErrInvalidTwoFactorCode)
+	_, err = service.Reauthenticate(u.ID, loginClaims.SessionID, "", nextTOTPCodeForTest(test, secret))
+	require.NoError(test, err)
+
+	require.NoError(test, service.RevokeSession(u.ID, loginClaims.SessionID))
+	_, err = service.Reauthenticate(u.ID, loginClaims.SessionID, "password123", "")
+	assert.ErrorIs(test, err, ErrSessionNotFound)
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Asymmetric access token signing algorithms. They let other services verify tokens with the public
+// keys from the JWKS endpoint; HS256 with the shared JWTSecret remains for local development.
+const (
+	SigningAlgorithmRS256 = "RS256"
+	SigningAlgorithmEdDSA = "EdDSA"
+)
+
+// minRSAKeyBits is the smallest RSA modulus accepted for signing keys.
+const minRSAKeyBits = 2048
+
+// En: SigningKey is an asymmetric key that signs or verifies access tokens, identified by its kid.
+// Previous keys keep only PublicKey and stay valid for verification until RetireAt (zero means no limit).
+// Es: SigningKey es una clave asimétrica que firma o verifica tokens de acceso, identificada por su kid.
+// Las claves anteriores conservan solo PublicKey y siguen siendo válidas para verificar hasta RetireAt (cero significa sin límite).
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+	RetireAt   time.Time
+}
+
+// En: ParseSigningKey builds a SigningKey from PEM data (PKCS#8 or PKCS#1 private key, PKIX public key).
+// The public key is derived from the private key when only the latter is given.
+// Es: ParseSigningKey construye una SigningKey a partir de datos PEM (clave privada PKCS#8 o PKCS#1, clave pública PKIX).
+// La clave pública se deriva de la privada cuando solo se proporciona esta última.
+func ParseSigningKey(id, algorithm, privateKeyPEM, publicKeyPEM string, retireAt time.Time) (*SigningKey, error) {
+	if id == "" {
+		return nil, fmt.Errorf("signing key: kid is required")
+	}
+	key := &SigningKey{ID: id, Algorithm: algorithm, RetireAt: retireAt}
+
+	if privateKeyPEM != "" {
+		signer, err := parsePrivateKeyPEM(privateKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q: %w", id, err)
+		}
+		key.PrivateKey = signer
+		key.PublicKey = signer.Public()
+	} else if publicKeyPEM != "" {
+		publicKey, err := parsePublicKeyPEM(publicKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q: %w", id, err)
+		}
+		key.PublicKey = publicKey
+	} else {
+		return nil, fmt.Errorf("signing key %q: a private or public key is required", id)
+	}
+
+	if err := key.checkAlgorithm(); err != nil {
+		return nil, fmt.Errorf("signing key %q: %w", id, err)
+	}
+	return key, nil
+}
+
+// checkAlgorithm verifies that the key type matches the declared algorithm.
+func (key *SigningKey) checkAlgorithm() error {
+	switch key.Algorithm {
+	case SigningAlgorithmRS256:
+		publicKey, ok := key.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("RS256 requires an RSA key")
+		}
+		if publicKey.N.BitLen() < minRSAKeyBits {
+			return fmt.Errorf("RSA key must be at least %d bits", minRSAKeyBits)
+		}
+	case SigningAlgorithmEdDSA:
+		if _, ok := key.PublicKey.(ed25519.PublicKey); !ok {
+			return fmt.Errorf("EdDSA requires an Ed25519 key")
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q", key.Algorithm)
+	}
+	return nil
+}
+
+// isRetired reports whether the rotation window of the key has ended.
+func (key *SigningKey) isRetired(now time.Time) bool {
+	return !key.RetireAt.IsZero() && !now.Before(key.RetireAt)
+}
+
+// signingMethod returns the jwt signing method of the key.
+func (key *SigningKey) signingMethod() jwt.SigningMethod {
+	if key.Algorithm == SigningAlgorithmEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// jwk returns the public part of the key as a JWKS entry.
+func (key *SigningKey) jwk() jsonWebKey {
+	entry := jsonWebKey{Kid: key.ID, Use: "sig", Alg: key.Algorithm}
+	switch publicKey := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		entry.Kty = "RSA"
+		entry.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		entry.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	case ed25519.PublicKey:
+		entry.Kty = "OKP"
+		entry.Crv = "Ed25519"
+		entry.X = base64.RawURLEncoding.EncodeToString(publicKey)
+	}
+	return entry
+}
+
+// En: SigningKeySet holds the key that signs new access tokens and the previous keys still accepted during a rotation.
+// Es: SigningKeySet contiene la clave que firma los nuevos tokens de acceso y las claves anteriores aún aceptadas durante una rotación.
+type SigningKeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// En: NewSigningKeySet builds a key set; the active key must be in keys and hold a private key.
+// Es: NewSigningKeySet construye un conjunto de claves; la clave activa debe estar en keys y tener clave privada.
+func NewSigningKeySet(activeKeyID string, keys ...*SigningKey) (*SigningKeySet, error) {
+	set := &SigningKeySet{keys: make(map[string]*SigningKey, len(keys))}
+	for _, key := range keys {
+		if _, exists := set.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate signing key %q", key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+
+	active, ok := set.keys[activeKeyID]
+	if !ok {
+		return nil, fmt.Errorf("active signing key %q not found", activeKeyID)
+	}
+	if active.PrivateKey == nil {
+		return nil, fmt.Errorf("active signing key %q has no private key", activeKeyID)
+	}
+	set.active = active
+	return set, nil
+}
+
+// sign signs the claims with the active key and sets its kid header.
+func (set *SigningKeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(set.active.signingMethod(), claims)
+	token.Header["kid"] = set.active.ID
+	return token.SignedString(set.active.PrivateKey)
+}
+
+// verificationKey picks the public key named by the kid header; unknown, retired or mismatched keys are rejected.
+func (set *SigningKeySet) verificationKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := set.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), kid)
+	}
+	if key != set.active && key.isRetired(time.Now()) {
+		return nil, fmt.Errorf("signing key %q is retired", kid)
+	}
+	return key.PublicKey, nil
+}
+
+// jwks returns the public keys that verifiers should currently accept.
+func (set *SigningKeySet) jwks() []jsonWebKey {
+	now := time.Now()
+	var previous []jsonWebKey
+	for _, key := range set.keys {
+		if key == set.active || key.isRetired(now) {
+			continue
+		}
+		previous = append(previous, key.jwk())
+	}
+	sort.Slice(previous, func(i, j int) bool { return previous[i].Kid < previous[j].Kid })
+	return append([]jsonWebKey{set.active.jwk()}, previous...)
+}
+
+// parsePrivateKeyPEM decodes a PKCS#8 (RSA or Ed25519) or PKCS#1 (RSA) private key.
+func parsePrivateKeyPEM(data string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("invalid private key PEM")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// parsePublicKeyPEM decodes a PKIX public key.
+func parsePublicKeyPEM(data string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("invalid public key PEM")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+	return key, nil
+}
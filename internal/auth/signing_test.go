@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudflax/api.cloudflax/internal/shared/database"
+	"github.com/cloudflax/api.cloudflax/internal/user"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// En: newEd25519KeyForTest generates an Ed25519 key and parses it back from PKCS#8 PEM.
+// Es: newEd25519KeyForTest genera una clave Ed25519 y la vuelve a leer desde PEM PKCS#8.
+func newEd25519KeyForTest(test *testing.T, id string, retireAt time.Time) *SigningKey {
+	test.Helper()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(test, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(test, err)
+
+	key, err := ParseSigningKey(id, SigningAlgorithmEdDSA, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), "", retireAt)
+	require.NoError(test, err)
+	return key
+}
+
+// En: setupSigningServiceTest creates a service that signs access tokens with the given key set.
+// Es: setupSigningServiceTest crea un servicio que firma los tokens de acceso con el conjunto de claves dado.
+func setupSigningServiceTest(test *testing.T, keys *SigningKeySet) *Service {
+	test.Helper()
+	require.NoError(test, database.InitForTesting())
+	require.NoError(test, database.RunMigrations(&user.User{}, &UserAuthProvider{}, &RefreshToken{}, &PasswordResetToken{}, &OAuthState{}, &TOTPCredential{}, &RecoveryCode{}, &MFAChallenge{}, &Session{}, &RevokedAccessToken{}, &EmailChangeToken{}, &MagicLinkToken{}, &EmailVerificationCode{}, &DeviceAuthorization{}, &OAuthAuthorizationCode{}, &OAuthGrant{}))
+	return NewService(NewRepository(database.DB), user.NewRepository(database.DB), ServiceOptions{
+		JWTSecret:   testJWTSecret,
+		SigningKeys: keys,
+	})
+}
+
+// En: TestParseSigningKeyRSA checks RS256 keys from PKCS#1 private and PKIX public PEM.
+// Es: TestParseSigningKeyRSA comprueba claves RS256 desde PEM privado PKCS#1 y público PKIX.
+func TestParseSigningKeyRSA(test *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(test, err)
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(test, err)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	key, err := ParseSigningKey("rsa-1", SigningAlgorithmRS256, string(privatePEM), "", time.Time{})
+	require.NoError(test, err)
+	assert.NotNil(test, key.PrivateKey)
+
+	verifyOnly, err := ParseSigningKey("rsa-0", SigningAlgorithmRS256, "", string(publicPEM), time.Time{})
+	require.NoError(test, err)
+	assert.Nil(test, verifyOnly.PrivateKey)
+
+	_, err = ParseSigningKey("rsa-1", SigningAlgorithmEdDSA, string(privatePEM), "", time.Time{})
+	assert.Error(test, err, "algorithm must match the key type")
+}
+
+// En: TestSigningKeySetRequiresActivePrivateKey checks that the active key must be able to sign.
+// Es: TestSigningKeySetRequiresActivePrivateKey comprueba que la clave activa debe poder firmar.
+func TestSigningKeySetRequiresActivePrivateKey(test *testing.T) {
+	key := newEd25519KeyForTest(test, "k1", time.Time{})
+	publicOnly := &SigningKey{ID: "k0", Algorithm: SigningAlgorithmEdDSA, PublicKey: key.PublicKey}
+
+	_, err := NewSigningKeySet("missing", key)
+	assert.Error(test, err)
+	_, err = NewSigningKeySet("k0", publicOnly)
+	assert.Error(test, err)
+	_, err = NewSigningKeySet("k1", key, key)
+	assert.Error(test, err)
+}
+
+// En: TestServiceAsymmetricSigningWithKid checks that access tokens carry the kid and verify against the key set.
+// Es: TestServiceAsymmetricSigningWithKid comprueba que los tokens de acceso llevan el kid y se verifican con el conjunto de claves.
+func TestServiceAsymmetricSigningWithKid(test *testing.T) {
+	keys, err := NewSigningKeySet("k1", newEd25519KeyForTest(test, "k1", time.Time{}))
+	require.NoError(test, err)
+	service := setupSigningServiceTest(test, keys)
+	seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+
+	pair, err := service.Login("alice@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+
+	token, _, err := jwt.NewParser().ParseUnverified(pair.AccessToken, &Claims{})
+	require.NoError(test, err)
+	assert.Equal(test, "EdDSA", token.Method.Alg())
+	assert.Equal(test, "k1", token.Header["kid"])
+
+	userID, email, err := service.ValidateAccessToken(pair.AccessToken)
+	require.NoError(test, err)
+	assert.NotEmpty(test, userID)
+	assert.Equal(test, "alice@example.com", email)
+
+	// An HS256 token signed with the shared secret is no longer accepted.
+	hmacToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: userID}).SignedString([]byte(testJWTSecret))
+	require.NoError(test, err)
+	_, _, err = service.ValidateAccessToken(hmacToken)
+	assert.Error(test, err)
+}
+
+// En: TestServiceSigningKeyRotationWindow checks that tokens of the previous key verify until it is retired.
+// Es: TestServiceSigningKeyRotationWindow comprueba que los tokens de la clave anterior se verifican hasta que se retira.
+func TestServiceSigningKeyRotationWindow(test *testing.T) {
+	previous := newEd25519KeyForTest(test, "k1", time.Time{})
+	oldKeys, err := NewSigningKeySet("k1", previous)
+	require.NoError(test, err)
+	oldService := setupSigningServiceTest(test, oldKeys)
+	seedVerifiedUser(test, "Alice", "alice@example.com", "password123")
+	pair, err := oldService.Login("alice@example.com", "password123", SessionMetadata{})
+	require.NoError(test, err)
+
+	current := newEd25519KeyForTest(test, "k2", time.Time{})
+	inWindow := &SigningKey{ID: "k1", Algorithm: SigningAlgorithmEdDSA, PublicKey: previous.PublicKey, RetireAt: time.Now().Add(time.Hour)}
+	rotatedKeys, err := NewSigningKeySet("k2", current, inWindow)
+	require.NoError(test, err)
+	rotated := NewService(oldService.repository, oldService.userRepository, ServiceOptions{SigningKeys: rotatedKeys})
+
+	_, _, err = rotated.ValidateAccessToken(pair.AccessToken)
+	assert.NoError(test, err, "previous key is accepted during the rotation window")
+	assert.Len(test, rotated.jwks(), 2)
+
+	retired := &SigningKey{ID: "k1", Algorithm: SigningAlgorithmEdDSA, PublicKey: previous.PublicKey, RetireAt: time.Now().Add(-time.Minute)}
+	retiredKeys, err := NewSigningKeySet("k2", current, retired)
+	require.NoError(test, err)
+	afterWindow := NewService(oldService.repository, oldService.userRepository, ServiceOptions{SigningKeys: retiredKeys})
+
+	_, _, err = afterWindow.ValidateAccessToken(pair.AccessToken)
+	assert.Error(test, err, "retired key is rejected")
+	assert.Len(test, afterWindow.jwks(), 1)
+}
+
+// En: TestJWKSHandler checks the public key set published at /.well-known/jwks.json.
+// Es: TestJWKSHandler comprueba el conjunto de claves públicas publicado en /.well-known/jwks.json.
+func TestJWKSHandler(test *testing.T) {
+	keys, err := NewSigningKeySet("k1", newEd25519KeyForTest(test, "k1", time.Time{}))
+	require.NoError(test, err)
+	handler := NewHandler(setupSigningServiceTest(test, keys))
+
+	app := fiber.New()
+	app.Get("/.well-known/jwks.json", handler.JWKS)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/.well-known/jwks.json", nil), fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+	require.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&body))
+	require.Len(test, body.Keys, 1)
+	assert.Equal(test, "k1", body.Keys[0].Kid)
+	assert.Equal(test, "OKP", body.Keys[0].Kty)
+	assert.Equal(test, "Ed25519", body.Keys[0].Crv)
+	assert.Equal(test, "EdDSA", body.Keys[0].Alg)
+	assert.NotEmpty(test, body.Keys[0].X)
+}
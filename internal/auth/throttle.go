@@ -0,0 +1,496 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	shareddynamodb "github.com/cloudflax/api.cloudflax/internal/shared/dynamodb"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const throttleStateSK = "STATE"
+
+// En: ErrRateLimited indicates a throttle limit was reached.
+// Es: ErrRateLimited indica que se alcanzó un límite de throttle.
+var ErrRateLimited = errors.New("rate limited")
+
+// En: RateLimitError reports how long to wait before retrying and the dimension (ThrottleDimensionEmail or
+// ThrottleDimensionIP) that tripped.
+// Es: RateLimitError informa cuánto esperar antes de reintentar y la dimensión (ThrottleDimensionEmail o
+// ThrottleDimensionIP) que lo activó.
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Dimension  string
+}
+
+// En: Error returns the throttle reason message.
+// Es: Error devuelve el mensaje del motivo del throttle.
+func (e *RateLimitError) Error() string {
+	return ErrRateLimited.Error()
+}
+
+// En: Is reports whether target is ErrRateLimited.
+// Es: Is indica si target es ErrRateLimited.
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// En: DynamoThrottleOptions configures the DynamoDB table and client of a throttle store.
+// Es: DynamoThrottleOptions configura la tabla y el cliente de DynamoDB de un almacén de throttle.
+type DynamoThrottleOptions struct {
+	TableName       string
+	EndpointURL     string
+	Region          string
+	Profile         string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// En: throttlePolicy configures the throttle state machine: attempts allowed before a lock, the pause between
+// attempts, the lock length and, optionally, the window after which the attempt counter starts over.
+// Es: throttlePolicy configura la máquina de estados del throttle: intentos permitidos antes del bloqueo, la pausa
+// entre intentos, la duración del bloqueo y, opcionalmente, la ventana tras la cual el contador vuelve a empezar.
+type throttlePolicy struct {
+	CooldownSeconds int64
+	MaxAttempts     int64
+	LockSeconds     int64
+	// WindowSeconds resets the counter once the first attempt is older than the window; 0 keeps counting until the lock.
+	WindowSeconds   int64
+	StateTTLSeconds int64
+}
+
+// En: throttleStore persists throttle state by key; update must apply fn atomically (compare-and-swap or row lock).
+// Es: throttleStore persiste el estado de throttle por clave; update debe aplicar fn de forma atómica (compare-and-swap o bloqueo de fila).
+type throttleStore interface {
+	load(ctx context.Context, key string) (*resendGuardState, error)
+	// update stores the state returned by fn; a nil state (and nil error) leaves the record untouched.
+	update(ctx context.Context, key string, fn func(current *resendGuardState) (*resendGuardState, error)) error
+}
+
+type resendGuardState struct {
+	Exists         bool
+	Version        int64
+	Count          int64
+	WindowStart    int64
+	NextAllowedAt  int64
+	LockUntil      int64
+	CreatedAt      int64
+	UpdatedAt      int64
+	ExpiresAt      int64
+	OriginalPK     string
+	OriginalSK     string
+	OriginalItem   map[string]types.AttributeValue
+	HasLockUntil   bool
+	HasCount       bool
+	HasVersion     bool
+	HasWindowStart bool
+}
+
+// evaluateThrottleState consumes one attempt under policy or returns the rate-limit error with the remaining wait.
+func evaluateThrottleState(policy throttlePolicy, current *resendGuardState, now int64) (*resendGuardState, error) {
+	if current == nil || !current.Exists {
+		return policy.freshState(now), nil
+	}
+
+	if current.LockUntil > now {
+		return nil, &ResendVerificationRateLimitError{
+			RetryAfter: time.Duration(current.LockUntil-now) * time.Second,
+		}
+	}
+
+	if current.Count >= policy.MaxAttempts || policy.windowExpired(current, now) {
+		return policy.freshStateFrom(current, now), nil
+	}
+
+	if current.NextAllowedAt > now {
+		return nil, &ResendVerificationRateLimitError{
+			RetryAfter: time.Duration(current.NextAllowedAt-now) * time.Second,
+		}
+	}
+
+	next := policy.freshStateFrom(current, now)
+	next.Count = current.Count + 1
+	if current.WindowStart > 0 {
+		next.WindowStart = current.WindowStart
+	}
+	if next.Count >= policy.MaxAttempts {
+		next.LockUntil = now + policy.LockSeconds
+		next.ExpiresAt = next.LockUntil + policy.StateTTLSeconds
+	}
+
+	return next, nil
+}
+
+// windowExpired reports whether the counting window of current has elapsed.
+func (policy throttlePolicy) windowExpired(current *resendGuardState, now int64) bool {
+	return policy.WindowSeconds > 0 && current.WindowStart > 0 && now-current.WindowStart >= policy.WindowSeconds
+}
+
+// freshState is the state after the first attempt on a key.
+func (policy throttlePolicy) freshState(now int64) *resendGuardState {
+	return &resendGuardState{
+		OriginalPK:    "",
+		OriginalSK:    throttleStateSK,
+		Version:       1,
+		Count:         1,
+		WindowStart:   now,
+		NextAllowedAt: now + policy.CooldownSeconds,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		ExpiresAt:     now + policy.CooldownSeconds + policy.StateTTLSeconds,
+	}
+}
+
+// freshStateFrom starts a new counting window on an existing record, keeping its key, creation time and version.
+func (policy throttlePolicy) freshStateFrom(current *resendGuardState, now int64) *resendGuardState {
+	if current == nil {
+		return policy.freshState(now)
+	}
+
+	createdAt := current.CreatedAt
+	if createdAt == 0 {
+		createdAt = now
+	}
+
+	return &resendGuardState{
+		Exists:        current.Exists,
+		OriginalPK:    current.OriginalPK,
+		OriginalSK:    current.OriginalSK,
+		Version:       current.Version + 1,
+		Count:         1,
+		WindowStart:   now,
+		CreatedAt:     createdAt,
+		UpdatedAt:     now,
+		NextAllowedAt: now + policy.CooldownSeconds,
+		ExpiresAt:     now + policy.CooldownSeconds + policy.StateTTLSeconds,
+	}
+}
+
+// throttleKey builds the key of one throttle record; the value (email, IP) is stored only as a SHA-256 hash.
+func throttleKey(scope, dimension, value string) string {
+	return fmt.Sprintf("THROTTLE#%s#%s#%s", scope, dimension, sha256Hex(value))
+}
+
+// En: memoryThrottleStore keeps throttle state in process memory (tests and single-instance development).
+// Es: memoryThrottleStore guarda el estado de throttle en memoria del proceso (tests y desarrollo con una instancia).
+type memoryThrottleStore struct {
+	mu     sync.Mutex
+	states map[string]resendGuardState
+	now    func() time.Time
+}
+
+func newMemoryThrottleStore(now func() time.Time) *memoryThrottleStore {
+	return &memoryThrottleStore{states: make(map[string]resendGuardState), now: now}
+}
+
+func (s *memoryThrottleStore) load(_ context.Context, key string) (*resendGuardState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(key), nil
+}
+
+func (s *memoryThrottleStore) update(_ context.Context, key string, fn func(current *resendGuardState) (*resendGuardState, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next, err := fn(s.get(key))
+	if err != nil || next == nil {
+		return err
+	}
+
+	now := s.now().Unix()
+	for k, state := range s.states {
+		if state.ExpiresAt <= now {
+			delete(s.states, k)
+		}
+	}
+	next.Exists = true
+	next.OriginalPK = key
+	s.states[key] = *next
+	return nil
+}
+
+// get returns a copy of the stored state; expired entries read as absent like DynamoDB items past their TTL.
+func (s *memoryThrottleStore) get(key string) *resendGuardState {
+	state, ok := s.states[key]
+	if !ok || state.ExpiresAt <= s.now().Unix() {
+		return &resendGuardState{}
+	}
+	return &state
+}
+
+// En: postgresThrottleStore keeps throttle state in the throttle_states table; update locks the row (SELECT ... FOR UPDATE).
+// Rows past expires_at read as absent, like DynamoDB items past their TTL, until maintenance deletes them.
+// Es: postgresThrottleStore guarda el estado de throttle en la tabla throttle_states; update bloquea la fila (SELECT ... FOR UPDATE).
+// Las filas con expires_at vencido se leen como ausentes, igual que los ítems de DynamoDB tras su TTL, hasta que el mantenimiento las borra.
+type postgresThrottleStore struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+func (s *postgresThrottleStore) load(ctx context.Context, key string) (*resendGuardState, error) {
+	var row ThrottleState
+	err := s.db.WithContext(ctx).Where("id = ? AND expires_at > ?", key, s.now().Unix()).Take(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &resendGuardState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return throttleStateFromRow(&row), nil
+}
+
+func (s *postgresThrottleStore) update(ctx context.Context, key string, fn func(current *resendGuardState) (*resendGuardState, error)) error {
+	const maxRetries = 4
+	for range maxRetries {
+		inserted := true
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var row ThrottleState
+			current := &resendGuardState{}
+			rowExists := false
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", key).Take(&row).Error
+			switch {
+			case err == nil:
+				rowExists = true
+				if row.ExpiresAt > s.now().Unix() {
+					current = throttleStateFromRow(&row)
+				}
+			case !errors.Is(err, gorm.ErrRecordNotFound):
+				return fmt.Errorf("load throttle state: %w", err)
+			}
+
+			next, err := fn(current)
+			if err != nil || next == nil {
+				return err
+			}
+
+			row = ThrottleState{
+				ID:            key,
+				Version:       next.Version,
+				Count:         next.Count,
+				WindowStart:   next.WindowStart,
+				NextAllowedAt: next.NextAllowedAt,
+				LockUntil:     next.LockUntil,
+				CreatedAt:     next.CreatedAt,
+				UpdatedAt:     next.UpdatedAt,
+				ExpiresAt:     next.ExpiresAt,
+			}
+			if rowExists {
+				return tx.Save(&row).Error
+			}
+			// A concurrent request may insert the same key first; retry so it is read under the row lock.
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&row)
+			inserted = result.RowsAffected > 0
+			return result.Error
+		})
+		if err != nil {
+			return err
+		}
+		if inserted {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("store throttle state: too much contention")
+}
+
+func throttleStateFromRow(row *ThrottleState) *resendGuardState {
+	return &resendGuardState{
+		Exists:         true,
+		OriginalPK:     row.ID,
+		OriginalSK:     throttleStateSK,
+		Version:        row.Version,
+		Count:          row.Count,
+		WindowStart:    row.WindowStart,
+		NextAllowedAt:  row.NextAllowedAt,
+		LockUntil:      row.LockUntil,
+		CreatedAt:      row.CreatedAt,
+		UpdatedAt:      row.UpdatedAt,
+		ExpiresAt:      row.ExpiresAt,
+		HasLockUntil:   row.LockUntil > 0,
+		HasCount:       true,
+		HasVersion:     true,
+		HasWindowStart: true,
+	}
+}
+
+type dynamoAPI interface {
+	GetItem(ctx context.Context, params *awsdynamodb.GetItemInput, optFns ...func(*awsdynamodb.Options)) (*awsdynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *awsdynamodb.PutItemInput, optFns ...func(*awsdynamodb.Options)) (*awsdynamodb.PutItemOutput, error)
+}
+
+// En: dynamoThrottleStore keeps throttle state in DynamoDB with optimistic locking on the version attribute.
+// Es: dynamoThrottleStore guarda el estado de throttle en DynamoDB con bloqueo optimista sobre el atributo version.
+type dynamoThrottleStore struct {
+	client    dynamoAPI
+	tableName string
+}
+
+// newDynamoThrottleStore builds the DynamoDB throttle store; it returns nil when no table is configured.
+func newDynamoThrottleStore(ctx context.Context, opts DynamoThrottleOptions) (*dynamoThrottleStore, error) {
+	tableName := strings.TrimSpace(opts.TableName)
+	if tableName == "" {
+		return nil, nil
+	}
+
+	client, err := shareddynamodb.NewClient(ctx, shareddynamodb.ClientOptions{
+		EndpointURL:     opts.EndpointURL,
+		Region:          opts.Region,
+		Profile:         opts.Profile,
+		AccessKeyID:     opts.AccessKeyID,
+		SecretAccessKey: opts.SecretAccessKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create dynamodb client for throttle store: %w", err)
+	}
+
+	return &dynamoThrottleStore{client: client, tableName: tableName}, nil
+}
+
+func (s *dynamoThrottleStore) load(ctx context.Context, pk string) (*resendGuardState, error) {
+	out, err := s.client.GetItem(ctx, &awsdynamodb.GetItemInput{
+		TableName:      aws.String(s.tableName),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: pk},
+			"sk": &types.AttributeValueMemberS{Value: throttleStateSK},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	state := &resendGuardState{}
+	if len(out.Item) == 0 {
+		return state, nil
+	}
+
+	state.Exists = true
+	state.OriginalItem = out.Item
+	state.OriginalPK = attrString(out.Item["pk"])
+	state.OriginalSK = attrString(out.Item["sk"])
+	state.Version, state.HasVersion = attrInt64(out.Item["version"])
+	state.Count, state.HasCount = attrInt64(out.Item["count"])
+	state.WindowStart, state.HasWindowStart = attrInt64(out.Item["window_start"])
+	state.NextAllowedAt, _ = attrInt64(out.Item["next_allowed_at"])
+	state.LockUntil, state.HasLockUntil = attrInt64(out.Item["lock_until"])
+	state.CreatedAt, _ = attrInt64(out.Item["created_at"])
+	state.UpdatedAt, _ = attrInt64(out.Item["updated_at"])
+	state.ExpiresAt, _ = attrInt64(out.Item["expires_at"])
+
+	return state, nil
+}
+
+func (s *dynamoThrottleStore) update(ctx context.Context, pk string, fn func(current *resendGuardState) (*resendGuardState, error)) error {
+	const maxRetries = 4
+	for range maxRetries {
+		current, err := s.load(ctx, pk)
+		if err != nil {
+			return fmt.Errorf("load throttle state: %w", err)
+		}
+
+		next, err := fn(current)
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			return nil
+		}
+		if next.OriginalPK == "" {
+			next.OriginalPK = pk
+		}
+		if next.OriginalSK == "" {
+			next.OriginalSK = throttleStateSK
+		}
+
+		if err := s.put(ctx, current, next); err != nil {
+			var ccf *types.ConditionalCheckFailedException
+			if errors.As(err, &ccf) {
+				continue
+			}
+			return fmt.Errorf("store throttle state: %w", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("store throttle state: too much contention")
+}
+
+func (s *dynamoThrottleStore) put(ctx context.Context, current, next *resendGuardState) error {
+	item := map[string]types.AttributeValue{
+		"pk":              &types.AttributeValueMemberS{Value: next.OriginalPK},
+		"sk":              &types.AttributeValueMemberS{Value: next.OriginalSK},
+		"version":         &types.AttributeValueMemberN{Value: strconv.FormatInt(next.Version, 10)},
+		"count":           &types.AttributeValueMemberN{Value: strconv.FormatInt(next.Count, 10)},
+		"window_start":    &types.AttributeValueMemberN{Value: strconv.FormatInt(next.WindowStart, 10)},
+		"next_allowed_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(next.NextAllowedAt, 10)},
+		"created_at":      &types.AttributeValueMemberN{Value: strconv.FormatInt(next.CreatedAt, 10)},
+		"updated_at":      &types.AttributeValueMemberN{Value: strconv.FormatInt(next.UpdatedAt, 10)},
+		"expires_at":      &types.AttributeValueMemberN{Value: strconv.FormatInt(next.ExpiresAt, 10)},
+	}
+	if next.LockUntil > 0 {
+		item["lock_until"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(next.LockUntil, 10)}
+	}
+
+	input := &awsdynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      item,
+	}
+	if current.Exists {
+		input.ConditionExpression = aws.String("#version = :expectedVersion")
+		input.ExpressionAttributeNames = map[string]string{
+			"#version": "version",
+		}
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":expectedVersion": &types.AttributeValueMemberN{Value: strconv.FormatInt(current.Version, 10)},
+		}
+	} else {
+		input.ConditionExpression = aws.String("attribute_not_exists(pk) AND attribute_not_exists(sk)")
+	}
+
+	_, err := s.client.PutItem(ctx, input)
+	return err
+}
+
+func attrInt64(v types.AttributeValue) (int64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	nv, ok := v.(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(nv.Value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func attrString(v types.AttributeValue) string {
+	if v == nil {
+		return ""
+	}
+	sv, ok := v.(*types.AttributeValueMemberS)
+	if !ok {
+		return ""
+	}
+	return sv.Value
+}
+
+func sha256Hex(input string) string {
+	sum := sha256.Sum256([]byte(input))
+	return hex.EncodeToString(sum[:])
+}
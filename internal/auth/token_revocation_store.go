@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	shareddynamodb "github.com/cloudflax/api.cloudflax/internal/shared/dynamodb"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const revokedTokenSK = "REVOKED"
+
+// En: TokenRevocationStore is the denylist of access tokens revoked before they expire.
+// Keys are "jti:<token id>" for one token or "sid:<session id>" for every token of a session;
+// entries only need to live until expiresAt, when the tokens they cover expire anyway.
+// Es: TokenRevocationStore es la lista de denegación de tokens de acceso revocados antes de expirar.
+// Las claves son "jti:<id del token>" para un token o "sid:<id de sesión>" para todos los tokens de una sesión;
+// las entradas solo deben vivir hasta expiresAt, cuando los tokens que cubren expiran de todas formas.
+type TokenRevocationStore interface {
+	Revoke(ctx context.Context, key string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, key string) (bool, error)
+}
+
+// En: memoryTokenRevocationStore keeps the denylist in process memory (tests and single-instance development).
+// Es: memoryTokenRevocationStore guarda la lista de denegación en memoria del proceso (tests y desarrollo con una instancia).
+type memoryTokenRevocationStore struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+	now     func() time.Time
+}
+
+// En: NewMemoryTokenRevocationStore builds an in-memory revocation store.
+// Es: NewMemoryTokenRevocationStore crea un almacén de revocación en memoria.
+func NewMemoryTokenRevocationStore() TokenRevocationStore {
+	return &memoryTokenRevocationStore{entries: make(map[string]time.Time), now: time.Now}
+}
+
+// En: Revoke adds the key to the denylist, dropping entries that already expired.
+// Es: Revoke agrega la clave a la lista de denegación y descarta las entradas ya expiradas.
+func (s *memoryTokenRevocationStore) Revoke(_ context.Context, key string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, exp := range s.entries {
+		if !exp.After(now) {
+			delete(s.entries, k)
+		}
+	}
+	if current, ok := s.entries[key]; !ok || expiresAt.After(current) {
+		s.entries[key] = expiresAt
+	}
+	return nil
+}
+
+// En: IsRevoked reports whether the key is denylisted and not yet expired.
+// Es: IsRevoked indica si la clave está en la lista de denegación y aún no expiró.
+func (s *memoryTokenRevocationStore) IsRevoked(_ context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, ok := s.entries[key]
+	return ok && expiresAt.After(s.now()), nil
+}
+
+// En: postgresTokenRevocationStore keeps the denylist in the revoked_access_tokens table.
+// Es: postgresTokenRevocationStore guarda la lista de denegación en la tabla revoked_access_tokens.
+type postgresTokenRevocationStore struct {
+	db *gorm.DB
+}
+
+// En: NewPostgresTokenRevocationStore builds a revocation store backed by the revoked_access_tokens table.
+// Es: NewPostgresTokenRevocationStore crea un almacén de revocación respaldado por la tabla revoked_access_tokens.
+func NewPostgresTokenRevocationStore(db *gorm.DB) TokenRevocationStore {
+	return &postgresTokenRevocationStore{db: db}
+}
+
+// En: Revoke upserts the key, keeping the latest expiration so a shorter revocation never shortens a longer one.
+// Es: Revoke inserta o actualiza la clave, conservando la expiración más tardía para que una revocación más corta
+// nunca acorte otra más larga.
+func (s *postgresTokenRevocationStore) Revoke(ctx context.Context, key string, expiresAt time.Time) error {
+	// SQLite (tests) spells GREATEST as the two-argument MAX.
+	greatest := "GREATEST"
+	if s.db.Dialector.Name() == "sqlite" {
+		greatest = "MAX"
+	}
+	entry := &RevokedAccessToken{ID: key, ExpiresAt: expiresAt}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"expires_at": gorm.Expr(greatest + "(revoked_access_tokens.expires_at, excluded.expires_at)"),
+		}),
+	}).Create(entry).Error
+}
+
+// En: IsRevoked reports whether an unexpired entry exists for the key.
+// Es: IsRevoked indica si existe una entrada no expirada para la clave.
+func (s *postgresTokenRevocationStore) IsRevoked(ctx context.Context, key string) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&RevokedAccessToken{}).
+		Where("id = ? AND expires_at > ?", key, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// En: DynamoTokenRevocationStoreOptions configures the DynamoDB revocation store.
+// The table uses the pk/sk layout of the throttle table with a TTL on expires_at (epoch seconds).
+// Es: DynamoTokenRevocationStoreOptions configura el almacén de revocación en DynamoDB.
+// La tabla usa el esquema pk/sk de la tabla de throttle con TTL sobre expires_at (segundos epoch).
+type DynamoTokenRevocationStoreOptions struct {
+	TableName       string
+	EndpointURL     string
+	Region          string
+	Profile         string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// En: dynamoTokenRevocationStore keeps the denylist in DynamoDB; the table TTL removes expired entries.
+// Es: dynamoTokenRevocationStore guarda la lista de denegación en DynamoDB; el TTL de la tabla elimina las entradas expiradas.
+type dynamoTokenRevocationStore struct {
+	client    dynamoAPI
+	tableName string
+	now       func() time.Time
+}
+
+// En: NewDynamoTokenRevocationStore builds a DynamoDB-backed revocation store; it returns nil when no table is configured.
+// Es: NewDynamoTokenRevocationStore crea un almacén de revocación con DynamoDB; devuelve nil si no hay tabla configurada.
+func NewDynamoTokenRevocationStore(ctx context.Context, opts DynamoTokenRevocationStoreOptions) (TokenRevocationStore, error) {
+	tableName := strings.TrimSpace(opts.TableName)
+	if tableName == "" {
+		return nil, nil
+	}
+
+	client, err := shareddynamodb.NewClient(ctx, shareddynamodb.ClientOptions{
+		EndpointURL:     opts.EndpointURL,
+		Region:          opts.Region,
+		Profile:         opts.Profile,
+		AccessKeyID:     opts.AccessKeyID,
+		SecretAccessKey: opts.SecretAccessKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create dynamodb client for token revocation store: %w", err)
+	}
+
+	return &dynamoTokenRevocationStore{
+		client:    client,
+		tableName: tableName,
+		now:       time.Now,
+	}, nil
+}
+
+// En: Revoke writes the denylist entry with its TTL unless an entry with a later expiration already exists.
+// Es: Revoke escribe la entrada de la lista de denegación con su TTL salvo que ya exista una con expiración más tardía.
+func (s *dynamoTokenRevocationStore) Revoke(ctx context.Context, key string, expiresAt time.Time) error {
+	expiresAtValue := &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.Unix(), 10)}
+	_, err := s.client.PutItem(ctx, &awsdynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item: map[string]types.AttributeValue{
+			"pk":         &types.AttributeValueMemberS{Value: revokedTokenPK(key)},
+			"sk":         &types.AttributeValueMemberS{Value: revokedTokenSK},
+			"created_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(s.now().Unix(), 10)},
+			"expires_at": expiresAtValue,
+		},
+		ConditionExpression:       aws.String("attribute_not_exists(pk) OR expires_at < :expiresAt"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":expiresAt": expiresAtValue},
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			// The stored entry already outlives this one.
+			return nil
+		}
+		return fmt.Errorf("store revoked token: %w", err)
+	}
+	return nil
+}
+
+// En: IsRevoked reads the entry; expired items are ignored because TTL deletion is not immediate.
+// Es: IsRevoked lee la entrada; los ítems expirados se ignoran porque el borrado por TTL no es inmediato.
+func (s *dynamoTokenRevocationStore) IsRevoked(ctx context.Context, key string) (bool, error) {
+	out, err := s.client.GetItem(ctx, &awsdynamodb.GetItemInput{
+		TableName:      aws.String(s.tableName),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: revokedTokenPK(key)},
+			"sk": &types.AttributeValueMemberS{Value: revokedTokenSK},
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("load revoked token: %w", err)
+	}
+	if len(out.Item) == 0 {
+		return false, nil
+	}
+	expiresAt, ok := attrInt64(out.Item["expires_at"])
+	return ok && expiresAt > s.now().Unix(), nil
+}
+
+// revokedTokenPK namespaces denylist keys in the DynamoDB table.
+func revokedTokenPK(key string) string {
+	return "REVOKED_TOKEN#" + key
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflax/api.cloudflax/internal/shared/database"
+)
+
+// fakeDynamoTable is an in-memory stand-in for the GetItem/PutItem calls of a pk/sk table.
+type fakeDynamoTable struct {
+	items map[string]map[string]types.AttributeValue
+}
+
+func (f *fakeDynamoTable) GetItem(_ context.Context, params *awsdynamodb.GetItemInput, _ ...func(*awsdynamodb.Options)) (*awsdynamodb.GetItemOutput, error) {
+	return &awsdynamodb.GetItemOutput{Item: f.items[attrString(params.Key["pk"])+"|"+attrString(params.Key["sk"])]}, nil
+}
+
+// PutItem understands the "expires_at < :expiresAt" guard of the revocation store; other conditions are not evaluated.
+func (f *fakeDynamoTable) PutItem(_ context.Context, params *awsdynamodb.PutItemInput, _ ...func(*awsdynamodb.Options)) (*awsdynamodb.PutItemOutput, error) {
+	key := attrString(params.Item["pk"]) + "|" + attrString(params.Item["sk"])
+	if existing, ok := f.items[key]; ok && params.ConditionExpression != nil && strings.Contains(*params.ConditionExpression, "expires_at < :expiresAt") {
+		current, _ := attrInt64(existing["expires_at"])
+		next, _ := attrInt64(params.ExpressionAttributeValues[":expiresAt"])
+		if current >= next {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	}
+	f.items[key] = params.Item
+	return &awsdynamodb.PutItemOutput{}, nil
+}
+
+// En: TestMemoryTokenRevocationStoreExpires verifies that entries stop matching once they expire.
+// Es: TestMemoryTokenRevocationStoreExpires verifica que las entradas dejan de coincidir al expirar.
+func TestMemoryTokenRevocationStoreExpires(test *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := &memoryTokenRevocationStore{entries: make(map[string]time.Time), now: func() time.Time { return now }}
+
+	require.NoError(test, store.Revoke(ctx, "jti:a", now.Add(time.Minute)))
+	revoked, err := store.IsRevoked(ctx, "jti:a")
+	require.NoError(test, err)
+	assert.True(test, revoked)
+
+	revoked, err = store.IsRevoked(ctx, "jti:b")
+	require.NoError(test, err)
+	assert.False(test, revoked)
+
+	now = now.Add(2 * time.Minute)
+	revoked, err = store.IsRevoked(ctx, "jti:a")
+	require.NoError(test, err)
+	assert.False(test, revoked)
+
+	require.NoError(test, store.Revoke(ctx, "jti:c", now.Add(time.Minute)))
+	assert.NotContains(test, store.entries, "jti:a", "expired entries are pruned on write")
+}
+
+// En: TestPostgresTokenRevocationStore verifies upsert and expiration with the revoked_access_tokens table.
+// Es: TestPostgresTokenRevocationStore verifica el upsert y la expiración con la tabla revoked_access_tokens.
+func TestPostgresTokenRevocationStore(test *testing.T) {
+	require.NoError(test, database.InitForTesting())
+	require.NoError(test, database.RunMigrations(&RevokedAccessToken{}))
+	ctx := context.Background()
+	store := NewPostgresTokenRevocationStore(database.DB)
+
+	require.NoError(test, store.Revoke(ctx, "sid:expired", time.Now().Add(-time.Second)))
+	revoked, err := store.IsRevoked(ctx, "sid:expired")
+	require.NoError(test, err)
+	assert.False(test, revoked)
+
+	require.NoError(test, store.Revoke(ctx, "sid:expired", time.Now().Add(time.Minute)))
+	revoked, err = store.IsRevoked(ctx, "sid:expired")
+	require.NoError(test, err)
+	assert.True(test, revoked, "revoking again extends the entry")
+
+	var count int64
+	require.NoError(test, database.DB.Model(&RevokedAccessToken{}).Count(&count).Error)
+	assert.Equal(test, int64(1), count)
+
+	require.NoError(test, store.Revoke(ctx, "sid:expired", time.Now().Add(time.Second)))
+	var entry RevokedAccessToken
+	require.NoError(test, database.DB.First(&entry, "id = ?", "sid:expired").Error)
+	assert.True(test, entry.ExpiresAt.After(time.Now().Add(30*time.Second)), "a shorter revocation keeps the later expiration")
+}
+
+// En: TestDynamoTokenRevocationStore verifies that expired items are ignored until the table TTL removes them.
+// Es: TestDynamoTokenRevocationStore verifica que los ítems expirados se ignoran hasta que el TTL de la tabla los elimina.
+func TestDynamoTokenRevocationStore(test *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	table := &fakeDynamoTable{items: make(map[string]map[string]types.AttributeValue)}
+	store := &dynamoTokenRevocationStore{client: table, tableName: "revocations", now: func() time.Time { return now }}
+
+	require.NoError(test, store.Revoke(ctx, "jti:a", now.Add(time.Minute)))
+	item := table.items[revokedTokenPK("jti:a")+"|"+revokedTokenSK]
+	require.NotNil(test, item)
+	expiresAt, ok := attrInt64(item["expires_at"])
+	require.True(test, ok)
+	assert.Equal(test, now.Add(time.Minute).Unix(), expiresAt)
+
+	revoked, err := store.IsRevoked(ctx, "jti:a")
+	require.NoError(test, err)
+	assert.True(test, revoked)
+
+	now = now.Add(2 * time.Minute)
+	revoked, err = store.IsRevoked(ctx, "jti:a")
+	require.NoError(test, err)
+	assert.False(test, revoked)
+
+	require.NoError(test, store.Revoke(ctx, "jti:b", now.Add(time.Hour)))
+	require.NoError(test, store.Revoke(ctx, "jti:b", now.Add(time.Minute)))
+	expiresAt, _ = attrInt64(table.items[revokedTokenPK("jti:b")+"|"+revokedTokenSK]["expires_at"])
+	assert.Equal(test, now.Add(time.Hour).Unix(), expiresAt, "a shorter revocation keeps the later expiration")
+
+	disabled, err := NewDynamoTokenRevocationStore(ctx, DynamoTokenRevocationStoreOptions{TableName: " "})
+	require.NoError(test, err)
+	assert.Nil(test, disabled, "an empty table name disables the DynamoDB store")
+}
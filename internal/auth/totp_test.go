@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// En: rfc6238Secret is the SHA-1 seed from RFC 6238 Appendix B ("12345678901234567890").
+// Es: rfc6238Secret es la semilla SHA-1 del Apéndice B del RFC 6238 ("12345678901234567890").
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+// En: TestTOTPCodeAtRFC6238Vectors checks the SHA-1 test vectors of RFC 6238 (last six digits).
+// Es: TestTOTPCodeAtRFC6238Vectors comprueba los vectores de prueba SHA-1 del RFC 6238 (últimos seis dígitos).
+func TestTOTPCodeAtRFC6238Vectors(test *testing.T) {
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, vector := range vectors {
+		code, err := totpCodeAt(rfc6238Secret, time.Unix(vector.unix, 0))
+		require.NoError(test, err)
+		assert.Equal(test, vector.code, code, "unix time %d", vector.unix)
+	}
+}
+
+// En: TestVerifyTOTPSkewAndReplay checks the drift window and that used steps are rejected.
+// Es: TestVerifyTOTPSkewAndReplay comprueba la ventana de desfase y que los pasos usados se rechazan.
+func TestVerifyTOTPSkewAndReplay(test *testing.T) {
+	now := time.Unix(1111111111, 0)
+	previous, err := totpCodeAt(rfc6238Secret, now.Add(-totpPeriod))
+	require.NoError(test, err)
+
+	step, ok := verifyTOTP(rfc6238Secret, previous, now, 0)
+	require.True(test, ok)
+	assert.Equal(test, totpStep(now)-1, step)
+
+	_, ok = verifyTOTP(rfc6238Secret, previous, now, step)
+	assert.False(test, ok, "replayed code must be rejected")
+
+	old, err := totpCodeAt(rfc6238Secret, now.Add(-3*totpPeriod))
+	require.NoError(test, err)
+	_, ok = verifyTOTP(rfc6238Secret, old, now, 0)
+	assert.False(test, ok, "code outside the skew window must be rejected")
+
+	_, ok = verifyTOTP(rfc6238Secret, "abc", now, 0)
+	assert.False(test, ok)
+}
+
+// En: TestTOTPProvisioningURI checks the otpauth URI format.
+// Es: TestTOTPProvisioningURI comprueba el formato del URI otpauth.
+func TestTOTPProvisioningURI(test *testing.T) {
+	uri := totpProvisioningURI("Cloudflax", "alice@example.com", "ABCDEF")
+
+	assert.True(test, strings.HasPrefix(uri, "otpauth://totp/Cloudflax:alice@example.com?"))
+	assert.Contains(test, uri, "secret=ABCDEF")
+	assert.Contains(test, uri, "issuer=Cloudflax")
+	assert.Contains(test, uri, "digits=6")
+}
@@ -1,9 +1,15 @@
 package app
 
 import (
+	"context"
+
+	"github.com/cloudflax/api.cloudflax/internal/auth"
 	"github.com/cloudflax/api.cloudflax/internal/bootstrap/config"
 	"github.com/cloudflax/api.cloudflax/internal/bootstrap/server"
+	"github.com/cloudflax/api.cloudflax/internal/maintenance"
+	"github.com/cloudflax/api.cloudflax/internal/shared/database"
 	"github.com/cloudflax/api.cloudflax/internal/shared/middleware"
+	"github.com/cloudflax/api.cloudflax/internal/user"
 	"github.com/gofiber/fiber/v3"
 )
 
@@ -12,8 +18,19 @@ func Run(cfg *config.Config) error {
 	app := fiber.New()
 
 	app.Use(middleware.Logger())
-	app.Use(middleware.CORS(cfg.FrontendURL))
-	server.Mount(app, cfg)
+	app.Use(middleware.CORS(cfg.FrontendURL, cfg.RefreshTokenDelivery == config.RefreshTokenDeliveryCookie))
+	if err := server.Mount(app, cfg); err != nil {
+		return err
+	}
+
+	if cfg.MaintenanceInterval > 0 {
+		authRepository := auth.NewRepository(database.DB)
+		service := maintenance.NewService(authRepository, user.NewRepository(database.DB), maintenance.Options{
+			BatchSize: cfg.MaintenanceBatchSize,
+		})
+		service.WithOAuthStates(authRepository).WithRevokedAccessTokens(authRepository).WithThrottleStates(authRepository)
+		go service.Schedule(context.Background(), maintenance.NewAdvisoryLock(database.DB), cfg.MaintenanceInterval)
+	}
 
 	return app.Listen(":" + cfg.Port)
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -40,10 +41,115 @@ type Config struct {
 
 	// Verification email is sent by Lambda (async).
 	LambdaSendVerifyEmailName string
-	APIThrottleTableName      string
+	// Password reset email is sent by Lambda (async).
+	LambdaSendPasswordResetEmailName string
+	// Magic link (passwordless login) email is sent by Lambda (async).
+	LambdaSendMagicLinkEmailName string
+	// Email change notice to the current address is sent by Lambda (async).
+	LambdaSendEmailChangeNoticeName string
+	// Email change confirmation link to the new address is sent by Lambda (async).
+	LambdaSendEmailChangeConfirmationName string
+	// Account invitation email is sent by Lambda (async).
+	LambdaSendInvitationEmailName string
+	APIThrottleTableName          string
+	// APIThrottleBackend stores the resend, forgot-password and login throttles: memory, postgres or dynamodb.
+	APIThrottleBackend string
+	// ResendThrottleEmail and ResendThrottleIP override the resend verification and forgot-password limits per dimension.
+	ResendThrottleEmail ThrottleLimitsConfig
+	ResendThrottleIP    ThrottleLimitsConfig
+	// TokenRevocationTableName stores the access token denylist in DynamoDB; empty keeps it in Postgres.
+	TokenRevocationTableName string
 
 	// JWTAccessTokenDuration is the signed JWT access token lifetime.
 	JWTAccessTokenDuration time.Duration
+	// JWTSigningKeys switches access tokens to RS256/EdDSA (kid + JWKS); nil keeps HS256 with JWTSecret.
+	JWTSigningKeys *secrets.SigningKeySet
+
+	// OAuthProviders lists the OIDC providers enabled for social sign-in.
+	OAuthProviders []OAuthProviderConfig
+
+	// RefreshTokenDelivery returns refresh tokens in the JSON body (body) or in an HttpOnly cookie with CSRF protection (cookie).
+	RefreshTokenDelivery string
+	// RefreshCookieSameSite is the SameSite attribute of the refresh and CSRF cookies: Strict, Lax or None.
+	RefreshCookieSameSite string
+	// RefreshCookieDomain shares the cookies with the frontend host (e.g. example.com); empty keeps them host-only.
+	RefreshCookieDomain string
+
+	// PasswordHashing selects the algorithm and cost of new password hashes; older hashes are upgraded on login.
+	PasswordHashing PasswordHashingConfig
+	// PasswordStrength are the rules new passwords must satisfy on register, reset and update.
+	PasswordStrength PasswordStrengthConfig
+	// BreachedPasswordListPath loads a local SHA-1 breach list ("<SHA1>:<count>" lines); it takes precedence over the API.
+	BreachedPasswordListPath string
+	// BreachedPasswordAPIURL queries a Pwned Passwords compatible range API (e.g. https://api.pwnedpasswords.com).
+	BreachedPasswordAPIURL string
+
+	// MaintenanceInterval is how often the API purges stale tokens in the background; zero disables the scheduler.
+	MaintenanceInterval time.Duration
+	// MaintenanceBatchSize is the number of rows removed per statement by a maintenance run.
+	MaintenanceBatchSize int
+}
+
+// OAuthProviderConfig configures one OIDC provider (Google, Facebook or any compatible issuer).
+type OAuthProviderConfig struct {
+	Name         string // google, facebook
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// PasswordHashingConfig is the password hashing policy; zero costs keep the built-in defaults.
+type PasswordHashingConfig struct {
+	Algorithm         string // bcrypt, argon2id
+	BcryptCost        int
+	Argon2MemoryKiB   int
+	Argon2Iterations  int
+	Argon2Parallelism int
+}
+
+// PasswordStrengthConfig configures the password strength rules; a zero MinLength keeps the default of 8.
+type PasswordStrengthConfig struct {
+	MinLength          int
+	RequireUppercase   bool
+	RequireLowercase   bool
+	RequireDigit       bool
+	RequireSymbol      bool
+	ForbidPersonalInfo bool
+}
+
+// ThrottleLimitsConfig overrides the policy of one throttle dimension; zero values keep the built-in default.
+type ThrottleLimitsConfig struct {
+	CooldownSeconds int
+	MaxAttempts     int
+	LockSeconds     int
+	WindowSeconds   int
+}
+
+// Throttle backends accepted in API_THROTTLE_BACKEND.
+const (
+	ThrottleBackendMemory   = "memory"
+	ThrottleBackendPostgres = "postgres"
+	ThrottleBackendDynamoDB = "dynamodb"
+)
+
+// Password hashing algorithms accepted in PASSWORD_HASH_ALGORITHM.
+const (
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashArgon2id = "argon2id"
+)
+
+// Refresh token delivery modes accepted in REFRESH_TOKEN_DELIVERY.
+const (
+	RefreshTokenDeliveryBody   = "body"
+	RefreshTokenDeliveryCookie = "cookie"
+)
+
+// defaultOAuthIssuers maps each supported provider to its public OIDC issuer. Each value must equal the iss
+// claim of the provider's ID tokens: Facebook signs them with https://www.facebook.com (www, no trailing slash).
+var defaultOAuthIssuers = map[string]string{
+	"google":   "https://accounts.google.com",
+	"facebook": "https://www.facebook.com",
 }
 
 var (
@@ -56,25 +162,44 @@ var (
 // Server settings (PORT, LOG_LEVEL) and DB_SSL_MODE come from environment variables.
 func Load() (*Config, error) {
 	cfg := &Config{
-		Port:                      getEnv("PORT", ""),
-		LogLevel:                  getEnv("LOG_LEVEL", ""),
-		DBSSLMode:                 getEnv("DB_SSL_MODE", ""),
-		DBSSLRootCert:             getEnv("DB_SSL_ROOT_CERT", ""),
-		DBSlowQueryThresholdMS:    resolveSlowQueryThresholdMS(),
-		JWTSecret:                 getEnv("JWT_SECRET", ""),
-		AppURL:                    getEnv("APP_URL", ""),
-		FrontendURL:               getEnv("FRONTEND_URL", ""),
-		AWSRegion:                 getEnv("AWS_REGION", ""),
-		AWSProfile:                getEnv("AWS_PROFILE", ""),
-		AWSEndpointURL:            awsEndpointURL(),
-		AWSAccessKeyID:            getEnv("AWS_ACCESS_KEY_ID", ""),
-		AWSSecretAccessKey:        getEnv("AWS_SECRET_ACCESS_KEY", ""),
-		SESFromAddress:            getEnv("SES_FROM_ADDRESS", ""),
-		SESEndpointURL:            getEnv("SES_ENDPOINT_URL", ""),
-		LambdaSendVerifyEmailName: getEnv("LAMBDA_SEND_VERIFY_EMAIL_NAME", ""),
-		APIThrottleTableName:      getEnv("API_THROTTLE_TABLE_NAME", ""),
-		JWTAccessTokenDuration:    jwtAccessTokenDurationFromEnv(),
+		Port:                                  getEnv("PORT", ""),
+		LogLevel:                              getEnv("LOG_LEVEL", ""),
+		DBSSLMode:                             getEnv("DB_SSL_MODE", ""),
+		DBSSLRootCert:                         getEnv("DB_SSL_ROOT_CERT", ""),
+		DBSlowQueryThresholdMS:                resolveSlowQueryThresholdMS(),
+		JWTSecret:                             getEnv("JWT_SECRET", ""),
+		AppURL:                                getEnv("APP_URL", ""),
+		FrontendURL:                           getEnv("FRONTEND_URL", ""),
+		AWSRegion:                             getEnv("AWS_REGION", ""),
+		AWSProfile:                            getEnv("AWS_PROFILE", ""),
+		AWSEndpointURL:                        awsEndpointURL(),
+		AWSAccessKeyID:                        getEnv("AWS_ACCESS_KEY_ID", ""),
+		AWSSecretAccessKey:                    getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		SESFromAddress:                        getEnv("SES_FROM_ADDRESS", ""),
+		SESEndpointURL:                        getEnv("SES_ENDPOINT_URL", ""),
+		LambdaSendVerifyEmailName:             getEnv("LAMBDA_SEND_VERIFY_EMAIL_NAME", ""),
+		LambdaSendPasswordResetEmailName:      getEnv("LAMBDA_SEND_PASSWORD_RESET_EMAIL_NAME", ""),
+		LambdaSendMagicLinkEmailName:          getEnv("LAMBDA_SEND_MAGIC_LINK_EMAIL_NAME", ""),
+		LambdaSendEmailChangeNoticeName:       getEnv("LAMBDA_SEND_EMAIL_CHANGE_NOTICE_NAME", ""),
+		LambdaSendEmailChangeConfirmationName: getEnv("LAMBDA_SEND_EMAIL_CHANGE_CONFIRMATION_NAME", ""),
+		LambdaSendInvitationEmailName:         getEnv("LAMBDA_SEND_INVITATION_EMAIL_NAME", ""),
+		APIThrottleTableName:                  getEnv("API_THROTTLE_TABLE_NAME", ""),
+		APIThrottleBackend:                    apiThrottleBackendFromEnv(),
+		ResendThrottleEmail:                   throttleLimitsFromEnv("RESEND_THROTTLE_EMAIL_"),
+		ResendThrottleIP:                      throttleLimitsFromEnv("RESEND_THROTTLE_IP_"),
+		TokenRevocationTableName:              getEnv("TOKEN_REVOCATION_TABLE_NAME", ""),
+		JWTAccessTokenDuration:                jwtAccessTokenDurationFromEnv(),
+		RefreshTokenDelivery:                  strings.ToLower(strings.TrimSpace(getEnv("REFRESH_TOKEN_DELIVERY", RefreshTokenDeliveryBody))),
+		RefreshCookieSameSite:                 getEnv("REFRESH_COOKIE_SAMESITE", "Strict"),
+		RefreshCookieDomain:                   getEnv("REFRESH_COOKIE_DOMAIN", ""),
+		PasswordHashing:                       passwordHashingFromEnv(),
+		PasswordStrength:                      passwordStrengthFromEnv(),
+		BreachedPasswordListPath:              getEnv("BREACHED_PASSWORD_LIST_PATH", ""),
+		BreachedPasswordAPIURL:                getEnv("BREACHED_PASSWORD_API_URL", ""),
+		MaintenanceInterval:                   time.Duration(getEnvInt("MAINTENANCE_INTERVAL_MINUTES", 60)) * time.Minute,
+		MaintenanceBatchSize:                  getEnvInt("MAINTENANCE_BATCH_SIZE", 1000),
 	}
+	cfg.OAuthProviders = oauthProvidersFromEnv(cfg.FrontendURL)
 
 	secretName := getEnv("AWS_SECRET_NAME", "")
 	if secretName == "" {
@@ -94,6 +219,12 @@ func Load() (*Config, error) {
 	cfg.DBPassword = dbCfg.Password()
 	cfg.DBName = dbCfg.DBName()
 
+	signingKeys, err := loadJWTSigningKeys(secretsCtx)
+	if err != nil {
+		return nil, fmt.Errorf("load jwt signing keys: %w", err)
+	}
+	cfg.JWTSigningKeys = signingKeys
+
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
@@ -133,13 +264,36 @@ func loadDBConfigFromSecrets(ctx context.Context, secretName string) (*secrets.D
 	return dbSecretsProvider.GetDBCredentials(ctx)
 }
 
+// loadJWTSigningKeys reads the JWT key set from the Secrets Manager secret JWT_SIGNING_KEYS_SECRET_NAME
+// or, for local setups, from the inline JSON in JWT_SIGNING_KEYS. It returns nil when neither is set.
+func loadJWTSigningKeys(ctx context.Context) (*secrets.SigningKeySet, error) {
+	if secretName := getEnv("JWT_SIGNING_KEYS_SECRET_NAME", ""); secretName != "" {
+		provider, err := secrets.NewSigningKeysProvider(ctx, secrets.SecretsManagerOptions{
+			EndpointURL:     awsEndpointURL(),
+			Region:          getEnv("AWS_REGION", ""),
+			SecretID:        secretName,
+			Profile:         getEnv("AWS_PROFILE", ""),
+			AccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
+			SecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return provider.GetSigningKeys(ctx)
+	}
+	if raw := getEnv("JWT_SIGNING_KEYS", ""); raw != "" {
+		return secrets.ParseSigningKeySet(raw)
+	}
+	return nil, nil
+}
+
 // Validate verifies that required configuration is present.
 func (c *Config) Validate() error {
 	if c.Port == "" {
 		return fmt.Errorf("PORT is required")
 	}
-	if c.JWTSecret == "" {
-		return fmt.Errorf("JWT_SECRET is required")
+	if c.JWTSecret == "" && c.JWTSigningKeys == nil {
+		return fmt.Errorf("JWT_SECRET is required when no JWT signing keys are configured")
 	}
 	if c.DBHost == "" {
 		return fmt.Errorf("DB_HOST is required")
@@ -153,12 +307,53 @@ func (c *Config) Validate() error {
 	if (c.DBSSLMode == "verify-full" || c.DBSSLMode == "verify-ca") && c.DBSSLRootCert == "" {
 		return fmt.Errorf("DB_SSL_ROOT_CERT is required when DB_SSL_MODE is %s", c.DBSSLMode)
 	}
+	switch c.APIThrottleBackend {
+	case ThrottleBackendMemory, ThrottleBackendPostgres:
+	case ThrottleBackendDynamoDB:
+		if strings.TrimSpace(c.APIThrottleTableName) == "" {
+			return fmt.Errorf("API_THROTTLE_TABLE_NAME is required when API_THROTTLE_BACKEND is dynamodb")
+		}
+	default:
+		return fmt.Errorf("API_THROTTLE_BACKEND must be memory, postgres or dynamodb")
+	}
+	switch c.RefreshTokenDelivery {
+	case "", RefreshTokenDeliveryBody:
+	case RefreshTokenDeliveryCookie:
+		if strings.TrimSpace(c.FrontendURL) == "" {
+			return fmt.Errorf("FRONTEND_URL is required when REFRESH_TOKEN_DELIVERY is cookie")
+		}
+		switch strings.ToLower(c.RefreshCookieSameSite) {
+		case "", "strict", "lax", "none":
+		default:
+			return fmt.Errorf("REFRESH_COOKIE_SAMESITE must be Strict, Lax or None")
+		}
+	default:
+		return fmt.Errorf("REFRESH_TOKEN_DELIVERY must be body or cookie")
+	}
 	if c.JWTAccessTokenDuration < time.Minute {
 		return fmt.Errorf("JWT_ACCESS_TOKEN_DURATION_MINUTES must be at least 1")
 	}
 	if c.JWTAccessTokenDuration > 7*24*time.Hour {
 		return fmt.Errorf("JWT_ACCESS_TOKEN_DURATION_MINUTES must not exceed 10080 (7 days)")
 	}
+	switch c.PasswordHashing.Algorithm {
+	case "", PasswordHashBcrypt, PasswordHashArgon2id:
+	default:
+		return fmt.Errorf("PASSWORD_HASH_ALGORITHM must be bcrypt or argon2id")
+	}
+	if c.PasswordHashing.BcryptCost < 0 || c.PasswordHashing.Argon2MemoryKiB < 0 || c.PasswordHashing.Argon2Iterations < 0 ||
+		c.PasswordHashing.Argon2Parallelism < 0 || c.PasswordHashing.Argon2Parallelism > 255 {
+		return fmt.Errorf("PASSWORD_BCRYPT_COST and PASSWORD_ARGON2_* must not be negative (parallelism at most 255)")
+	}
+	if c.PasswordStrength.MinLength < 0 || c.PasswordStrength.MinLength > 72 {
+		return fmt.Errorf("PASSWORD_MIN_LENGTH must be between 0 and 72")
+	}
+	if c.MaintenanceInterval < 0 {
+		return fmt.Errorf("MAINTENANCE_INTERVAL_MINUTES must not be negative")
+	}
+	if c.MaintenanceBatchSize < 0 {
+		return fmt.Errorf("MAINTENANCE_BATCH_SIZE must not be negative")
+	}
 	return nil
 }
 
@@ -178,6 +373,17 @@ func getEnvInt(key string, defaultVal int) int {
 	return defaultVal
 }
 
+// getEnvBool reads a boolean (1, true, yes, on / 0, false, no, off); unset or unparsable values keep defaultVal.
+func getEnvBool(key string, defaultVal bool) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(key))) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	}
+	return defaultVal
+}
+
 // resolveSlowQueryThresholdMS returns DB_SLOW_QUERY_THRESHOLD_MS when set to a positive value;
 // otherwise 500 in development (APP_ENV=development) and 200 for other environments.
 func resolveSlowQueryThresholdMS() int {
@@ -199,8 +405,77 @@ func awsEndpointURL() string {
 	return ""
 }
 
+// apiThrottleBackendFromEnv reads API_THROTTLE_BACKEND; when unset it is dynamodb if API_THROTTLE_TABLE_NAME
+// is set (existing deployments) and postgres otherwise, so throttling is never silently disabled.
+func apiThrottleBackendFromEnv() string {
+	if backend := strings.ToLower(strings.TrimSpace(getEnv("API_THROTTLE_BACKEND", ""))); backend != "" {
+		return backend
+	}
+	if getEnv("API_THROTTLE_TABLE_NAME", "") != "" {
+		return ThrottleBackendDynamoDB
+	}
+	return ThrottleBackendPostgres
+}
+
+// throttleLimitsFromEnv reads <prefix>COOLDOWN_SECONDS, _MAX_ATTEMPTS, _LOCK_SECONDS and _WINDOW_SECONDS.
+func throttleLimitsFromEnv(prefix string) ThrottleLimitsConfig {
+	return ThrottleLimitsConfig{
+		CooldownSeconds: getEnvInt(prefix+"COOLDOWN_SECONDS", 0),
+		MaxAttempts:     getEnvInt(prefix+"MAX_ATTEMPTS", 0),
+		LockSeconds:     getEnvInt(prefix+"LOCK_SECONDS", 0),
+		WindowSeconds:   getEnvInt(prefix+"WINDOW_SECONDS", 0),
+	}
+}
+
+// passwordHashingFromEnv reads PASSWORD_HASH_ALGORITHM (default bcrypt), PASSWORD_BCRYPT_COST
+// and PASSWORD_ARGON2_MEMORY_KIB, _ITERATIONS and _PARALLELISM.
+func passwordHashingFromEnv() PasswordHashingConfig {
+	return PasswordHashingConfig{
+		Algorithm:         strings.ToLower(strings.TrimSpace(getEnv("PASSWORD_HASH_ALGORITHM", PasswordHashBcrypt))),
+		BcryptCost:        getEnvInt("PASSWORD_BCRYPT_COST", 0),
+		Argon2MemoryKiB:   getEnvInt("PASSWORD_ARGON2_MEMORY_KIB", 0),
+		Argon2Iterations:  getEnvInt("PASSWORD_ARGON2_ITERATIONS", 0),
+		Argon2Parallelism: getEnvInt("PASSWORD_ARGON2_PARALLELISM", 0),
+	}
+}
+
+// passwordStrengthFromEnv reads PASSWORD_MIN_LENGTH, PASSWORD_REQUIRE_UPPERCASE, _LOWERCASE, _DIGIT and _SYMBOL
+// (default false) and PASSWORD_FORBID_PERSONAL_INFO (default true).
+func passwordStrengthFromEnv() PasswordStrengthConfig {
+	return PasswordStrengthConfig{
+		MinLength:          getEnvInt("PASSWORD_MIN_LENGTH", 0),
+		RequireUppercase:   getEnvBool("PASSWORD_REQUIRE_UPPERCASE", false),
+		RequireLowercase:   getEnvBool("PASSWORD_REQUIRE_LOWERCASE", false),
+		RequireDigit:       getEnvBool("PASSWORD_REQUIRE_DIGIT", false),
+		RequireSymbol:      getEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+		ForbidPersonalInfo: getEnvBool("PASSWORD_FORBID_PERSONAL_INFO", true),
+	}
+}
+
 // jwtAccessTokenDurationFromEnv reads JWT_ACCESS_TOKEN_DURATION_MINUTES (default 15).
 func jwtAccessTokenDurationFromEnv() time.Duration {
 	mins := getEnvInt("JWT_ACCESS_TOKEN_DURATION_MINUTES", 15)
 	return time.Duration(mins) * time.Minute
 }
+
+// oauthProvidersFromEnv reads OAUTH_<PROVIDER>_CLIENT_ID, _CLIENT_SECRET, _ISSUER_URL and _REDIRECT_URL.
+// A provider is enabled only when its client ID is set. The issuer defaults to the public one
+// (override it to point at a local mock) and the redirect URL to {FRONTEND_URL}/auth/oauth/{provider}/callback.
+func oauthProvidersFromEnv(frontendURL string) []OAuthProviderConfig {
+	var providers []OAuthProviderConfig
+	for _, name := range []string{"google", "facebook"} {
+		prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+		clientID := getEnv(prefix+"CLIENT_ID", "")
+		if clientID == "" {
+			continue
+		}
+		providers = append(providers, OAuthProviderConfig{
+			Name:         name,
+			IssuerURL:    getEnv(prefix+"ISSUER_URL", defaultOAuthIssuers[name]),
+			ClientID:     clientID,
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", strings.TrimSuffix(frontendURL, "/")+"/auth/oauth/"+name+"/callback"),
+		})
+	}
+	return providers
+}
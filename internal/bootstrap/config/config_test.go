@@ -1,8 +1,11 @@
 package config
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/cloudflax/api.cloudflax/internal/shared/secrets"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -59,3 +62,126 @@ func TestResolveSlowQueryThresholdMS(t *testing.T) {
 		})
 	}
 }
+
+func TestOAuthProvidersFromEnv(t *testing.T) {
+	t.Setenv("OAUTH_GOOGLE_CLIENT_ID", "google-client")
+	t.Setenv("OAUTH_GOOGLE_CLIENT_SECRET", "google-secret")
+	t.Setenv("OAUTH_GOOGLE_ISSUER_URL", "")
+	t.Setenv("OAUTH_GOOGLE_REDIRECT_URL", "")
+	t.Setenv("OAUTH_FACEBOOK_CLIENT_ID", "")
+
+	providers := oauthProvidersFromEnv("http://localhost:3001/")
+
+	assert.Equal(t, []OAuthProviderConfig{{
+		Name:         "google",
+		IssuerURL:    "https://accounts.google.com",
+		ClientID:     "google-client",
+		ClientSecret: "google-secret",
+		RedirectURL:  "http://localhost:3001/auth/oauth/google/callback",
+	}}, providers)
+}
+
+func TestOAuthProvidersFromEnvFacebookIssuer(t *testing.T) {
+	t.Setenv("OAUTH_GOOGLE_CLIENT_ID", "")
+	t.Setenv("OAUTH_FACEBOOK_CLIENT_ID", "facebook-client")
+	t.Setenv("OAUTH_FACEBOOK_ISSUER_URL", "")
+
+	providers := oauthProvidersFromEnv("http://localhost:3001")
+
+	if assert.Len(t, providers, 1) {
+		assert.Equal(t, "https://www.facebook.com", providers[0].IssuerURL, "must match the iss claim of Facebook ID tokens")
+	}
+}
+
+func TestLoadJWTSigningKeysInline(t *testing.T) {
+	t.Setenv("JWT_SIGNING_KEYS_SECRET_NAME", "")
+	t.Setenv("JWT_SIGNING_KEYS", "")
+
+	keys, err := loadJWTSigningKeys(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, keys, "HS256 stays the default when no key set is configured")
+
+	t.Setenv("JWT_SIGNING_KEYS", `{"active_kid":"k1","keys":[{"kid":"k1","alg":"EdDSA","private_key":"pem"}]}`)
+	keys, err = loadJWTSigningKeys(context.Background())
+	assert.NoError(t, err)
+	if assert.NotNil(t, keys) {
+		assert.Equal(t, "k1", keys.ActiveKeyID)
+	}
+}
+
+func TestValidateJWTSecretOptionalWithSigningKeys(t *testing.T) {
+	cfg := &Config{Port: "3000", DBHost: "h", DBUser: "u", DBName: "d", APIThrottleBackend: ThrottleBackendPostgres, JWTAccessTokenDuration: 15 * time.Minute}
+	assert.Error(t, cfg.Validate())
+
+	cfg.JWTSigningKeys = &secrets.SigningKeySet{ActiveKeyID: "k1"}
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestAPIThrottleBackend(t *testing.T) {
+	t.Setenv("API_THROTTLE_BACKEND", "")
+	t.Setenv("API_THROTTLE_TABLE_NAME", "")
+	assert.Equal(t, ThrottleBackendPostgres, apiThrottleBackendFromEnv())
+
+	t.Setenv("API_THROTTLE_TABLE_NAME", "throttle")
+	assert.Equal(t, ThrottleBackendDynamoDB, apiThrottleBackendFromEnv(), "a configured table keeps DynamoDB")
+
+	t.Setenv("API_THROTTLE_BACKEND", " Memory ")
+	assert.Equal(t, ThrottleBackendMemory, apiThrottleBackendFromEnv())
+
+	cfg := &Config{Port: "3000", JWTSecret: "s", DBHost: "h", DBUser: "u", DBName: "d", JWTAccessTokenDuration: 15 * time.Minute}
+	cfg.APIThrottleBackend = ThrottleBackendDynamoDB
+	assert.Error(t, cfg.Validate(), "dynamodb needs API_THROTTLE_TABLE_NAME")
+	cfg.APIThrottleTableName = "throttle"
+	assert.NoError(t, cfg.Validate())
+	cfg.APIThrottleBackend = "redis"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestThrottleLimitsFromEnv(t *testing.T) {
+	t.Setenv("RESEND_THROTTLE_IP_MAX_ATTEMPTS", "25")
+	t.Setenv("RESEND_THROTTLE_IP_LOCK_SECONDS", "600")
+	t.Setenv("RESEND_THROTTLE_IP_COOLDOWN_SECONDS", "")
+	t.Setenv("RESEND_THROTTLE_IP_WINDOW_SECONDS", "")
+
+	assert.Equal(t, ThrottleLimitsConfig{MaxAttempts: 25, LockSeconds: 600}, throttleLimitsFromEnv("RESEND_THROTTLE_IP_"))
+}
+
+func TestPasswordHashingFromEnv(t *testing.T) {
+	t.Setenv("PASSWORD_HASH_ALGORITHM", " Argon2id ")
+	t.Setenv("PASSWORD_BCRYPT_COST", "")
+	t.Setenv("PASSWORD_ARGON2_MEMORY_KIB", "19456")
+	t.Setenv("PASSWORD_ARGON2_ITERATIONS", "2")
+	t.Setenv("PASSWORD_ARGON2_PARALLELISM", "")
+
+	hashing := passwordHashingFromEnv()
+	assert.Equal(t, PasswordHashingConfig{Algorithm: PasswordHashArgon2id, Argon2MemoryKiB: 19456, Argon2Iterations: 2}, hashing)
+
+	cfg := &Config{Port: "3000", JWTSecret: "s", DBHost: "h", DBUser: "u", DBName: "d", APIThrottleBackend: ThrottleBackendPostgres, JWTAccessTokenDuration: 15 * time.Minute}
+	cfg.PasswordHashing = hashing
+	assert.NoError(t, cfg.Validate())
+	cfg.PasswordHashing.Algorithm = "scrypt"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestPasswordStrengthFromEnv(t *testing.T) {
+	t.Setenv("PASSWORD_MIN_LENGTH", "12")
+	t.Setenv("PASSWORD_REQUIRE_UPPERCASE", "true")
+	t.Setenv("PASSWORD_REQUIRE_LOWERCASE", "")
+	t.Setenv("PASSWORD_REQUIRE_DIGIT", "1")
+	t.Setenv("PASSWORD_REQUIRE_SYMBOL", "maybe")
+	t.Setenv("PASSWORD_FORBID_PERSONAL_INFO", "off")
+
+	assert.Equal(t, PasswordStrengthConfig{MinLength: 12, RequireUppercase: true, RequireDigit: true}, passwordStrengthFromEnv())
+}
+
+func TestValidateRefreshTokenDelivery(t *testing.T) {
+	cfg := &Config{Port: "3000", JWTSecret: "s", DBHost: "h", DBUser: "u", DBName: "d", APIThrottleBackend: ThrottleBackendPostgres, JWTAccessTokenDuration: 15 * time.Minute}
+	cfg.RefreshTokenDelivery = RefreshTokenDeliveryCookie
+	assert.Error(t, cfg.Validate(), "cookie mode needs FRONTEND_URL for credentialed CORS")
+	cfg.FrontendURL = "https://app.example.com"
+	assert.NoError(t, cfg.Validate())
+	cfg.RefreshCookieSameSite = "sideways"
+	assert.Error(t, cfg.Validate())
+	cfg.RefreshTokenDelivery = "header"
+	assert.Error(t, cfg.Validate())
+}
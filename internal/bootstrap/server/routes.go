@@ -2,8 +2,10 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/cloudflax/api.cloudflax/internal/account"
 	"github.com/cloudflax/api.cloudflax/internal/auth"
@@ -11,58 +13,120 @@ import (
 	"github.com/cloudflax/api.cloudflax/internal/invoice"
 	"github.com/cloudflax/api.cloudflax/internal/shared/database"
 	"github.com/cloudflax/api.cloudflax/internal/shared/middleware"
+	"github.com/cloudflax/api.cloudflax/internal/shared/validator"
 	"github.com/cloudflax/api.cloudflax/internal/shared/verificationnotify"
 	"github.com/cloudflax/api.cloudflax/internal/user"
 	"github.com/gofiber/fiber/v3"
 )
 
 // Mount mounts all routes on the Fiber app.
-func Mount(app *fiber.App, cfg *config.Config) {
+// It fails when the configured JWT signing keys cannot be parsed or the password policy is invalid.
+func Mount(app *fiber.App, cfg *config.Config) error {
 	app.Get("/", Home)
 	app.Get("/health", Health())
 
+	if err := user.SetPasswordPolicy(user.PasswordPolicy{
+		Algorithm:         cfg.PasswordHashing.Algorithm,
+		BcryptCost:        cfg.PasswordHashing.BcryptCost,
+		Argon2Memory:      uint32(cfg.PasswordHashing.Argon2MemoryKiB),
+		Argon2Iterations:  uint32(cfg.PasswordHashing.Argon2Iterations),
+		Argon2Parallelism: uint8(cfg.PasswordHashing.Argon2Parallelism),
+	}); err != nil {
+		return fmt.Errorf("password policy: %w", err)
+	}
+
 	verifyNotifier := newVerificationNotifier(cfg)
+	passwordResetNotifier := newPasswordResetNotifier(cfg)
+	magicLinkNotifier := newMagicLinkNotifier(cfg)
+	emailChangeNotifier := newEmailChangeNotifier(cfg)
+	emailChangeConfirmationNotifier := newEmailChangeConfirmationNotifier(cfg)
+	accountInvitationNotifier := newAccountInvitationNotifier(cfg)
 
 	authRepository := auth.NewRepository(database.DB)
 	userRepository := user.NewRepository(database.DB)
 	accountRepository := account.NewRepository(database.DB)
-	accountService := account.NewService(accountRepository, userRepository)
+	accountService := account.NewService(accountRepository, userRepository).
+		WithInvitationNotifier(accountInvitationNotifier, cfg.FrontendURL)
+
+	signingKeys, err := newSigningKeys(cfg)
+	if err != nil {
+		return fmt.Errorf("jwt signing keys: %w", err)
+	}
+	passwordPolicy, err := newPasswordPolicy(cfg)
+	if err != nil {
+		return fmt.Errorf("password policy: %w", err)
+	}
 
 	authService := auth.NewService(authRepository, userRepository, auth.ServiceOptions{
-		JWTSecret:            cfg.JWTSecret,
-		VerificationNotifier: verifyNotifier,
-		FrontendURL:          cfg.FrontendURL,
-		AccessTokenDuration:  cfg.JWTAccessTokenDuration,
-	})
-	authHandler := auth.NewHandler(authService)
-	resendGuard, err := auth.NewDynamoResendVerificationGuard(context.Background(), auth.DynamoResendVerificationGuardOptions{
-		TableName:       cfg.APIThrottleTableName,
-		EndpointURL:     cfg.AWSEndpointURL,
-		Region:          cfg.AWSRegion,
-		Profile:         cfg.AWSProfile,
-		AccessKeyID:     cfg.AWSAccessKeyID,
-		SecretAccessKey: cfg.AWSSecretAccessKey,
+		JWTSecret:                       cfg.JWTSecret,
+		VerificationNotifier:            verifyNotifier,
+		PasswordResetNotifier:           passwordResetNotifier,
+		MagicLinkNotifier:               magicLinkNotifier,
+		EmailChangeNotifier:             emailChangeNotifier,
+		EmailChangeConfirmationNotifier: emailChangeConfirmationNotifier,
+		FrontendURL:                     cfg.FrontendURL,
+		AccessTokenDuration:             cfg.JWTAccessTokenDuration,
+		OAuthProviders:                  newOAuthProviders(cfg),
+		SigningKeys:                     signingKeys,
+		RevocationStore:                 newTokenRevocationStore(cfg),
+		AccountMembers:                  accountRepository,
+		PasswordPolicy:                  passwordPolicy,
+		Issuer:                          cfg.AppURL,
+		OAuthClients:                    accountService,
+		AccountInvitations:              accountService,
 	})
+	resendGuard, err := newThrottleGuard(cfg, auth.ThrottleScopeResendVerification)
+	if err != nil {
+		return fmt.Errorf("resend verification throttle: %w", err)
+	}
+	forgotPasswordGuard, err := newThrottleGuard(cfg, auth.ThrottleScopeForgotPassword)
+	if err != nil {
+		return fmt.Errorf("forgot password throttle: %w", err)
+	}
+	magicLinkGuard, err := newThrottleGuard(cfg, auth.ThrottleScopeMagicLink)
+	if err != nil {
+		return fmt.Errorf("magic link throttle: %w", err)
+	}
+	deviceCodeGuard, err := newThrottleGuard(cfg, auth.ThrottleScopeDeviceCode)
+	if err != nil {
+		return fmt.Errorf("device code throttle: %w", err)
+	}
+	loginThrottle, err := newLoginThrottle(cfg)
 	if err != nil {
-		slog.Warn("failed to initialise resend verification guard", "error", err)
-	} else if resendGuard != nil {
-		authHandler = authHandler.WithResendVerificationGuard(resendGuard)
+		return fmt.Errorf("login throttle: %w", err)
 	}
+	authHandler := auth.NewHandler(authService).
+		WithResendVerificationGuard(resendGuard).
+		WithForgotPasswordGuard(forgotPasswordGuard).
+		WithLoginThrottle(loginThrottle).
+		WithMagicLinkGuard(magicLinkGuard).
+		WithDeviceCodeGuard(deviceCodeGuard)
+	if cfg.RefreshTokenDelivery == config.RefreshTokenDeliveryCookie {
+		authHandler.WithRefreshTokenCookie(auth.RefreshTokenCookieOptions{
+			SameSite: cfg.RefreshCookieSameSite,
+			Domain:   cfg.RefreshCookieDomain,
+		})
+	}
+	accountService.WithMemberTokenRevoker(authService)
 	requireAuth := middleware.RequireAuth(authService)
-	auth.Routes(app, authHandler, requireAuth)
+	requireRecentAuth := middleware.RequireRecentAuth(auth.RecentAuthMaxAge)
+	auth.Routes(app, authHandler, requireAuth, requireRecentAuth)
 
-	userService := user.NewService(userRepository).WithTokenRevoker(authRepository)
+	userService := user.NewService(userRepository).WithTokenRevoker(authService).WithPasswordPolicy(passwordPolicy)
 	userHandler := user.NewHandler(userService).WithAccountLister(&accountListerAdapter{service: accountService})
-	user.Routes(app, userHandler, requireAuth)
+	user.Routes(app, userHandler, requireAuth, requireRecentAuth)
 
-	accountHandler := account.NewHandler(accountService)
+	accountHandler := account.NewHandler(accountService).WithAccessTokenIssuer(authService)
 	requireAccountMember := middleware.RequireAccountMember(accountRepository)
-	account.Routes(app, accountHandler, requireAuth)
+	account.Routes(app, accountHandler, requireAuth, requireRecentAuth)
 
 	invoiceRepository := invoice.NewRepository(database.DB)
 	invoiceService := invoice.NewService(invoiceRepository)
 	invoiceHandler := invoice.NewHandler(invoiceService)
-	invoice.Routes(app, invoiceHandler, requireAuth, requireAccountMember)
+	// Invoice endpoints also accept account API keys (Bearer cfx_...) for machine clients.
+	requireAuthOrAPIKey := middleware.RequireAuthOrAPIKey(authService, accountService)
+	invoice.Routes(app, invoiceHandler, requireAuthOrAPIKey, requireAccountMember)
+	return nil
 }
 
 // accountListerAdapter adapts the account.Service to the user.AccountLister interface.
@@ -87,12 +151,215 @@ func (a *accountListerAdapter) ListAccountsForUser(userID string) ([]user.Accoun
 	return result, nil
 }
 
+// newThrottleGuard builds the throttle guard for the given scope on the configured API_THROTTLE_BACKEND.
+// It fails instead of running without throttling when the DynamoDB table cannot be used.
+func newThrottleGuard(cfg *config.Config, scope string) (auth.ResendVerificationGuard, error) {
+	switch cfg.APIThrottleBackend {
+	case config.ThrottleBackendMemory:
+		return auth.NewMemoryResendVerificationGuard(scope, resendThrottleLimits(cfg)), nil
+	case config.ThrottleBackendDynamoDB:
+		guard, err := auth.NewDynamoResendVerificationGuard(context.Background(), dynamoThrottleOptions(cfg, scope))
+		if err == nil && guard == nil {
+			err = fmt.Errorf("API_THROTTLE_TABLE_NAME is empty")
+		}
+		return guard, err
+	default:
+		return auth.NewPostgresResendVerificationGuard(database.DB, scope, resendThrottleLimits(cfg)), nil
+	}
+}
+
+// newLoginThrottle builds the failed-login throttle on the configured API_THROTTLE_BACKEND.
+func newLoginThrottle(cfg *config.Config) (auth.LoginThrottle, error) {
+	switch cfg.APIThrottleBackend {
+	case config.ThrottleBackendMemory:
+		return auth.NewMemoryLoginThrottle(), nil
+	case config.ThrottleBackendDynamoDB:
+		throttle, err := auth.NewDynamoLoginThrottle(context.Background(), dynamoThrottleTable(cfg))
+		if err == nil && throttle == nil {
+			err = fmt.Errorf("API_THROTTLE_TABLE_NAME is empty")
+		}
+		return throttle, err
+	default:
+		return auth.NewPostgresLoginThrottle(database.DB), nil
+	}
+}
+
+// dynamoThrottleTable maps the AWS settings and throttle table to the DynamoDB throttle options.
+func dynamoThrottleTable(cfg *config.Config) auth.DynamoThrottleOptions {
+	return auth.DynamoThrottleOptions{
+		TableName:       cfg.APIThrottleTableName,
+		EndpointURL:     cfg.AWSEndpointURL,
+		Region:          cfg.AWSRegion,
+		Profile:         cfg.AWSProfile,
+		AccessKeyID:     cfg.AWSAccessKeyID,
+		SecretAccessKey: cfg.AWSSecretAccessKey,
+	}
+}
+
+// dynamoThrottleOptions maps the AWS settings and throttle table to the DynamoDB guard options.
+func dynamoThrottleOptions(cfg *config.Config, scope string) auth.DynamoResendVerificationGuardOptions {
+	return auth.DynamoResendVerificationGuardOptions{
+		TableName:       cfg.APIThrottleTableName,
+		EndpointURL:     cfg.AWSEndpointURL,
+		Region:          cfg.AWSRegion,
+		Profile:         cfg.AWSProfile,
+		AccessKeyID:     cfg.AWSAccessKeyID,
+		SecretAccessKey: cfg.AWSSecretAccessKey,
+		Scope:           scope,
+		Limits:          resendThrottleLimits(cfg),
+	}
+}
+
+// resendThrottleLimits maps the per-dimension overrides of the resend and forgot-password throttles.
+func resendThrottleLimits(cfg *config.Config) auth.ResendVerificationLimits {
+	return auth.ResendVerificationLimits{
+		Email: throttleLimits(cfg.ResendThrottleEmail),
+		IP:    throttleLimits(cfg.ResendThrottleIP),
+	}
+}
+
+func throttleLimits(limits config.ThrottleLimitsConfig) auth.ThrottleLimits {
+	return auth.ThrottleLimits{
+		Cooldown:    time.Duration(limits.CooldownSeconds) * time.Second,
+		MaxAttempts: int64(limits.MaxAttempts),
+		Lock:        time.Duration(limits.LockSeconds) * time.Second,
+		Window:      time.Duration(limits.WindowSeconds) * time.Second,
+	}
+}
+
+// newTokenRevocationStore builds the access token denylist: DynamoDB when TOKEN_REVOCATION_TABLE_NAME is set,
+// otherwise the revoked_access_tokens table. Falls back to Postgres (and logs a warning) if DynamoDB init fails.
+func newTokenRevocationStore(cfg *config.Config) auth.TokenRevocationStore {
+	store, err := auth.NewDynamoTokenRevocationStore(context.Background(), auth.DynamoTokenRevocationStoreOptions{
+		TableName:       cfg.TokenRevocationTableName,
+		EndpointURL:     cfg.AWSEndpointURL,
+		Region:          cfg.AWSRegion,
+		Profile:         cfg.AWSProfile,
+		AccessKeyID:     cfg.AWSAccessKeyID,
+		SecretAccessKey: cfg.AWSSecretAccessKey,
+	})
+	if err != nil {
+		slog.Warn("failed to initialise DynamoDB token revocation store, falling back to Postgres", "error", err)
+	}
+	if store == nil {
+		return auth.NewPostgresTokenRevocationStore(database.DB)
+	}
+	return store
+}
+
+// newPasswordPolicy builds the password strength rules and the breached-password check:
+// the local list when BREACHED_PASSWORD_LIST_PATH is set, else the range API when BREACHED_PASSWORD_API_URL is set.
+func newPasswordPolicy(cfg *config.Config) (*validator.PasswordPolicy, error) {
+	rules := validator.PasswordRules{
+		MinLength:          cfg.PasswordStrength.MinLength,
+		MaxLength:          72,
+		RequireUppercase:   cfg.PasswordStrength.RequireUppercase,
+		RequireLowercase:   cfg.PasswordStrength.RequireLowercase,
+		RequireDigit:       cfg.PasswordStrength.RequireDigit,
+		RequireSymbol:      cfg.PasswordStrength.RequireSymbol,
+		ForbidPersonalInfo: cfg.PasswordStrength.ForbidPersonalInfo,
+	}
+	var breached validator.BreachedPasswordChecker
+	switch {
+	case strings.TrimSpace(cfg.BreachedPasswordListPath) != "":
+		list, err := validator.LoadBreachedPasswordsFile(cfg.BreachedPasswordListPath)
+		if err != nil {
+			return nil, err
+		}
+		breached = list
+	case strings.TrimSpace(cfg.BreachedPasswordAPIURL) != "":
+		breached = validator.NewRangeBreachedPasswords(cfg.BreachedPasswordAPIURL)
+	}
+	return validator.NewPasswordPolicy(rules, breached), nil
+}
+
+// newOAuthProviders maps the configured social sign-in providers to the auth service options.
+func newOAuthProviders(cfg *config.Config) []auth.OIDCProviderConfig {
+	providers := make([]auth.OIDCProviderConfig, 0, len(cfg.OAuthProviders))
+	for _, p := range cfg.OAuthProviders {
+		providers = append(providers, auth.OIDCProviderConfig{
+			Provider:     auth.ProviderType(p.Name),
+			IssuerURL:    p.IssuerURL,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+		})
+	}
+	return providers
+}
+
+// newSigningKeys parses the configured JWT key set; nil keeps HS256 signing with JWT_SECRET.
+func newSigningKeys(cfg *config.Config) (*auth.SigningKeySet, error) {
+	if cfg.JWTSigningKeys == nil {
+		return nil, nil
+	}
+	keys := make([]*auth.SigningKey, 0, len(cfg.JWTSigningKeys.Keys))
+	for _, k := range cfg.JWTSigningKeys.Keys {
+		var retireAt time.Time
+		if k.RetireAt != nil {
+			retireAt = *k.RetireAt
+		}
+		key, err := auth.ParseSigningKey(k.KeyID, k.Algorithm, k.PrivateKey, k.PublicKey, retireAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return auth.NewSigningKeySet(cfg.JWTSigningKeys.ActiveKeyID, keys...)
+}
+
+// emailNotifier is implemented by both the Lambda and the noop notifiers.
+type emailNotifier interface {
+	verificationnotify.Notifier
+	verificationnotify.PasswordResetNotifier
+	verificationnotify.MagicLinkNotifier
+	verificationnotify.EmailChangeNotifier
+	verificationnotify.EmailChangeConfirmationNotifier
+	verificationnotify.AccountInvitationNotifier
+}
+
 // newVerificationNotifier builds a Lambda-backed notifier for verification emails (async invoke).
 // Falls back to noop and logs a warning if the function is not configured or init fails.
 func newVerificationNotifier(cfg *config.Config) verificationnotify.Notifier {
-	fn := strings.TrimSpace(cfg.LambdaSendVerifyEmailName)
+	return newLambdaNotifier(cfg, "LAMBDA_SEND_VERIFY_EMAIL_NAME", cfg.LambdaSendVerifyEmailName, "verification")
+}
+
+// newPasswordResetNotifier builds a Lambda-backed notifier for password reset emails (async invoke).
+// Falls back to noop and logs a warning if the function is not configured or init fails.
+func newPasswordResetNotifier(cfg *config.Config) verificationnotify.PasswordResetNotifier {
+	return newLambdaNotifier(cfg, "LAMBDA_SEND_PASSWORD_RESET_EMAIL_NAME", cfg.LambdaSendPasswordResetEmailName, "password reset")
+}
+
+// newMagicLinkNotifier builds a Lambda-backed notifier for passwordless login links (async invoke).
+// Falls back to noop and logs a warning if the function is not configured or init fails.
+func newMagicLinkNotifier(cfg *config.Config) verificationnotify.MagicLinkNotifier {
+	return newLambdaNotifier(cfg, "LAMBDA_SEND_MAGIC_LINK_EMAIL_NAME", cfg.LambdaSendMagicLinkEmailName, "magic link")
+}
+
+// newEmailChangeNotifier builds a Lambda-backed notifier that warns the current address of an email change (async invoke).
+// Falls back to noop and logs a warning if the function is not configured or init fails.
+func newEmailChangeNotifier(cfg *config.Config) verificationnotify.EmailChangeNotifier {
+	return newLambdaNotifier(cfg, "LAMBDA_SEND_EMAIL_CHANGE_NOTICE_NAME", cfg.LambdaSendEmailChangeNoticeName, "email change notice")
+}
+
+// newEmailChangeConfirmationNotifier builds a Lambda-backed notifier for the confirmation link sent to the new address
+// of an email change (async invoke).
+// Falls back to noop and logs a warning if the function is not configured or init fails.
+func newEmailChangeConfirmationNotifier(cfg *config.Config) verificationnotify.EmailChangeConfirmationNotifier {
+	return newLambdaNotifier(cfg, "LAMBDA_SEND_EMAIL_CHANGE_CONFIRMATION_NAME", cfg.LambdaSendEmailChangeConfirmationName, "email change confirmation")
+}
+
+// newAccountInvitationNotifier builds a Lambda-backed notifier for invitations to join an account (async invoke).
+// Falls back to noop and logs a warning if the function is not configured or init fails.
+func newAccountInvitationNotifier(cfg *config.Config) verificationnotify.AccountInvitationNotifier {
+	return newLambdaNotifier(cfg, "LAMBDA_SEND_INVITATION_EMAIL_NAME", cfg.LambdaSendInvitationEmailName, "account invitation")
+}
+
+// newLambdaNotifier builds a notifier bound to the given Lambda function or a noop when it is not usable.
+func newLambdaNotifier(cfg *config.Config, envName, functionName, purpose string) emailNotifier {
+	fn := strings.TrimSpace(functionName)
 	if fn == "" {
-		slog.Warn("LAMBDA_SEND_VERIFY_EMAIL_NAME is empty; verification emails will not be sent")
+		slog.Warn(envName + " is empty; " + purpose + " emails will not be sent")
 		return verificationnotify.NoopNotifier{}
 	}
 
@@ -104,7 +371,7 @@ func newVerificationNotifier(cfg *config.Config) verificationnotify.Notifier {
 		FunctionName:    fn,
 	})
 	if err != nil {
-		slog.Warn("failed to initialise verification Lambda notifier, falling back to noop", "error", err)
+		slog.Warn("failed to initialise "+purpose+" Lambda notifier, falling back to noop", "error", err)
 		return verificationnotify.NoopNotifier{}
 	}
 	return n
@@ -1,14 +1,20 @@
 package invoice
 
 import (
+	"github.com/cloudflax/api.cloudflax/internal/account"
+	"github.com/cloudflax/api.cloudflax/internal/shared/middleware"
 	"github.com/gofiber/fiber/v3"
 )
 
 // Routes mounts invoice routes on the given router.
 // All routes require authentication (authMiddleware) and account membership (accountMiddleware).
+// Scoped account API keys and OAuth client tokens also need the invoices:read or invoices:write scope.
 func Routes(router fiber.Router, handler *Handler, authMiddleware, accountMiddleware fiber.Handler) {
+	read := middleware.RequireScope(account.APIKeyScopeInvoicesRead)
+	write := middleware.RequireScope(account.APIKeyScopeInvoicesWrite)
+
 	invoices := router.Group("/invoices", authMiddleware, accountMiddleware)
-	invoices.Get("/", handler.ListInvoice)
-	invoices.Get("/:id", handler.GetInvoice)
-	invoices.Post("/", handler.CreateInvoice)
+	invoices.Get("/", read, handler.ListInvoice)
+	invoices.Get("/:id", read, handler.GetInvoice)
+	invoices.Post("/", write, handler.CreateInvoice)
 }
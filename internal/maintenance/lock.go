@@ -0,0 +1,64 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+// advisoryLockKey identifies the maintenance job among the Postgres advisory locks ("cfxmaint" in ASCII).
+const advisoryLockKey int64 = 0x6366786d61696e74
+
+// Locker elects the instance that runs maintenance. TryLock does not wait: acquired is false when another
+// instance holds the lock, and release must be called once the run is done.
+type Locker interface {
+	TryLock(ctx context.Context) (release func(), acquired bool, err error)
+}
+
+// AdvisoryLock is a Locker backed by a session-level Postgres advisory lock. It holds a dedicated
+// connection while locked, so the lock is also freed if the process dies mid-run.
+type AdvisoryLock struct {
+	db *gorm.DB
+}
+
+// NewAdvisoryLock creates a Postgres advisory lock over db.
+func NewAdvisoryLock(db *gorm.DB) *AdvisoryLock {
+	return &AdvisoryLock{db: db}
+}
+
+// TryLock takes the advisory lock on its own connection with pg_try_advisory_lock.
+func (l *AdvisoryLock) TryLock(ctx context.Context) (func(), bool, error) {
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return nil, false, fmt.Errorf("get connection pool: %w", err)
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("get connection: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", advisoryLockKey).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("try advisory lock: %w", err)
+	}
+	if !acquired {
+		conn.Close()
+		return nil, false, nil
+	}
+	return func() { releaseAdvisoryLock(conn) }, true, nil
+}
+
+// releaseAdvisoryLock unlocks and returns the connection to the pool. If the unlock fails the connection
+// is discarded instead, since closing the session is the only other way to free the lock.
+func releaseAdvisoryLock(conn *sql.Conn) {
+	if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryLockKey); err != nil {
+		slog.Error("release maintenance lock", "error", err)
+		_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+	conn.Close()
+}
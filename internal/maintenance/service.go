@@ -0,0 +1,215 @@
+// Package maintenance purges stale auth data in batches: refresh tokens that can no longer be used,
+// email verification tokens that expired on users, abandoned social sign-in states, expired access
+// token revocations and throttle states past their TTL. Runs are guarded by a Locker so only one instance
+// works at a time, either from the in-process scheduler or from the cmd/maintenance one-shot command.
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	defaultBatchSize                    = 1000
+	defaultRevokedRefreshTokenRetention = 24 * time.Hour
+)
+
+// Task names reported in the structured logs and in Report.
+const (
+	TaskRefreshTokens       = "refresh_tokens"
+	TaskVerificationTokens  = "verification_tokens"
+	TaskOAuthStates         = "oauth_states"
+	TaskRevokedAccessTokens = "revoked_access_tokens"
+	TaskThrottleStates      = "throttle_states"
+)
+
+// RefreshTokenPurger deletes refresh tokens that expired or were revoked long enough ago.
+type RefreshTokenPurger interface {
+	DeleteStaleRefreshTokens(now, revokedBefore time.Time, limit int) (int64, error)
+}
+
+// VerificationTokenPurger clears email verification tokens that expired.
+type VerificationTokenPurger interface {
+	ClearExpiredVerificationTokens(now time.Time, limit int) (int64, error)
+}
+
+// OAuthStatePurger deletes social sign-in states that expired without being consumed.
+type OAuthStatePurger interface {
+	DeleteExpiredOAuthStates(now time.Time, limit int) (int64, error)
+}
+
+// RevokedAccessTokenPurger deletes denylist entries of access tokens that expired anyway.
+type RevokedAccessTokenPurger interface {
+	DeleteExpiredRevokedAccessTokens(now time.Time, limit int) (int64, error)
+}
+
+// ThrottleStatePurger deletes Postgres throttle states past their expiry.
+type ThrottleStatePurger interface {
+	DeleteExpiredThrottleStates(now time.Time, limit int) (int64, error)
+}
+
+// Options tunes a maintenance run; zero values keep the defaults.
+type Options struct {
+	// BatchSize is the number of rows removed per statement (default 1000).
+	BatchSize int
+	// RevokedRefreshTokenRetention keeps revoked refresh tokens for a while before deleting them (default 24h).
+	RevokedRefreshTokenRetention time.Duration
+}
+
+// Report counts the rows removed by one run, keyed by task name. Skipped is true when another instance held the lock.
+type Report struct {
+	Skipped bool
+	Deleted map[string]int64
+}
+
+// Service runs the purge tasks.
+type Service struct {
+	refreshTokens       RefreshTokenPurger
+	verificationTokens  VerificationTokenPurger
+	oauthStates         OAuthStatePurger
+	revokedAccessTokens RevokedAccessTokenPurger
+	throttleStates      ThrottleStatePurger
+	batchSize           int
+	revokedRetention    time.Duration
+	now                 func() time.Time
+}
+
+// NewService creates a maintenance service over the auth and user repositories.
+func NewService(refreshTokens RefreshTokenPurger, verificationTokens VerificationTokenPurger, opts Options) *Service {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.RevokedRefreshTokenRetention <= 0 {
+		opts.RevokedRefreshTokenRetention = defaultRevokedRefreshTokenRetention
+	}
+	return &Service{
+		refreshTokens:      refreshTokens,
+		verificationTokens: verificationTokens,
+		batchSize:          opts.BatchSize,
+		revokedRetention:   opts.RevokedRefreshTokenRetention,
+		now:                time.Now,
+	}
+}
+
+// WithOAuthStates adds the purge of expired OAuth states to every run.
+func (s *Service) WithOAuthStates(purger OAuthStatePurger) *Service {
+	s.oauthStates = purger
+	return s
+}
+
+// WithRevokedAccessTokens adds the purge of expired revoked_access_tokens rows to every run.
+func (s *Service) WithRevokedAccessTokens(purger RevokedAccessTokenPurger) *Service {
+	s.revokedAccessTokens = purger
+	return s
+}
+
+// WithThrottleStates adds the purge of expired throttle_states rows to every run.
+func (s *Service) WithThrottleStates(purger ThrottleStatePurger) *Service {
+	s.throttleStates = purger
+	return s
+}
+
+// purgeTask removes one batch of at most limit rows and returns how many it removed.
+type purgeTask struct {
+	name  string
+	purge func(limit int) (int64, error)
+}
+
+// RunOnce runs every task while holding the lock. When another instance holds it the run is skipped
+// and the returned report has Skipped set.
+func (s *Service) RunOnce(ctx context.Context, locker Locker) (*Report, error) {
+	release, acquired, err := locker.TryLock(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acquire maintenance lock: %w", err)
+	}
+	if !acquired {
+		slog.Info("maintenance run skipped", "event", "maintenance_skipped", "reason", "lock held by another instance")
+		return &Report{Skipped: true}, nil
+	}
+	defer release()
+	return s.Run(ctx)
+}
+
+// Run purges every task in batches until a batch comes back short, logging one entry per task.
+// It stops early when ctx is cancelled and returns what was removed so far.
+func (s *Service) Run(ctx context.Context) (*Report, error) {
+	now := s.now()
+	tasks := []purgeTask{
+		{name: TaskRefreshTokens, purge: func(limit int) (int64, error) {
+			return s.refreshTokens.DeleteStaleRefreshTokens(now, now.Add(-s.revokedRetention), limit)
+		}},
+		{name: TaskVerificationTokens, purge: func(limit int) (int64, error) {
+			return s.verificationTokens.ClearExpiredVerificationTokens(now, limit)
+		}},
+	}
+	if s.oauthStates != nil {
+		tasks = append(tasks, purgeTask{name: TaskOAuthStates, purge: func(limit int) (int64, error) {
+			return s.oauthStates.DeleteExpiredOAuthStates(now, limit)
+		}})
+	}
+	if s.revokedAccessTokens != nil {
+		tasks = append(tasks, purgeTask{name: TaskRevokedAccessTokens, purge: func(limit int) (int64, error) {
+			return s.revokedAccessTokens.DeleteExpiredRevokedAccessTokens(now, limit)
+		}})
+	}
+	if s.throttleStates != nil {
+		tasks = append(tasks, purgeTask{name: TaskThrottleStates, purge: func(limit int) (int64, error) {
+			return s.throttleStates.DeleteExpiredThrottleStates(now, limit)
+		}})
+	}
+
+	report := &Report{Deleted: make(map[string]int64, len(tasks))}
+	for _, task := range tasks {
+		started := time.Now()
+		deleted, batches, err := s.drain(ctx, task)
+		report.Deleted[task.name] = deleted
+		if err != nil {
+			slog.Error("maintenance task failed", "event", "maintenance_task", "task", task.name, "deleted", deleted, "batches", batches, "error", err)
+			return report, fmt.Errorf("%s: %w", task.name, err)
+		}
+		slog.Info("maintenance task finished",
+			"event", "maintenance_task",
+			"task", task.name,
+			"deleted", deleted,
+			"batches", batches,
+			"duration_ms", time.Since(started).Milliseconds(),
+		)
+	}
+	return report, nil
+}
+
+// drain repeats one task until it removes fewer rows than a full batch.
+func (s *Service) drain(ctx context.Context, task purgeTask) (deleted int64, batches int, err error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return deleted, batches, err
+		}
+		n, err := task.purge(s.batchSize)
+		if err != nil {
+			return deleted, batches, err
+		}
+		batches++
+		deleted += n
+		if n < int64(s.batchSize) {
+			return deleted, batches, nil
+		}
+	}
+}
+
+// Schedule calls RunOnce every interval until ctx is done. Failures are logged and retried on the next tick.
+func (s *Service) Schedule(ctx context.Context, locker Locker, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.RunOnce(ctx, locker); err != nil {
+				slog.Error("maintenance run failed", "event", "maintenance_run", "error", err)
+			}
+		}
+	}
+}
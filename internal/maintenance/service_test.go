@@ -0,0 +1,168 @@
+package maintenance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudflax/api.cloudflax/internal/auth"
+	"github.com/cloudflax/api.cloudflax/internal/shared/database"
+	"github.com/cloudflax/api.cloudflax/internal/user"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLocker grants or refuses the lock and records releases.
+type fakeLocker struct {
+	acquired bool
+	released int
+}
+
+func (l *fakeLocker) TryLock(context.Context) (func(), bool, error) {
+	if !l.acquired {
+		return nil, false, nil
+	}
+	return func() { l.released++ }, true, nil
+}
+
+func setupMaintenanceTest(t *testing.T, batchSize int) *Service {
+	t.Helper()
+	require.NoError(t, database.InitForTesting())
+	require.NoError(t, database.RunMigrations(&user.User{}, &auth.RefreshToken{}))
+	return NewService(auth.NewRepository(database.DB), user.NewRepository(database.DB), Options{BatchSize: batchSize})
+}
+
+func seedRefreshToken(t *testing.T, userID string, expiresAt time.Time, revokedAt, rotatedAt *time.Time) *auth.RefreshToken {
+	t.Helper()
+	token := &auth.RefreshToken{
+		UserID:    userID,
+		TokenHash: uuid.NewString(),
+		FamilyID:  uuid.NewString(),
+		ExpiresAt: expiresAt,
+		RevokedAt: revokedAt,
+		RotatedAt: rotatedAt,
+	}
+	require.NoError(t, database.DB.Create(token).Error)
+	return token
+}
+
+func seedUserWithVerificationToken(t *testing.T, email string, expiresAt time.Time) *user.User {
+	t.Helper()
+	token := uuid.NewString()
+	u := &user.User{Name: "Test", Email: email, EmailVerificationToken: &token, EmailVerificationExpiresAt: &expiresAt}
+	require.NoError(t, u.SetPassword("password123"))
+	require.NoError(t, database.DB.Create(u).Error)
+	return u
+}
+
+func TestRunOnce_PurgesStaleTokensInBatches(t *testing.T) {
+	service := setupMaintenanceTest(t, 2)
+	now := time.Now()
+	userID := uuid.NewString()
+	longAgo := now.Add(-48 * time.Hour)
+	recently := now.Add(-time.Hour)
+
+	for range 3 {
+		seedRefreshToken(t, userID, now.Add(-time.Minute), nil, nil)
+	}
+	seedRefreshToken(t, userID, now.Add(time.Hour), &longAgo, nil)
+	recentlyRevoked := seedRefreshToken(t, userID, now.Add(time.Hour), &recently, nil)
+	rotated := seedRefreshToken(t, userID, now.Add(time.Hour), &longAgo, &longAgo)
+	active := seedRefreshToken(t, userID, now.Add(time.Hour), nil, nil)
+
+	expired := seedUserWithVerificationToken(t, "expired.verification@example.com", now.Add(-time.Minute))
+	pending := seedUserWithVerificationToken(t, "pending.verification@example.com", now.Add(time.Hour))
+
+	locker := &fakeLocker{acquired: true}
+	report, err := service.RunOnce(context.Background(), locker)
+	require.NoError(t, err)
+	assert.False(t, report.Skipped)
+	assert.Equal(t, int64(4), report.Deleted[TaskRefreshTokens])
+	assert.Equal(t, int64(1), report.Deleted[TaskVerificationTokens])
+	assert.Equal(t, 1, locker.released)
+
+	var remaining []string
+	require.NoError(t, database.DB.Unscoped().Model(&auth.RefreshToken{}).Pluck("id", &remaining).Error)
+	assert.ElementsMatch(t, []string{recentlyRevoked.ID, rotated.ID, active.ID}, remaining, "rotated tokens are kept until they expire for reuse detection")
+
+	var reloaded user.User
+	require.NoError(t, database.DB.First(&reloaded, "id = ?", expired.ID).Error)
+	assert.Nil(t, reloaded.EmailVerificationToken)
+	assert.Nil(t, reloaded.EmailVerificationExpiresAt)
+	var untouched user.User
+	require.NoError(t, database.DB.First(&untouched, "id = ?", pending.ID).Error)
+	assert.NotNil(t, untouched.EmailVerificationToken)
+}
+
+func TestRunOnce_SkipsWhenLockIsHeld(t *testing.T) {
+	service := setupMaintenanceTest(t, 10)
+	seedRefreshToken(t, uuid.NewString(), time.Now().Add(-time.Minute), nil, nil)
+
+	report, err := service.RunOnce(context.Background(), &fakeLocker{acquired: false})
+	require.NoError(t, err)
+	assert.True(t, report.Skipped)
+
+	var count int64
+	require.NoError(t, database.DB.Model(&auth.RefreshToken{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestRun_PurgesExpiredOAuthStates(t *testing.T) {
+	service := setupMaintenanceTest(t, 10)
+	require.NoError(t, database.RunMigrations(&auth.OAuthState{}))
+	repository := auth.NewRepository(database.DB)
+	service.WithOAuthStates(repository)
+
+	seedOAuthState := func(expiresAt time.Time) *auth.OAuthState {
+		state := &auth.OAuthState{ID: uuid.NewString(), StateHash: uuid.NewString(), Provider: auth.ProviderGoogle, CodeVerifier: "verifier", Nonce: "nonce", ExpiresAt: expiresAt}
+		require.NoError(t, repository.CreateOAuthState(state))
+		return state
+	}
+	seedOAuthState(time.Now().Add(-time.Minute))
+	pending := seedOAuthState(time.Now().Add(time.Minute))
+
+	report, err := service.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), report.Deleted[TaskOAuthStates])
+
+	var remaining []string
+	require.NoError(t, database.DB.Model(&auth.OAuthState{}).Pluck("id", &remaining).Error)
+	assert.Equal(t, []string{pending.ID}, remaining)
+}
+
+func TestRun_PurgesExpiredRevokedAccessTokens(t *testing.T) {
+	service := setupMaintenanceTest(t, 10)
+	require.NoError(t, database.RunMigrations(&auth.RevokedAccessToken{}))
+	service.WithRevokedAccessTokens(auth.NewRepository(database.DB))
+
+	store := auth.NewPostgresTokenRevocationStore(database.DB)
+	require.NoError(t, store.Revoke(context.Background(), "sid:expired", time.Now().Add(-time.Minute)))
+	require.NoError(t, store.Revoke(context.Background(), "sid:active", time.Now().Add(time.Minute)))
+
+	report, err := service.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), report.Deleted[TaskRevokedAccessTokens])
+
+	var remaining []string
+	require.NoError(t, database.DB.Model(&auth.RevokedAccessToken{}).Pluck("id", &remaining).Error)
+	assert.Equal(t, []string{"sid:active"}, remaining)
+}
+
+func TestRun_PurgesExpiredThrottleStates(t *testing.T) {
+	service := setupMaintenanceTest(t, 10)
+	require.NoError(t, database.RunMigrations(&auth.ThrottleState{}))
+	service.WithThrottleStates(auth.NewRepository(database.DB))
+
+	now := time.Now().Unix()
+	require.NoError(t, database.DB.Create(&auth.ThrottleState{ID: "THROTTLE#LOGIN#EMAIL#expired", Version: 1, Count: 1, ExpiresAt: now - 60}).Error)
+	require.NoError(t, database.DB.Create(&auth.ThrottleState{ID: "THROTTLE#LOGIN#EMAIL#active", Version: 1, Count: 1, ExpiresAt: now + 60}).Error)
+
+	report, err := service.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), report.Deleted[TaskThrottleStates])
+
+	var remaining []string
+	require.NoError(t, database.DB.Model(&auth.ThrottleState{}).Pluck("id", &remaining).Error)
+	assert.Equal(t, []string{"THROTTLE#LOGIN#EMAIL#active"}, remaining)
+}
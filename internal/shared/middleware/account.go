@@ -25,15 +25,39 @@ type AccountRepository interface {
 //  3. X-Account-Slug header
 //  4. account_slug query parameter
 //
-// On success it sets "accountID" in Fiber locals and calls Next.
+// On success it sets "accountID" and "accountRole" in Fiber locals and calls Next.
 // It requires RequireAuth to run first (userID must already be in locals).
+//
+// Account-scoped access tokens are trusted without a database lookup: when the token claims
+// an account and the request names that same account by ID (or names none), its claimed role
+// is used. Any other request falls back to resolving the account and the membership.
+//
+// Requests authenticated with an API key are bound to the key's account: the identifier is
+// optional and, when present, must name that same account. OAuth client tokens are bound the
+// same way to the account claimed by the token.
 func RequireAccountMember(repo AccountRepository) fiber.Handler {
 	return func(c fiber.Ctx) error {
+		if keyAccountID, ok := c.Locals("apiKeyAccountID").(string); ok && keyAccountID != "" {
+			return requireAPIKeyAccount(c, repo, keyAccountID)
+		}
+
 		userID, ok := c.Locals("userID").(string)
 		if !ok || userID == "" {
 			return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeUnauthorized, "Unauthorized")
 		}
 
+		claimAccountID, _ := c.Locals("tokenAccountID").(string)
+		if _, ok := c.Locals("oauthClientID").(string); ok {
+			if claimAccountID == "" || !requestTargetsAccount(c, claimAccountID) {
+				return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeForbidden, "Access denied: token is bound to another account")
+			}
+		}
+		if claimAccountID != "" && requestTargetsAccount(c, claimAccountID) {
+			c.Locals("accountID", claimAccountID)
+			c.Locals("accountRole", c.Locals("tokenAccountRole"))
+			return c.Next()
+		}
+
 		acc, err := resolveAccount(c, repo)
 		if err != nil {
 			if errors.Is(err, account.ErrNotFound) {
@@ -42,7 +66,8 @@ func RequireAccountMember(repo AccountRepository) fiber.Handler {
 			return runtimeError.Respond(c, fiber.StatusBadRequest, runtimeError.CodeInvalidRequestBody, "Account identifier required (X-Account-ID, X-Account-Slug, account_id or account_slug)")
 		}
 
-		if _, err := repo.GetMember(acc.ID, userID); err != nil {
+		member, err := repo.GetMember(acc.ID, userID)
+		if err != nil {
 			if errors.Is(err, account.ErrMemberNotFound) {
 				return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeForbidden, "Access denied: not a member of this account")
 			}
@@ -50,10 +75,45 @@ func RequireAccountMember(repo AccountRepository) fiber.Handler {
 		}
 
 		c.Locals("accountID", acc.ID)
+		c.Locals("accountRole", string(member.Role))
 		return c.Next()
 	}
 }
 
+// requestTargetsAccount reports whether the request names accountID by ID or names no account at all.
+func requestTargetsAccount(c fiber.Ctx, accountID string) bool {
+	if id := firstNonEmpty(c.Get("X-Account-ID"), c.Query("account_id")); id != "" {
+		return id == accountID
+	}
+	return firstNonEmpty(c.Get("X-Account-Slug"), c.Query("account_slug")) == ""
+}
+
+// requireAPIKeyAccount sets "accountID" to the API key's account, rejecting requests that name another one.
+func requireAPIKeyAccount(c fiber.Ctx, repo AccountRepository, keyAccountID string) error {
+	acc, err := resolveAccount(c, repo)
+	switch {
+	case errors.Is(err, errNoAccountIdentifier):
+		acc, err = repo.GetByID(keyAccountID)
+		if err != nil {
+			if errors.Is(err, account.ErrNotFound) {
+				return runtimeError.Respond(c, fiber.StatusNotFound, runtimeError.CodeAccountNotFound, "Account not found")
+			}
+			return runtimeError.Respond(c, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Failed to resolve account")
+		}
+	case errors.Is(err, account.ErrNotFound):
+		return runtimeError.Respond(c, fiber.StatusNotFound, runtimeError.CodeAccountNotFound, "Account not found")
+	case err != nil:
+		return runtimeError.Respond(c, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Failed to resolve account")
+	}
+
+	if acc.ID != keyAccountID {
+		return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeForbidden, "Access denied: API key belongs to another account")
+	}
+
+	c.Locals("accountID", acc.ID)
+	return c.Next()
+}
+
 // resolveAccount finds the account from the request headers or query params.
 // Returns errNoAccountIdentifier if neither ID nor slug is provided.
 func resolveAccount(c fiber.Ctx, repo AccountRepository) (*account.Account, error) {
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http/httptest"
 	"testing"
 	"time"
@@ -18,7 +19,7 @@ import (
 func setupAccountMiddlewareTest(t *testing.T) (*account.Repository, *user.Repository) {
 	t.Helper()
 	require.NoError(t, database.InitForTesting())
-	require.NoError(t, database.RunMigrations(&user.User{}, &account.Account{}, &account.AccountMember{}))
+	require.NoError(t, database.RunMigrations(&user.User{}, &account.Account{}, &account.AccountMember{}, &account.APIKey{}, &account.OAuthClient{}))
 	return account.NewRepository(database.DB), user.NewRepository(database.DB)
 }
 
@@ -257,3 +258,257 @@ func TestRequireAccountMember_IDTakesPrecedenceOverSlug(t *testing.T) {
 	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
 	assert.Equal(t, accByID.ID, capturedAccountID)
 }
+
+type rejectingTokenValidator struct{}
+
+func (rejectingTokenValidator) ValidateAccessToken(string) (string, string, error) {
+	return "", "", errors.New("not a jwt")
+}
+
+func newAPIKeyApp(accountRepo *account.Repository, userRepo *user.Repository) *fiber.App {
+	accountService := account.NewService(accountRepo, userRepo)
+	app := fiber.New()
+	app.Post("/test",
+		RequireAuthOrAPIKey(rejectingTokenValidator{}, accountService),
+		RequireAccountMember(accountRepo),
+		RequireScope(account.APIKeyScopeInvoicesWrite),
+		func(c fiber.Ctx) error {
+			return c.JSON(fiber.Map{"accountID": c.Locals("accountID"), "apiKeyID": c.Locals("apiKeyID")})
+		},
+	)
+	return app
+}
+
+func TestRequireAuthOrAPIKey_BindsKeyAccount(t *testing.T) {
+	accountRepo, userRepo := setupAccountMiddlewareTest(t)
+	owner := seedVerifiedUser(t, userRepo, "Lena", "lena@example.com")
+	acc := seedAccountWithOwner(t, accountRepo, owner.ID, "Lena Org", "lena-org")
+	other := seedAccountWithOwner(t, accountRepo, owner.ID, "Lena Other", "lena-other")
+	key, raw, err := account.NewService(accountRepo, userRepo).CreateAPIKey(acc.ID, owner.ID, "ERP", nil, nil)
+	require.NoError(t, err)
+	app := newAPIKeyApp(accountRepo, userRepo)
+
+	req := httptest.NewRequest("POST", "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+raw)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var result map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, acc.ID, result["accountID"])
+	assert.Equal(t, key.ID, result["apiKeyID"])
+
+	otherReq := httptest.NewRequest("POST", "/test", nil)
+	otherReq.Header.Set("Authorization", "Bearer "+raw)
+	otherReq.Header.Set("X-Account-ID", other.ID)
+	otherResp, err := app.Test(otherReq, fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	defer otherResp.Body.Close()
+	assert.Equal(t, fiber.StatusForbidden, otherResp.StatusCode)
+}
+
+func TestRequireAuthOrAPIKey_RejectsInvalidAndUnscopedKeys(t *testing.T) {
+	accountRepo, userRepo := setupAccountMiddlewareTest(t)
+	owner := seedVerifiedUser(t, userRepo, "Lena", "lena@example.com")
+	acc := seedAccountWithOwner(t, accountRepo, owner.ID, "Lena Org", "lena-org")
+	_, readOnly, err := account.NewService(accountRepo, userRepo).CreateAPIKey(acc.ID, owner.ID, "Reports", []string{account.APIKeyScopeInvoicesRead}, nil)
+	require.NoError(t, err)
+	app := newAPIKeyApp(accountRepo, userRepo)
+
+	cases := map[string]struct {
+		token  string
+		status int
+		code   runtimeerror.ErrorCode
+	}{
+		"unknown key":   {token: account.APIKeyPrefix + "unknown", status: fiber.StatusUnauthorized, code: runtimeerror.CodeTokenInvalid},
+		"missing scope": {token: readOnly, status: fiber.StatusForbidden, code: runtimeerror.CodeInsufficientScope},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/test", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tc.status, resp.StatusCode)
+			var result runtimeerror.ErrorResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+			assert.Equal(t, tc.code, result.Error.Code)
+		})
+	}
+}
+
+// missingAccountRepository finds nothing, so any lookup shows up as a 404.
+type missingAccountRepository struct{}
+
+func (missingAccountRepository) GetByID(string) (*account.Account, error) {
+	return nil, account.ErrNotFound
+}
+
+func (missingAccountRepository) GetBySlug(string) (*account.Account, error) {
+	return nil, account.ErrNotFound
+}
+
+func (missingAccountRepository) GetMember(string, string) (*account.AccountMember, error) {
+	return nil, account.ErrMemberNotFound
+}
+
+func TestRequireAccountMember_TrustsAccountClaim(t *testing.T) {
+	app := fiber.New()
+	app.Get("/test",
+		func(c fiber.Ctx) error {
+			c.Locals("userID", "user-1")
+			c.Locals("tokenAccountID", "account-1")
+			c.Locals("tokenAccountRole", string(account.RoleAdmin))
+			return c.Next()
+		},
+		RequireAccountMember(missingAccountRepository{}),
+		func(c fiber.Ctx) error {
+			return c.JSON(fiber.Map{"accountID": c.Locals("accountID"), "accountRole": c.Locals("accountRole")})
+		},
+	)
+
+	for _, accountHeader := range []string{"", "account-1"} {
+		req := httptest.NewRequest("GET", "/test", nil)
+		if accountHeader != "" {
+			req.Header.Set("X-Account-ID", accountHeader)
+		}
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, fiber.StatusOK, resp.StatusCode)
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "account-1", body["accountID"])
+		assert.Equal(t, "admin", body["accountRole"])
+	}
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("X-Account-ID", "account-2")
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, fiber.StatusNotFound, resp.StatusCode, "another account falls back to the lookup")
+}
+
+// clientTokenValidator accepts any bearer token as an OAuth client token bound to account-1.
+type clientTokenValidator struct{}
+
+func (clientTokenValidator) ValidateAccessToken(string) (string, string, error) {
+	return "user-1", "", nil
+}
+
+func (clientTokenValidator) ValidateAccessTokenClaims(string) (*AccessTokenClaims, error) {
+	return &AccessTokenClaims{
+		UserID:      "user-1",
+		AccountID:   "account-1",
+		AccountRole: account.RoleMember,
+		ClientID:    "client-1",
+		Scopes:      []string{account.APIKeyScopeInvoicesRead},
+	}, nil
+}
+
+func TestOAuthClientTokens_ScopedAndBoundToAccount(t *testing.T) {
+	ok := func(c fiber.Ctx) error {
+		return c.JSON(fiber.Map{"accountID": c.Locals("accountID"), "oauthClientID": c.Locals("oauthClientID")})
+	}
+	app := fiber.New()
+	app.Get("/users/me", RequireAuth(clientTokenValidator{}), ok)
+	app.Get("/invoices", RequireAuthOrAPIKey(clientTokenValidator{}, nil), RequireAccountMember(missingAccountRepository{}),
+		RequireScope(account.APIKeyScopeInvoicesRead), ok)
+	app.Post("/invoices", RequireAuthOrAPIKey(clientTokenValidator{}, nil), RequireAccountMember(missingAccountRepository{}),
+		RequireScope(account.APIKeyScopeInvoicesWrite), ok)
+
+	cases := map[string]struct {
+		method        string
+		path          string
+		accountHeader string
+		status        int
+		code          runtimeerror.ErrorCode
+	}{
+		"user route":        {method: "GET", path: "/users/me", status: fiber.StatusForbidden, code: runtimeerror.CodeInsufficientScope},
+		"granted scope":     {method: "GET", path: "/invoices", status: fiber.StatusOK},
+		"missing scope":     {method: "POST", path: "/invoices", status: fiber.StatusForbidden, code: runtimeerror.CodeInsufficientScope},
+		"another account":   {method: "GET", path: "/invoices", accountHeader: "account-2", status: fiber.StatusForbidden, code: runtimeerror.CodeForbidden},
+		"the bound account": {method: "GET", path: "/invoices", accountHeader: "account-1", status: fiber.StatusOK},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.Header.Set("Authorization", "Bearer client-token")
+			if tc.accountHeader != "" {
+				req.Header.Set("X-Account-ID", tc.accountHeader)
+			}
+			resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, tc.status, resp.StatusCode)
+			if tc.status == fiber.StatusOK {
+				var body map[string]string
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+				assert.Equal(t, "account-1", body["accountID"])
+				assert.Equal(t, "client-1", body["oauthClientID"])
+				return
+			}
+			var result runtimeerror.ErrorResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+			assert.Equal(t, tc.code, result.Error.Code)
+		})
+	}
+}
+
+// authTimeTokenValidator reads the bearer token as the age of the auth_time claim ("none" leaves it out).
+type authTimeTokenValidator struct{}
+
+func (authTimeTokenValidator) ValidateAccessToken(string) (string, string, error) {
+	return "user-1", "", nil
+}
+
+func (authTimeTokenValidator) ValidateAccessTokenClaims(token string) (*AccessTokenClaims, error) {
+	claims := &AccessTokenClaims{UserID: "user-1"}
+	if token != "none" {
+		age, err := time.ParseDuration(token)
+		if err != nil {
+			return nil, err
+		}
+		claims.AuthTime = time.Now().Add(-age)
+	}
+	return claims, nil
+}
+
+func TestRequireRecentAuth(t *testing.T) {
+	app := fiber.New()
+	app.Delete("/users/me", RequireAuth(authTimeTokenValidator{}), RequireRecentAuth(5*time.Minute), func(c fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	cases := map[string]struct {
+		token  string
+		status int
+	}{
+		"recent":       {token: "1m", status: fiber.StatusNoContent},
+		"stale":        {token: "10m", status: fiber.StatusForbidden},
+		"no auth_time": {token: "none", status: fiber.StatusForbidden},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodDelete, "/users/me", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, tc.status, resp.StatusCode)
+			if tc.status == fiber.StatusForbidden {
+				var result runtimeerror.ErrorResponse
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+				assert.Equal(t, runtimeerror.CodeReauthenticationRequired, result.Error.Code)
+			}
+		})
+	}
+}
@@ -1,8 +1,14 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/cloudflax/api.cloudflax/internal/account"
 	runtimeError "github.com/cloudflax/api.cloudflax/internal/shared/runtimeerror"
 	"github.com/gofiber/fiber/v3"
 )
@@ -12,9 +18,69 @@ type TokenValidator interface {
 	ValidateAccessToken(tokenString string) (userID, email string, err error)
 }
 
+// AccessTokenClaims is the identity carried by a validated access token.
+type AccessTokenClaims struct {
+	UserID    string
+	Email     string
+	SessionID string
+	// TokenID is the "jti" claim; ExpiresAt is when the token stops being valid.
+	TokenID   string
+	ExpiresAt time.Time
+	// AccountID and AccountRole are set for account-scoped tokens; RequireAccountMember trusts them.
+	AccountID   string
+	AccountRole account.RoleType
+	// ClientID and Scopes are set for tokens issued to a third-party OAuth client. Those tokens are only
+	// accepted by RequireAuthOrAPIKey, are bound to AccountID and limited to their scopes.
+	ClientID string
+	Scopes   []string
+	// ActorID is set for impersonation tokens: the platform admin acting as UserID. ReadOnly
+	// impersonation tokens are limited to safe methods (GET, HEAD, OPTIONS).
+	ActorID  string
+	ReadOnly bool
+	// AuthTime is when the user last proved their credentials; zero when the token does not say.
+	AuthTime time.Time
+}
+
+// ClaimsValidator is an optional extension of TokenValidator for validators that expose
+// every claim the middleware publishes (e.g. the session id of the token).
+type ClaimsValidator interface {
+	ValidateAccessTokenClaims(tokenString string) (*AccessTokenClaims, error)
+}
+
+// RevocationChecker is an optional extension of TokenValidator for validators that keep a
+// denylist of access tokens revoked before they expire (logout, password change, deletion).
+type RevocationChecker interface {
+	IsAccessTokenRevoked(ctx context.Context, claims *AccessTokenClaims) (bool, error)
+}
+
+// APIKeyAuthenticator resolves the account API keys ("Bearer cfx_...") used by machine clients.
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(rawKey string) (*account.APIKey, error)
+}
+
 // RequireAuth returns a Fiber middleware that validates the Bearer JWT in the
-// Authorization header. On success it sets "userID" and "email" in Fiber locals.
+// Authorization header. On success it sets "userID" and "email" in Fiber locals, plus
+// "sessionID", "tokenID", "tokenExpiresAt", "tokenAccountID", "tokenAccountRole" and "authTime" when the
+// validator implements ClaimsValidator and the token carries them. Validators implementing
+// RevocationChecker reject revoked tokens. Tokens issued to OAuth clients are rejected with
+// INSUFFICIENT_SCOPE: user-scoped routes stay reserved to first-party sessions. Impersonation
+// tokens set "actorID" and "readOnly"; read-only ones get IMPERSONATION_READ_ONLY on any
+// method other than GET, HEAD or OPTIONS.
 func RequireAuth(validator TokenValidator) fiber.Handler {
+	return requireAuth(validator, nil, false)
+}
+
+// RequireAuthOrAPIKey works like RequireAuth and also accepts account API keys (tokens
+// starting with account.APIKeyPrefix) when apiKeys is not nil. For a key it sets "apiKeyID",
+// "apiKeyAccountID" and "apiKeyScopes" instead of "userID": user-scoped routes keep rejecting
+// keys, while RequireAccountMember binds the request to the key's account. Tokens issued to
+// OAuth clients are accepted too and additionally set "oauthClientID" and "tokenScopes".
+func RequireAuthOrAPIKey(validator TokenValidator, apiKeys APIKeyAuthenticator) fiber.Handler {
+	return requireAuth(validator, apiKeys, true)
+}
+
+// requireAuth validates the bearer credential; allowClients accepts access tokens issued to OAuth clients.
+func requireAuth(validator TokenValidator, apiKeys APIKeyAuthenticator, allowClients bool) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		header := c.Get("Authorization")
 		if header == "" {
@@ -26,13 +92,129 @@ func RequireAuth(validator TokenValidator) fiber.Handler {
 			return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeTokenInvalid, "Invalid authorization format, expected: Bearer <token>")
 		}
 
-		userID, email, err := validator.ValidateAccessToken(parts[1])
+		if apiKeys != nil && strings.HasPrefix(parts[1], account.APIKeyPrefix) {
+			return authenticateAPIKey(c, apiKeys, parts[1])
+		}
+
+		claims, err := validateAccessToken(validator, parts[1])
 		if err != nil {
 			return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeTokenInvalid, "Invalid or expired token")
 		}
 
-		c.Locals("userID", userID)
-		c.Locals("email", email)
+		if checker, ok := validator.(RevocationChecker); ok {
+			revoked, err := checker.IsAccessTokenRevoked(c.Context(), claims)
+			if err != nil {
+				slog.Error("check access token revocation", "user_id", claims.UserID, "error", err)
+				return runtimeError.Respond(c, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not validate token")
+			}
+			if revoked {
+				return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeTokenRevoked, "Token has been revoked")
+			}
+		}
+
+		if claims.ClientID != "" {
+			if !allowClients {
+				return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeInsufficientScope, "OAuth client tokens cannot access this endpoint")
+			}
+			c.Locals("oauthClientID", claims.ClientID)
+			c.Locals("tokenScopes", claims.Scopes)
+		}
+
+		c.Locals("userID", claims.UserID)
+		if claims.ActorID != "" {
+			// Set before the read-only check so Logger records who attempted a blocked write.
+			c.Locals("actorID", claims.ActorID)
+			c.Locals("readOnly", claims.ReadOnly)
+			if claims.ReadOnly && !isSafeMethod(c.Method()) {
+				return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeImpersonationReadOnly, "Impersonation session is read-only")
+			}
+		}
+		c.Locals("email", claims.Email)
+		if claims.SessionID != "" {
+			c.Locals("sessionID", claims.SessionID)
+		}
+		if claims.TokenID != "" {
+			c.Locals("tokenID", claims.TokenID)
+			c.Locals("tokenExpiresAt", claims.ExpiresAt)
+		}
+		if claims.AccountID != "" {
+			c.Locals("tokenAccountID", claims.AccountID)
+			c.Locals("tokenAccountRole", string(claims.AccountRole))
+		}
+		if !claims.AuthTime.IsZero() {
+			c.Locals("authTime", claims.AuthTime)
+		}
 		return c.Next()
 	}
 }
+
+// RequireRecentAuth guards sensitive routes: it answers 403 REAUTHENTICATION_REQUIRED unless the access token
+// says the user proved their credentials ("authTime", the auth_time claim) within maxAge. The client then calls
+// POST /auth/reauthenticate and retries with the elevated token. API keys and impersonation tokens carry no
+// auth_time and are always rejected. Mount it after RequireAuth.
+func RequireRecentAuth(maxAge time.Duration) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		authTime, ok := c.Locals("authTime").(time.Time)
+		if !ok || time.Since(authTime) > maxAge {
+			return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeReauthenticationRequired, "Recent authentication required")
+		}
+		return c.Next()
+	}
+}
+
+// isSafeMethod reports whether the HTTP method only reads data.
+func isSafeMethod(method string) bool {
+	return method == fiber.MethodGet || method == fiber.MethodHead || method == fiber.MethodOptions
+}
+
+// authenticateAPIKey validates an account API key and publishes its identity in Fiber locals.
+func authenticateAPIKey(c fiber.Ctx, apiKeys APIKeyAuthenticator, rawKey string) error {
+	key, err := apiKeys.AuthenticateAPIKey(rawKey)
+	if err != nil {
+		if errors.Is(err, account.ErrAPIKeyInvalid) {
+			return runtimeError.Respond(c, fiber.StatusUnauthorized, runtimeError.CodeTokenInvalid, "Invalid, revoked or expired API key")
+		}
+		slog.Error("authenticate api key", "error", err)
+		return runtimeError.Respond(c, fiber.StatusInternalServerError, runtimeError.CodeInternalServerError, "Could not validate API key")
+	}
+
+	c.Locals("apiKeyID", key.ID)
+	c.Locals("apiKeyAccountID", key.AccountID)
+	c.Locals("apiKeyScopes", key.Scopes)
+	return c.Next()
+}
+
+// RequireScope returns a Fiber middleware that rejects credentials lacking the given scope:
+// API keys with scopes that do not include it, and OAuth client tokens not granted it.
+// Requests authenticated with a first-party user token, and keys without scopes, pass through.
+func RequireScope(scope string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if _, ok := c.Locals("apiKeyID").(string); ok {
+			scopes, _ := c.Locals("apiKeyScopes").([]string)
+			key := account.APIKey{Scopes: scopes}
+			if !key.HasScope(scope) {
+				return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeInsufficientScope, "API key lacks the "+scope+" scope")
+			}
+			return c.Next()
+		}
+		if _, ok := c.Locals("oauthClientID").(string); ok {
+			scopes, _ := c.Locals("tokenScopes").([]string)
+			if !slices.Contains(scopes, scope) {
+				return runtimeError.Respond(c, fiber.StatusForbidden, runtimeError.CodeInsufficientScope, "Access token lacks the "+scope+" scope")
+			}
+		}
+		return c.Next()
+	}
+}
+
+// validateAccessToken uses ClaimsValidator when available and falls back to the basic interface.
+func validateAccessToken(validator TokenValidator, tokenString string) (*AccessTokenClaims, error) {
+	if claimsValidator, ok := validator.(ClaimsValidator); ok {
+		return claimsValidator.ValidateAccessTokenClaims(tokenString)
+	}
+	userID, email, err := validator.ValidateAccessToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	return &AccessTokenClaims{UserID: userID, Email: email}, nil
+}
@@ -9,7 +9,8 @@ import (
 
 // CORS returns a Fiber middleware that configures CORS for the API.
 // It allows the given origin (typically the frontend URL) to access the API.
-func CORS(allowedOrigin string) fiber.Handler {
+// allowCredentials lets that origin send cookies, as needed when refresh tokens travel in a cookie.
+func CORS(allowedOrigin string, allowCredentials bool) fiber.Handler {
 	origin := strings.TrimSuffix(strings.TrimSpace(allowedOrigin), "/")
 
 	cfg := fibercors.Config{
@@ -28,6 +29,7 @@ func CORS(allowedOrigin string) fiber.Handler {
 			"Accept",
 			"Authorization",
 			"X-Requested-With",
+			"X-CSRF-Token",
 		},
 	}
 
@@ -35,6 +37,8 @@ func CORS(allowedOrigin string) fiber.Handler {
 	// This prevents accidental open CORS in production.
 	if origin != "" {
 		cfg.AllowOrigins = []string{origin}
+		// Credentials are only ever allowed for the explicit origin, never for a wildcard.
+		cfg.AllowCredentials = allowCredentials
 	}
 
 	return fibercors.New(cfg)
@@ -7,7 +7,8 @@ import (
 	"github.com/gofiber/fiber/v3"
 )
 
-// Logger logs each request with slog (structured JSON).
+// Logger logs each request with slog (structured JSON). Requests made with an impersonation
+// token also log the impersonating admin ("actor_id") and the impersonated user ("user_id").
 func Logger() fiber.Handler {
 	return func(c fiber.Ctx) error {
 		start := time.Now()
@@ -24,6 +25,10 @@ func Logger() fiber.Handler {
 			"status", c.Response().StatusCode(),
 			"latency_ms", time.Since(start).Milliseconds(),
 		}
+		if actorID, ok := c.Locals("actorID").(string); ok && actorID != "" {
+			userID, _ := c.Locals("userID").(string)
+			attrs = append(attrs, "actor_id", actorID, "user_id", userID)
+		}
 
 		if err != nil {
 			attrs = append(attrs, "error", err)
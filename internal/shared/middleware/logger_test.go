@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudflax/api.cloudflax/internal/shared/runtimeerror"
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// impersonationTokenValidator accepts any bearer token as a read-only impersonation of user-1 by admin-1.
+type impersonationTokenValidator struct{}
+
+func (impersonationTokenValidator) ValidateAccessToken(string) (string, string, error) {
+	return "user-1", "user@example.com", nil
+}
+
+func (impersonationTokenValidator) ValidateAccessTokenClaims(string) (*AccessTokenClaims, error) {
+	return &AccessTokenClaims{UserID: "user-1", Email: "user@example.com", ActorID: "admin-1", ReadOnly: true}, nil
+}
+
+// captureLogs routes slog to a JSON buffer for the duration of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestImpersonationTokens_ReadOnlyAndLoggedWithActor(t *testing.T) {
+	logs := captureLogs(t)
+
+	app := fiber.New()
+	app.Use(Logger())
+	ok := func(c fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) }
+	app.Get("/invoices", RequireAuth(impersonationTokenValidator{}), ok)
+	app.Post("/invoices", RequireAuth(impersonationTokenValidator{}), ok)
+
+	req := httptest.NewRequest(fiber.MethodGet, "/invoices", nil)
+	req.Header.Set("Authorization", "Bearer impersonation")
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNoContent, resp.StatusCode)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, "request", entry["msg"])
+	assert.Equal(t, "admin-1", entry["actor_id"])
+	assert.Equal(t, "user-1", entry["user_id"])
+
+	logs.Reset()
+	req = httptest.NewRequest(fiber.MethodPost, "/invoices", nil)
+	req.Header.Set("Authorization", "Bearer impersonation")
+	resp, err = app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+	var body runtimeerror.ErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, runtimeerror.CodeImpersonationReadOnly, body.Error.Code)
+
+	entry = nil
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, "admin-1", entry["actor_id"], "blocked writes are logged with the actor")
+	assert.Equal(t, "user-1", entry["user_id"])
+}
@@ -2,6 +2,7 @@ package requestctx
 
 import (
 	"errors"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 )
@@ -15,16 +16,34 @@ var ErrMissingAccountID = errors.New("accountID not found in request context")
 // RequestContext holds the authenticated identity extracted from Fiber locals.
 // It is populated by the RequireAuth and RequireAccountMember middlewares.
 type RequestContext struct {
+	// UserID is empty when the request is authenticated with an account API key.
 	UserID    string
 	Email     string
 	AccountID string
+	// AccountRole is the role of the user in AccountID ("owner", "admin" or "member"); empty for API keys.
+	AccountRole string
+	// SessionID is the login session of the access token ("sid" claim); empty for tokens without one.
+	SessionID string
+	// TokenID and TokenExpiresAt identify the access token ("jti" and "exp" claims) so it can be revoked.
+	TokenID        string
+	TokenExpiresAt time.Time
+	// APIKeyID is the account API key that authenticated the request; empty for user tokens.
+	APIKeyID string
+	// OAuthClientID is the third-party OAuth client the access token was issued to; empty for first-party tokens.
+	OAuthClientID string
+	// ActorID is the platform admin impersonating UserID ("act" claim); empty for the user's own tokens.
+	ActorID string
+	// ReadOnly is set for impersonation tokens that may not change data.
+	ReadOnly bool
 }
 
 // FromFiber extracts a full RequestContext from Fiber locals.
 // Requires both "userID" (set by RequireAuth) and "accountID" (set by RequireAccountMember).
+// An account API key ("apiKeyID") stands in for the user ID.
 func FromFiber(c fiber.Ctx) (*RequestContext, error) {
-	userID, ok := c.Locals("userID").(string)
-	if !ok || userID == "" {
+	userID, _ := c.Locals("userID").(string)
+	apiKeyID, _ := c.Locals("apiKeyID").(string)
+	if userID == "" && apiKeyID == "" {
 		return nil, ErrMissingUserID
 	}
 
@@ -34,16 +53,32 @@ func FromFiber(c fiber.Ctx) (*RequestContext, error) {
 	}
 
 	email, _ := c.Locals("email").(string)
+	accountRole, _ := c.Locals("accountRole").(string)
+	sessionID, _ := c.Locals("sessionID").(string)
+	tokenID, _ := c.Locals("tokenID").(string)
+	tokenExpiresAt, _ := c.Locals("tokenExpiresAt").(time.Time)
+	oauthClientID, _ := c.Locals("oauthClientID").(string)
+	actorID, _ := c.Locals("actorID").(string)
+	readOnly, _ := c.Locals("readOnly").(bool)
 
 	return &RequestContext{
-		UserID:    userID,
-		Email:     email,
-		AccountID: accountID,
+		UserID:         userID,
+		Email:          email,
+		AccountID:      accountID,
+		AccountRole:    accountRole,
+		SessionID:      sessionID,
+		TokenID:        tokenID,
+		TokenExpiresAt: tokenExpiresAt,
+		APIKeyID:       apiKeyID,
+		OAuthClientID:  oauthClientID,
+		ActorID:        actorID,
+		ReadOnly:       readOnly,
 	}, nil
 }
 
 // UserOnly extracts a RequestContext without requiring AccountID.
 // Use on routes that require authentication but do not operate within an account scope.
+// Requests authenticated with an API key have no user and are rejected with ErrMissingUserID.
 func UserOnly(c fiber.Ctx) (*RequestContext, error) {
 	userID, ok := c.Locals("userID").(string)
 	if !ok || userID == "" {
@@ -51,9 +86,19 @@ func UserOnly(c fiber.Ctx) (*RequestContext, error) {
 	}
 
 	email, _ := c.Locals("email").(string)
+	sessionID, _ := c.Locals("sessionID").(string)
+	tokenID, _ := c.Locals("tokenID").(string)
+	tokenExpiresAt, _ := c.Locals("tokenExpiresAt").(time.Time)
+	actorID, _ := c.Locals("actorID").(string)
+	readOnly, _ := c.Locals("readOnly").(bool)
 
 	return &RequestContext{
-		UserID: userID,
-		Email:  email,
+		UserID:         userID,
+		Email:          email,
+		SessionID:      sessionID,
+		TokenID:        tokenID,
+		TokenExpiresAt: tokenExpiresAt,
+		ActorID:        actorID,
+		ReadOnly:       readOnly,
 	}, nil
 }
@@ -32,6 +32,7 @@ func respondWithUserOnly(c fiber.Ctx) error {
 		"user_id":    rctx.UserID,
 		"email":      rctx.Email,
 		"account_id": rctx.AccountID,
+		"session_id": rctx.SessionID,
 	})
 }
 
@@ -162,3 +163,22 @@ func TestUserOnly_DoesNotRequireAccountID(t *testing.T) {
 
 	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
 }
+
+func TestUserOnly_IncludesSessionID(t *testing.T) {
+	app := fiber.New()
+	app.Get("/test",
+		injectLocals(map[string]any{"userID": "user-123", "sessionID": "session-789"}),
+		respondWithUserOnly,
+	)
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var result map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, "session-789", result["session_id"])
+}
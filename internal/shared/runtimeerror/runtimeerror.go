@@ -18,6 +18,9 @@ const (
 	CodeEmailAlreadyExists       ErrorCode = "EMAIL_ALREADY_EXISTS"
 	CodeEmailAlreadyVerified     ErrorCode = "EMAIL_ALREADY_VERIFIED"
 	CodeInvalidVerificationToken ErrorCode = "INVALID_VERIFICATION_TOKEN"
+	CodeInvalidVerificationCode  ErrorCode = "INVALID_VERIFICATION_CODE"
+	CodeInvalidResetToken        ErrorCode = "INVALID_RESET_TOKEN"
+	CodeInvalidEmailChangeToken  ErrorCode = "INVALID_EMAIL_CHANGE_TOKEN"
 )
 
 // Invoice error codes.
@@ -31,16 +34,43 @@ const (
 	CodeAccountSlugTaken          ErrorCode = "ACCOUNT_SLUG_TAKEN"
 	CodeEmailVerificationRequired ErrorCode = "EMAIL_VERIFICATION_REQUIRED"
 	CodeForbidden                 ErrorCode = "FORBIDDEN"
+	CodeAPIKeyNotFound            ErrorCode = "API_KEY_NOT_FOUND"
+	CodeInsufficientScope         ErrorCode = "INSUFFICIENT_SCOPE"
+	CodeOAuthClientNotFound       ErrorCode = "OAUTH_CLIENT_NOT_FOUND"
+	CodeInvitationNotFound        ErrorCode = "INVITATION_NOT_FOUND"
+	CodeInvalidInvitationToken    ErrorCode = "INVALID_INVITATION_TOKEN"
+	CodeInvitationEmailMismatch   ErrorCode = "INVITATION_EMAIL_MISMATCH"
+	CodeAccountMemberExists       ErrorCode = "ACCOUNT_MEMBER_EXISTS"
+	CodeAccountMemberNotFound     ErrorCode = "ACCOUNT_MEMBER_NOT_FOUND"
 )
 
 // Auth error codes.
 const (
-	CodeInvalidCredentials      ErrorCode = "INVALID_CREDENTIALS"
-	CodeUnauthorized            ErrorCode = "UNAUTHORIZED"
-	CodeTokenExpired            ErrorCode = "TOKEN_EXPIRED"
-	CodeTokenInvalid            ErrorCode = "TOKEN_INVALID"
-	CodeRefreshTokenWrongFormat ErrorCode = "REFRESH_TOKEN_WRONG_FORMAT"
-	CodeRateLimited             ErrorCode = "RATE_LIMITED"
+	CodeInvalidCredentials          ErrorCode = "INVALID_CREDENTIALS"
+	CodeUnauthorized                ErrorCode = "UNAUTHORIZED"
+	CodeTokenExpired                ErrorCode = "TOKEN_EXPIRED"
+	CodeTokenInvalid                ErrorCode = "TOKEN_INVALID"
+	CodeTokenRevoked                ErrorCode = "TOKEN_REVOKED"
+	CodeRefreshTokenWrongFormat     ErrorCode = "REFRESH_TOKEN_WRONG_FORMAT"
+	CodeRateLimited                 ErrorCode = "RATE_LIMITED"
+	CodeOAuthProviderNotSupported   ErrorCode = "OAUTH_PROVIDER_NOT_SUPPORTED"
+	CodeInvalidOAuthState           ErrorCode = "INVALID_OAUTH_STATE"
+	CodeOAuthFailed                 ErrorCode = "OAUTH_FAILED"
+	CodeAuthProviderNotFound        ErrorCode = "AUTH_PROVIDER_NOT_FOUND"
+	CodeAuthProviderAlreadyLinked   ErrorCode = "AUTH_PROVIDER_ALREADY_LINKED"
+	CodeLastLoginMethod             ErrorCode = "LAST_LOGIN_METHOD"
+	CodeInvalidMFAToken             ErrorCode = "INVALID_MFA_TOKEN"
+	CodeInvalidMagicLinkToken       ErrorCode = "INVALID_MAGIC_LINK_TOKEN"
+	CodeInvalidTwoFactorCode        ErrorCode = "INVALID_TWO_FACTOR_CODE"
+	CodeTwoFactorAlreadyEnabled     ErrorCode = "TWO_FACTOR_ALREADY_ENABLED"
+	CodeTwoFactorNotEnabled         ErrorCode = "TWO_FACTOR_NOT_ENABLED"
+	CodeSessionNotFound             ErrorCode = "SESSION_NOT_FOUND"
+	CodeCSRFTokenInvalid            ErrorCode = "CSRF_TOKEN_INVALID"
+	CodeInvalidUserCode             ErrorCode = "INVALID_USER_CODE"
+	CodeInvalidAuthorizationRequest ErrorCode = "INVALID_AUTHORIZATION_REQUEST"
+	CodeOAuthServerDisabled         ErrorCode = "OAUTH_SERVER_DISABLED"
+	CodeImpersonationReadOnly       ErrorCode = "IMPERSONATION_READ_ONLY"
+	CodeReauthenticationRequired    ErrorCode = "REAUTHENTICATION_REQUIRED"
 )
 
 // ErrorDetail describes a single field-level validation failure.
@@ -44,6 +44,11 @@ type SecretsManagerOptions struct {
 // NewSecretsManagerProvider creates a provider that fetches DB credentials from Secrets Manager.
 // EndpointURL overrides the default AWS endpoint; leave empty for standard AWS.
 func NewSecretsManagerProvider(ctx context.Context, opts SecretsManagerOptions) (Provider, error) {
+	return newSecretsManagerProvider(ctx, opts)
+}
+
+// newSecretsManagerProvider builds the Secrets Manager client and cache bound to opts.SecretID.
+func newSecretsManagerProvider(ctx context.Context, opts SecretsManagerOptions) (*SecretsManagerProvider, error) {
 	region := opts.Region
 	if region == "" {
 		region = "us-east-1"
@@ -99,3 +99,35 @@ func TestSecretsManagerProvider_AWSErrorWrapped(t *testing.T) {
 		t.Fatalf("expected one call to GetSecretStringWithContext, got %d", cache.calls)
 	}
 }
+
+func TestSecretsManagerProvider_GetSigningKeys(t *testing.T) {
+	raw := `{"active_kid":"2026-10","keys":[{"kid":"2026-10","alg":"EdDSA","private_key":"pem"},{"kid":"2026-04","alg":"EdDSA","public_key":"pem","retire_at":"2026-11-01T00:00:00Z"}]}`
+	cache := &stubSecretCache{
+		responses: []struct {
+			value string
+			err   error
+		}{
+			{value: raw, err: nil},
+		},
+	}
+
+	p := &SecretsManagerProvider{cache: cache, secret: "any"}
+
+	set, err := p.GetSigningKeys(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if set.ActiveKeyID != "2026-10" || len(set.Keys) != 2 {
+		t.Fatalf("unexpected key set: active=%q keys=%d", set.ActiveKeyID, len(set.Keys))
+	}
+	if set.Keys[1].RetireAt == nil {
+		t.Fatalf("expected retire_at on the previous key")
+	}
+}
+
+func TestParseSigningKeySet_ActiveKeyMissing(t *testing.T) {
+	_, err := ParseSigningKeySet(`{"active_kid":"new","keys":[{"kid":"old","alg":"RS256","public_key":"pem"}]}`)
+	if err == nil {
+		t.Fatalf("expected error when the active key is not in the set")
+	}
+}
@@ -0,0 +1,67 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SigningKeysProvider returns the JWT signing key set from an external source (e.g. AWS Secrets Manager).
+type SigningKeysProvider interface {
+	GetSigningKeys(ctx context.Context) (*SigningKeySet, error)
+}
+
+// SigningKeySet is the JWT key set as stored in the secret: the key that signs new tokens
+// plus previous keys still accepted for verification during a rotation.
+// NOTE: never log this struct directly, to avoid leaking private keys.
+type SigningKeySet struct {
+	ActiveKeyID string       `json:"active_kid"`
+	Keys        []SigningKey `json:"keys"`
+}
+
+// SigningKey is one PEM-encoded key of the set. Previous keys may carry only the public key;
+// RetireAt (RFC 3339) ends their rotation window.
+type SigningKey struct {
+	KeyID      string     `json:"kid"`
+	Algorithm  string     `json:"alg"` // RS256 or EdDSA
+	PrivateKey string     `json:"private_key,omitempty"`
+	PublicKey  string     `json:"public_key,omitempty"`
+	RetireAt   *time.Time `json:"retire_at,omitempty"`
+}
+
+// ParseSigningKeySet parses the JSON representation of a key set (secret value or JWT_SIGNING_KEYS).
+func ParseSigningKeySet(raw string) (*SigningKeySet, error) {
+	var set SigningKeySet
+	if err := json.Unmarshal([]byte(raw), &set); err != nil {
+		return nil, fmt.Errorf("parse signing keys json: %w", err)
+	}
+	if set.ActiveKeyID == "" {
+		return nil, fmt.Errorf("signing keys: active_kid is required")
+	}
+	for _, key := range set.Keys {
+		if key.KeyID == set.ActiveKeyID {
+			return &set, nil
+		}
+	}
+	return nil, fmt.Errorf("signing keys: active key %q not found", set.ActiveKeyID)
+}
+
+// NewSigningKeysProvider creates a provider that fetches the JWT key set from Secrets Manager.
+func NewSigningKeysProvider(ctx context.Context, opts SecretsManagerOptions) (SigningKeysProvider, error) {
+	return newSecretsManagerProvider(ctx, opts)
+}
+
+// GetSigningKeys retrieves the secret string and parses it as a SigningKeySet.
+func (p *SecretsManagerProvider) GetSigningKeys(ctx context.Context) (*SigningKeySet, error) {
+	raw, err := p.cache.GetSecretStringWithContext(ctx, p.secret)
+	if err != nil {
+		return nil, fmt.Errorf("get secret value: %w", err)
+	}
+
+	if raw == "" {
+		return nil, fmt.Errorf("secret value is empty")
+	}
+
+	return ParseSigningKeySet(raw)
+}
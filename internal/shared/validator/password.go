@@ -0,0 +1,253 @@
+package validator
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultPasswordMinLength = 8
+	// minPersonalInfoLength skips fragments too short to be meaningful (e.g. a two-letter name).
+	minPersonalInfoLength = 3
+	// breachedPrefixLength is the k-anonymity prefix: only the first five hex characters of the SHA-1 leave the process.
+	breachedPrefixLength   = 5
+	defaultBreachedTimeout = 3 * time.Second
+)
+
+// PasswordRules configures the strength rules of a PasswordPolicy; zero lengths keep the defaults (minimum 8, no maximum).
+type PasswordRules struct {
+	MinLength        int
+	MaxLength        int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	// ForbidPersonalInfo rejects passwords containing the email, its local part or a word of the name.
+	ForbidPersonalInfo bool
+}
+
+// PasswordSubject is the personal information a password must not contain.
+type PasswordSubject struct {
+	Email string
+	Name  string
+}
+
+// BreachedPasswordChecker reports whether a password appears in a known breach corpus.
+type BreachedPasswordChecker interface {
+	IsBreached(ctx context.Context, password string) (bool, error)
+}
+
+// PasswordPolicy checks passwords against the strength rules and, optionally, a breached-password list.
+type PasswordPolicy struct {
+	rules    PasswordRules
+	breached BreachedPasswordChecker
+}
+
+// NewPasswordPolicy creates a policy; breached may be nil to skip the breach check.
+func NewPasswordPolicy(rules PasswordRules, breached BreachedPasswordChecker) *PasswordPolicy {
+	if rules.MinLength <= 0 {
+		rules.MinLength = defaultPasswordMinLength
+	}
+	return &PasswordPolicy{rules: rules, breached: breached}
+}
+
+// Check validates password for subject and returns ValidationErrors with one FieldError per violated rule,
+// all reported under field. An unavailable breach backend is logged and does not reject the password.
+func (p *PasswordPolicy) Check(ctx context.Context, field, password string, subject PasswordSubject) error {
+	var violations ValidationErrors
+	add := func(message string) {
+		violations = append(violations, FieldError{Field: field, Message: message})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.rules.MinLength {
+		add(fmt.Sprintf("Must be at least %d characters", p.rules.MinLength))
+	}
+	if p.rules.MaxLength > 0 && length > p.rules.MaxLength {
+		add(fmt.Sprintf("Must be at most %d characters", p.rules.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.rules.RequireUppercase && !hasUpper {
+		add("Must contain an uppercase letter")
+	}
+	if p.rules.RequireLowercase && !hasLower {
+		add("Must contain a lowercase letter")
+	}
+	if p.rules.RequireDigit && !hasDigit {
+		add("Must contain a digit")
+	}
+	if p.rules.RequireSymbol && !hasSymbol {
+		add("Must contain a symbol")
+	}
+	if p.rules.ForbidPersonalInfo {
+		if fragment := personalInfoIn(password, subject); fragment != "" {
+			add(fmt.Sprintf("Must not contain your %s", fragment))
+		}
+	}
+
+	if len(violations) == 0 && p.breached != nil {
+		breached, err := p.breached.IsBreached(ctx, password)
+		if err != nil {
+			slog.Warn("breached password check unavailable", "error", err)
+		} else if breached {
+			add("Has appeared in a data breach; choose a different password")
+		}
+	}
+
+	if len(violations) > 0 {
+		return violations
+	}
+	return nil
+}
+
+// personalInfoIn returns which part of the subject ("email" or "name") the password contains, or "".
+func personalInfoIn(password string, subject PasswordSubject) string {
+	lowered := strings.ToLower(password)
+	contains := func(fragment string) bool {
+		fragment = strings.ToLower(strings.TrimSpace(fragment))
+		return utf8.RuneCountInString(fragment) >= minPersonalInfoLength && strings.Contains(lowered, fragment)
+	}
+
+	email := strings.ToLower(strings.TrimSpace(subject.Email))
+	if email != "" {
+		localPart, _, _ := strings.Cut(email, "@")
+		if contains(email) || contains(localPart) {
+			return "email"
+		}
+	}
+	for _, word := range strings.Fields(subject.Name) {
+		if contains(word) {
+			return "name"
+		}
+	}
+	return ""
+}
+
+// breachedSHA1 returns the upper-case SHA-1 of the password split into the k-anonymity prefix and suffix.
+func breachedSHA1(password string) (prefix, suffix string) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return digest[:breachedPrefixLength], digest[breachedPrefixLength:]
+}
+
+// LocalBreachedPasswords is a BreachedPasswordChecker over an in-memory SHA-1 list indexed by k-anonymity prefix.
+type LocalBreachedPasswords struct {
+	suffixes map[string]map[string]struct{}
+}
+
+// LoadBreachedPasswords reads a breach list with one "<SHA1>:<count>" (or bare "<SHA1>") line per entry,
+// the format of the Pwned Passwords downloads and of range responses prefixed with their five-character prefix.
+// Entries with a zero count (range padding) are skipped.
+func LoadBreachedPasswords(r io.Reader) (*LocalBreachedPasswords, error) {
+	list := &LocalBreachedPasswords{suffixes: make(map[string]map[string]struct{})}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		hash, count, _ := strings.Cut(entry, ":")
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("breached password list line %d: expected a 40-character SHA-1", line)
+		}
+		if strings.TrimSpace(count) == "0" {
+			continue
+		}
+		hash = strings.ToUpper(hash)
+		prefix := hash[:breachedPrefixLength]
+		if list.suffixes[prefix] == nil {
+			list.suffixes[prefix] = make(map[string]struct{})
+		}
+		list.suffixes[prefix][hash[breachedPrefixLength:]] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read breached password list: %w", err)
+	}
+	return list, nil
+}
+
+// LoadBreachedPasswordsFile loads a breach list from path (see LoadBreachedPasswords).
+func LoadBreachedPasswordsFile(path string) (*LocalBreachedPasswords, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open breached password list: %w", err)
+	}
+	defer file.Close()
+	return LoadBreachedPasswords(file)
+}
+
+// IsBreached looks the password's SHA-1 suffix up in the bucket of its prefix.
+func (l *LocalBreachedPasswords) IsBreached(_ context.Context, password string) (bool, error) {
+	prefix, suffix := breachedSHA1(password)
+	_, found := l.suffixes[prefix][suffix]
+	return found, nil
+}
+
+// RangeBreachedPasswords is a BreachedPasswordChecker over a Pwned Passwords compatible range API:
+// GET {baseURL}/range/{prefix} answers "<suffix>:<count>" lines, so the full hash never leaves the process.
+type RangeBreachedPasswords struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewRangeBreachedPasswords creates a range API checker (e.g. baseURL "https://api.pwnedpasswords.com").
+func NewRangeBreachedPasswords(baseURL string) *RangeBreachedPasswords {
+	return &RangeBreachedPasswords{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: defaultBreachedTimeout},
+	}
+}
+
+// IsBreached queries the range of the password's prefix with response padding enabled.
+func (c *RangeBreachedPasswords) IsBreached(ctx context.Context, password string) (bool, error) {
+	prefix, suffix := breachedSHA1(password)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/range/"+prefix, nil)
+	if err != nil {
+		return false, fmt.Errorf("build range request: %w", err)
+	}
+	req.Header.Set("Add-Padding", "true")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("query breached password range: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("query breached password range: status %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(candidate, suffix) {
+			return strings.TrimSpace(count) != "0", nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("read breached password range: %w", err)
+	}
+	return false, nil
+}
@@ -0,0 +1,118 @@
+package validator
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sha1Hex returns the upper-case SHA-1 of password, as in breach lists.
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// messages returns the messages of the ValidationErrors in err, or nil.
+func messages(err error) []string {
+	var ve ValidationErrors
+	if !errors.As(err, &ve) {
+		return nil
+	}
+	out := make([]string, len(ve))
+	for i, fe := range ve {
+		out[i] = fe.Message
+	}
+	return out
+}
+
+func TestPasswordPolicy_Rules(t *testing.T) {
+	policy := NewPasswordPolicy(PasswordRules{
+		MinLength:          10,
+		RequireUppercase:   true,
+		RequireLowercase:   true,
+		RequireDigit:       true,
+		RequireSymbol:      true,
+		ForbidPersonalInfo: true,
+	}, nil)
+	subject := PasswordSubject{Email: "alice.smith@example.com", Name: "Alice Smith"}
+
+	err := policy.Check(context.Background(), "password", "short", subject)
+	require.Error(t, err)
+	assert.Equal(t, []string{
+		"Must be at least 10 characters",
+		"Must contain an uppercase letter",
+		"Must contain a digit",
+		"Must contain a symbol",
+	}, messages(err))
+	for _, fe := range err.(ValidationErrors) {
+		assert.Equal(t, "password", fe.Field)
+	}
+
+	assert.Equal(t, []string{"Must not contain your email"}, messages(policy.Check(context.Background(), "password", "Alice.Smith#2024", subject)))
+	assert.Equal(t, []string{"Must not contain your name"}, messages(policy.Check(context.Background(), "password", "Smithereens#42", subject)))
+	assert.NoError(t, policy.Check(context.Background(), "password", "Correct-Horse-7", subject))
+}
+
+func TestPasswordPolicy_DefaultsToMinimumEight(t *testing.T) {
+	policy := NewPasswordPolicy(PasswordRules{}, nil)
+	assert.Equal(t, []string{"Must be at least 8 characters"}, messages(policy.Check(context.Background(), "password", "seven77", PasswordSubject{})))
+	assert.NoError(t, policy.Check(context.Background(), "password", "alice123", PasswordSubject{Name: "Alice"}), "personal info is allowed unless forbidden")
+}
+
+func TestLocalBreachedPasswords(t *testing.T) {
+	list, err := LoadBreachedPasswords(strings.NewReader(
+		"# comment\n" + strings.ToLower(sha1Hex("password123")) + ":250\n" + sha1Hex("padding-entry") + ":0\n" + sha1Hex("letmein") + "\n",
+	))
+	require.NoError(t, err)
+
+	for password, want := range map[string]bool{"password123": true, "letmein": true, "padding-entry": false, "Correct-Horse-7": false} {
+		breached, err := list.IsBreached(context.Background(), password)
+		require.NoError(t, err)
+		assert.Equal(t, want, breached, password)
+	}
+
+	_, err = LoadBreachedPasswords(strings.NewReader("ABCDEF:1\n"))
+	assert.Error(t, err)
+
+	policy := NewPasswordPolicy(PasswordRules{}, list)
+	assert.Equal(t, []string{"Has appeared in a data breach; choose a different password"}, messages(policy.Check(context.Background(), "password", "password123", PasswordSubject{})))
+}
+
+func TestRangeBreachedPasswords(t *testing.T) {
+	hash := sha1Hex("password123")
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		assert.Equal(t, "true", r.Header.Get("Add-Padding"))
+		_, _ = w.Write([]byte("0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n" + hash[5:] + ":250\r\n"))
+	}))
+	defer server.Close()
+
+	checker := NewRangeBreachedPasswords(server.URL + "/")
+	breached, err := checker.IsBreached(context.Background(), "password123")
+	require.NoError(t, err)
+	assert.True(t, breached)
+	assert.Equal(t, "/range/"+hash[:5], requested, "only the five-character prefix is sent")
+
+	breached, err = checker.IsBreached(context.Background(), "Correct-Horse-7")
+	require.NoError(t, err)
+	assert.False(t, breached)
+}
+
+func TestPasswordPolicy_BreachBackendUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	policy := NewPasswordPolicy(PasswordRules{}, NewRangeBreachedPasswords(server.URL))
+	assert.NoError(t, policy.Check(context.Background(), "password", "password123", PasswordSubject{}), "an unavailable backend does not block the password")
+}
@@ -70,6 +70,8 @@ func fieldMessage(fe validator.FieldError) string {
 	switch fe.Tag() {
 	case "required":
 		return "Is required"
+	case "required_without":
+		return fmt.Sprintf("Is required when %s is not given", strings.ToLower(fe.Param()))
 	case "email":
 		return "Must be a valid email address"
 	case "min":
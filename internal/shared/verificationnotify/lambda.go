@@ -13,7 +13,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
 )
 
-// LambdaNotifierOptions configures async Lambda invocation for verification emails.
+// LambdaNotifierOptions configures async Lambda invocation for transactional auth emails.
 type LambdaNotifierOptions struct {
 	EndpointURL     string
 	Region          string
@@ -33,9 +33,13 @@ type LambdaNotifier struct {
 }
 
 type verificationPayload struct {
-	Email string `json:"email"`
-	Name  string `json:"name"`
-	Link  string `json:"link"`
+	Email       string `json:"email"`
+	Name        string `json:"name"`
+	Link        string `json:"link,omitempty"`
+	Code        string `json:"code,omitempty"`
+	NewEmail    string `json:"new_email,omitempty"`
+	InviterName string `json:"inviter_name,omitempty"`
+	AccountName string `json:"account_name,omitempty"`
 }
 
 // NewLambdaNotifier builds a Notifier that invokes the given function asynchronously.
@@ -78,20 +82,66 @@ func NewLambdaNotifier(ctx context.Context, opts LambdaNotifierOptions) (*Lambda
 }
 
 // NotifyVerificationEmail implements Notifier.
-func (n *LambdaNotifier) NotifyVerificationEmail(ctx context.Context, toEmail, name, link string) error {
-	to := strings.TrimSpace(toEmail)
-	if to == "" {
-		return fmt.Errorf("recipient email is required")
-	}
+func (n *LambdaNotifier) NotifyVerificationEmail(ctx context.Context, toEmail, name, link, code string) error {
 	if strings.TrimSpace(link) == "" {
 		return fmt.Errorf("verification link is required")
 	}
+	return n.invoke(ctx, verificationPayload{Email: toEmail, Name: name, Link: link, Code: code})
+}
 
-	body, err := json.Marshal(verificationPayload{
-		Email: to,
-		Name:  name,
-		Link:  link,
-	})
+// NotifyPasswordReset implements PasswordResetNotifier.
+// The payload has the same shape as the verification one; the target function picks the template.
+func (n *LambdaNotifier) NotifyPasswordReset(ctx context.Context, toEmail, name, link string) error {
+	if strings.TrimSpace(link) == "" {
+		return fmt.Errorf("password reset link is required")
+	}
+	return n.invoke(ctx, verificationPayload{Email: toEmail, Name: name, Link: link})
+}
+
+// NotifyMagicLink implements MagicLinkNotifier.
+// The payload has the same shape as the verification one; the target function picks the template.
+func (n *LambdaNotifier) NotifyMagicLink(ctx context.Context, toEmail, name, link string) error {
+	if strings.TrimSpace(link) == "" {
+		return fmt.Errorf("magic link is required")
+	}
+	return n.invoke(ctx, verificationPayload{Email: toEmail, Name: name, Link: link})
+}
+
+// NotifyEmailChangeRequested implements EmailChangeNotifier.
+// The payload carries new_email instead of a link; the target function picks the template.
+func (n *LambdaNotifier) NotifyEmailChangeRequested(ctx context.Context, toEmail, name, newEmail string) error {
+	if strings.TrimSpace(newEmail) == "" {
+		return fmt.Errorf("new email is required")
+	}
+	return n.invoke(ctx, verificationPayload{Email: toEmail, Name: name, NewEmail: newEmail})
+}
+
+// NotifyEmailChangeConfirmation implements EmailChangeConfirmationNotifier.
+// The payload has the same shape as the verification one; the target function picks the template.
+func (n *LambdaNotifier) NotifyEmailChangeConfirmation(ctx context.Context, toEmail, name, link string) error {
+	if strings.TrimSpace(link) == "" {
+		return fmt.Errorf("email change confirmation link is required")
+	}
+	return n.invoke(ctx, verificationPayload{Email: toEmail, Name: name, Link: link})
+}
+
+// NotifyAccountInvitation implements AccountInvitationNotifier.
+// The invitee may not have an account yet, so name is empty and the payload carries inviter_name and account_name.
+func (n *LambdaNotifier) NotifyAccountInvitation(ctx context.Context, toEmail, inviterName, accountName, link string) error {
+	if strings.TrimSpace(link) == "" {
+		return fmt.Errorf("invitation link is required")
+	}
+	return n.invoke(ctx, verificationPayload{Email: toEmail, Link: link, InviterName: inviterName, AccountName: accountName})
+}
+
+// invoke sends the email payload to the configured function as an async (Event) invocation.
+func (n *LambdaNotifier) invoke(ctx context.Context, payload verificationPayload) error {
+	payload.Email = strings.TrimSpace(payload.Email)
+	if payload.Email == "" {
+		return fmt.Errorf("recipient email is required")
+	}
+
+	body, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("marshal verification payload: %w", err)
 	}
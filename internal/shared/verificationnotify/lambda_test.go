@@ -39,7 +39,7 @@ func TestLambdaNotifierNotifyVerificationEmail(t *testing.T) {
 	stub := &stubLambdaClient{}
 	n := &LambdaNotifier{client: stub, functionName: "my-fn"}
 
-	err := n.NotifyVerificationEmail(context.Background(), "a@b.com", "Alice", "https://front/auth/verify-email?token=t")
+	err := n.NotifyVerificationEmail(context.Background(), "a@b.com", "Alice", "https://front/auth/verify-email?token=t", "123456")
 	require.NoError(t, err)
 
 	require.NotNil(t, stub.lastInput)
@@ -52,11 +52,91 @@ func TestLambdaNotifierNotifyVerificationEmail(t *testing.T) {
 	assert.Equal(t, "a@b.com", got.Email)
 	assert.Equal(t, "Alice", got.Name)
 	assert.Equal(t, "https://front/auth/verify-email?token=t", got.Link)
+	assert.Equal(t, "123456", got.Code)
 }
 
 func TestLambdaNotifierNotifyVerificationEmailEmptyRecipient(t *testing.T) {
 	t.Parallel()
 	n := &LambdaNotifier{client: &stubLambdaClient{}, functionName: "fn"}
-	err := n.NotifyVerificationEmail(context.Background(), "  ", "N", "https://x")
+	err := n.NotifyVerificationEmail(context.Background(), "  ", "N", "https://x", "")
+	assert.Error(t, err)
+}
+
+func TestLambdaNotifierNotifyPasswordReset(t *testing.T) {
+	t.Parallel()
+	stub := &stubLambdaClient{}
+	n := &LambdaNotifier{client: stub, functionName: "reset-fn"}
+
+	err := n.NotifyPasswordReset(context.Background(), "a@b.com", "Alice", "https://front/auth/reset-password?token=t")
+	require.NoError(t, err)
+
+	require.NotNil(t, stub.lastInput)
+	assert.Equal(t, "reset-fn", *stub.lastInput.FunctionName)
+
+	var got verificationPayload
+	require.NoError(t, json.Unmarshal(stub.lastInput.Payload, &got))
+	assert.Equal(t, "https://front/auth/reset-password?token=t", got.Link)
+}
+
+func TestLambdaNotifierNotifyPasswordResetEmptyLink(t *testing.T) {
+	t.Parallel()
+	n := &LambdaNotifier{client: &stubLambdaClient{}, functionName: "fn"}
+	err := n.NotifyPasswordReset(context.Background(), "a@b.com", "N", " ")
+	assert.Error(t, err)
+}
+
+func TestLambdaNotifierNotifyEmailChangeRequested(t *testing.T) {
+	t.Parallel()
+	stub := &stubLambdaClient{}
+	n := &LambdaNotifier{client: stub, functionName: "email-change-fn"}
+
+	err := n.NotifyEmailChangeRequested(context.Background(), "old@b.com", "Alice", "new@b.com")
+	require.NoError(t, err)
+
+	var got verificationPayload
+	require.NoError(t, json.Unmarshal(stub.lastInput.Payload, &got))
+	assert.Equal(t, "old@b.com", got.Email)
+	assert.Equal(t, "new@b.com", got.NewEmail)
+	assert.Empty(t, got.Link)
+}
+
+func TestLambdaNotifierNotifyEmailChangeConfirmation(t *testing.T) {
+	t.Parallel()
+	stub := &stubLambdaClient{}
+	n := &LambdaNotifier{client: stub, functionName: "email-change-confirmation-fn"}
+
+	err := n.NotifyEmailChangeConfirmation(context.Background(), "new@b.com", "Alice", "https://app/auth/confirm-email-change?token=t")
+	require.NoError(t, err)
+
+	var got verificationPayload
+	require.NoError(t, json.Unmarshal(stub.lastInput.Payload, &got))
+	assert.Equal(t, "new@b.com", got.Email)
+	assert.Equal(t, "https://app/auth/confirm-email-change?token=t", got.Link)
+	assert.Empty(t, got.Code)
+}
+
+func TestLambdaNotifierNotifyMagicLinkEmptyLink(t *testing.T) {
+	t.Parallel()
+	n := &LambdaNotifier{client: &stubLambdaClient{}, functionName: "fn"}
+	err := n.NotifyMagicLink(context.Background(), "a@b.com", "N", " ")
+	assert.Error(t, err)
+}
+
+func TestLambdaNotifierNotifyAccountInvitation(t *testing.T) {
+	t.Parallel()
+	stub := &stubLambdaClient{}
+	n := &LambdaNotifier{client: stub, functionName: "invitation-fn"}
+
+	err := n.NotifyAccountInvitation(context.Background(), "bob@b.com", "Alice", "Acme", "https://front/invitations/accept?token=t")
+	require.NoError(t, err)
+
+	var got verificationPayload
+	require.NoError(t, json.Unmarshal(stub.lastInput.Payload, &got))
+	assert.Equal(t, "bob@b.com", got.Email)
+	assert.Equal(t, "Alice", got.InviterName)
+	assert.Equal(t, "Acme", got.AccountName)
+	assert.Equal(t, "https://front/invitations/accept?token=t", got.Link)
+
+	err = n.NotifyAccountInvitation(context.Background(), "bob@b.com", "Alice", "Acme", " ")
 	assert.Error(t, err)
 }
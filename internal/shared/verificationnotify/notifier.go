@@ -3,14 +3,67 @@ package verificationnotify
 import "context"
 
 // Notifier triggers delivery of the email verification message (e.g. async Lambda that sends via SES).
+// code is the six-digit alternative to the link for clients that cannot open it; empty when not issued.
 type Notifier interface {
-	NotifyVerificationEmail(ctx context.Context, toEmail, name, link string) error
+	NotifyVerificationEmail(ctx context.Context, toEmail, name, link, code string) error
+}
+
+// PasswordResetNotifier triggers delivery of the password reset message with a single-use reset link.
+type PasswordResetNotifier interface {
+	NotifyPasswordReset(ctx context.Context, toEmail, name, link string) error
+}
+
+// MagicLinkNotifier triggers delivery of a passwordless login message with a single-use login link.
+type MagicLinkNotifier interface {
+	NotifyMagicLink(ctx context.Context, toEmail, name, link string) error
+}
+
+// EmailChangeNotifier warns the current address of a user that a change to newEmail was requested.
+type EmailChangeNotifier interface {
+	NotifyEmailChangeRequested(ctx context.Context, toEmail, name, newEmail string) error
+}
+
+// EmailChangeConfirmationNotifier triggers delivery of the single-use link that confirms a pending email change,
+// sent to the new address.
+type EmailChangeConfirmationNotifier interface {
+	NotifyEmailChangeConfirmation(ctx context.Context, toEmail, name, link string) error
+}
+
+// AccountInvitationNotifier triggers delivery of an invitation to join accountName, sent by inviterName,
+// with a single-use link to accept it.
+type AccountInvitationNotifier interface {
+	NotifyAccountInvitation(ctx context.Context, toEmail, inviterName, accountName, link string) error
 }
 
 // NoopNotifier is a Notifier that does nothing.
 type NoopNotifier struct{}
 
 // NotifyVerificationEmail implements Notifier.
-func (NoopNotifier) NotifyVerificationEmail(context.Context, string, string, string) error {
+func (NoopNotifier) NotifyVerificationEmail(context.Context, string, string, string, string) error {
+	return nil
+}
+
+// NotifyPasswordReset implements PasswordResetNotifier.
+func (NoopNotifier) NotifyPasswordReset(context.Context, string, string, string) error {
+	return nil
+}
+
+// NotifyMagicLink implements MagicLinkNotifier.
+func (NoopNotifier) NotifyMagicLink(context.Context, string, string, string) error {
+	return nil
+}
+
+// NotifyEmailChangeRequested implements EmailChangeNotifier.
+func (NoopNotifier) NotifyEmailChangeRequested(context.Context, string, string, string) error {
+	return nil
+}
+
+// NotifyEmailChangeConfirmation implements EmailChangeConfirmationNotifier.
+func (NoopNotifier) NotifyEmailChangeConfirmation(context.Context, string, string, string) error {
+	return nil
+}
+
+// NotifyAccountInvitation implements AccountInvitationNotifier.
+func (NoopNotifier) NotifyAccountInvitation(context.Context, string, string, string, string) error {
 	return nil
 }
@@ -9,10 +9,24 @@ type CreateUserRequest struct {
 }
 
 // En: UpdateMeRequest is the request body for updating the authenticated user's profile.
-// At least one field must be present. Email cannot be changed.
+// At least one field must be present. Email is changed through POST /users/me/email.
 // Es: UpdateMeRequest es el cuerpo de la petición para actualizar el perfil del usuario autenticado.
-// Debe estar presente al menos un campo. El email no se puede cambiar.
+// Debe estar presente al menos un campo. El email se cambia mediante POST /users/me/email.
 type UpdateMeRequest struct {
 	Name     *string `json:"name"     validate:"omitempty,min=2,max=100"`
 	Password *string `json:"password" validate:"omitempty,min=8,max=72"`
 }
+
+// En: MeResponse is the body of GET /users/me: the user plus, for impersonation tokens, who is acting as them.
+// Es: MeResponse es el cuerpo de GET /users/me: el usuario más, para tokens de suplantación, quién actúa como él.
+type MeResponse struct {
+	*User
+	Impersonation *ImpersonationInfo `json:"impersonation,omitempty"`
+}
+
+// En: ImpersonationInfo flags a session opened by a platform admin so the frontend can show a visible banner.
+// Es: ImpersonationInfo marca una sesión abierta por un platform admin para que el frontend muestre un aviso visible.
+type ImpersonationInfo struct {
+	ActorID  string `json:"actor_id"`
+	ReadOnly bool   `json:"read_only"`
+}
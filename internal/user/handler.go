@@ -44,8 +44,10 @@ func (handler *Handler) WithAccountLister(accountLister AccountLister) *Handler
 	return handler
 }
 
-// En: GetMe returns the authenticated user based on the userID stored in locals.
-// Es: GetMe devuelve el usuario autenticado según el userID almacenado en locals.
+// En: GetMe returns the authenticated user based on the userID stored in locals; impersonation tokens add an
+// "impersonation" object with the acting platform admin.
+// Es: GetMe devuelve el usuario autenticado según el userID almacenado en locals; los tokens de suplantación añaden un
+// objeto "impersonation" con el platform admin que actúa.
 func (handler *Handler) GetMe(ctx fiber.Ctx) error {
 	requestContext, err := requestctx.UserOnly(ctx)
 	if err != nil {
@@ -67,7 +69,11 @@ func (handler *Handler) GetMe(ctx fiber.Ctx) error {
 		)
 	}
 
-	return ctx.JSON(fiber.Map{"data": user})
+	response := MeResponse{User: user}
+	if requestContext.ActorID != "" {
+		response.Impersonation = &ImpersonationInfo{ActorID: requestContext.ActorID, ReadOnly: requestContext.ReadOnly}
+	}
+	return ctx.JSON(fiber.Map{"data": response})
 }
 
 // En: GetMyAccounts returns all accounts where the authenticated user is a member.
@@ -143,6 +149,13 @@ func (handler *Handler) UpdateMe(ctx fiber.Ctx) error {
 
 	user, err := handler.service.UpdateUser(requestContext.UserID, req.Name, req.Password)
 	if err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
 		if errors.Is(err, ErrNotFound) {
 			return runtimeError.Respond(
 				ctx, fiber.StatusNotFound, runtimeError.CodeUserNotFound, "User not found",
@@ -184,6 +197,13 @@ func (handler *Handler) CreateUser(ctx fiber.Ctx) error {
 
 	user, err := handler.service.CreateUser(req.Name, req.Email, req.Password)
 	if err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			return runtimeError.RespondWithDetails(
+				ctx, fiber.StatusUnprocessableEntity, runtimeError.CodeValidationError,
+				"Validation failed", toErrorDetails(ve),
+			)
+		}
 		if errors.Is(err, ErrDuplicateEmail) {
 			return runtimeError.Respond(
 				ctx, fiber.StatusConflict, runtimeError.CodeEmailAlreadyExists, "Email already exists",
@@ -111,6 +111,40 @@ func TestGetMeReturnsActiveAccountID(test *testing.T) {
 	assert.Equal(test, activeID, *result.Data.ActiveAccountID)
 }
 
+// En: TestGetMeFlagsImpersonation checks GET /users/me exposes the acting platform admin of an impersonation token.
+// Es: TestGetMeFlagsImpersonation comprueba que GET /users/me expone al platform admin que actúa en un token de suplantación.
+func TestGetMeFlagsImpersonation(test *testing.T) {
+	handler := SetupUserHandlerTest(test)
+
+	testUser := User{Name: "Impersonated", Email: "impersonated@example.com"}
+	require.NoError(test, testUser.SetPassword("secret123"))
+	require.NoError(test, database.DB.Create(&testUser).Error)
+
+	app := fiber.New()
+	app.Get("/users/me", func(c fiber.Ctx) error {
+		c.Locals("userID", testUser.ID)
+		c.Locals("actorID", "admin-1")
+		c.Locals("readOnly", true)
+		return c.Next()
+	}, handler.GetMe)
+
+	req := httptest.NewRequest("GET", "/users/me", nil)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+	require.NoError(test, err)
+	defer resp.Body.Close()
+
+	assert.Equal(test, fiber.StatusOK, resp.StatusCode)
+
+	var result struct {
+		Data MeResponse `json:"data"`
+	}
+	require.NoError(test, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(test, testUser.ID, result.Data.ID)
+	require.NotNil(test, result.Data.Impersonation)
+	assert.Equal(test, "admin-1", result.Data.Impersonation.ActorID)
+	assert.True(test, result.Data.Impersonation.ReadOnly)
+}
+
 func TestGetMyAccountsSuccess(test *testing.T) {
 	repository := NewRepository(database.DB)
 	service := NewService(repository)
@@ -588,6 +622,41 @@ func TestUpdateMeUpdateName(test *testing.T) {
 	assert.Empty(test, result.Data.PasswordHash)
 }
 
+type stubTokenRevoker struct {
+	revokedUserIDs []string
+}
+
+func (s *stubTokenRevoker) RevokeAllByUserID(userID string) error {
+	s.revokedUserIDs = append(s.revokedUserIDs, userID)
+	return nil
+}
+
+// TestUpdateMePasswordRevokesTokens tests that a password change ends every session of the user.
+// En: Verifies that changing the password calls the token revoker, while a name change does not.
+// Es: Verifica que cambiar la contraseña llama al revocador de tokens, mientras que cambiar el nombre no.
+func TestUpdateMePasswordRevokesTokens(test *testing.T) {
+	handler := SetupUserHandlerTest(test)
+	revoker := &stubTokenRevoker{}
+	handler.service.WithTokenRevoker(revoker)
+
+	testUser := User{Name: "Old Name", Email: "rotate@example.com"}
+	require.NoError(test, testUser.SetPassword("secret123"))
+	require.NoError(test, database.DB.Create(&testUser).Error)
+
+	app := setupUpdateMe(test, handler, testUser.ID)
+
+	for _, body := range []string{`{"name":"New Name"}`, `{"password":"newsecret123"}`} {
+		req := httptest.NewRequest("PUT", "/users/me", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+		require.NoError(test, err)
+		resp.Body.Close()
+		require.Equal(test, fiber.StatusOK, resp.StatusCode)
+	}
+
+	assert.Equal(test, []string{testUser.ID}, revoker.revokedUserIDs)
+}
+
 // TestUpdateMeEmailIgnored tests that email field is ignored in update requests.
 // En: Ensures that email cannot be updated through the Update Me endpoint.
 // Es: Asegura que el email no pueda ser actualizado a través del endpoint de actualización.
@@ -1,5 +1,5 @@
 // Package user provides user identity management: profile CRUD (GetMe, UpdateMe),
-// password hashing with bcrypt, email normalization, soft delete, and session
+// versioned password hashing (bcrypt or argon2id), email normalization, soft delete, and session
 // revocation via TokenRevoker.
 package user
 
@@ -7,11 +7,16 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
-const bcryptCost = 12
+// En: PlatformRole grants staff permissions across the whole platform, outside any account.
+// Es: PlatformRole otorga permisos de personal sobre toda la plataforma, fuera de cualquier cuenta.
+type PlatformRole string
+
+// En: PlatformRoleAdmin is the support staff role; it can impersonate customers through POST /admin/impersonate/:userID.
+// Es: PlatformRoleAdmin es el rol del equipo de soporte; puede suplantar a clientes mediante POST /admin/impersonate/:userID.
+const PlatformRoleAdmin PlatformRole = "platform-admin"
 
 // En: User represents a user in the system.
 // Es: User representa un usuario en el sistema.
@@ -24,6 +29,7 @@ type User struct {
 	EmailVerificationToken     *string        `gorm:"column:email_verification_token;index" json:"-"`
 	EmailVerificationExpiresAt *time.Time     `gorm:"column:email_verification_expires_at" json:"-"`
 	ActiveAccountID            *string        `gorm:"type:uuid;column:active_account_id" json:"active_account_id,omitempty"`
+	PlatformRole               PlatformRole   `gorm:"column:platform_role;not null;default:''" json:"platform_role,omitempty"`
 	CreatedAt                  time.Time      `json:"created_at"`
 	UpdatedAt                  time.Time      `json:"updated_at"`
 	DeletedAt                  gorm.DeletedAt `gorm:"index" json:"-"`
@@ -35,21 +41,34 @@ func (user *User) IsEmailVerified() bool {
 	return user.EmailVerifiedAt != nil
 }
 
-// En: SetPassword hashes the plain password and stores it in PasswordHash.
-// Es: SetPassword hashea la contraseña en claro y la guarda en PasswordHash.
+// En: IsPlatformAdmin returns true if the user belongs to the support staff.
+// Es: IsPlatformAdmin devuelve true si el usuario pertenece al equipo de soporte.
+func (user *User) IsPlatformAdmin() bool {
+	return user.PlatformRole == PlatformRoleAdmin
+}
+
+// En: SetPassword hashes the plain password with the current password policy and stores it in PasswordHash.
+// Es: SetPassword hashea la contraseña en claro con la política de contraseñas actual y la guarda en PasswordHash.
 func (user *User) SetPassword(plain string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plain), bcryptCost)
+	hash, err := passwordHasher().Hash(plain)
 	if err != nil {
 		return err
 	}
-	user.PasswordHash = string(hash)
+	user.PasswordHash = hash
 	return nil
 }
 
-// En: CheckPassword verifies that the plain password matches the stored hash.
-// Es: CheckPassword verifica que la contraseña en claro coincida con el hash almacenado.
+// En: CheckPassword verifies the plain password with the algorithm the stored hash was made with.
+// Es: CheckPassword verifica la contraseña en claro con el algoritmo con el que se generó el hash almacenado.
 func (user *User) CheckPassword(plain string) bool {
-	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(plain)) == nil
+	hasher := identifyPasswordHasher(user.PasswordHash)
+	return hasher != nil && hasher.Verify(user.PasswordHash, plain)
+}
+
+// En: PasswordNeedsRehash reports whether the stored hash uses another algorithm or cost than the current policy.
+// Es: PasswordNeedsRehash indica si el hash almacenado usa otro algoritmo o costo que la política actual.
+func (user *User) PasswordNeedsRehash() bool {
+	return user.PasswordHash != "" && passwordHasher().NeedsRehash(user.PasswordHash)
 }
 
 // En: TableName overrides the table name.
@@ -1,6 +1,7 @@
 package user
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -29,3 +30,58 @@ func TestUserCheckPassword(test *testing.T) {
 	assert.False(test, user.CheckPassword("wrongpassword"))
 	assert.False(test, user.CheckPassword(""))
 }
+
+// usePasswordPolicy switches the password policy for one test and restores the default afterwards.
+func usePasswordPolicy(test *testing.T, policy PasswordPolicy) {
+	test.Helper()
+	require.NoError(test, SetPasswordPolicy(policy))
+	test.Cleanup(func() { require.NoError(test, SetPasswordPolicy(DefaultPasswordPolicy)) })
+}
+
+// En: TestUserPasswordMixedHashes verifies that bcrypt and argon2id hashes both verify whatever the current policy,
+// and that only hashes made under another policy need a rehash.
+// Es: TestUserPasswordMixedHashes verifica que los hashes bcrypt y argon2id verifican sea cual sea la política actual,
+// y que solo los generados con otra política necesitan rehash.
+func TestUserPasswordMixedHashes(test *testing.T) {
+	usePasswordPolicy(test, PasswordPolicy{Algorithm: PasswordAlgorithmBcrypt, BcryptCost: 4})
+	legacy := &User{}
+	require.NoError(test, legacy.SetPassword("mypassword123"))
+	assert.True(test, strings.HasPrefix(legacy.PasswordHash, "$2a$"))
+	assert.False(test, legacy.PasswordNeedsRehash())
+
+	usePasswordPolicy(test, PasswordPolicy{Algorithm: PasswordAlgorithmArgon2id, Argon2Memory: 1024, Argon2Iterations: 1, Argon2Parallelism: 1})
+	current := &User{}
+	require.NoError(test, current.SetPassword("mypassword123"))
+	assert.True(test, strings.HasPrefix(current.PasswordHash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	for _, u := range []*User{legacy, current} {
+		assert.True(test, u.CheckPassword("mypassword123"))
+		assert.False(test, u.CheckPassword("wrongpassword"))
+	}
+	assert.True(test, legacy.PasswordNeedsRehash(), "bcrypt hashes are upgraded to argon2id")
+	assert.False(test, current.PasswordNeedsRehash())
+
+	usePasswordPolicy(test, PasswordPolicy{Algorithm: PasswordAlgorithmArgon2id, Argon2Memory: 2048, Argon2Iterations: 1, Argon2Parallelism: 1})
+	assert.True(test, current.CheckPassword("mypassword123"), "parameters are read from the stored hash")
+	assert.True(test, current.PasswordNeedsRehash(), "a raised argon2id cost triggers a rehash")
+
+	usePasswordPolicy(test, PasswordPolicy{Algorithm: PasswordAlgorithmBcrypt, BcryptCost: 5})
+	assert.True(test, legacy.PasswordNeedsRehash(), "a raised bcrypt cost triggers a rehash")
+}
+
+// En: TestUserCheckPasswordUnknownHash verifies that unknown or malformed hashes never verify.
+// Es: TestUserCheckPasswordUnknownHash verifica que los hashes desconocidos o mal formados nunca verifican.
+func TestUserCheckPasswordUnknownHash(test *testing.T) {
+	for _, hash := range []string{"", "plaintext", "$argon2id$v=19$m=1024,t=1,p=1$bad", "$scrypt$ln=15,r=8,p=1$c2FsdA$a2V5"} {
+		u := &User{PasswordHash: hash}
+		assert.False(test, u.CheckPassword("plaintext"), hash)
+	}
+}
+
+// En: TestSetPasswordPolicyRejectsInvalidPolicy verifies that unknown algorithms and out-of-range costs are rejected.
+// Es: TestSetPasswordPolicyRejectsInvalidPolicy verifica que se rechazan algoritmos desconocidos y costos fuera de rango.
+func TestSetPasswordPolicyRejectsInvalidPolicy(test *testing.T) {
+	assert.ErrorIs(test, SetPasswordPolicy(PasswordPolicy{Algorithm: "scrypt"}), ErrInvalidPasswordPolicy)
+	assert.ErrorIs(test, SetPasswordPolicy(PasswordPolicy{Algorithm: PasswordAlgorithmBcrypt, BcryptCost: 40}), ErrInvalidPasswordPolicy)
+	assert.ErrorIs(test, SetPasswordPolicy(PasswordPolicy{Algorithm: PasswordAlgorithmArgon2id, Argon2Memory: 8, Argon2Parallelism: 4}), ErrInvalidPasswordPolicy)
+}
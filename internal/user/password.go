@@ -0,0 +1,250 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// En: Password hashing algorithms accepted in PasswordPolicy.Algorithm.
+// Es: Algoritmos de hash de contraseñas aceptados en PasswordPolicy.Algorithm.
+const (
+	PasswordAlgorithmBcrypt   = "bcrypt"
+	PasswordAlgorithmArgon2id = "argon2id"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// En: ErrInvalidPasswordPolicy is returned by SetPasswordPolicy for an unknown algorithm or out-of-range parameters.
+// Es: ErrInvalidPasswordPolicy lo devuelve SetPasswordPolicy para un algoritmo desconocido o parámetros fuera de rango.
+var ErrInvalidPasswordPolicy = errors.New("invalid password policy")
+
+// En: PasswordPolicy selects the algorithm and cost used for new password hashes. Stored hashes made with
+// another algorithm or cost keep verifying and are upgraded on the next successful login.
+// Es: PasswordPolicy elige el algoritmo y el costo usados para los nuevos hashes de contraseña. Los hashes
+// guardados con otro algoritmo o costo siguen verificando y se actualizan en el siguiente login correcto.
+type PasswordPolicy struct {
+	// Algorithm is PasswordAlgorithmBcrypt or PasswordAlgorithmArgon2id.
+	Algorithm string
+	// BcryptCost is the bcrypt work factor (4 to 31).
+	BcryptCost int
+	// Argon2Memory is the argon2id memory in KiB.
+	Argon2Memory uint32
+	// Argon2Iterations is the argon2id number of passes.
+	Argon2Iterations uint32
+	// Argon2Parallelism is the argon2id number of lanes.
+	Argon2Parallelism uint8
+}
+
+// En: DefaultPasswordPolicy keeps bcrypt with cost 12; the argon2id parameters follow the OWASP baseline.
+// Es: DefaultPasswordPolicy mantiene bcrypt con costo 12; los parámetros de argon2id siguen la base de OWASP.
+var DefaultPasswordPolicy = PasswordPolicy{
+	Algorithm:         PasswordAlgorithmBcrypt,
+	BcryptCost:        12,
+	Argon2Memory:      64 * 1024,
+	Argon2Iterations:  3,
+	Argon2Parallelism: 2,
+}
+
+// En: PasswordHasher produces and checks hashes of one algorithm. Identifies reports whether a stored hash
+// belongs to that algorithm, and NeedsRehash whether it was made with parameters other than the hasher's.
+// Es: PasswordHasher produce y comprueba hashes de un algoritmo. Identifies indica si un hash guardado pertenece
+// a ese algoritmo, y NeedsRehash si se generó con parámetros distintos a los del hasher.
+type PasswordHasher interface {
+	Identifies(encoded string) bool
+	Hash(plain string) (string, error)
+	Verify(encoded, plain string) bool
+	NeedsRehash(encoded string) bool
+}
+
+var (
+	passwordHasherMu sync.RWMutex
+	// currentHasher hashes new passwords; verifyHashers recognise every supported stored format.
+	currentHasher PasswordHasher = bcryptHasher{cost: DefaultPasswordPolicy.BcryptCost}
+	verifyHashers                = []PasswordHasher{bcryptHasher{}, argon2idHasher{}}
+)
+
+// En: SetPasswordPolicy switches the hasher used by SetPassword; call it once at startup.
+// Es: SetPasswordPolicy cambia el hasher que usa SetPassword; se llama una vez al arrancar.
+func SetPasswordPolicy(policy PasswordPolicy) error {
+	hasher, err := NewPasswordHasher(policy)
+	if err != nil {
+		return err
+	}
+	passwordHasherMu.Lock()
+	defer passwordHasherMu.Unlock()
+	currentHasher = hasher
+	return nil
+}
+
+// En: NewPasswordHasher builds the hasher of a policy; zero parameters fall back to DefaultPasswordPolicy.
+// Es: NewPasswordHasher crea el hasher de una política; los parámetros en cero usan DefaultPasswordPolicy.
+func NewPasswordHasher(policy PasswordPolicy) (PasswordHasher, error) {
+	switch strings.ToLower(strings.TrimSpace(policy.Algorithm)) {
+	case "", PasswordAlgorithmBcrypt:
+		cost := policy.BcryptCost
+		if cost == 0 {
+			cost = DefaultPasswordPolicy.BcryptCost
+		}
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("%w: bcrypt cost must be between %d and %d", ErrInvalidPasswordPolicy, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return bcryptHasher{cost: cost}, nil
+	case PasswordAlgorithmArgon2id:
+		hasher := argon2idHasher{
+			memory:      policy.Argon2Memory,
+			iterations:  policy.Argon2Iterations,
+			parallelism: policy.Argon2Parallelism,
+		}
+		if hasher.memory == 0 {
+			hasher.memory = DefaultPasswordPolicy.Argon2Memory
+		}
+		if hasher.iterations == 0 {
+			hasher.iterations = DefaultPasswordPolicy.Argon2Iterations
+		}
+		if hasher.parallelism == 0 {
+			hasher.parallelism = DefaultPasswordPolicy.Argon2Parallelism
+		}
+		if hasher.memory < 8*uint32(hasher.parallelism) {
+			return nil, fmt.Errorf("%w: argon2id memory must be at least 8 KiB per lane", ErrInvalidPasswordPolicy)
+		}
+		return hasher, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown algorithm %q", ErrInvalidPasswordPolicy, policy.Algorithm)
+	}
+}
+
+// passwordHasher returns the hasher of the current policy.
+func passwordHasher() PasswordHasher {
+	passwordHasherMu.RLock()
+	defer passwordHasherMu.RUnlock()
+	return currentHasher
+}
+
+// identifyPasswordHasher returns the hasher that recognises the stored hash, or nil for an unknown format.
+func identifyPasswordHasher(encoded string) PasswordHasher {
+	for _, hasher := range verifyHashers {
+		if hasher.Identifies(encoded) {
+			return hasher
+		}
+	}
+	return nil
+}
+
+// bcryptHasher hashes with bcrypt at a fixed cost.
+type bcryptHasher struct {
+	cost int
+}
+
+func (h bcryptHasher) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h bcryptHasher) Hash(plain string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h bcryptHasher) Verify(encoded, plain string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(plain)) == nil
+}
+
+func (h bcryptHasher) NeedsRehash(encoded string) bool {
+	if !h.Identifies(encoded) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.cost
+}
+
+// argon2idHasher hashes with argon2id and encodes the result in the PHC string format
+// ($argon2id$v=19$m=<KiB>,t=<passes>,p=<lanes>$<salt>$<key>), so verification reads the parameters from the hash.
+type argon2idHasher struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+// argon2idParams are the parameters and material decoded from a stored argon2id hash.
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h argon2idHasher) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h argon2idHasher) Hash(plain string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(plain), salt, h.iterations, h.memory, h.parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.memory, h.iterations, h.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h argon2idHasher) Verify(encoded, plain string) bool {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false
+	}
+	key := argon2.IDKey([]byte(plain), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1
+}
+
+func (h argon2idHasher) NeedsRehash(encoded string) bool {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.memory != h.memory || params.iterations != h.iterations || params.parallelism != h.parallelism ||
+		len(params.key) != argon2KeyLength
+}
+
+// decodeArgon2id parses a PHC-formatted argon2id hash.
+func decodeArgon2id(encoded string) (*argon2idParams, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != PasswordAlgorithmArgon2id {
+		return nil, errors.New("malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errors.New("unsupported argon2id version")
+	}
+	var params argon2idParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return nil, fmt.Errorf("parse argon2id parameters: %w", err)
+	}
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("decode argon2id salt: %w", err)
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("decode argon2id key: %w", err)
+	}
+	if len(params.key) == 0 || params.iterations == 0 || params.parallelism == 0 {
+		return nil, errors.New("malformed argon2id hash")
+	}
+	return &params, nil
+}
@@ -3,6 +3,7 @@ package user
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
@@ -91,6 +92,24 @@ func (repository *Repository) Update(user *User) error {
 	return nil
 }
 
+// En: ClearExpiredVerificationTokens removes up to limit email verification tokens that expired before now,
+// including those of soft-deleted users. It returns how many users were cleared.
+// Es: ClearExpiredVerificationTokens elimina hasta limit tokens de verificación de email que expiraron antes de now,
+// incluidos los de usuarios con borrado lógico. Devuelve cuántos usuarios se limpiaron.
+func (repository *Repository) ClearExpiredVerificationTokens(now time.Time, limit int) (int64, error) {
+	batch := repository.db.Unscoped().Model(&User{}).
+		Select("id").
+		Where("email_verification_token IS NOT NULL AND email_verification_expires_at < ?", now).
+		Limit(limit)
+	result := repository.db.Unscoped().Model(&User{}).
+		Where("id IN (?)", batch).
+		UpdateColumns(map[string]any{"email_verification_token": nil, "email_verification_expires_at": nil})
+	if result.Error != nil {
+		return 0, fmt.Errorf("clear expired verification tokens: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
 // En: Delete soft-deletes a user by ID.
 // Es: Delete hace borrado lógico de un usuario por ID.
 func (repository *Repository) Delete(id string) error {
@@ -1,15 +1,31 @@
 package user
 
 import (
+	"encoding/json"
+
 	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/skip"
 )
 
-// En: Routes mounts user routes on the given router.
-// Es: Monta las rutas de usuario en el router dado.
-func Routes(router fiber.Router, handler *Handler, authMiddleware fiber.Handler) {
+// En: Routes mounts user routes on the given router. recentAuthMiddleware guards the operations a stolen access token
+// must not be enough for: deleting the user and changing the password.
+// Es: Monta las rutas de usuario en el router dado. recentAuthMiddleware protege las operaciones para las que no debe
+// bastar un token de acceso robado: borrar el usuario y cambiar la contraseña.
+func Routes(router fiber.Router, handler *Handler, authMiddleware, recentAuthMiddleware fiber.Handler) {
 	//router.Post("/users", authMiddleware, handler.CreateUser)
 	router.Get("/users/me", authMiddleware, handler.GetMe)
 	router.Get("/users/me/accounts", authMiddleware, handler.GetMyAccounts)
-	router.Put("/users/me", authMiddleware, handler.UpdateMe)
-	router.Delete("/users/me", authMiddleware, handler.DeleteMe)
+	router.Put("/users/me", authMiddleware, skip.New(recentAuthMiddleware, keepsPassword), handler.UpdateMe)
+	router.Delete("/users/me", authMiddleware, recentAuthMiddleware, handler.DeleteMe)
+}
+
+// keepsPassword reports whether an update body leaves the password alone; unreadable bodies count as a password change.
+func keepsPassword(c fiber.Ctx) bool {
+	var body struct {
+		Password *string `json:"password"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return false
+	}
+	return body.Password == nil
 }
@@ -0,0 +1,55 @@
+package user
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudflax/api.cloudflax/internal/shared/database"
+)
+
+// TestRoutesRequireRecentAuth checks which user routes go through the recent authentication middleware.
+// En: Deleting the user and changing the password need recent authentication; a name change does not.
+// Es: Borrar el usuario y cambiar la contraseña necesitan autenticación reciente; un cambio de nombre no.
+func TestRoutesRequireRecentAuth(test *testing.T) {
+	handler := SetupUserHandlerTest(test)
+	testUser := User{Name: "Routes User", Email: "routes@example.com"}
+	require.NoError(test, testUser.SetPassword("secret123"))
+	require.NoError(test, database.DB.Create(&testUser).Error)
+
+	app := fiber.New()
+	authenticated := func(c fiber.Ctx) error {
+		c.Locals("userID", testUser.ID)
+		return c.Next()
+	}
+	notRecent := func(c fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+	Routes(app, handler, authenticated, notRecent)
+
+	cases := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"name change", "PUT", `{"name":"Renamed User"}`, fiber.StatusOK},
+		{"password change", "PUT", `{"password":"newsecret123"}`, fiber.StatusForbidden},
+		{"unreadable body", "PUT", `{"password":`, fiber.StatusForbidden},
+		{"delete", "DELETE", "", fiber.StatusForbidden},
+	}
+	for _, tc := range cases {
+		test.Run(tc.name, func(test *testing.T) {
+			req := httptest.NewRequest(tc.method, "/users/me", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req, fiber.TestConfig{Timeout: 0})
+			require.NoError(test, err)
+			defer resp.Body.Close()
+			assert.Equal(test, tc.status, resp.StatusCode)
+		})
+	}
+}
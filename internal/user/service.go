@@ -1,16 +1,18 @@
 package user
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
+	"github.com/cloudflax/api.cloudflax/internal/shared/validator"
 	"github.com/google/uuid"
 )
 
-// En: TokenRevoker is the subset of the auth repository the user service depends on
-// to revoke refresh tokens when a user is deleted.
-// Es: TokenRevoker es el subconjunto del repositorio de auth del que depende el servicio de usuario
-// para revocar los refresh tokens cuando se elimina un usuario.
+// En: TokenRevoker is the subset of the auth service the user service depends on
+// to end every session (refresh and access tokens) when a user is deleted or changes password.
+// Es: TokenRevoker es el subconjunto del servicio de auth del que depende el servicio de usuario
+// para cerrar todas las sesiones (refresh y access tokens) cuando se elimina un usuario o cambia la contraseña.
 type TokenRevoker interface {
 	RevokeAllByUserID(userID string) error
 }
@@ -18,8 +20,9 @@ type TokenRevoker interface {
 // En: Service handles user business logic.
 // Es: Service maneja la lógica de negocio de usuarios.
 type Service struct {
-	repository   *Repository
-	tokenRevoker TokenRevoker
+	repository     *Repository
+	tokenRevoker   TokenRevoker
+	passwordPolicy *validator.PasswordPolicy
 }
 
 // En: NewService creates a new user service.
@@ -28,13 +31,20 @@ func NewService(repository *Repository) *Service {
 	return &Service{repository: repository}
 }
 
-// En: WithTokenRevoker sets the token revoker used to invalidate refresh tokens on user deletion.
-// Es: WithTokenRevoker establece el revocador de tokens para invalidar refresh tokens al eliminar usuario.
+// En: WithTokenRevoker sets the token revoker used to invalidate tokens on user deletion and password change.
+// Es: WithTokenRevoker establece el revocador de tokens para invalidar tokens al eliminar usuario o cambiar la contraseña.
 func (service *Service) WithTokenRevoker(tokenRevoker TokenRevoker) *Service {
 	service.tokenRevoker = tokenRevoker
 	return service
 }
 
+// En: WithPasswordPolicy sets the policy new passwords must satisfy on create and update; violations return validator.ValidationErrors.
+// Es: WithPasswordPolicy establece la política que deben cumplir las contraseñas nuevas al crear y actualizar; las infracciones devuelven validator.ValidationErrors.
+func (service *Service) WithPasswordPolicy(policy *validator.PasswordPolicy) *Service {
+	service.passwordPolicy = policy
+	return service
+}
+
 // En: GetUser returns a user by ID.
 // Returns ErrNotFound for invalid UUID format or when the user does not exist.
 // Es: GetUser devuelve un usuario por ID.
@@ -53,6 +63,9 @@ func (service *Service) GetUser(id string) (*User, error) {
 func (service *Service) CreateUser(name, email, password string) (*User, error) {
 	normalizedEmail := strings.ToLower(strings.TrimSpace(email))
 	user := &User{Name: name, Email: normalizedEmail}
+	if err := service.checkPassword(user, password); err != nil {
+		return nil, err
+	}
 	if err := user.SetPassword(password); err != nil {
 		return nil, err
 	}
@@ -63,7 +76,9 @@ func (service *Service) CreateUser(name, email, password string) (*User, error)
 }
 
 // En: UpdateUser updates an existing user by ID. Only name and password can be updated.
+// A password change revokes every session of the user.
 // Es: UpdateUser actualiza un usuario existente por ID. Solo se pueden actualizar nombre y contraseña.
+// Un cambio de contraseña revoca todas las sesiones del usuario.
 func (service *Service) UpdateUser(id string, name *string, password *string) (*User, error) {
 	if _, err := uuid.Parse(id); err != nil {
 		return nil, ErrNotFound
@@ -76,6 +91,9 @@ func (service *Service) UpdateUser(id string, name *string, password *string) (*
 		user.Name = *name
 	}
 	if password != nil {
+		if err := service.checkPassword(user, *password); err != nil {
+			return nil, err
+		}
 		if err := user.SetPassword(*password); err != nil {
 			return nil, err
 		}
@@ -83,11 +101,16 @@ func (service *Service) UpdateUser(id string, name *string, password *string) (*
 	if err := service.repository.Update(user); err != nil {
 		return nil, err
 	}
+	if password != nil && service.tokenRevoker != nil {
+		if err := service.tokenRevoker.RevokeAllByUserID(id); err != nil {
+			return nil, fmt.Errorf("revoke tokens after password change: %w", err)
+		}
+	}
 	return user, nil
 }
 
-// En: DeleteUser soft-deletes a user by ID and revokes all their refresh tokens.
-// Es: DeleteUser hace borrado lógico del usuario por ID y revoca todos sus refresh tokens.
+// En: DeleteUser soft-deletes a user by ID and revokes all their sessions and tokens.
+// Es: DeleteUser hace borrado lógico del usuario por ID y revoca todas sus sesiones y tokens.
 func (service *Service) DeleteUser(id string) error {
 	if _, err := uuid.Parse(id); err != nil {
 		return ErrNotFound
@@ -102,3 +125,11 @@ func (service *Service) DeleteUser(id string) error {
 	}
 	return nil
 }
+
+// checkPassword applies the password policy, if any, to a new password of user.
+func (service *Service) checkPassword(user *User, password string) error {
+	if service.passwordPolicy == nil {
+		return nil
+	}
+	return service.passwordPolicy.Check(context.Background(), "password", password, validator.PasswordSubject{Email: user.Email, Name: user.Name})
+}